@@ -0,0 +1,150 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+const (
+	// ContractAddressAliasType is the name of a contract read from the blockchain
+	ContractAddressAliasType = "Contract"
+	// OperatorAddressAliasType is the alias supplied by the operator of Blockbook in the aliases file
+	OperatorAddressAliasType = "Operator"
+)
+
+// AddressAlias contains a human readable name of an address
+type AddressAlias struct {
+	Type  string `json:"type"`
+	Alias string `json:"alias"`
+}
+
+// AddressAliases maps addresses to their aliases
+type AddressAliases map[string]AddressAlias
+
+// operatorAliases are loaded by LoadAddressAliases, the keys are addresses as written in the aliases file
+var operatorAliases map[string]string
+
+// LoadAddressAliases loads the aliases of addresses from a json file in the format {"<address>":"<alias>",...}
+// the aliases are used by the workers created after the call
+func LoadAddressAliases(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return errors.Annotatef(err, "Error reading aliases file %v", file)
+	}
+	var aliases map[string]string
+	if err = json.Unmarshal(data, &aliases); err != nil {
+		return errors.Annotatef(err, "Error parsing aliases file %v", file)
+	}
+	operatorAliases = aliases
+	glog.Info("Loaded ", len(aliases), " address aliases from ", file)
+	return nil
+}
+
+// getOperatorAliases returns the operator aliases keyed by address descriptor so that the lookup does not depend
+// on the format of the address (for example checksummed and lowercase Ethereum addresses)
+func getOperatorAliases(parser bchain.BlockChainParser) map[string]string {
+	r := make(map[string]string, len(operatorAliases))
+	for address, alias := range operatorAliases {
+		addrDesc, err := parser.GetAddrDescFromAddress(address)
+		if err != nil {
+			glog.Warning("Invalid address ", address, " in aliases file: ", err)
+			continue
+		}
+		r[string(addrDesc)] = alias
+	}
+	return r
+}
+
+// addContractName records the name of the token contract, which is already known from the contract info,
+// the name of a contract without the contract info is its address
+func addContractName(contract, name string, contracts map[string]string) {
+	if contract != "" && name != "" && name != contract {
+		contracts[contract] = name
+	}
+}
+
+func addTxAddressesToSet(tx *Tx, addresses map[string]struct{}, contracts map[string]string) {
+	add := func(a string) {
+		if a != "" {
+			addresses[a] = struct{}{}
+		}
+	}
+	for i := range tx.Vin {
+		for _, a := range tx.Vin[i].Addresses {
+			add(a)
+		}
+	}
+	for i := range tx.Vout {
+		for _, a := range tx.Vout[i].Addresses {
+			add(a)
+		}
+	}
+	for i := range tx.TokenTransfers {
+		t := &tx.TokenTransfers[i]
+		add(t.From)
+		add(t.To)
+		add(t.Token)
+		addContractName(t.Token, t.Name, contracts)
+	}
+	if tx.EthereumSpecific != nil {
+		for i := range tx.EthereumSpecific.InternalTransfers {
+			t := &tx.EthereumSpecific.InternalTransfers[i]
+			add(t.From)
+			add(t.To)
+		}
+	}
+}
+
+// getAddressAliasCandidates returns the address, its token contracts and the addresses in the returned transactions
+// and the names of the token contracts
+func getAddressAliasCandidates(a *Address) (map[string]struct{}, map[string]string) {
+	addresses := map[string]struct{}{a.AddrStr: {}}
+	contracts := make(map[string]string)
+	if a.Erc20Contract != nil {
+		addContractName(a.AddrStr, a.Erc20Contract.Name, contracts)
+	}
+	for i := range a.Tokens {
+		if a.Tokens[i].Contract != "" {
+			addresses[a.Tokens[i].Contract] = struct{}{}
+			addContractName(a.Tokens[i].Contract, a.Tokens[i].Name, contracts)
+		}
+	}
+	for _, tx := range a.Transactions {
+		addTxAddressesToSet(tx, addresses, contracts)
+	}
+	return addresses, contracts
+}
+
+// getAddressAliases returns the aliases of the addresses, operator aliases take precedence over the contract names,
+// the contract names are only those of the token contracts, there is no backend request for the other addresses
+func (w *Worker) getAddressAliases(addresses map[string]struct{}, contracts map[string]string) AddressAliases {
+	aliases := make(AddressAliases)
+	for a := range addresses {
+		addrDesc, err := w.chainParser.GetAddrDescFromAddress(a)
+		if err == nil && len(addrDesc) > 0 {
+			if alias, found := w.operatorAliases[string(addrDesc)]; found {
+				aliases[a] = AddressAlias{Type: OperatorAddressAliasType, Alias: alias}
+				continue
+			}
+		}
+		if name, found := contracts[a]; found {
+			aliases[a] = AddressAlias{Type: ContractAddressAliasType, Alias: name}
+		}
+	}
+	if len(aliases) == 0 {
+		return nil
+	}
+	return aliases
+}
+
+// GetTxAddressAliases returns the aliases of the addresses taking part in the transaction
+func (w *Worker) GetTxAddressAliases(tx *Tx) AddressAliases {
+	addresses := make(map[string]struct{})
+	contracts := make(map[string]string)
+	addTxAddressesToSet(tx, addresses, contracts)
+	return w.getAddressAliases(addresses, contracts)
+}
@@ -0,0 +1,90 @@
+// +build unittest
+
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadAddressAliases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aliases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { operatorAliases = nil }()
+
+	file := filepath.Join(dir, "aliases.json")
+	if err = ioutil.WriteFile(file, []byte(`{"mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz":"Exchange hot wallet","0x4Bda106325C335dF99eab7fE363cAC8A0ba2a24D":"Token"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = LoadAddressAliases(file); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz":         "Exchange hot wallet",
+		"0x4Bda106325C335dF99eab7fE363cAC8A0ba2a24D": "Token",
+	}
+	if !reflect.DeepEqual(operatorAliases, want) {
+		t.Errorf("LoadAddressAliases() = %v, want %v", operatorAliases, want)
+	}
+
+	if err = ioutil.WriteFile(file, []byte(`["mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = LoadAddressAliases(file); err == nil {
+		t.Error("LoadAddressAliases() expected error for invalid file")
+	}
+	if err = LoadAddressAliases(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("LoadAddressAliases() expected error for missing file")
+	}
+}
+
+func Test_addTxAddressesToSet(t *testing.T) {
+	tx := &Tx{
+		Vin: []Vin{
+			{Addresses: []string{"addr1"}},
+			{Addresses: []string{"addr2", "addr3"}},
+		},
+		Vout: []Vout{
+			{Addresses: []string{"addr1"}},
+			{},
+		},
+		TokenTransfers: []TokenTransfer{
+			{From: "addr4", To: "addr5", Token: "contract1", Name: "Token 1"},
+			{From: "addr5", To: "addr4", Token: "contract2", Name: "contract2"},
+		},
+		EthereumSpecific: &EthereumSpecific{
+			InternalTransfers: []EthereumInternalTransfer{
+				{From: "contract1", To: "addr6"},
+			},
+		},
+	}
+	addresses := make(map[string]struct{})
+	contracts := make(map[string]string)
+	addTxAddressesToSet(tx, addresses, contracts)
+	want := map[string]struct{}{
+		"addr1":     {},
+		"addr2":     {},
+		"addr3":     {},
+		"addr4":     {},
+		"addr5":     {},
+		"addr6":     {},
+		"contract1": {},
+		"contract2": {},
+	}
+	if !reflect.DeepEqual(addresses, want) {
+		t.Errorf("addTxAddressesToSet() = %v, want %v", addresses, want)
+	}
+	// contract2 has no contract info, its name is its address
+	wantContracts := map[string]string{
+		"contract1": "Token 1",
+	}
+	if !reflect.DeepEqual(contracts, wantContracts) {
+		t.Errorf("addTxAddressesToSet() contracts = %v, want %v", contracts, wantContracts)
+	}
+}
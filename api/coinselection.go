@@ -0,0 +1,276 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"math"
+	"math/big"
+	"sort"
+)
+
+const (
+	// txOverheadVSize is the vsize of version, locktime and input and output counts, rounded up to cover the segwit marker
+	txOverheadVSize = 11
+	// dustLimit is the smallest change that is worth creating an output for
+	dustLimit = 546
+	// maxBnBTries limits the number of steps of the branch and bound search
+	maxBnBTries = 100000
+)
+
+// CoinSelectionBnB is the algorithm which found a selection without change
+const CoinSelectionBnB = "branchAndBound"
+
+// CoinSelectionLargestFirst is the fallback algorithm adding the largest utxos until the target is reached
+const CoinSelectionLargestFirst = "largestFirst"
+
+// estimated vsizes of the inputs spending outputs of the script types,
+// P2SH inputs are expected to be P2SH-P2WPKH, P2WSH inputs 2-of-3 multisig, unknown scripts are estimated as P2PKH
+var inputVSizes = map[bchain.ScriptType]int{
+	bchain.ScriptTypeUnknown: 148,
+	bchain.ScriptTypeP2PKH:   148,
+	bchain.ScriptTypeP2SH:    91,
+	bchain.ScriptTypeP2WPKH:  68,
+	bchain.ScriptTypeP2WSH:   105,
+	bchain.ScriptTypeP2TR:    58,
+}
+
+// vsizes of the outputs paying to the script types
+var outputVSizes = map[bchain.ScriptType]int{
+	bchain.ScriptTypeUnknown: 34,
+	bchain.ScriptTypeP2PKH:   34,
+	bchain.ScriptTypeP2SH:    32,
+	bchain.ScriptTypeP2WPKH:  31,
+	bchain.ScriptTypeP2WSH:   43,
+	bchain.ScriptTypeP2TR:    43,
+}
+
+// UtxoFilter restricts the utxos returned by the utxo api
+type UtxoFilter struct {
+	MinValue *big.Int
+	MaxCount int
+}
+
+// UtxoSelection contains the utxos selected to fund a transaction paying the target value
+type UtxoSelection struct {
+	Algorithm string  `json:"algorithm"`
+	Utxos     Utxos   `json:"utxos"`
+	ValueSat  *Amount `json:"value"`
+	FeeSat    *Amount `json:"fee"`
+	ChangeSat *Amount `json:"change"`
+	VSize     int     `json:"vsize"`
+}
+
+// FilterUtxos returns the utxos with value at least filter.MinValue,
+// if filter.MaxCount is set, only the MaxCount largest utxos sorted by value are returned
+func FilterUtxos(utxos Utxos, filter *UtxoFilter) Utxos {
+	if filter == nil {
+		return utxos
+	}
+	r := utxos
+	if filter.MinValue != nil {
+		r = make(Utxos, 0, len(utxos))
+		for i := range utxos {
+			if (*big.Int)(utxos[i].AmountSat).Cmp(filter.MinValue) >= 0 {
+				r = append(r, utxos[i])
+			}
+		}
+	}
+	if filter.MaxCount > 0 && len(r) > filter.MaxCount {
+		s := make(Utxos, len(r))
+		copy(s, r)
+		sort.SliceStable(s, func(i, j int) bool {
+			return (*big.Int)(s[i].AmountSat).Cmp((*big.Int)(s[j].AmountSat)) > 0
+		})
+		r = s[:filter.MaxCount]
+	}
+	return r
+}
+
+type coinSelectionCandidate struct {
+	utxo       *Utxo
+	value      int64
+	inputVSize int
+	// effectiveValue is the value of the utxo minus the fee for spending it
+	effectiveValue int64
+}
+
+type coinSelectionParams struct {
+	target  int64
+	feeRate float64
+	// baseVSize is the vsize of the transaction without inputs and without change
+	baseVSize        int
+	changeOutputSize int
+	changeInputSize  int
+}
+
+func (p *coinSelectionParams) fee(vsize int) int64 {
+	return int64(math.Ceil(float64(vsize) * p.feeRate))
+}
+
+// SelectUtxos selects the utxos funding a transaction paying target satoshis at the feeRate in satoshis per vbyte
+// using the branch and bound search for a selection without change with the largest first selection as the fallback
+func (w *Worker) SelectUtxos(utxos Utxos, target int64, feeRate float64) (*UtxoSelection, error) {
+	if target <= 0 {
+		return nil, NewAPIError("Target must be a positive number of satoshis", true)
+	}
+	if feeRate <= 0 {
+		return nil, NewAPIError("Fee rate must be a positive number of satoshis per vbyte", true)
+	}
+	candidates := make([]coinSelectionCandidate, 0, len(utxos))
+	// the outputs of the transaction are expected to be of the script type of the largest utxo
+	outputScriptType := bchain.ScriptTypeUnknown
+	var largest int64
+	for i := range utxos {
+		u := &utxos[i]
+		value := (*big.Int)(u.AmountSat).Int64()
+		st := w.chainParser.GetScriptType(u.AddrDesc)
+		if value > largest {
+			largest = value
+			outputScriptType = st
+		}
+		candidates = append(candidates, coinSelectionCandidate{
+			utxo:       u,
+			value:      value,
+			inputVSize: inputVSizes[st],
+		})
+	}
+	p := coinSelectionParams{
+		target:           target,
+		feeRate:          feeRate,
+		baseVSize:        txOverheadVSize + outputVSizes[outputScriptType],
+		changeOutputSize: outputVSizes[outputScriptType],
+		changeInputSize:  inputVSizes[outputScriptType],
+	}
+	r := selectCoins(candidates, &p)
+	if r == nil {
+		return nil, NewAPIError("Insufficient funds", true)
+	}
+	return r, nil
+}
+
+func selectCoins(candidates []coinSelectionCandidate, p *coinSelectionParams) *UtxoSelection {
+	// utxos which cost more to spend than their value are never selected
+	pool := make([]coinSelectionCandidate, 0, len(candidates))
+	for _, c := range candidates {
+		c.effectiveValue = c.value - p.fee(c.inputVSize)
+		if c.effectiveValue > 0 {
+			pool = append(pool, c)
+		}
+	}
+	sort.SliceStable(pool, func(i, j int) bool {
+		return pool[i].effectiveValue > pool[j].effectiveValue
+	})
+	if selected := selectCoinsBnB(pool, p); selected != nil {
+		return newUtxoSelection(CoinSelectionBnB, selected, p, false)
+	}
+	return selectCoinsLargestFirst(pool, p)
+}
+
+// selectCoinsBnB searches for the set of utxos whose effective value covers the target and the fee
+// and does not exceed it by more than the cost of creating and later spending a change output
+func selectCoinsBnB(pool []coinSelectionCandidate, p *coinSelectionParams) []coinSelectionCandidate {
+	target := p.target + p.fee(p.baseVSize)
+	costOfChange := p.fee(p.changeOutputSize) + p.fee(p.changeInputSize)
+	var available int64
+	for i := range pool {
+		available += pool[i].effectiveValue
+	}
+	if available < target {
+		return nil
+	}
+	included := make([]bool, len(pool))
+	var best []bool
+	bestExcess := int64(math.MaxInt64)
+	var value int64
+	depth := 0
+	for tries := 0; tries < maxBnBTries; tries++ {
+		backtrack := false
+		if value+available < target || value > target+costOfChange {
+			backtrack = true
+		} else if value >= target {
+			if excess := value - target; excess < bestExcess {
+				bestExcess = excess
+				best = append(best[:0], included[:depth]...)
+				if excess == 0 {
+					break
+				}
+			}
+			backtrack = true
+		}
+		if depth == len(pool) {
+			backtrack = true
+		}
+		if backtrack {
+			// walk back to the last included utxo and try the branch without it
+			for depth > 0 && !included[depth-1] {
+				depth--
+				available += pool[depth].effectiveValue
+			}
+			if depth == 0 {
+				break
+			}
+			included[depth-1] = false
+			value -= pool[depth-1].effectiveValue
+			continue
+		}
+		// branch including the utxo at depth first
+		available -= pool[depth].effectiveValue
+		included[depth] = true
+		value += pool[depth].effectiveValue
+		depth++
+	}
+	if best == nil {
+		return nil
+	}
+	var selected []coinSelectionCandidate
+	for i, in := range best {
+		if in {
+			selected = append(selected, pool[i])
+		}
+	}
+	return selected
+}
+
+// selectCoinsLargestFirst adds the utxos from the largest until the target and the fee are covered
+func selectCoinsLargestFirst(pool []coinSelectionCandidate, p *coinSelectionParams) *UtxoSelection {
+	sort.SliceStable(pool, func(i, j int) bool {
+		return pool[i].value > pool[j].value
+	})
+	var value int64
+	vsize := p.baseVSize
+	for i := range pool {
+		value += pool[i].value
+		vsize += pool[i].inputVSize
+		if value < p.target+p.fee(vsize) {
+			continue
+		}
+		change := value - p.target - p.fee(vsize+p.changeOutputSize)
+		return newUtxoSelection(CoinSelectionLargestFirst, pool[:i+1], p, change >= dustLimit)
+	}
+	return nil
+}
+
+func newUtxoSelection(algorithm string, selected []coinSelectionCandidate, p *coinSelectionParams, withChange bool) *UtxoSelection {
+	r := UtxoSelection{
+		Algorithm: algorithm,
+		Utxos:     make(Utxos, len(selected)),
+		VSize:     p.baseVSize,
+	}
+	var value int64
+	for i := range selected {
+		r.Utxos[i] = *selected[i].utxo
+		value += selected[i].value
+		r.VSize += selected[i].inputVSize
+	}
+	// without the change output the whole excess over the target is paid as the fee
+	fee := value - p.target
+	var change int64
+	if withChange {
+		r.VSize += p.changeOutputSize
+		fee = p.fee(r.VSize)
+		change = value - p.target - fee
+	}
+	r.ValueSat = (*Amount)(big.NewInt(value))
+	r.FeeSat = (*Amount)(big.NewInt(fee))
+	r.ChangeSat = (*Amount)(big.NewInt(change))
+	return &r
+}
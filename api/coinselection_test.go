@@ -0,0 +1,158 @@
+// +build unittest
+
+package api
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func newTestUtxos(values ...int64) Utxos {
+	utxos := make(Utxos, len(values))
+	for i, v := range values {
+		utxos[i] = Utxo{
+			Txid:      string('a' + rune(i)),
+			AmountSat: (*Amount)(big.NewInt(v)),
+		}
+	}
+	return utxos
+}
+
+func utxoTxids(utxos Utxos) []string {
+	r := make([]string, len(utxos))
+	for i := range utxos {
+		r[i] = utxos[i].Txid
+	}
+	return r
+}
+
+func TestFilterUtxos(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter *UtxoFilter
+		want   []string
+	}{
+		{
+			name:   "no filter",
+			filter: nil,
+			want:   []string{"a", "b", "c", "d"},
+		},
+		{
+			name:   "minValue",
+			filter: &UtxoFilter{MinValue: big.NewInt(3000)},
+			want:   []string{"b", "c"},
+		},
+		{
+			name:   "maxCount",
+			filter: &UtxoFilter{MaxCount: 3},
+			want:   []string{"c", "b", "a"},
+		},
+		{
+			name:   "minValue and maxCount",
+			filter: &UtxoFilter{MinValue: big.NewInt(2000), MaxCount: 1},
+			want:   []string{"c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := utxoTxids(FilterUtxos(newTestUtxos(2000, 3000, 5000, 1000), tt.filter))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterUtxos() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_selectCoins(t *testing.T) {
+	// P2WPKH inputs and outputs
+	params := func(target int64) *coinSelectionParams {
+		return &coinSelectionParams{
+			target:           target,
+			feeRate:          1,
+			baseVSize:        txOverheadVSize + 31,
+			changeOutputSize: 31,
+			changeInputSize:  68,
+		}
+	}
+	tests := []struct {
+		name       string
+		values     []int64
+		target     int64
+		want       []string
+		wantAlgo   string
+		wantValue  int64
+		wantFee    int64
+		wantChange int64
+		wantVSize  int
+	}{
+		{
+			name:       "branch and bound exact match",
+			values:     []int64{5068, 20000, 5110},
+			target:     10000,
+			want:       []string{"c", "a"},
+			wantAlgo:   CoinSelectionBnB,
+			wantValue:  10178,
+			wantFee:    178,
+			wantChange: 0,
+			wantVSize:  178,
+		},
+		{
+			name:       "largest first with change",
+			values:     []int64{5068, 20000},
+			target:     1000,
+			want:       []string{"b"},
+			wantAlgo:   CoinSelectionLargestFirst,
+			wantValue:  20000,
+			wantFee:    141,
+			wantChange: 18859,
+			wantVSize:  141,
+		},
+		{
+			name:       "largest first with dust change",
+			values:     []int64{1600},
+			target:     1000,
+			want:       []string{"a"},
+			wantAlgo:   CoinSelectionLargestFirst,
+			wantValue:  1600,
+			wantFee:    600,
+			wantChange: 0,
+			wantVSize:  110,
+		},
+		{
+			name:   "insufficient funds",
+			values: []int64{5068, 20000, 50},
+			target: 100000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			utxos := newTestUtxos(tt.values...)
+			candidates := make([]coinSelectionCandidate, len(utxos))
+			for i := range utxos {
+				candidates[i] = coinSelectionCandidate{utxo: &utxos[i], value: tt.values[i], inputVSize: 68}
+			}
+			got := selectCoins(candidates, params(tt.target))
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("selectCoins() = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("selectCoins() = nil")
+			}
+			if !reflect.DeepEqual(utxoTxids(got.Utxos), tt.want) {
+				t.Errorf("selectCoins() utxos = %v, want %v", utxoTxids(got.Utxos), tt.want)
+			}
+			if got.Algorithm != tt.wantAlgo {
+				t.Errorf("selectCoins() algorithm = %v, want %v", got.Algorithm, tt.wantAlgo)
+			}
+			if (*big.Int)(got.ValueSat).Int64() != tt.wantValue || (*big.Int)(got.FeeSat).Int64() != tt.wantFee ||
+				(*big.Int)(got.ChangeSat).Int64() != tt.wantChange || got.VSize != tt.wantVSize {
+				t.Errorf("selectCoins() value %v, fee %v, change %v, vsize %v, want %v, %v, %v, %v",
+					got.ValueSat, got.FeeSat, got.ChangeSat, got.VSize, tt.wantValue, tt.wantFee, tt.wantChange, tt.wantVSize)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"math/big"
+	"sort"
 	"time"
 )
 
@@ -136,22 +137,36 @@ type TokenType string
 // ERC20TokenType is Ethereum ERC20 token
 const ERC20TokenType TokenType = "ERC20"
 
+// ERC721TokenType is Ethereum ERC721 non-fungible token
+const ERC721TokenType TokenType = "ERC721"
+
+// ERC1155TokenType is Ethereum ERC1155 multi token
+const ERC1155TokenType TokenType = "ERC1155"
+
 // XPUBAddressTokenType is address derived from xpub
 const XPUBAddressTokenType TokenType = "XPUBAddress"
 
 // Token contains info about tokens held by an address
 type Token struct {
-	Type             TokenType `json:"type"`
-	Name             string    `json:"name"`
-	Path             string    `json:"path,omitempty"`
-	Contract         string    `json:"contract,omitempty"`
-	Transfers        int       `json:"transfers"`
-	Symbol           string    `json:"symbol,omitempty"`
-	Decimals         int       `json:"decimals,omitempty"`
-	BalanceSat       *Amount   `json:"balance,omitempty"`
-	TotalReceivedSat *Amount   `json:"totalReceived,omitempty"`
-	TotalSentSat     *Amount   `json:"totalSent,omitempty"`
-	ContractIndex    string    `json:"-"`
+	Type             TokenType         `json:"type"`
+	Name             string            `json:"name"`
+	Path             string            `json:"path,omitempty"`
+	Contract         string            `json:"contract,omitempty"`
+	Transfers        int               `json:"transfers"`
+	Symbol           string            `json:"symbol,omitempty"`
+	Decimals         int               `json:"decimals,omitempty"`
+	BalanceSat       *Amount           `json:"balance,omitempty"`
+	TotalReceivedSat *Amount           `json:"totalReceived,omitempty"`
+	TotalSentSat     *Amount           `json:"totalSent,omitempty"`
+	Ids              []Amount          `json:"ids,omitempty"`              // ids of ERC721 tokens held by the address
+	MultiTokenValues []MultiTokenValue `json:"multiTokenValues,omitempty"` // ids and amounts of ERC1155 tokens held by the address
+	ContractIndex    string            `json:"-"`
+}
+
+// MultiTokenValue contains the id of ERC1155 token and the amount of tokens with this id
+type MultiTokenValue struct {
+	ID    *Amount `json:"id"`
+	Value *Amount `json:"value"`
 }
 
 // TokenTransfer contains info about a token transfer done in a transaction
@@ -164,15 +179,25 @@ type TokenTransfer struct {
 	Symbol   string    `json:"symbol"`
 	Decimals int       `json:"decimals"`
 	Value    *Amount   `json:"value"`
+	ID       *Amount   `json:"id,omitempty"` // id of ERC721 or ERC1155 token
+}
+
+// EthereumInternalTransfer contains ETH transfer done by a contract call inside of the transaction
+type EthereumInternalTransfer struct {
+	Type  string  `json:"type"` // call, create or selfdestruct
+	From  string  `json:"from"`
+	To    string  `json:"to"`
+	Value *Amount `json:"value"`
 }
 
 // EthereumSpecific contains ethereum specific transaction data
 type EthereumSpecific struct {
-	Status   int      `json:"status"` // 1 OK, 0 Fail, -1 pending
-	Nonce    uint64   `json:"nonce"`
-	GasLimit *big.Int `json:"gasLimit"`
-	GasUsed  *big.Int `json:"gasUsed"`
-	GasPrice *Amount  `json:"gasPrice"`
+	Status            int                        `json:"status"` // 1 OK, 0 Fail, -1 pending
+	Nonce             uint64                     `json:"nonce"`
+	GasLimit          *big.Int                   `json:"gasLimit"`
+	GasUsed           *big.Int                   `json:"gasUsed"`
+	GasPrice          *Amount                    `json:"gasPrice"`
+	InternalTransfers []EthereumInternalTransfer `json:"internalTransfers,omitempty"`
 }
 
 // Tx holds information about a transaction
@@ -195,6 +220,8 @@ type Tx struct {
 	CoinSpecificJSON json.RawMessage   `json:"-"`
 	TokenTransfers   []TokenTransfer   `json:"tokenTransfers,omitempty"`
 	EthereumSpecific *EthereumSpecific `json:"ethereumSpecific,omitempty"`
+	ValueOutFiat     *FiatValue        `json:"valueFiat,omitempty"`
+	AddressAliases   AddressAliases    `json:"addressAliases,omitempty"`
 }
 
 // Paging contains information about paging for address, blocks and block
@@ -232,6 +259,11 @@ type AddressFilter struct {
 	TokensToReturn TokensToReturn
 	// OnlyConfirmed set to true will ignore mempool transactions; mempool is also ignored if FromHeight/ToHeight filter is specified
 	OnlyConfirmed bool
+	// FromTime and ToTime are translated to FromHeight and ToHeight using the median time past of the blocks
+	FromTime int64
+	ToTime   int64
+	// AtHeight reconstructs the balances and the transaction history as of the block at the height, supported only by Bitcoin type coins
+	AtHeight uint32
 }
 
 // Address holds information about address and its transactions
@@ -251,6 +283,8 @@ type Address struct {
 	UsedTokens            int                   `json:"usedTokens,omitempty"`
 	Tokens                []Token               `json:"tokens,omitempty"`
 	Erc20Contract         *bchain.Erc20Contract `json:"erc20Contract,omitempty"`
+	BalanceFiat           *FiatValue            `json:"balanceFiat,omitempty"`
+	AddressAliases        AddressAliases        `json:"addressAliases,omitempty"`
 	// helpers for explorer
 	Filter        string              `json:"-"`
 	XPubAddresses map[string]struct{} `json:"-"`
@@ -258,14 +292,15 @@ type Address struct {
 
 // Utxo is one unspent transaction output
 type Utxo struct {
-	Txid          string  `json:"txid"`
-	Vout          int32   `json:"vout"`
-	AmountSat     *Amount `json:"value"`
-	Height        int     `json:"height,omitempty"`
-	Confirmations int     `json:"confirmations"`
-	Address       string  `json:"address,omitempty"`
-	Path          string  `json:"path,omitempty"`
-	Locktime      uint32  `json:"lockTime,omitempty"`
+	Txid          string                   `json:"txid"`
+	Vout          int32                    `json:"vout"`
+	AmountSat     *Amount                  `json:"value"`
+	Height        int                      `json:"height,omitempty"`
+	Confirmations int                      `json:"confirmations"`
+	Address       string                   `json:"address,omitempty"`
+	Path          string                   `json:"path,omitempty"`
+	Locktime      uint32                   `json:"lockTime,omitempty"`
+	AddrDesc      bchain.AddressDescriptor `json:"-"`
 }
 
 // Utxos is array of Utxo
@@ -286,6 +321,76 @@ func (a Utxos) Less(i, j int) bool {
 	return hi >= hj
 }
 
+// BalanceHistory contains info about one point in time of balance history
+type BalanceHistory struct {
+	Time        uint32  `json:"time"`
+	Txs         uint32  `json:"txs"`
+	ReceivedSat *Amount `json:"received"`
+	SentSat     *Amount `json:"sent"`
+	BalanceSat  *Amount `json:"balance"`
+	Txid        string  `json:"txid,omitempty"`
+}
+
+// BalanceHistories is array of BalanceHistory
+type BalanceHistories []BalanceHistory
+
+func (a BalanceHistories) Len() int      { return len(a) }
+func (a BalanceHistories) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a BalanceHistories) Less(i, j int) bool {
+	ti := a[i].Time
+	tj := a[j].Time
+	if ti == tj {
+		return a[i].Txid < a[j].Txid
+	}
+	return ti < tj
+}
+
+// SortAndAggregate sums BalanceHistories to groups defined by parameter groupByTime
+// balanceSat is the balance after the last item of the history, the balance of each group is derived from it
+func (a BalanceHistories) SortAndAggregate(groupByTime uint32, balanceSat *big.Int) BalanceHistories {
+	bhs := make(BalanceHistories, 0)
+	if len(a) > 0 {
+		if groupByTime == 0 {
+			groupByTime = 1
+		}
+		// compute the balance before the first item of the history
+		var balance big.Int
+		balance.Set(balanceSat)
+		for i := range a {
+			balance.Sub(&balance, (*big.Int)(a[i].ReceivedSat))
+			balance.Add(&balance, (*big.Int)(a[i].SentSat))
+		}
+		sort.Sort(a)
+		var bha *BalanceHistory
+		txs := make(map[string]struct{})
+		for i := range a {
+			bh := &a[i]
+			time := bh.Time - bh.Time%groupByTime
+			if bha == nil || bha.Time != time {
+				bhs = append(bhs, BalanceHistory{
+					Time:        time,
+					SentSat:     &Amount{},
+					ReceivedSat: &Amount{},
+					BalanceSat:  &Amount{},
+				})
+				bha = &bhs[len(bhs)-1]
+				txs = make(map[string]struct{})
+			}
+			// the same tx can be in the history multiple times (for example for more addresses of one xpub), count it only once
+			if _, found := txs[bh.Txid]; !found {
+				bha.Txs++
+				txs[bh.Txid] = struct{}{}
+			}
+			(*big.Int)(bha.SentSat).Add((*big.Int)(bha.SentSat), (*big.Int)(bh.SentSat))
+			(*big.Int)(bha.ReceivedSat).Add((*big.Int)(bha.ReceivedSat), (*big.Int)(bh.ReceivedSat))
+			balance.Add(&balance, (*big.Int)(bh.ReceivedSat))
+			balance.Sub(&balance, (*big.Int)(bh.SentSat))
+			(*big.Int)(bha.BalanceSat).Set(&balance)
+		}
+	}
+	return bhs
+}
+
 // Blocks is list of blocks with paging information
 type Blocks struct {
 	Paging
@@ -317,6 +422,60 @@ type Block struct {
 	Transactions []*Tx `json:"txs,omitempty"`
 }
 
+// FiatValue is an amount converted to a fiat currency using the exchange rate valid at the time Timestamp
+type FiatValue struct {
+	Currency  string  `json:"currency"`
+	Rate      float64 `json:"rate"`
+	Value     float64 `json:"value"`
+	Timestamp int64   `json:"ts"`
+}
+
+// FiatTicker contains exchange rates of the coin to fiat currencies valid from Timestamp
+type FiatTicker struct {
+	Timestamp int64              `json:"ts,omitempty"`
+	Rates     map[string]float64 `json:"rates"`
+	Error     string             `json:"error,omitempty"`
+}
+
+// FiatTickers is a list of fiat tickers
+type FiatTickers struct {
+	Tickers []FiatTicker `json:"tickers"`
+}
+
+// BlockFilter contains BIP158 basic block filter of a block
+type BlockFilter struct {
+	Hash   string `json:"hash"`
+	Height uint32 `json:"height"`
+	Filter string `json:"filter"`
+}
+
+// BlockHeaders contains the raw headers of consecutive blocks starting at Height
+type BlockHeaders struct {
+	Height  uint32 `json:"height"`
+	Count   int    `json:"count"`
+	Headers string `json:"headers"`
+	Raw     []byte `json:"-"`
+}
+
+// TxMerkleProof contains the merkle branch proving the inclusion of the transaction in the block
+type TxMerkleProof struct {
+	Txid        string   `json:"txid"`
+	BlockHash   string   `json:"blockHash"`
+	BlockHeight uint32   `json:"blockHeight"`
+	Header      string   `json:"header,omitempty"`
+	MerkleRoot  string   `json:"merkleRoot"`
+	Pos         int      `json:"pos"`
+	Merkle      []string `json:"merkle"`
+}
+
+// BlockByTime contains the block found by the time, the time of the block may be newer than the requested time
+type BlockByTime struct {
+	Hash       string `json:"hash"`
+	Height     uint32 `json:"height"`
+	Time       int64  `json:"time"`
+	MedianTime int64  `json:"medianTime"`
+}
+
 // BlockbookInfo contains information about the running blockbook instance
 type BlockbookInfo struct {
 	Coin              string                       `json:"coin"`
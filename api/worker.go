@@ -6,6 +6,7 @@ import (
 	"blockbook/common"
 	"blockbook/db"
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -13,6 +14,7 @@ import (
 	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
@@ -28,10 +30,13 @@ type Worker struct {
 	chainType   bchain.ChainType
 	mempool     bchain.Mempool
 	is          *common.InternalState
+	metrics     *common.Metrics
+	// operatorAliases are the aliases from the aliases file keyed by address descriptor
+	operatorAliases map[string]string
 }
 
 // NewWorker creates new api worker
-func NewWorker(db *db.RocksDB, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, is *common.InternalState) (*Worker, error) {
+func NewWorker(db *db.RocksDB, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, metrics *common.Metrics, is *common.InternalState) (*Worker, error) {
 	w := &Worker{
 		db:          db,
 		txCache:     txCache,
@@ -40,7 +45,9 @@ func NewWorker(db *db.RocksDB, chain bchain.BlockChain, mempool bchain.Mempool,
 		chainType:   chain.GetChainParser().GetChainType(),
 		mempool:     mempool,
 		is:          is,
+		metrics:     metrics,
 	}
+	w.operatorAliases = getOperatorAliases(w.chainParser)
 	return w, nil
 }
 
@@ -54,8 +61,24 @@ func (w *Worker) getAddressesFromVout(vout *bchain.Vout) (bchain.AddressDescript
 }
 
 // setSpendingTxToVout is helper function, that finds transaction that spent given output and sets it to the output
-// there is no direct index for the operation, it must be found using addresses -> txaddresses -> tx
+// the spending input is read from the spentOutputs index, if it is not there (the output was spent in a block
+// indexed by an older version of blockbook), it is searched for in the history of the address
 func (w *Worker) setSpendingTxToVout(vout *Vout, txid string, height uint32) error {
+	si, err := w.db.GetSpendingInput(txid, uint32(vout.N))
+	if err != nil {
+		return err
+	}
+	if si != nil {
+		vout.SpentTxID = si.Txid
+		vout.SpentHeight = int(si.Height)
+		vout.SpentIndex = int(si.Vin)
+		return nil
+	}
+	return w.findSpendingTxOfVout(vout, txid, height)
+}
+
+// findSpendingTxOfVout finds the spending transaction using addresses -> txaddresses -> tx, which is slow for busy addresses
+func (w *Worker) findSpendingTxOfVout(vout *Vout, txid string, height uint32) error {
 	err := w.db.GetAddrDescTransactions(vout.AddrDesc, height, maxUint32, func(t string, height uint32, indexes []int32) error {
 		for _, index := range indexes {
 			// take only inputs
@@ -100,6 +123,9 @@ func (w *Worker) GetSpendingTxid(txid string, n int) (string, error) {
 	if n >= len(tx.Vout) || n < 0 {
 		return "", NewAPIError(fmt.Sprintf("Passed incorrect vout index %v for tx %v, len vout %v", n, tx.Txid, len(tx.Vout)), false)
 	}
+	if !tx.Vout[n].Spent {
+		return "", nil
+	}
 	err = w.setSpendingTxToVout(&tx.Vout[n], tx.Txid, uint32(tx.Blockheight))
 	if err != nil {
 		return "", err
@@ -250,7 +276,7 @@ func (w *Worker) GetTransactionFromBchainTx(bchainTx *bchain.Tx, height uint32,
 		if err != nil {
 			glog.Errorf("GetErc20FromTx error %v, %v", err, bchainTx)
 		}
-		tokens = make([]TokenTransfer, len(ets))
+		tokens = make([]TokenTransfer, 0, len(ets))
 		for i := range ets {
 			e := &ets[i]
 			cd, err := w.chainParser.GetAddrDescFromAddress(e.Contract)
@@ -265,15 +291,32 @@ func (w *Worker) GetTransactionFromBchainTx(bchainTx *bchain.Tx, height uint32,
 			if erc20c == nil {
 				erc20c = &bchain.Erc20Contract{Name: e.Contract}
 			}
-			tokens[i] = TokenTransfer{
-				Type:     ERC20TokenType,
-				Token:    e.Contract,
-				From:     e.From,
-				To:       e.To,
-				Decimals: erc20c.Decimals,
-				Value:    (*Amount)(&e.Tokens),
-				Name:     erc20c.Name,
-				Symbol:   erc20c.Symbol,
+			if e.Type == bchain.ERC20TokenType {
+				tokens = append(tokens, TokenTransfer{
+					Type:     ERC20TokenType,
+					Token:    e.Contract,
+					From:     e.From,
+					To:       e.To,
+					Decimals: erc20c.Decimals,
+					Value:    (*Amount)(&e.Tokens),
+					Name:     erc20c.Name,
+					Symbol:   erc20c.Symbol,
+				})
+				continue
+			}
+			// ERC721 and ERC1155 tokens are not divisible, each transferred id is returned as a separate transfer
+			for j := range e.IDValues {
+				iv := &e.IDValues[j]
+				tokens = append(tokens, TokenTransfer{
+					Type:   tokenTypeName(e.Type),
+					Token:  e.Contract,
+					From:   e.From,
+					To:     e.To,
+					Value:  (*Amount)(&iv.Value),
+					ID:     (*Amount)(&iv.ID),
+					Name:   erc20c.Name,
+					Symbol: erc20c.Symbol,
+				})
 			}
 		}
 		ethTxData := eth.GetEthereumTxData(bchainTx)
@@ -291,6 +334,22 @@ func (w *Worker) GetTransactionFromBchainTx(bchainTx *bchain.Tx, height uint32,
 			Nonce:    ethTxData.Nonce,
 			Status:   ethTxData.Status,
 		}
+		its, err := w.chainParser.EthereumTypeGetInternalTransfersFromTx(bchainTx)
+		if err != nil {
+			glog.Errorf("GetInternalTransfersFromTx error %v, %v", err, bchainTx)
+		}
+		if len(its) > 0 {
+			ethSpecific.InternalTransfers = make([]EthereumInternalTransfer, len(its))
+			for i := range its {
+				it := &its[i]
+				ethSpecific.InternalTransfers[i] = EthereumInternalTransfer{
+					Type:  internalTransferTypeName(it.Type),
+					From:  it.From,
+					To:    it.To,
+					Value: (*Amount)(&it.Value),
+				}
+			}
+		}
 	}
 	// for now do not return size, we would have to compute vsize of segwit transactions
 	// size:=len(bchainTx.Hex) / 2
@@ -327,6 +386,16 @@ func (w *Worker) GetTransactionFromBchainTx(bchainTx *bchain.Tx, height uint32,
 	return r, nil
 }
 
+func internalTransferTypeName(t bchain.EthereumInternalTransferType) string {
+	switch t {
+	case bchain.InternalTransferTypeCreate:
+		return "create"
+	case bchain.InternalTransferTypeSelfDestruct:
+		return "selfdestruct"
+	}
+	return "call"
+}
+
 func (w *Worker) getAddressTxids(addrDesc bchain.AddressDescriptor, mempool bool, filter *AddressFilter, maxResults int) ([]string, error) {
 	var err error
 	txids := make([]string, 0, 4)
@@ -492,6 +561,34 @@ func computePaging(count, page, itemsOnPage int) (Paging, int, int, int) {
 	}, from, to, page
 }
 
+func tokenTypeName(t bchain.TokenType) TokenType {
+	switch t {
+	case bchain.ERC721TokenType:
+		return ERC721TokenType
+	case bchain.ERC1155TokenType:
+		return ERC1155TokenType
+	}
+	return ERC20TokenType
+}
+
+// setTokenIDValues sets the ids of ERC721 tokens or the ids and values of ERC1155 tokens held by the address
+func setTokenIDValues(t *Token, tokenType bchain.TokenType, idValues []bchain.TokenIDValue) {
+	if tokenType == bchain.ERC721TokenType {
+		t.Ids = make([]Amount, len(idValues))
+		for i := range idValues {
+			t.Ids[i] = Amount(idValues[i].ID)
+		}
+		// the balance of ERC721 tokens is the number of the held tokens
+		t.BalanceSat = (*Amount)(big.NewInt(int64(len(idValues))))
+	} else {
+		t.MultiTokenValues = make([]MultiTokenValue, len(idValues))
+		for i := range idValues {
+			iv := &idValues[i]
+			t.MultiTokenValues[i] = MultiTokenValue{ID: (*Amount)(&iv.ID), Value: (*Amount)(&iv.Value)}
+		}
+	}
+}
+
 func (w *Worker) getEthereumTypeAddressBalances(addrDesc bchain.AddressDescriptor, details AccountDetails, filter *AddressFilter) (*db.AddrBalance, []Token, *bchain.Erc20Contract, uint64, int, int, error) {
 	var (
 		ba             *db.AddrBalance
@@ -553,6 +650,24 @@ func (w *Worker) getEthereumTypeAddressBalances(addrDesc bchain.AddressDescripto
 					}
 					validContract = false
 				}
+				t := &tokens[j]
+				*t = Token{
+					Type:          tokenTypeName(c.Type),
+					Contract:      ci.Contract,
+					Name:          ci.Name,
+					Symbol:        ci.Symbol,
+					Transfers:     int(c.Txs),
+					ContractIndex: strconv.Itoa(i + 1),
+				}
+				j++
+				// the ids of ERC721 and ERC1155 tokens held by the address are stored in db, they do not have decimals
+				if c.Type != bchain.ERC20TokenType {
+					if details >= AccountDetailsTokenBalances {
+						setTokenIDValues(t, c.Type, c.IDValues)
+					}
+					continue
+				}
+				t.Decimals = ci.Decimals
 				// do not read contract balances etc in case of Basic option
 				if details >= AccountDetailsTokenBalances && validContract {
 					b, err = w.chain.EthereumTypeGetErc20ContractBalance(addrDesc, c.Contract)
@@ -560,20 +675,8 @@ func (w *Worker) getEthereumTypeAddressBalances(addrDesc bchain.AddressDescripto
 						// return nil, nil, nil, errors.Annotatef(err, "EthereumTypeGetErc20ContractBalance %v %v", addrDesc, c.Contract)
 						glog.Warningf("EthereumTypeGetErc20ContractBalance addr %v, contract %v, %v", addrDesc, c.Contract, err)
 					}
-				} else {
-					b = nil
-				}
-				tokens[j] = Token{
-					Type:          ERC20TokenType,
-					BalanceSat:    (*Amount)(b),
-					Contract:      ci.Contract,
-					Name:          ci.Name,
-					Symbol:        ci.Symbol,
-					Transfers:     int(c.Txs),
-					Decimals:      ci.Decimals,
-					ContractIndex: strconv.Itoa(i + 1),
+					t.BalanceSat = (*Amount)(b)
 				}
-				j++
 			}
 			tokens = tokens[:j]
 		}
@@ -684,7 +787,31 @@ func (w *Worker) GetAddress(address string, page int, txsOnPage int, option Acco
 	if err != nil {
 		return nil, err
 	}
-	if w.chainType == bchain.ChainEthereumType {
+	if err = w.setFilterHeightsByTime(filter); err != nil {
+		return nil, err
+	}
+	if filter.AtHeight > 0 {
+		if w.chainType != bchain.ChainBitcoinType {
+			return nil, NewAPIError("Parameter atHeight is not supported", true)
+		}
+		// the state at the height contains only the transactions up to the height, the mempool is skipped
+		f := *filter
+		if f.ToHeight == 0 || f.ToHeight > f.AtHeight {
+			f.ToHeight = f.AtHeight
+		}
+		ba, err = w.getAddrDescBalanceAtHeight(addrDesc, filter.AtHeight, false)
+		if err != nil {
+			return nil, errors.Annotatef(err, "getAddrDescBalanceAtHeight %v %v", addrDesc, filter.AtHeight)
+		}
+		if ba != nil {
+			if filter.Vout == AddressFilterVoutOff && filter.FromHeight == 0 && f.ToHeight == f.AtHeight {
+				totalResults = int(ba.Txs)
+			} else {
+				totalResults = -1
+			}
+		}
+		filter = &f
+	} else if w.chainType == bchain.ChainEthereumType {
 		var n uint64
 		ba, tokens, erc20c, n, nonTokenTxs, totalResults, err = w.getEthereumTypeAddressBalances(addrDesc, option, filter)
 		if err != nil {
@@ -791,6 +918,7 @@ func (w *Worker) GetAddress(address string, page int, txsOnPage int, option Acco
 		Erc20Contract:         erc20c,
 		Nonce:                 nonce,
 	}
+	r.AddressAliases = w.getAddressAliases(getAddressAliasCandidates(r))
 	glog.Info("GetAddress ", address, " finished in ", time.Since(start))
 	return r, nil
 }
@@ -848,6 +976,7 @@ func (w *Worker) getAddrDescUtxo(addrDesc bchain.AddressDescriptor, ba *db.AddrB
 									Vout:      int32(i),
 									AmountSat: (*Amount)(&vout.ValueSat),
 									Locktime:  bchainTx.LockTime,
+									AddrDesc:  addrDesc,
 								})
 							}
 						}
@@ -888,6 +1017,7 @@ func (w *Worker) getAddrDescUtxo(addrDesc bchain.AddressDescriptor, ba *db.AddrB
 						AmountSat:     (*Amount)(&utxo.ValueSat),
 						Height:        int(utxo.Height),
 						Confirmations: bestheight - int(utxo.Height) + 1,
+						AddrDesc:      addrDesc,
 					})
 				}
 				checksum.Sub(&checksum, &utxo.ValueSat)
@@ -900,8 +1030,94 @@ func (w *Worker) getAddrDescUtxo(addrDesc bchain.AddressDescriptor, ba *db.AddrB
 	return r, nil
 }
 
-// GetAddressUtxo returns unspent outputs for given address
-func (w *Worker) GetAddressUtxo(address string, onlyConfirmed bool) (Utxos, error) {
+// isOutputSpentAtHeight checks if the output was spent by a transaction in a block up to the height
+func (w *Worker) isOutputSpentAtHeight(txid string, txHeight uint32, vout int32, o *db.TxOutput, height uint32) (bool, error) {
+	if !o.Spent {
+		return false, nil
+	}
+	si, err := w.db.GetSpendingInput(txid, uint32(vout))
+	if err != nil {
+		return false, err
+	}
+	if si != nil {
+		return si.Height <= height, nil
+	}
+	v := Vout{N: int(vout), AddrDesc: o.AddrDesc, ValueSat: (*Amount)(&o.ValueSat)}
+	if err = w.findSpendingTxOfVout(&v, txid, txHeight); err != nil {
+		return false, err
+	}
+	if v.SpentTxID == "" {
+		glog.Warning("DB inconsistency:  tx ", txid, ", output ", vout, ": spending tx not found")
+		return false, nil
+	}
+	return uint32(v.SpentHeight) <= height, nil
+}
+
+// getAddrDescBalanceAtHeight reconstructs the balance of the address as it was after the block at the height
+// from the address transactions and txAddresses, optionally including the utxos at the height
+// returns nil if the address did not have any transaction up to the height
+func (w *Worker) getAddrDescBalanceAtHeight(addrDesc bchain.AddressDescriptor, height uint32, utxos bool) (*db.AddrBalance, error) {
+	type addrTx struct {
+		txid    string
+		indexes []int32
+	}
+	var txs []addrTx
+	err := w.db.GetAddrDescTransactions(addrDesc, 0, height, func(txid string, _ uint32, indexes []int32) error {
+		txs = append(txs, addrTx{txid, append([]int32(nil), indexes...)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		return nil, nil
+	}
+	ba := &db.AddrBalance{Txs: uint32(len(txs))}
+	// the transactions are returned newest first, the utxos are kept oldest first as in the index
+	for i := len(txs) - 1; i >= 0; i-- {
+		t := &txs[i]
+		ta, err := w.db.GetTxAddresses(t.txid)
+		if err != nil {
+			return nil, err
+		}
+		if ta == nil {
+			glog.Warning("DB inconsistency:  tx ", t.txid, ": not found in txAddresses")
+			continue
+		}
+		for _, index := range t.indexes {
+			if index < 0 {
+				index = ^index
+				if int(index) < len(ta.Inputs) {
+					ba.SentSat.Add(&ba.SentSat, &ta.Inputs[index].ValueSat)
+					ba.BalanceSat.Sub(&ba.BalanceSat, &ta.Inputs[index].ValueSat)
+				}
+				continue
+			}
+			if int(index) >= len(ta.Outputs) {
+				continue
+			}
+			o := &ta.Outputs[index]
+			ba.BalanceSat.Add(&ba.BalanceSat, &o.ValueSat)
+			if utxos {
+				spent, err := w.isOutputSpentAtHeight(t.txid, ta.Height, index, o, height)
+				if err != nil {
+					return nil, err
+				}
+				if !spent {
+					btxID, err := w.chainParser.PackTxid(t.txid)
+					if err != nil {
+						return nil, err
+					}
+					ba.Utxos = append(ba.Utxos, db.Utxo{BtxID: btxID, Vout: index, Height: ta.Height, ValueSat: o.ValueSat})
+				}
+			}
+		}
+	}
+	return ba, nil
+}
+
+// GetAddressUtxo returns unspent outputs for given address, if atHeight is specified, returns the unspent outputs as of that height
+func (w *Worker) GetAddressUtxo(address string, onlyConfirmed bool, atHeight uint32) (Utxos, error) {
 	if w.chainType != bchain.ChainBitcoinType {
 		return nil, NewAPIError("Not supported", true)
 	}
@@ -910,7 +1126,20 @@ func (w *Worker) GetAddressUtxo(address string, onlyConfirmed bool) (Utxos, erro
 	if err != nil {
 		return nil, NewAPIError(fmt.Sprintf("Invalid address '%v', %v", address, err), true)
 	}
-	r, err := w.getAddrDescUtxo(addrDesc, nil, onlyConfirmed, false)
+	var r Utxos
+	if atHeight > 0 {
+		var ba *db.AddrBalance
+		ba, err = w.getAddrDescBalanceAtHeight(addrDesc, atHeight, true)
+		if err != nil {
+			return nil, err
+		}
+		if ba == nil {
+			ba = &db.AddrBalance{}
+		}
+		r, err = w.getAddrDescUtxo(addrDesc, ba, true, false)
+	} else {
+		r, err = w.getAddrDescUtxo(addrDesc, nil, onlyConfirmed, false)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -918,6 +1147,230 @@ func (w *Worker) GetAddressUtxo(address string, onlyConfirmed bool) (Utxos, erro
 	return r, nil
 }
 
+// block times are not monotonic, a block can have time older than its predecessors
+// the iteration over address transactions continues this many seconds below the requested start of the history
+const balanceHistoryTimeTolerance = 7200
+
+func balanceHistoryTimeRange(fromTimestamp, toTimestamp int64) (uint32, uint32) {
+	fromUnix := uint32(0)
+	toUnix := maxUint32
+	if fromTimestamp > 0 {
+		fromUnix = uint32(fromTimestamp)
+	}
+	if toTimestamp > 0 && toTimestamp < int64(maxUint32) {
+		toUnix = uint32(toTimestamp)
+	}
+	return fromUnix, toUnix
+}
+
+func (w *Worker) getBlockTime(height uint32, blockTimes map[uint32]uint32) (uint32, error) {
+	if t, found := blockTimes[height]; found {
+		return t, nil
+	}
+	bi, err := w.db.GetBlockInfo(height)
+	if err != nil {
+		return 0, err
+	}
+	if bi == nil {
+		return 0, errors.Errorf("Block info for height %d not found", height)
+	}
+	t := uint32(bi.Time)
+	blockTimes[height] = t
+	return t, nil
+}
+
+// balanceHistoryForAddrDesc returns received and sent amounts of confirmed transactions of the address in the time range <fromUnix, toUnix)
+// the balance changes caused by transactions newer than toUnix are subtracted from balanceSat
+func (w *Worker) balanceHistoryForAddrDesc(addrDesc bchain.AddressDescriptor, fromUnix, toUnix uint32, balanceSat *big.Int, blockTimes map[uint32]uint32) (BalanceHistories, error) {
+	bhs := make(BalanceHistories, 0)
+	err := w.db.GetAddrDescTransactions(addrDesc, 0, maxUint32, func(txid string, height uint32, indexes []int32) error {
+		blockTime, err := w.getBlockTime(height, blockTimes)
+		if err != nil {
+			return err
+		}
+		if uint64(blockTime)+balanceHistoryTimeTolerance < uint64(fromUnix) {
+			return &db.StopIteration{}
+		}
+		if blockTime < fromUnix {
+			return nil
+		}
+		ta, err := w.db.GetTxAddresses(txid)
+		if err != nil {
+			return err
+		}
+		if ta == nil {
+			glog.Warning("DB inconsistency:  tx ", txid, ": not found in txAddresses")
+			return nil
+		}
+		var receivedSat, sentSat big.Int
+		for _, index := range indexes {
+			if index < 0 {
+				index = ^index
+				if int(index) < len(ta.Inputs) {
+					sentSat.Add(&sentSat, &ta.Inputs[index].ValueSat)
+				}
+			} else if int(index) < len(ta.Outputs) {
+				receivedSat.Add(&receivedSat, &ta.Outputs[index].ValueSat)
+			}
+		}
+		if blockTime >= toUnix {
+			balanceSat.Sub(balanceSat, &receivedSat)
+			balanceSat.Add(balanceSat, &sentSat)
+			return nil
+		}
+		bhs = append(bhs, BalanceHistory{
+			Time:        blockTime,
+			Txs:         1,
+			ReceivedSat: (*Amount)(&receivedSat),
+			SentSat:     (*Amount)(&sentSat),
+			Txid:        txid,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bhs, nil
+}
+
+// GetBalanceHistory returns history of balance of given address in time buckets of size groupBy seconds
+func (w *Worker) GetBalanceHistory(address string, fromTimestamp, toTimestamp int64, groupBy uint32) (BalanceHistories, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, NewAPIError("Not supported", true)
+	}
+	start := time.Now()
+	addrDesc, _, err := w.getAddrDescAndNormalizeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	ba, err := w.db.GetAddrDescBalance(addrDesc, db.AddressBalanceDetailNoUTXO)
+	if err != nil {
+		return nil, NewAPIError(fmt.Sprintf("Address not found, %v", err), true)
+	}
+	if ba == nil {
+		return BalanceHistories{}, nil
+	}
+	fromUnix, toUnix := balanceHistoryTimeRange(fromTimestamp, toTimestamp)
+	var balanceSat big.Int
+	balanceSat.Set(&ba.BalanceSat)
+	bhs, err := w.balanceHistoryForAddrDesc(addrDesc, fromUnix, toUnix, &balanceSat, make(map[uint32]uint32))
+	if err != nil {
+		return nil, err
+	}
+	bha := bhs.SortAndAggregate(groupBy, &balanceSat)
+	glog.Info("GetBalanceHistory ", address, ", ", len(bhs), " txs, ", len(bha), " items, finished in ", time.Since(start))
+	return bha, nil
+}
+
+// fiatTicker returns the rates of the requested currencies from the ticker, all rates if no currency is requested
+// the rate of a currency missing in the ticker is -1
+func fiatTicker(ticker *db.CurrencyRatesTicker, currencies []string) FiatTicker {
+	ft := FiatTicker{Timestamp: ticker.Timestamp.Unix()}
+	if len(currencies) == 0 {
+		ft.Rates = ticker.Rates
+		return ft
+	}
+	ft.Rates = make(map[string]float64, len(currencies))
+	for _, c := range currencies {
+		c = strings.ToLower(c)
+		if rate, found := ticker.Rates[c]; found {
+			ft.Rates[c] = rate
+		} else {
+			ft.Rates[c] = -1
+		}
+	}
+	return ft
+}
+
+func (w *Worker) getFiatTicker(timestamp int64) (*db.CurrencyRatesTicker, error) {
+	if timestamp <= 0 {
+		return w.db.FiatRatesFindLastTicker()
+	}
+	return w.db.FiatRatesGetTicker(time.Unix(timestamp, 0))
+}
+
+// GetFiatRatesTicker returns the exchange rates valid at the timestamp, the last available rates if timestamp is 0
+func (w *Worker) GetFiatRatesTicker(timestamp int64, currencies []string) (*FiatTicker, error) {
+	ticker, err := w.getFiatTicker(timestamp)
+	if err != nil {
+		return nil, errors.Annotatef(err, "getFiatTicker %v", timestamp)
+	}
+	if ticker == nil {
+		return nil, NewAPIError("No tickers available", true)
+	}
+	ft := fiatTicker(ticker, currencies)
+	return &ft, nil
+}
+
+// GetFiatRatesForTimestamps returns the exchange rates valid at each of the timestamps
+func (w *Worker) GetFiatRatesForTimestamps(timestamps []int64, currencies []string) (*FiatTickers, error) {
+	if len(timestamps) == 0 {
+		return nil, NewAPIError("No timestamps provided", true)
+	}
+	rv := &FiatTickers{Tickers: make([]FiatTicker, len(timestamps))}
+	for i, ts := range timestamps {
+		ticker, err := w.getFiatTicker(ts)
+		if err != nil {
+			return nil, errors.Annotatef(err, "getFiatTicker %v", ts)
+		}
+		if ticker == nil {
+			rv.Tickers[i] = FiatTicker{Timestamp: ts, Error: "No tickers available"}
+			continue
+		}
+		rv.Tickers[i] = fiatTicker(ticker, currencies)
+	}
+	return rv, nil
+}
+
+// fiatValue converts the amount to the currency using the rate valid at the timestamp, returns nil if the rate is not available
+func (w *Worker) fiatValue(amount *Amount, currency string, timestamp int64) (*FiatValue, error) {
+	if amount == nil {
+		return nil, nil
+	}
+	ticker, err := w.getFiatTicker(timestamp)
+	if err != nil || ticker == nil {
+		return nil, err
+	}
+	rate, found := ticker.Rates[currency]
+	if !found {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(w.chainParser.AmountToDecimalString((*big.Int)(amount)), 64)
+	if err != nil {
+		return nil, err
+	}
+	return &FiatValue{
+		Currency:  currency,
+		Rate:      rate,
+		Value:     v * rate,
+		Timestamp: ticker.Timestamp.Unix(),
+	}, nil
+}
+
+// SetTxFiatValue sets the value of the tx in the currency, converted using the rate valid at the block time
+// the current rate is used for the mempool transactions
+func (w *Worker) SetTxFiatValue(tx *Tx, currency string) error {
+	var err error
+	tx.ValueOutFiat, err = w.fiatValue(tx.ValueOutSat, strings.ToLower(currency), tx.Blocktime)
+	return err
+}
+
+// SetAddressFiatValue sets the balance of the address in the currency using the current rate
+// and the values of the returned transactions using the rates valid at their block times
+func (w *Worker) SetAddressFiatValue(address *Address, currency string) error {
+	var err error
+	currency = strings.ToLower(currency)
+	if address.BalanceFiat, err = w.fiatValue(address.BalanceSat, currency, 0); err != nil {
+		return err
+	}
+	for _, tx := range address.Transactions {
+		if err = w.SetTxFiatValue(tx, currency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetBlocks returns BlockInfo for blocks on given page
 func (w *Worker) GetBlocks(page int, blocksOnPage int) (*Blocks, error) {
 	start := time.Now()
@@ -1028,20 +1481,315 @@ func (w *Worker) GetBlock(bid string, page int, txsOnPage int) (*Block, error) {
 	}, nil
 }
 
+// GetBlockFilter returns BIP158 block filter of the block specified by height or hash
+func (w *Worker) GetBlockFilter(bid string) (*BlockFilter, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, NewAPIError("Block filters are not supported", true)
+	}
+	var hash string
+	var height uint32
+	h, err := strconv.Atoi(bid)
+	if err == nil && h >= 0 && h < int(maxUint32) {
+		height = uint32(h)
+		hash, err = w.db.GetBlockHash(height)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetBlockHash %v", height)
+		}
+	} else {
+		bh, err := w.chain.GetBlockHeader(bid)
+		if err != nil {
+			if err == bchain.ErrBlockNotFound {
+				return nil, NewAPIError("Block not found", true)
+			}
+			return nil, NewAPIError(fmt.Sprintf("Block not found, %v", err), true)
+		}
+		height = bh.Height
+		// check that the block is in the main chain known to the index
+		hash, err = w.db.GetBlockHash(height)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetBlockHash %v", height)
+		}
+		if hash != bh.Hash {
+			hash = ""
+		}
+	}
+	if hash == "" {
+		return nil, NewAPIError("Block not found", true)
+	}
+	filter, err := w.db.GetBlockFilter(height)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockFilter %v", height)
+	}
+	if filter == nil {
+		from, stored := w.is.GetBlockFilterHeight()
+		if !stored {
+			return nil, NewAPIError("Block filters are not stored", true)
+		}
+		if height < from {
+			return nil, NewAPIError(fmt.Sprintf("Block filters are not available below height %d", from), true)
+		}
+		return nil, NewAPIError("Block filter not found", true)
+	}
+	return &BlockFilter{
+		Hash:   hash,
+		Height: height,
+		Filter: hex.EncodeToString(filter),
+	}, nil
+}
+
+// maxBlockHeaders is the maximum number of headers returned by GetBlockHeaders, one difficulty adjustment period of Bitcoin
+const maxBlockHeaders = 2016
+
+// GetBlockHeaders returns the concatenated raw headers of up to count blocks starting at the height from the index,
+// the headers missing in the index are got from the backend
+func (w *Worker) GetBlockHeaders(height uint32, count int) (*BlockHeaders, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, NewAPIError("Block headers are not supported", true)
+	}
+	if count <= 0 || count > maxBlockHeaders {
+		count = maxBlockHeaders
+	}
+	bestHeight, _, err := w.db.GetBestBlock()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBestBlock")
+	}
+	if height > bestHeight {
+		return nil, NewAPIError("Block not found", true)
+	}
+	from, stored := w.is.GetBlockHeadersHeight()
+	if !stored {
+		return nil, NewAPIError("Block headers are not stored", true)
+	}
+	if height < from {
+		return nil, NewAPIError(fmt.Sprintf("Block headers are not available below height %d", from), true)
+	}
+	if uint64(height)+uint64(count) > uint64(bestHeight)+1 {
+		count = int(bestHeight - height + 1)
+	}
+	r := &BlockHeaders{Height: height}
+	for r.Count < count {
+		h := height + uint32(r.Count)
+		headers, err := w.db.GetBlockHeaders(h, count-r.Count)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetBlockHeaders %v %v", h, count-r.Count)
+		}
+		for _, header := range headers {
+			r.Raw = append(r.Raw, header...)
+		}
+		r.Count += len(headers)
+		if r.Count < count {
+			// the header is not in the index although it should be, get it from the backend
+			header, err := w.getBlockHeaderFromBackend(height + uint32(r.Count))
+			if err != nil {
+				return nil, err
+			}
+			if header == nil {
+				break
+			}
+			r.Raw = append(r.Raw, header...)
+			r.Count++
+		}
+	}
+	if r.Count == 0 {
+		return nil, NewAPIError("Block header not available", true)
+	}
+	r.Headers = hex.EncodeToString(r.Raw)
+	return r, nil
+}
+
+// getBlockHeaderFromBackend returns the raw header of the indexed block from the backend, nil if the backend cannot return it
+func (w *Worker) getBlockHeaderFromBackend(height uint32) ([]byte, error) {
+	rc := bchain.GetRawBlockHeaderChain(w.chain)
+	if rc == nil {
+		return nil, nil
+	}
+	bi, err := w.db.GetBlockInfo(height)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockInfo %v", height)
+	}
+	if bi == nil {
+		return nil, nil
+	}
+	header, err := rc.GetBlockHeaderRaw(bi.Hash)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockHeaderRaw %v %v", height, bi.Hash)
+	}
+	return header, nil
+}
+
+// GetTxMerkleProof returns the merkle branch of a confirmed transaction, which proves the inclusion
+// of the transaction in the block to a client that knows only the header of the block
+func (w *Worker) GetTxMerkleProof(txid string) (*TxMerkleProof, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, NewAPIError("Merkle proofs are not supported", true)
+	}
+	if b, err := hex.DecodeString(txid); err != nil || len(b) != 32 {
+		return nil, NewAPIError("Invalid txid", true)
+	}
+	ta, err := w.db.GetTxAddresses(txid)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetTxAddresses %v", txid)
+	}
+	if ta == nil {
+		return nil, NewAPIError(fmt.Sprintf("Transaction '%v' not found or not confirmed", txid), true)
+	}
+	hash, err := w.db.GetBlockHash(ta.Height)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockHash %v", ta.Height)
+	}
+	if hash == "" {
+		return nil, errors.Errorf("Block %v of transaction %v not found", ta.Height, txid)
+	}
+	bi, err := w.chain.GetBlockInfo(hash)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockInfo %v", hash)
+	}
+	pos := -1
+	for i := range bi.Txids {
+		if bi.Txids[i] == txid {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		return nil, errors.Errorf("Transaction %v not found in block %v", txid, hash)
+	}
+	branch, root, err := bchain.MerkleBranch(bi.Txids, pos)
+	if err != nil {
+		return nil, errors.Annotatef(err, "MerkleBranch %v", hash)
+	}
+	if bi.MerkleRoot != "" && bi.MerkleRoot != root {
+		return nil, errors.Errorf("Computed merkle root %v does not match merkle root %v of block %v", root, bi.MerkleRoot, hash)
+	}
+	r := &TxMerkleProof{
+		Txid:        txid,
+		BlockHash:   hash,
+		BlockHeight: ta.Height,
+		MerkleRoot:  root,
+		Pos:         pos,
+		Merkle:      branch,
+	}
+	headers, err := w.db.GetBlockHeaders(ta.Height, 1)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockHeaders %v", ta.Height)
+	}
+	if len(headers) == 1 {
+		h := headers[0]
+		// the merkle root is at the offset 36 of the bitcoin header, in the reversed byte order
+		if len(h) == 80 {
+			hr := make([]byte, 32)
+			for i := range hr {
+				hr[i] = h[67-i]
+			}
+			if hex.EncodeToString(hr) != root {
+				return nil, errors.Errorf("Computed merkle root %v does not match the stored header of block %v", root, hash)
+			}
+		}
+		r.Header = hex.EncodeToString(h)
+	}
+	return r, nil
+}
+
+// GetBlockByTime returns the last block with the median time past equal or older than the timestamp
+// the median time past is used because the times of the blocks are not monotonic
+func (w *Worker) GetBlockByTime(timestamp int64) (*BlockByTime, error) {
+	height, found, err := w.db.GetHeightByMedianTime(timestamp + 1)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetHeightByMedianTime %v", timestamp+1)
+	}
+	if !found {
+		// all blocks are older than the timestamp, return the best block
+		if height, _, err = w.db.GetBestBlock(); err != nil {
+			return nil, errors.Annotatef(err, "GetBestBlock")
+		}
+		height++
+	}
+	if height == 0 {
+		return nil, NewAPIError("Block not found", true)
+	}
+	height--
+	bi, err := w.db.GetBlockInfo(height)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockInfo %v", height)
+	}
+	if bi == nil {
+		return nil, NewAPIError("Block not found", true)
+	}
+	mtp, err := w.db.GetBlockMedianTimePast(height)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockMedianTimePast %v", height)
+	}
+	return &BlockByTime{
+		Hash:       bi.Hash,
+		Height:     height,
+		Time:       bi.Time,
+		MedianTime: mtp,
+	}, nil
+}
+
+// setFilterHeightsByTime translates FromTime and ToTime of the filter to FromHeight and ToHeight,
+// the blocks with the median time past in the range FromTime to ToTime (inclusive) are selected
+func (w *Worker) setFilterHeightsByTime(filter *AddressFilter) error {
+	if filter.FromTime > 0 {
+		height, found, err := w.db.GetHeightByMedianTime(filter.FromTime)
+		if err != nil {
+			return errors.Annotatef(err, "GetHeightByMedianTime %v", filter.FromTime)
+		}
+		if !found {
+			// no block after FromTime, only mempool transactions can match
+			height = maxUint32
+		}
+		if height > filter.FromHeight {
+			filter.FromHeight = height
+		}
+	}
+	if filter.ToTime > 0 {
+		height, found, err := w.db.GetHeightByMedianTime(filter.ToTime + 1)
+		if err != nil {
+			return errors.Annotatef(err, "GetHeightByMedianTime %v", filter.ToTime+1)
+		}
+		if !found {
+			if height, _, err = w.db.GetBestBlock(); err != nil {
+				return errors.Annotatef(err, "GetBestBlock")
+			}
+			height++
+		}
+		if height == 0 {
+			// no block before ToTime, ToHeight zero would mean no filter
+			filter.FromHeight, filter.ToHeight = maxUint32, maxUint32
+		} else if filter.ToHeight == 0 || height-1 < filter.ToHeight {
+			filter.ToHeight = height - 1
+		}
+	}
+	return nil
+}
+
 // ComputeFeeStats computes fee distribution in defined blocks and logs them to log
 func (w *Worker) ComputeFeeStats(blockFrom, blockTo int, stopCompute chan os.Signal) error {
 	bestheight, _, err := w.db.GetBestBlock()
 	if err != nil {
 		return errors.Annotatef(err, "GetBestBlock")
 	}
+	// if the backend supports batch requests, the block infos are prefetched in batches
+	bc := bchain.GetBatchBlockChain(w.chain)
+	var infos []*bchain.BlockInfo
 	for block := blockFrom; block <= blockTo; block++ {
-		hash, err := w.db.GetBlockHash(uint32(block))
-		if err != nil {
-			return err
-		}
-		bi, err := w.chain.GetBlockInfo(hash)
-		if err != nil {
-			return err
+		var bi *bchain.BlockInfo
+		if bc != nil {
+			if len(infos) == 0 {
+				if infos, err = w.getBlockInfos(bc, block, blockTo); err != nil {
+					return err
+				}
+			}
+			bi, infos = infos[0], infos[1:]
+		} else {
+			hash, err := w.db.GetBlockHash(uint32(block))
+			if err != nil {
+				return err
+			}
+			if bi, err = w.chain.GetBlockInfo(hash); err != nil {
+				return err
+			}
 		}
 		// process only blocks with enough transactions
 		if len(bi.Txids) > 20 {
@@ -1088,6 +1836,22 @@ func (w *Worker) ComputeFeeStats(blockFrom, blockTo int, stopCompute chan os.Sig
 	return nil
 }
 
+// getBlockInfos returns the block infos of the blocks from the height from up to the height to, using one batch request
+func (w *Worker) getBlockInfos(bc bchain.BatchBlockChain, from, to int) ([]*bchain.BlockInfo, error) {
+	if n := bc.RPCBatchSize(); to-from >= n {
+		to = from + n - 1
+	}
+	hashes := make([]string, 0, to-from+1)
+	for block := from; block <= to; block++ {
+		hash, err := w.db.GetBlockHash(uint32(block))
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return bc.GetBlockInfos(hashes)
+}
+
 // GetSystemInfo returns information about system
 func (w *Worker) GetSystemInfo(internal bool) (*SystemInfo, error) {
 	start := time.Now()
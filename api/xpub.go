@@ -2,11 +2,14 @@ package api
 
 import (
 	"blockbook/bchain"
+	"blockbook/common"
 	"blockbook/db"
 	"fmt"
 	"math/big"
 	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/glog"
@@ -22,8 +25,15 @@ const txOutput = 2
 const xpubCacheSize = 512
 const xpubCacheExpirationSeconds = 7200
 
+// xpubCacheStoreAccessSeconds is the period of storing the time of the last access of unchanged xpub to the persistent cache
+const xpubCacheStoreAccessSeconds = 600
+
 var cachedXpubs = make(map[string]xpubData)
 var cachedXpubsMux sync.Mutex
+var xpubCacheUpdating int32
+
+var xpubDefaultGap = defaultAddressesGap
+var xpubMaxGap = maxAddressesGap
 
 type xpubTxid struct {
 	txid        string
@@ -55,8 +65,11 @@ type xpubAddress struct {
 }
 
 type xpubData struct {
+	xpub            string
 	gap             int
 	accessed        int64
+	stored          int64 // access time of the xpub stored in the persistent cache
+	rescan          bool  // the balances of the addresses were not loaded yet
 	basePath        string
 	dataHeight      uint32
 	dataHash        string
@@ -67,6 +80,68 @@ type xpubData struct {
 	changeAddresses []xpubAddress
 }
 
+// details returns the level of details to which the xpub data were loaded
+func (data *xpubData) details() AccountDetails {
+	for _, da := range [][]xpubAddress{data.addresses, data.changeAddresses} {
+		for i := range da {
+			if da[i].complete {
+				return AccountDetailsTxidHistory
+			}
+		}
+	}
+	return AccountDetailsBasic
+}
+
+// copyXpubAddresses returns a copy of the addresses which can be updated without affecting the readers of the original,
+// the txids and balances are not copied, the update replaces them and does not modify them
+func copyXpubAddresses(addresses []xpubAddress) []xpubAddress {
+	if addresses == nil {
+		return nil
+	}
+	r := make([]xpubAddress, len(addresses))
+	copy(r, addresses)
+	return r
+}
+
+// atHeight returns a copy of the xpub data with the balances of the addresses reconstructed as of the height
+// the data can be shared with the cache and are not modified, the txids of the addresses must be filtered by the caller
+func (data *xpubData) atHeight(w *Worker, height uint32, utxos bool) (*xpubData, error) {
+	r := &xpubData{
+		xpub:       data.xpub,
+		gap:        data.gap,
+		basePath:   data.basePath,
+		dataHeight: height,
+	}
+	for ci, da := range [][]xpubAddress{data.addresses, data.changeAddresses} {
+		ra := make([]xpubAddress, len(da))
+		for i := range da {
+			ra[i] = da[i]
+			ad := &ra[i]
+			if ad.balance == nil {
+				continue
+			}
+			ba, err := w.getAddrDescBalanceAtHeight(ad.addrDesc, height, utxos)
+			if err != nil {
+				return nil, err
+			}
+			ad.balance = ba
+			ad.txs = 0
+			if ba != nil {
+				ad.txs = ba.Txs
+				r.txCountEstimate += ba.Txs
+				r.sentSat.Add(&r.sentSat, &ba.SentSat)
+				r.balanceSat.Add(&r.balanceSat, &ba.BalanceSat)
+			}
+		}
+		if ci == 0 {
+			r.addresses = ra
+		} else {
+			r.changeAddresses = ra
+		}
+	}
+	return r, nil
+}
+
 func (w *Worker) xpubGetAddressTxids(addrDesc bchain.AddressDescriptor, mempool bool, fromHeight, toHeight uint32, maxResults int) ([]xpubTxid, bool, error) {
 	var err error
 	complete := true
@@ -119,10 +194,11 @@ func (w *Worker) xpubGetAddressTxids(addrDesc bchain.AddressDescriptor, mempool
 	return txs, complete, nil
 }
 
-func (w *Worker) xpubCheckAndLoadTxids(ad *xpubAddress, filter *AddressFilter, maxHeight uint32, maxResults int) error {
+// xpubCheckAndLoadTxids loads the txids of the used address up to maxHeight, returns true if some txids were loaded
+func (w *Worker) xpubCheckAndLoadTxids(ad *xpubAddress, maxHeight uint32) (bool, error) {
 	// skip if not used
 	if ad.balance == nil {
-		return nil
+		return false, nil
 	}
 	// if completely loaded, check if there are not some new txs and load if necessary
 	if ad.complete {
@@ -136,14 +212,14 @@ func (w *Worker) xpubCheckAndLoadTxids(ad *xpubAddress, filter *AddressFilter, m
 					glog.Warning("xpubCheckAndLoadTxids inconsistency ", ad.addrDesc, ", ad.txs=", ad.txs, ", ad.balance.Txs=", ad.balance.Txs)
 				}
 			}
-			return err
+			return err == nil, err
 		}
-		return nil
+		return false, nil
 	}
 	// load all txids to get paging correctly
 	newTxids, complete, err := w.xpubGetAddressTxids(ad.addrDesc, false, 0, maxHeight, maxInt)
 	if err != nil {
-		return err
+		return false, err
 	}
 	ad.txids = newTxids
 	ad.complete = complete
@@ -154,7 +230,7 @@ func (w *Worker) xpubCheckAndLoadTxids(ad *xpubAddress, filter *AddressFilter, m
 			glog.Warning("xpubCheckAndLoadTxids inconsistency ", ad.addrDesc, ", ad.txs=", ad.txs, ", ad.balance.Txs=", ad.balance.Txs)
 		}
 	}
-	return nil
+	return true, nil
 }
 
 func (w *Worker) xpubDerivedAddressBalance(data *xpubData, ad *xpubAddress) (bool, error) {
@@ -269,27 +345,139 @@ func evictXpubCacheItems() {
 	glog.Info("Evicted ", count, " items from xpub cache, oldest item accessed at ", time.Unix(oldest, 0), ", cache size ", len(cachedXpubs))
 }
 
+// SetXpubAddressesGap sets the gap used if the request does not specify it and the maximum gap allowed in the requests
+func SetXpubAddressesGap(defaultGap, maxGap int) error {
+	if defaultGap <= 0 || maxGap < defaultGap {
+		return errors.Errorf("Invalid xpub gap %v, maximum gap %v", defaultGap, maxGap)
+	}
+	xpubDefaultGap = defaultGap
+	xpubMaxGap = maxGap
+	return nil
+}
+
+func xpubCacheKey(xpub string, gap int) string {
+	return strconv.Itoa(gap) + ":" + xpub
+}
+
+func xpubAddressesToCache(addresses []xpubAddress) []db.XpubCacheAddress {
+	r := make([]db.XpubCacheAddress, len(addresses))
+	for i := range addresses {
+		ad := &addresses[i]
+		ca := &r[i]
+		ca.AddrDesc = ad.addrDesc
+		// only the complete lists of txids can be updated incrementally
+		if ad.complete {
+			ca.Txs = ad.txs
+			ca.MaxHeight = ad.maxHeight
+			ca.Complete = true
+			ca.Txids = make([]db.XpubCacheTxid, len(ad.txids))
+			for j := range ad.txids {
+				ca.Txids[j] = db.XpubCacheTxid{Txid: ad.txids[j].txid, Height: ad.txids[j].height, InputOutput: ad.txids[j].inputOutput}
+			}
+		}
+	}
+	return r
+}
+
+func xpubAddressesFromCache(addresses []db.XpubCacheAddress) []xpubAddress {
+	r := make([]xpubAddress, len(addresses))
+	for i := range addresses {
+		ca := &addresses[i]
+		ad := &r[i]
+		ad.addrDesc = ca.AddrDesc
+		ad.txs = ca.Txs
+		ad.maxHeight = ca.MaxHeight
+		ad.complete = ca.Complete
+		if len(ca.Txids) > 0 {
+			ad.txids = make(xpubTxids, len(ca.Txids))
+			for j := range ca.Txids {
+				ad.txids[j] = xpubTxid{txid: ca.Txids[j].Txid, height: ca.Txids[j].Height, inputOutput: ca.Txids[j].InputOutput}
+			}
+		}
+	}
+	return r
+}
+
+// loadXpubData returns the xpub from the persistent cache, the balances of the addresses are not stored and must be rescanned
+func (w *Worker) loadXpubData(xpub string, gap int) (xpubData, bool) {
+	cd, err := w.db.GetXpubCacheData(xpub, gap)
+	if err != nil {
+		glog.Error("GetXpubCacheData ", xpub[:16], " error ", err)
+		w.db.DeleteXpubCacheData(xpub, gap)
+		return xpubData{}, false
+	}
+	if cd == nil {
+		return xpubData{}, false
+	}
+	return xpubData{
+		xpub:            xpub,
+		gap:             gap,
+		accessed:        cd.Accessed,
+		stored:          cd.Accessed,
+		basePath:        cd.BasePath,
+		dataHeight:      cd.DataHeight,
+		dataHash:        cd.DataHash,
+		rescan:          true,
+		addresses:       xpubAddressesFromCache(cd.Addresses),
+		changeAddresses: xpubAddressesFromCache(cd.ChangeAddresses),
+	}, true
+}
+
+func (w *Worker) storeXpubData(data *xpubData) {
+	err := w.db.StoreXpubCacheData(data.xpub, data.gap, &db.XpubCacheData{
+		Accessed:        data.accessed,
+		BasePath:        data.basePath,
+		DataHeight:      data.dataHeight,
+		DataHash:        data.dataHash,
+		Addresses:       xpubAddressesToCache(data.addresses),
+		ChangeAddresses: xpubAddressesToCache(data.changeAddresses),
+	})
+	if err != nil {
+		// do not return caching error, only log it
+		glog.Error("StoreXpubCacheData ", data.xpub[:16], " error ", err)
+		return
+	}
+	data.stored = data.accessed
+}
+
 func (w *Worker) getXpubData(xpub string, page int, txsOnPage int, option AccountDetails, filter *AddressFilter, gap int) (*xpubData, uint32, error) {
 	if w.chainType != bchain.ChainBitcoinType {
 		return nil, 0, ErrUnsupportedXpub
 	}
-	var (
-		err        error
-		bestheight uint32
-		besthash   string
-	)
 	if gap <= 0 {
-		gap = defaultAddressesGap
-	} else if gap > maxAddressesGap {
+		gap = xpubDefaultGap
+	} else if gap > xpubMaxGap {
 		// limit the maximum gap to protect against unreasonably big values that could cause high load of the server
-		gap = maxAddressesGap
+		gap = xpubMaxGap
 	}
 	// gap is increased one as there must be gap of empty addresses before the derivation is stopped
 	gap++
+	return w.updateXpubData(xpub, gap, option, true)
+}
+
+// updateXpubData gets the xpub from the cache and updates it to the best block or derives it if it is not cached
+func (w *Worker) updateXpubData(xpub string, gap int, option AccountDetails, access bool) (*xpubData, uint32, error) {
+	var (
+		err        error
+		bestheight uint32
+		besthash   string
+	)
 	var processedHash string
+	key := xpubCacheKey(xpub, gap)
 	cachedXpubsMux.Lock()
-	data, found := cachedXpubs[xpub]
+	data, found := cachedXpubs[key]
 	cachedXpubsMux.Unlock()
+	if found {
+		// the cached addresses are read by concurrent requests, they are updated in a copy which replaces them in the cache
+		data.addresses = copyXpubAddresses(data.addresses)
+		data.changeAddresses = copyXpubAddresses(data.changeAddresses)
+		w.metrics.XpubCacheEfficiency.With(common.Labels{"status": "hit"}).Inc()
+	} else if data, found = w.loadXpubData(xpub, gap); found {
+		w.metrics.XpubCacheEfficiency.With(common.Labels{"status": "dbhit"}).Inc()
+	} else {
+		w.metrics.XpubCacheEfficiency.With(common.Labels{"status": "miss"}).Inc()
+	}
+	modified := false
 	// to load all data for xpub may take some time, do it in a loop to process a possible new block
 	for {
 		bestheight, besthash, err = w.db.GetBestBlock()
@@ -300,13 +488,14 @@ func (w *Worker) getXpubData(xpub string, page int, txsOnPage int, option Accoun
 			break
 		}
 		fork := false
-		if !found || data.gap != gap {
-			data = xpubData{gap: gap}
+		if !found {
+			data = xpubData{xpub: xpub, gap: gap}
 			data.basePath, err = w.chainParser.DerivationBasePath(xpub)
 			if err != nil {
 				glog.Warning("DerivationBasePath error", err)
 				data.basePath = "unknown"
 			}
+			found = true
 		} else {
 			hash, err := w.db.GetBlockHash(data.dataHeight)
 			if err != nil {
@@ -318,7 +507,8 @@ func (w *Worker) getXpubData(xpub string, page int, txsOnPage int, option Accoun
 			}
 		}
 		processedHash = besthash
-		if data.dataHeight < bestheight || fork {
+		if data.dataHeight < bestheight || fork || data.rescan {
+			data.rescan = false
 			data.dataHeight = bestheight
 			data.dataHash = besthash
 			data.balanceSat = *new(big.Int)
@@ -333,27 +523,75 @@ func (w *Worker) getXpubData(xpub string, page int, txsOnPage int, option Accoun
 			if err != nil {
 				return nil, 0, err
 			}
+			modified = true
 		}
 		if option >= AccountDetailsTxidHistory {
 			for _, da := range [][]xpubAddress{data.addresses, data.changeAddresses} {
 				for i := range da {
-					if err = w.xpubCheckAndLoadTxids(&da[i], filter, bestheight, (page+1)*txsOnPage); err != nil {
+					loaded, err := w.xpubCheckAndLoadTxids(&da[i], bestheight)
+					if err != nil {
 						return nil, 0, err
 					}
+					modified = modified || loaded
 				}
 			}
 		}
 	}
-	data.accessed = time.Now().Unix()
+	now := time.Now().Unix()
+	if access {
+		data.accessed = now
+	}
+	if w.db.XpubCacheEnabled() && (modified || data.stored+xpubCacheStoreAccessSeconds < data.accessed) {
+		w.storeXpubData(&data)
+	}
 	cachedXpubsMux.Lock()
 	if len(cachedXpubs) >= xpubCacheSize {
 		evictXpubCacheItems()
 	}
-	cachedXpubs[xpub] = data
+	cachedXpubs[key] = data
+	w.metrics.XpubCacheSize.With(common.Labels{"cache": "memory"}).Set(float64(len(cachedXpubs)))
 	cachedXpubsMux.Unlock()
 	return &data, bestheight, nil
 }
 
+// UpdateXpubCache updates the recently accessed xpubs in the memory cache to the best block and stores them to the persistent cache,
+// the xpubs not in the memory cache are updated incrementally on the next access
+func (w *Worker) UpdateXpubCache() {
+	if w.chainType != bchain.ChainBitcoinType {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&xpubCacheUpdating, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&xpubCacheUpdating, 0)
+	// the update runs outside of any request, it must hold the read lock itself
+	w.db.LockRead()
+	defer w.db.UnlockRead()
+	start := time.Now()
+	type cachedXpub struct {
+		xpub   string
+		gap    int
+		option AccountDetails
+	}
+	cachedXpubsMux.Lock()
+	xpubs := make([]cachedXpub, 0, len(cachedXpubs))
+	for _, data := range cachedXpubs {
+		if data.accessed+xpubCacheExpirationSeconds >= start.Unix() {
+			xpubs = append(xpubs, cachedXpub{data.xpub, data.gap, data.details()})
+		}
+	}
+	cachedXpubsMux.Unlock()
+	for _, x := range xpubs {
+		if _, _, err := w.updateXpubData(x.xpub, x.gap, x.option, false); err != nil {
+			glog.Error("UpdateXpubCache ", x.xpub[:16], " error ", err)
+		}
+	}
+	if _, err := w.db.EvictXpubCacheItems(); err != nil {
+		glog.Error("EvictXpubCacheItems error ", err)
+	}
+	glog.Info("UpdateXpubCache updated ", len(xpubs), " xpubs, finished in ", time.Since(start))
+}
+
 // GetXpubAddress computes address value and gets transactions for given address
 func (w *Worker) GetXpubAddress(xpub string, page int, txsOnPage int, option AccountDetails, filter *AddressFilter, gap int) (*Address, error) {
 	start := time.Now()
@@ -377,10 +615,18 @@ func (w *Worker) GetXpubAddress(xpub string, page int, txsOnPage int, option Acc
 		uBalSat        big.Int
 		unconfirmedTxs int
 	)
+	if err = w.setFilterHeightsByTime(filter); err != nil {
+		return nil, err
+	}
 	data, bestheight, err := w.getXpubData(xpub, page, txsOnPage, option, filter, gap)
 	if err != nil {
 		return nil, err
 	}
+	if filter.AtHeight > 0 {
+		if data, err = data.atHeight(w, filter.AtHeight, false); err != nil {
+			return nil, err
+		}
+	}
 	// setup filtering of txids
 	var txidFilter func(txid *xpubTxid, ad *xpubAddress) bool
 	if !(filter.FromHeight == 0 && filter.ToHeight == 0 && filter.Vout == AddressFilterVoutOff) {
@@ -402,8 +648,8 @@ func (w *Worker) GetXpubAddress(xpub string, page int, txsOnPage int, option Acc
 		}
 		filtered = true
 	}
-	// process mempool, only if ToHeight is not specified
-	if filter.ToHeight == 0 && !filter.OnlyConfirmed {
+	// process mempool, only if ToHeight or AtHeight is not specified
+	if filter.ToHeight == 0 && filter.AtHeight == 0 && !filter.OnlyConfirmed {
 		txmMap = make(map[string]*Tx)
 		mempoolEntries := make(bchain.MempoolTxidEntries, 0)
 		for _, da := range [][]xpubAddress{data.addresses, data.changeAddresses} {
@@ -457,6 +703,10 @@ func (w *Worker) GetXpubAddress(xpub string, page int, txsOnPage int, option Acc
 			for i := range da {
 				ad := &da[i]
 				for _, txid := range ad.txids {
+					// the txs after AtHeight are not part of the xpub history at that height
+					if filter.AtHeight > 0 && txid.height > filter.AtHeight {
+						continue
+					}
 					added, foundTx := txcMap[txid.txid]
 					// count txs regardless of filter but only once
 					if !foundTx {
@@ -549,9 +799,12 @@ func (w *Worker) GetXpubAddress(xpub string, page int, txsOnPage int, option Acc
 	return &addr, nil
 }
 
-// GetXpubUtxo returns unspent outputs for given xpub
-func (w *Worker) GetXpubUtxo(xpub string, onlyConfirmed bool, gap int) (Utxos, error) {
+// GetXpubUtxo returns unspent outputs for given xpub, if atHeight is specified, returns the unspent outputs as of that height
+func (w *Worker) GetXpubUtxo(xpub string, onlyConfirmed bool, gap int, atHeight uint32) (Utxos, error) {
 	start := time.Now()
+	if atHeight > 0 {
+		onlyConfirmed = true
+	}
 	data, _, err := w.getXpubData(xpub, 0, 1, AccountDetailsBasic, &AddressFilter{
 		Vout:          AddressFilterVoutOff,
 		OnlyConfirmed: onlyConfirmed,
@@ -559,6 +812,11 @@ func (w *Worker) GetXpubUtxo(xpub string, onlyConfirmed bool, gap int) (Utxos, e
 	if err != nil {
 		return nil, err
 	}
+	if atHeight > 0 {
+		if data, err = data.atHeight(w, atHeight, true); err != nil {
+			return nil, err
+		}
+	}
 	r := make(Utxos, 0, 8)
 	for ci, da := range [][]xpubAddress{data.addresses, data.changeAddresses} {
 		for i := range da {
@@ -589,3 +847,36 @@ func (w *Worker) GetXpubUtxo(xpub string, onlyConfirmed bool, gap int) (Utxos, e
 	glog.Info("GetXpubUtxo ", xpub[:16], ", ", len(r), " utxos, finished in ", time.Since(start))
 	return r, nil
 }
+
+// GetXpubBalanceHistory returns history of balance of given xpub in time buckets of size groupBy seconds
+func (w *Worker) GetXpubBalanceHistory(xpub string, fromTimestamp, toTimestamp int64, groupBy uint32, gap int) (BalanceHistories, error) {
+	start := time.Now()
+	data, _, err := w.getXpubData(xpub, 0, 1, AccountDetailsBasic, &AddressFilter{
+		Vout:          AddressFilterVoutOff,
+		OnlyConfirmed: true,
+	}, gap)
+	if err != nil {
+		return nil, err
+	}
+	fromUnix, toUnix := balanceHistoryTimeRange(fromTimestamp, toTimestamp)
+	var balanceSat big.Int
+	balanceSat.Set(&data.balanceSat)
+	blockTimes := make(map[uint32]uint32)
+	bhs := make(BalanceHistories, 0)
+	for _, da := range [][]xpubAddress{data.addresses, data.changeAddresses} {
+		for i := range da {
+			ad := &da[i]
+			if ad.balance == nil {
+				continue
+			}
+			h, err := w.balanceHistoryForAddrDesc(ad.addrDesc, fromUnix, toUnix, &balanceSat, blockTimes)
+			if err != nil {
+				return nil, err
+			}
+			bhs = append(bhs, h...)
+		}
+	}
+	bha := bhs.SortAndAggregate(groupBy, &balanceSat)
+	glog.Info("GetXpubBalanceHistory ", xpub[:16], ", ", len(bhs), " address txs, ", len(bha), " items, finished in ", time.Since(start))
+	return bha, nil
+}
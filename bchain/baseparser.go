@@ -274,6 +274,11 @@ func (p *BaseParser) IsAddrDescIndexable(addrDesc AddressDescriptor) bool {
 	return true
 }
 
+// GetScriptType returns ScriptTypeUnknown, the script types are recognized only by the Bitcoin type parsers
+func (p *BaseParser) GetScriptType(addrDesc AddressDescriptor) ScriptType {
+	return ScriptTypeUnknown
+}
+
 // DerivationBasePath is unsupported
 func (p *BaseParser) DerivationBasePath(xpub string) (string, error) {
 	return "", errors.New("Not supported")
@@ -293,3 +298,8 @@ func (p *BaseParser) DeriveAddressDescriptorsFromTo(xpub string, change uint32,
 func (p *BaseParser) EthereumTypeGetErc20FromTx(tx *Tx) ([]Erc20Transfer, error) {
 	return nil, errors.New("Not supported")
 }
+
+// EthereumTypeGetInternalTransfersFromTx is unsupported
+func (p *BaseParser) EthereumTypeGetInternalTransfersFromTx(tx *Tx) ([]EthereumInternalTransfer, error) {
+	return nil, errors.New("Not supported")
+}
@@ -0,0 +1,178 @@
+package bchain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+const (
+	// each block in the block file is preceded by the network magic and the size of the block
+	blockFileRecordHeaderSize = 8
+	blockFileBlockHeaderSize  = 80
+	blockFileXorKeySize       = 8
+)
+
+// BlockFileHash is a block hash in the internal byte order, as it is stored in the block headers
+type BlockFileHash [sha256.Size]byte
+
+// String returns the hash in the usual (reversed) hex form
+func (h BlockFileHash) String() string {
+	return encodeReversedHash(h[:])
+}
+
+// NewBlockFileHash converts the hash in the usual (reversed) hex form to BlockFileHash
+func NewBlockFileHash(hash string) (BlockFileHash, error) {
+	var h BlockFileHash
+	b, err := decodeReversedHash(hash)
+	if err != nil {
+		return h, err
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+// BlockFileLocation is the position of a block in the block files
+type BlockFileLocation struct {
+	File   int
+	Offset int64
+	Size   uint32
+}
+
+// BlockFiles reads blocks directly from the block files (blk*.dat) of the bitcoind-like backends.
+// The files written by bitcoind 28 and newer are obfuscated by the xor key stored in the file xor.dat.
+type BlockFiles struct {
+	names  []string
+	xorKey []byte
+	magic  uint32
+}
+
+// OpenBlockFiles finds the block files in the blocks directory of the backend
+func OpenBlockFiles(dir string) (*BlockFiles, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "blk[0-9]*.dat"))
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, errors.Errorf("No block files in %v", dir)
+	}
+	// the file names contain zero padded numbers, ordering by name is ordering by number
+	sort.Strings(names)
+	bf := &BlockFiles{names: names}
+	key, err := ioutil.ReadFile(filepath.Join(dir, "xor.dat"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	} else {
+		if len(key) != blockFileXorKeySize {
+			return nil, errors.Errorf("Invalid xor key in %v", dir)
+		}
+		for _, k := range key {
+			if k != 0 {
+				bf.xorKey = key
+				break
+			}
+		}
+	}
+	return bf, nil
+}
+
+// Len returns the number of the block files
+func (bf *BlockFiles) Len() int {
+	return len(bf.names)
+}
+
+func (bf *BlockFiles) deobfuscate(b []byte, offset int64) {
+	if bf.xorKey == nil {
+		return
+	}
+	for i := range b {
+		b[i] ^= bf.xorKey[(offset+int64(i))%blockFileXorKeySize]
+	}
+}
+
+// Scan reads the headers of all blocks in the block files and passes the location of each block,
+// its hash and the hash of the previous block to the function fn
+func (bf *BlockFiles) Scan(fn func(loc BlockFileLocation, hash, prevHash BlockFileHash) error) error {
+	for i := range bf.names {
+		if err := bf.scanFile(i, fn); err != nil {
+			return errors.Annotatef(err, "%v", bf.names[i])
+		}
+	}
+	return nil
+}
+
+func (bf *BlockFiles) scanFile(i int, fn func(loc BlockFileLocation, hash, prevHash BlockFileHash) error) error {
+	f, err := os.Open(bf.names[i])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+	buf := make([]byte, blockFileRecordHeaderSize+blockFileBlockHeaderSize)
+	var offset int64
+	for offset+int64(len(buf)) <= size {
+		if _, err := f.ReadAt(buf, offset); err != nil {
+			return err
+		}
+		if binary.LittleEndian.Uint32(buf) == 0 {
+			// the rest of the preallocated file is not used yet, the preallocated space is not obfuscated
+			break
+		}
+		bf.deobfuscate(buf, offset)
+		magic := binary.LittleEndian.Uint32(buf)
+		if bf.magic == 0 {
+			bf.magic = magic
+		} else if magic != bf.magic {
+			glog.Warningf("blockfiles: %v unexpected magic %x at offset %v, rest of the file skipped", bf.names[i], magic, offset)
+			break
+		}
+		blockSize := binary.LittleEndian.Uint32(buf[4:])
+		next := offset + blockFileRecordHeaderSize + int64(blockSize)
+		if blockSize < blockFileBlockHeaderSize || next > size {
+			// the block is being written by the backend
+			glog.Warning("blockfiles: ", bf.names[i], " incomplete block at offset ", offset, " skipped")
+			break
+		}
+		header := buf[blockFileRecordHeaderSize:]
+		var hash, prevHash BlockFileHash
+		h := sha256.Sum256(header)
+		hash = sha256.Sum256(h[:])
+		copy(prevHash[:], header[4:4+len(prevHash)])
+		if err := fn(BlockFileLocation{File: i, Offset: offset + blockFileRecordHeaderSize, Size: blockSize}, hash, prevHash); err != nil {
+			return err
+		}
+		offset = next
+	}
+	return nil
+}
+
+// ReadBlock returns the raw block at the location, it can be called concurrently
+func (bf *BlockFiles) ReadBlock(loc BlockFileLocation) ([]byte, error) {
+	if loc.File < 0 || loc.File >= len(bf.names) {
+		return nil, errors.Errorf("Invalid block file %v", loc.File)
+	}
+	// the file is opened for each block, there are thousands of block files and the blocks are read concurrently
+	f, err := os.Open(bf.names[loc.File])
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b := make([]byte, loc.Size)
+	if _, err := f.ReadAt(b, loc.Offset); err != nil {
+		return nil, errors.Annotatef(err, "%v offset %v", bf.names[loc.File], loc.Offset)
+	}
+	bf.deobfuscate(b, loc.Offset)
+	return b, nil
+}
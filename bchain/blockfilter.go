@@ -0,0 +1,272 @@
+package bchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"math/bits"
+	"sort"
+
+	"github.com/juju/errors"
+)
+
+// parameters of the BIP158 basic block filter
+const (
+	blockFilterP = 19
+	blockFilterM = 784931
+)
+
+// ComputeBlockFilter computes BIP158 compact block filter (golomb coded set) of the scripts in the block
+// blockHash is in the usual (reversed) hex form, the filter key is derived from it
+func ComputeBlockFilter(blockHash string, scripts [][]byte) ([]byte, error) {
+	k0, k1, err := blockFilterKey(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	// the filter is a set, remove the duplicate scripts
+	unique := make(map[string]struct{}, len(scripts))
+	items := make([][]byte, 0, len(scripts))
+	for _, s := range scripts {
+		if len(s) == 0 {
+			continue
+		}
+		if _, found := unique[string(s)]; !found {
+			unique[string(s)] = struct{}{}
+			items = append(items, s)
+		}
+	}
+	n := uint64(len(items))
+	values := make([]uint64, n)
+	for i, s := range items {
+		values[i] = hashToRange(k0, k1, s, n*blockFilterM)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	buf := make([]byte, 9)
+	l := putCompactSize(n, buf)
+	w := bitWriter{bytes: buf[:l]}
+	var last uint64
+	for _, v := range values {
+		golombEncode(&w, v-last)
+		last = v
+	}
+	return w.bytes, nil
+}
+
+// BlockFilterMatch checks if the script is possibly in the block filter
+// false positives are possible with the probability 1/M, false negatives are not
+func BlockFilterMatch(filter []byte, blockHash string, script []byte) (bool, error) {
+	k0, k1, err := blockFilterKey(blockHash)
+	if err != nil {
+		return false, err
+	}
+	n, l, err := readCompactSize(filter)
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+	target := hashToRange(k0, k1, script, n*blockFilterM)
+	r := bitReader{bytes: filter[l:]}
+	var value uint64
+	for i := uint64(0); i < n; i++ {
+		delta, err := golombDecode(&r)
+		if err != nil {
+			return false, err
+		}
+		value += delta
+		if value == target {
+			return true, nil
+		}
+		if value > target {
+			return false, nil
+		}
+	}
+	return false, nil
+}
+
+func blockFilterKey(blockHash string) (uint64, uint64, error) {
+	b, err := hex.DecodeString(blockHash)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(b) < 16 {
+		return 0, 0, errors.Errorf("Invalid block hash %v", blockHash)
+	}
+	// the key is made of the first 16 bytes of the block hash in the internal (not reversed) byte order
+	var key [16]byte
+	for i := range key {
+		key[i] = b[len(b)-1-i]
+	}
+	return binary.LittleEndian.Uint64(key[0:8]), binary.LittleEndian.Uint64(key[8:16]), nil
+}
+
+func hashToRange(k0, k1 uint64, item []byte, f uint64) uint64 {
+	hi, _ := bits.Mul64(sipHash24(k0, k1, item), f)
+	return hi
+}
+
+func putCompactSize(n uint64, buf []byte) int {
+	switch {
+	case n < 0xfd:
+		buf[0] = byte(n)
+		return 1
+	case n <= 0xffff:
+		buf[0] = 0xfd
+		binary.LittleEndian.PutUint16(buf[1:], uint16(n))
+		return 3
+	case n <= 0xffffffff:
+		buf[0] = 0xfe
+		binary.LittleEndian.PutUint32(buf[1:], uint32(n))
+		return 5
+	}
+	buf[0] = 0xff
+	binary.LittleEndian.PutUint64(buf[1:], n)
+	return 9
+}
+
+func readCompactSize(buf []byte) (uint64, int, error) {
+	if len(buf) == 0 {
+		return 0, 0, errors.New("Empty block filter")
+	}
+	var l int
+	switch buf[0] {
+	case 0xfd:
+		l = 3
+	case 0xfe:
+		l = 5
+	case 0xff:
+		l = 9
+	default:
+		return uint64(buf[0]), 1, nil
+	}
+	if len(buf) < l {
+		return 0, 0, errors.New("Invalid block filter")
+	}
+	var b [8]byte
+	copy(b[:], buf[1:l])
+	return binary.LittleEndian.Uint64(b[:]), l, nil
+}
+
+type bitWriter struct {
+	bytes []byte
+	n     uint8
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.n == 0 {
+		w.bytes = append(w.bytes, 0)
+		w.n = 8
+	}
+	w.n--
+	if bit {
+		w.bytes[len(w.bytes)-1] |= 1 << w.n
+	}
+}
+
+func (w *bitWriter) writeBits(v uint64, count uint) {
+	for i := count; i > 0; i-- {
+		w.writeBit(v&(1<<(i-1)) != 0)
+	}
+}
+
+type bitReader struct {
+	bytes []byte
+	pos   uint
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	i := r.pos >> 3
+	if i >= uint(len(r.bytes)) {
+		return false, errors.New("Unexpected end of block filter")
+	}
+	bit := r.bytes[i]&(0x80>>(r.pos&7)) != 0
+	r.pos++
+	return bit, nil
+}
+
+func golombEncode(w *bitWriter, v uint64) {
+	for q := v >> blockFilterP; q > 0; q-- {
+		w.writeBit(true)
+	}
+	w.writeBit(false)
+	w.writeBits(v, blockFilterP)
+}
+
+func golombDecode(r *bitReader) (uint64, error) {
+	var q uint64
+	for {
+		b, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !b {
+			break
+		}
+		q++
+	}
+	v := q << blockFilterP
+	for i := blockFilterP; i > 0; i-- {
+		b, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if b {
+			v |= 1 << uint(i-1)
+		}
+	}
+	return v, nil
+}
+
+func sipRound(v0, v1, v2, v3 uint64) (uint64, uint64, uint64, uint64) {
+	v0 += v1
+	v1 = bits.RotateLeft64(v1, 13)
+	v1 ^= v0
+	v0 = bits.RotateLeft64(v0, 32)
+	v2 += v3
+	v3 = bits.RotateLeft64(v3, 16)
+	v3 ^= v2
+	v0 += v3
+	v3 = bits.RotateLeft64(v3, 21)
+	v3 ^= v0
+	v2 += v1
+	v1 = bits.RotateLeft64(v1, 17)
+	v1 ^= v2
+	v2 = bits.RotateLeft64(v2, 32)
+	return v0, v1, v2, v3
+}
+
+// sipHash24 is SipHash-2-4 as used by BIP158
+func sipHash24(k0, k1 uint64, b []byte) uint64 {
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+	l := len(b)
+	for ; len(b) >= 8; b = b[8:] {
+		m := binary.LittleEndian.Uint64(b)
+		v3 ^= m
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0 ^= m
+	}
+	var last [8]byte
+	copy(last[:], b)
+	last[7] = byte(l)
+	m := binary.LittleEndian.Uint64(last[:])
+	v3 ^= m
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0 ^= m
+	v2 ^= 0xff
+	for i := 0; i < 4; i++ {
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	}
+	return v0 ^ v1 ^ v2 ^ v3
+}
+
+// IsBlockFilterScript returns false for the scripts which are excluded from the BIP158 basic filter
+func IsBlockFilterScript(script []byte) bool {
+	// empty and OP_RETURN scripts are not part of the filter
+	return len(script) > 0 && !bytes.HasPrefix(script, []byte{0x6a})
+}
@@ -0,0 +1,135 @@
+package bchain
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func hexToBytes(t *testing.T, h string) []byte {
+	b, err := hex.DecodeString(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSipHash24(t *testing.T) {
+	// reference vectors of SipHash-2-4 with the key 00 01 02 ... 0f
+	k0 := uint64(0x0706050403020100)
+	k1 := uint64(0x0f0e0d0c0b0a0908)
+	tests := []struct {
+		name string
+		len  int
+		want uint64
+	}{
+		{name: "empty", len: 0, want: 0x726fdb47dd0e0e31},
+		{name: "15 bytes", len: 15, want: 0xa129ca6149be45e5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := make([]byte, tt.len)
+			for i := range b {
+				b[i] = byte(i)
+			}
+			if got := sipHash24(k0, k1, b); got != tt.want {
+				t.Errorf("sipHash24() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeBlockFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		blockHash string
+		scripts   []string
+		want      string
+	}{
+		{
+			// BIP158 test vector, testnet genesis block
+			name:      "testnet genesis",
+			blockHash: "000000000933ea01ad0ee984209779baaec3ced90fa3f408719526f8d77f4943",
+			scripts:   []string{"4104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac"},
+			want:      "019dfca8",
+		},
+		{
+			name:      "duplicate scripts",
+			blockHash: "000000000933ea01ad0ee984209779baaec3ced90fa3f408719526f8d77f4943",
+			scripts: []string{
+				"4104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac",
+				"",
+				"4104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac",
+			},
+			want: "019dfca8",
+		},
+		{
+			name:      "empty",
+			blockHash: "000000000933ea01ad0ee984209779baaec3ced90fa3f408719526f8d77f4943",
+			want:      "00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scripts := make([][]byte, len(tt.scripts))
+			for i, s := range tt.scripts {
+				scripts[i] = hexToBytes(t, s)
+			}
+			got, err := ComputeBlockFilter(tt.blockHash, scripts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h := hex.EncodeToString(got); h != tt.want {
+				t.Errorf("ComputeBlockFilter() = %v, want %v", h, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockFilterMatch(t *testing.T) {
+	blockHash := "0000000000000bec5d1d2e1c8c8e2e2b5a2e5e9ec4f1eae1a3a4e0b5b9c0f21e"
+	scripts := [][]byte{
+		hexToBytes(t, "76a914010d39800f86122416e28f485029acf77507169288ac"),
+		hexToBytes(t, "a9144a1154d50b03292b3024370901711946cb7cccc387"),
+		hexToBytes(t, "0014ce3c7c5e6cf1bb5d8d0ff4cdb2e5a6f4f7b0c0a1"),
+		hexToBytes(t, "5121034d0ff1b76bed1a7ae29b8e3e5e2e21f4e0a7bd1d64c0c1b5e0a1f06e1e9e2f0a51ae"),
+	}
+	filter, err := ComputeBlockFilter(blockHash, scripts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range scripts {
+		got, err := BlockFilterMatch(filter, blockHash, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got {
+			t.Errorf("BlockFilterMatch() script %d not matched", i)
+		}
+	}
+	got, err := BlockFilterMatch(filter, blockHash, hexToBytes(t, "76a914a08eae93007f22668ab5e4a9c83c8cd1c325e3e088ac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got {
+		t.Error("BlockFilterMatch() unexpected match")
+	}
+}
+
+func TestIsBlockFilterScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   bool
+	}{
+		{name: "p2pkh", script: "76a914010d39800f86122416e28f485029acf77507169288ac", want: true},
+		{name: "OP_RETURN", script: "6a072020f1686f6a20", want: false},
+		{name: "empty", script: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsBlockFilterScript(hexToBytes(t, tt.script)); got != tt.want {
+				t.Errorf("IsBlockFilterScript() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -136,6 +136,15 @@ func NewBlockChain(coin string, configfile string, pushHandler func(bchain.Notif
 	if err != nil {
 		return nil, nil, err
 	}
+	if pc, ok := bc.(bchain.RPCPoolChain); ok {
+		pc.RPCPool().ObserveLatency = func(url string, latency time.Duration, err error) {
+			var e string
+			if err != nil {
+				e = "failure"
+			}
+			metrics.RPCLatency.With(common.Labels{"method": "healthcheck " + bchain.EndpointName(url), "error": e}).Observe(float64(latency) / 1e6) // in milliseconds
+		}
+	}
 	err = bc.Initialize()
 	if err != nil {
 		return nil, nil, err
@@ -227,6 +236,42 @@ func (c *blockChainWithMetrics) GetBlockInfo(hash string) (v *bchain.BlockInfo,
 	return c.b.GetBlockInfo(hash)
 }
 
+// RPCBatchSize returns the batch size of the wrapped chain, zero if the wrapped chain does not support the batch requests
+func (c *blockChainWithMetrics) RPCBatchSize() int {
+	if bc, ok := c.b.(bchain.BatchBlockChain); ok {
+		return bc.RPCBatchSize()
+	}
+	return 0
+}
+
+func (c *blockChainWithMetrics) GetBlockHashes(heights []uint32) (v []string, err error) {
+	defer func(s time.Time) { c.observeRPCLatency("GetBlockHashes", s, err) }(time.Now())
+	return c.b.(bchain.BatchBlockChain).GetBlockHashes(heights)
+}
+
+func (c *blockChainWithMetrics) GetBlockInfos(hashes []string) (v []*bchain.BlockInfo, err error) {
+	defer func(s time.Time) { c.observeRPCLatency("GetBlockInfos", s, err) }(time.Now())
+	return c.b.(bchain.BatchBlockChain).GetBlockInfos(hashes)
+}
+
+func (c *blockChainWithMetrics) GetTransactionsBatch(txids []string) (v map[string]*bchain.Tx, err error) {
+	defer func(s time.Time) { c.observeRPCLatency("GetTransactionsBatch", s, err) }(time.Now())
+	return c.b.(bchain.BatchBlockChain).GetTransactionsBatch(txids)
+}
+
+// RawBlockHeaders returns false if the wrapped chain does not support the raw block headers
+func (c *blockChainWithMetrics) RawBlockHeaders() bool {
+	if rc, ok := c.b.(bchain.RawBlockHeaderChain); ok {
+		return rc.RawBlockHeaders()
+	}
+	return false
+}
+
+func (c *blockChainWithMetrics) GetBlockHeaderRaw(hash string) (v []byte, err error) {
+	defer func(s time.Time) { c.observeRPCLatency("GetBlockHeaderRaw", s, err) }(time.Now())
+	return c.b.(bchain.RawBlockHeaderChain).GetBlockHeaderRaw(hash)
+}
+
 func (c *blockChainWithMetrics) GetMempoolTransactions() (v []string, err error) {
 	defer func(s time.Time) { c.observeRPCLatency("GetMempoolTransactions", s, err) }(time.Now())
 	return c.b.GetMempoolTransactions()
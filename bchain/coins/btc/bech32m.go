@@ -0,0 +1,182 @@
+package btc
+
+import (
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/martinboehm/btcutil/txscript"
+)
+
+// the bech32 package of btcutil supports only the original bech32 checksum (BIP173),
+// segwit v1+ addresses use the bech32m checksum (BIP350)
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+const (
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+)
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		b := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (b>>uint(i))&1 == 1 {
+				chk ^= bech32Generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HrpExpand(hrp string) []byte {
+	r := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		r = append(r, hrp[i]>>5)
+	}
+	r = append(r, 0)
+	for i := 0; i < len(hrp); i++ {
+		r = append(r, hrp[i]&31)
+	}
+	return r
+}
+
+func bech32Encode(hrp string, data []byte, checksumConst uint32) string {
+	values := append(bech32HrpExpand(hrp), data...)
+	polymod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ checksumConst
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, d := range data {
+		sb.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+	return sb.String()
+}
+
+// bech32Decode decodes bech32 or bech32m string, returns the human readable part, the data and the checksum constant
+func bech32Decode(s string) (string, []byte, uint32, error) {
+	if len(s) > 90 {
+		return "", nil, 0, errors.New("Invalid bech32 string length")
+	}
+	lower := strings.ToLower(s)
+	if lower != s && strings.ToUpper(s) != s {
+		return "", nil, 0, errors.New("Mixed case in bech32 string")
+	}
+	for i := 0; i < len(lower); i++ {
+		if lower[i] < 33 || lower[i] > 126 {
+			return "", nil, 0, errors.New("Invalid character in bech32 string")
+		}
+	}
+	pos := strings.LastIndexByte(lower, '1')
+	if pos < 1 || pos+7 > len(lower) {
+		return "", nil, 0, errors.New("Invalid bech32 separator position")
+	}
+	hrp := lower[:pos]
+	data := make([]byte, 0, len(lower)-pos-1)
+	for i := pos + 1; i < len(lower); i++ {
+		d := strings.IndexByte(bech32Charset, lower[i])
+		if d < 0 {
+			return "", nil, 0, errors.New("Invalid character in bech32 data")
+		}
+		data = append(data, byte(d))
+	}
+	c := bech32Polymod(append(bech32HrpExpand(hrp), data...))
+	if c != bech32Const && c != bech32mConst {
+		return "", nil, 0, errors.New("Invalid bech32 checksum")
+	}
+	return hrp, data[:len(data)-6], c, nil
+}
+
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	maxv := uint32(1)<<toBits - 1
+	r := make([]byte, 0, len(data)*int(fromBits)/int(toBits)+1)
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, errors.New("Invalid data range")
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			r = append(r, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			r = append(r, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, errors.New("Invalid padding")
+	}
+	return r, nil
+}
+
+// encodeSegwitAddress encodes witness program to address, using bech32 for version 0 and bech32m for higher versions
+func encodeSegwitAddress(hrp string, version byte, program []byte) (string, error) {
+	if version > 16 || len(program) < 2 || len(program) > 40 {
+		return "", errors.New("Invalid witness program")
+	}
+	data, err := convertBits(program, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	c := uint32(bech32mConst)
+	if version == 0 {
+		c = bech32Const
+	}
+	return bech32Encode(hrp, append([]byte{version}, data...), c), nil
+}
+
+// decodeSegwitAddress decodes address with the human readable part hrp to witness version and program
+func decodeSegwitAddress(hrp string, address string) (byte, []byte, error) {
+	h, data, c, err := bech32Decode(address)
+	if err != nil {
+		return 0, nil, err
+	}
+	if h != hrp {
+		return 0, nil, errors.New("Invalid human readable part")
+	}
+	if len(data) < 1 || data[0] > 16 {
+		return 0, nil, errors.New("Invalid witness version")
+	}
+	version := data[0]
+	program, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(program) < 2 || len(program) > 40 || (version == 0 && len(program) != 20 && len(program) != 32) {
+		return 0, nil, errors.New("Invalid witness program length")
+	}
+	if (version == 0 && c != bech32Const) || (version != 0 && c != bech32mConst) {
+		return 0, nil, errors.New("Invalid checksum for witness version")
+	}
+	return version, program, nil
+}
+
+// witnessProgramFromScript returns version and program of segwit v1+ output script <OP_1..OP_16><len><program>
+func witnessProgramFromScript(script []byte) (byte, []byte, bool) {
+	if len(script) < 4 || len(script) > 42 || script[0] < txscript.OP_1 || script[0] > txscript.OP_16 || int(script[1]) != len(script)-2 {
+		return 0, nil, false
+	}
+	return script[0] - txscript.OP_1 + 1, script[2:], true
+}
+
+// witnessScript returns segwit output script for the witness version and program
+func witnessScript(version byte, program []byte) []byte {
+	script := make([]byte, len(program)+2)
+	if version > 0 {
+		script[0] = txscript.OP_1 + version - 1
+	}
+	script[1] = byte(len(program))
+	copy(script[2:], program)
+	return script
+}
@@ -3,9 +3,11 @@ package btc
 import (
 	"blockbook/bchain"
 	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
 	"math/big"
+	"sort"
 	"strconv"
 
 	vlq "github.com/bsm/go-vlq"
@@ -100,8 +102,33 @@ func (p *BitcoinParser) IsAddrDescIndexable(addrDesc bchain.AddressDescriptor) b
 	return true
 }
 
+// GetScriptType returns the type of the output script of the address descriptor
+func (p *BitcoinParser) GetScriptType(addrDesc bchain.AddressDescriptor) bchain.ScriptType {
+	switch txscript.GetScriptClass(addrDesc) {
+	case txscript.PubKeyHashTy:
+		return bchain.ScriptTypeP2PKH
+	case txscript.ScriptHashTy:
+		return bchain.ScriptTypeP2SH
+	case txscript.WitnessV0PubKeyHashTy:
+		return bchain.ScriptTypeP2WPKH
+	case txscript.WitnessV0ScriptHashTy:
+		return bchain.ScriptTypeP2WSH
+	}
+	if version, program, ok := witnessProgramFromScript(addrDesc); ok && version == 1 && len(program) == 32 {
+		return bchain.ScriptTypeP2TR
+	}
+	return bchain.ScriptTypeUnknown
+}
+
 // addressToOutputScript converts bitcoin address to ScriptPubKey
 func (p *BitcoinParser) addressToOutputScript(address string) ([]byte, error) {
+	// btcutil does not support bech32m encoded segwit v1+ addresses
+	if p.Params.Bech32HRPSegwit != "" {
+		version, program, err := decodeSegwitAddress(p.Params.Bech32HRPSegwit, address)
+		if err == nil && version > 0 {
+			return witnessScript(version, program), nil
+		}
+	}
 	da, err := btcutil.DecodeAddress(address, p.Params)
 	if err != nil {
 		return nil, err
@@ -193,6 +220,14 @@ func (p *BitcoinParser) tryParseOmni(data []byte) string {
 
 // outputScriptToAddresses converts ScriptPubKey to addresses with a flag that the addresses are searchable
 func (p *BitcoinParser) outputScriptToAddresses(script []byte) ([]string, bool, error) {
+	if version, program, ok := witnessProgramFromScript(script); ok && p.Params.Bech32HRPSegwit != "" {
+		a, err := encodeSegwitAddress(p.Params.Bech32HRPSegwit, version, program)
+		if err != nil {
+			return nil, false, err
+		}
+		// only taproot is defined for segwit v1+ outputs
+		return []string{a}, version == 1 && len(program) == 32, nil
+	}
 	sc, addresses, _, err := txscript.ExtractPkScriptAddrs(script, p.Params)
 	if err != nil {
 		return nil, false, err
@@ -301,6 +336,8 @@ func (p *BitcoinParser) ParseBlock(b []byte) (*bchain.Block, error) {
 			Time: w.Header.Timestamp.Unix(),
 		},
 		Txs: txs,
+		// copy the header so that the raw block can be released
+		RawHeader: append([]byte(nil), b[:wire.MaxBlockHeaderPayload]...),
 	}, nil
 }
 
@@ -326,23 +363,59 @@ func (p *BitcoinParser) UnpackTx(buf []byte) (*bchain.Tx, uint32, error) {
 	return tx, height, nil
 }
 
-func (p *BitcoinParser) addrDescFromExtKey(extKey *hdkeychain.ExtendedKey) (bchain.AddressDescriptor, error) {
+func (p *BitcoinParser) multisigScript(d *xpubDescriptor, extKeys []*hdkeychain.ExtendedKey) ([]byte, error) {
+	pubKeys := make([][]byte, len(extKeys))
+	for i := range extKeys {
+		pubKeys[i] = extKeys[i].PubKeyBytes()
+	}
+	if d.sortedMulti {
+		sort.Slice(pubKeys, func(i, j int) bool {
+			return bytes.Compare(pubKeys[i], pubKeys[j]) < 0
+		})
+	}
+	b := txscript.NewScriptBuilder().AddInt64(int64(d.requiredSigs))
+	for _, pk := range pubKeys {
+		b.AddData(pk)
+	}
+	return b.AddInt64(int64(len(pubKeys))).AddOp(txscript.OP_CHECKMULTISIG).Script()
+}
+
+func (p *BitcoinParser) addrDescFromExtKeys(d *xpubDescriptor, extKeys []*hdkeychain.ExtendedKey) (bchain.AddressDescriptor, error) {
 	var a btcutil.Address
 	var err error
-	if extKey.Version() == p.XPubMagicSegwitP2sh {
+	switch d.scriptType {
+	case descriptorP2SHWPKH:
 		// redeemScript <witness version: OP_0><len pubKeyHash: 20><20-byte-pubKeyHash>
-		pubKeyHash := btcutil.Hash160(extKey.PubKeyBytes())
-		redeemScript := make([]byte, len(pubKeyHash)+2)
-		redeemScript[0] = 0
-		redeemScript[1] = byte(len(pubKeyHash))
-		copy(redeemScript[2:], pubKeyHash)
-		hash := btcutil.Hash160(redeemScript)
-		a, err = btcutil.NewAddressScriptHashFromHash(hash, p.Params)
-	} else if extKey.Version() == p.XPubMagicSegwitNative {
-		a, err = btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(extKey.PubKeyBytes()), p.Params)
-	} else {
-		// default to P2PKH address
-		a, err = extKey.Address(p.Params)
+		redeemScript := witnessScript(0, btcutil.Hash160(extKeys[0].PubKeyBytes()))
+		a, err = btcutil.NewAddressScriptHashFromHash(btcutil.Hash160(redeemScript), p.Params)
+	case descriptorP2WPKH:
+		a, err = btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(extKeys[0].PubKeyBytes()), p.Params)
+	case descriptorP2TR:
+		pubKey, err := extKeys[0].ECPubKey()
+		if err != nil {
+			return nil, err
+		}
+		outputKey, err := taprootOutputKey(pubKey)
+		if err != nil {
+			return nil, err
+		}
+		return witnessScript(1, outputKey), nil
+	case descriptorP2SHMultisig, descriptorP2WSHMultisig, descriptorP2SHWSHMultisig:
+		script, err := p.multisigScript(d, extKeys)
+		if err != nil {
+			return nil, err
+		}
+		if d.scriptType == descriptorP2SHMultisig {
+			a, err = btcutil.NewAddressScriptHash(script, p.Params)
+			break
+		}
+		hash := sha256.Sum256(script)
+		if d.scriptType == descriptorP2WSHMultisig {
+			return witnessScript(0, hash[:]), nil
+		}
+		a, err = btcutil.NewAddressScriptHash(witnessScript(0, hash[:]), p.Params)
+	default:
+		a, err = extKeys[0].Address(p.Params)
 	}
 	if err != nil {
 		return nil, err
@@ -350,23 +423,29 @@ func (p *BitcoinParser) addrDescFromExtKey(extKey *hdkeychain.ExtendedKey) (bcha
 	return txscript.PayToAddrScript(a)
 }
 
-// DeriveAddressDescriptors derives address descriptors from given xpub for listed indexes
-func (p *BitcoinParser) DeriveAddressDescriptors(xpub string, change uint32, indexes []uint32) ([]bchain.AddressDescriptor, error) {
-	extKey, err := hdkeychain.NewKeyFromString(xpub, p.Params.Base58CksumHasher)
+// deriveAddressDescriptors derives address descriptors from all keys of the descriptor using the path <change>/<index>
+func (p *BitcoinParser) deriveAddressDescriptors(descriptor string, change uint32, indexes []uint32) ([]bchain.AddressDescriptor, error) {
+	d, err := p.parseXpubDescriptor(descriptor)
 	if err != nil {
 		return nil, err
 	}
-	changeExtKey, err := extKey.Child(change)
-	if err != nil {
-		return nil, err
+	changeExtKeys := make([]*hdkeychain.ExtendedKey, len(d.keys))
+	for i := range d.keys {
+		changeExtKeys[i], err = d.keys[i].Child(change)
+		if err != nil {
+			return nil, err
+		}
 	}
+	indexExtKeys := make([]*hdkeychain.ExtendedKey, len(changeExtKeys))
 	ad := make([]bchain.AddressDescriptor, len(indexes))
 	for i, index := range indexes {
-		indexExtKey, err := changeExtKey.Child(index)
-		if err != nil {
-			return nil, err
+		for j := range changeExtKeys {
+			indexExtKeys[j], err = changeExtKeys[j].Child(index)
+			if err != nil {
+				return nil, err
+			}
 		}
-		ad[i], err = p.addrDescFromExtKey(indexExtKey)
+		ad[i], err = p.addrDescFromExtKeys(d, indexExtKeys)
 		if err != nil {
 			return nil, err
 		}
@@ -374,39 +453,33 @@ func (p *BitcoinParser) DeriveAddressDescriptors(xpub string, change uint32, ind
 	return ad, nil
 }
 
-// DeriveAddressDescriptorsFromTo derives address descriptors from given xpub for addresses in index range
+// DeriveAddressDescriptors derives address descriptors from given xpub or output descriptor for listed indexes
+func (p *BitcoinParser) DeriveAddressDescriptors(xpub string, change uint32, indexes []uint32) ([]bchain.AddressDescriptor, error) {
+	return p.deriveAddressDescriptors(xpub, change, indexes)
+}
+
+// DeriveAddressDescriptorsFromTo derives address descriptors from given xpub or output descriptor for addresses in index range
 func (p *BitcoinParser) DeriveAddressDescriptorsFromTo(xpub string, change uint32, fromIndex uint32, toIndex uint32) ([]bchain.AddressDescriptor, error) {
 	if toIndex <= fromIndex {
 		return nil, errors.New("toIndex<=fromIndex")
 	}
-	extKey, err := hdkeychain.NewKeyFromString(xpub, p.Params.Base58CksumHasher)
-	if err != nil {
-		return nil, err
-	}
-	changeExtKey, err := extKey.Child(change)
-	if err != nil {
-		return nil, err
-	}
-	ad := make([]bchain.AddressDescriptor, toIndex-fromIndex)
-	for index := fromIndex; index < toIndex; index++ {
-		indexExtKey, err := changeExtKey.Child(index)
-		if err != nil {
-			return nil, err
-		}
-		ad[index-fromIndex], err = p.addrDescFromExtKey(indexExtKey)
-		if err != nil {
-			return nil, err
-		}
+	indexes := make([]uint32, toIndex-fromIndex)
+	for i := range indexes {
+		indexes[i] = fromIndex + uint32(i)
 	}
-	return ad, nil
+	return p.deriveAddressDescriptors(xpub, change, indexes)
 }
 
-// DerivationBasePath returns base path of xpub
+// DerivationBasePath returns base path of xpub or output descriptor
 func (p *BitcoinParser) DerivationBasePath(xpub string) (string, error) {
-	extKey, err := hdkeychain.NewKeyFromString(xpub, p.Params.Base58CksumHasher)
+	d, err := p.parseXpubDescriptor(xpub)
 	if err != nil {
 		return "", err
 	}
+	if d.originPath != "" {
+		return d.originPath, nil
+	}
+	extKey := d.keys[0]
 	var c, bip string
 	cn := extKey.ChildNum()
 	if cn >= 0x80000000 {
@@ -417,12 +490,17 @@ func (p *BitcoinParser) DerivationBasePath(xpub string) (string, error) {
 	if extKey.Depth() != 3 {
 		return "unknown/" + c, nil
 	}
-	if extKey.Version() == p.XPubMagicSegwitP2sh {
+	switch d.scriptType {
+	case descriptorP2PKH:
+		bip = "44"
+	case descriptorP2SHWPKH:
 		bip = "49"
-	} else if extKey.Version() == p.XPubMagicSegwitNative {
+	case descriptorP2WPKH:
 		bip = "84"
-	} else {
-		bip = "44"
+	case descriptorP2TR:
+		bip = "86"
+	default:
+		return "unknown/" + c, nil
 	}
 	return "m/" + bip + "'/" + strconv.Itoa(int(p.Slip44)) + "'/" + c, nil
 }
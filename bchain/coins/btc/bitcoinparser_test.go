@@ -59,6 +59,36 @@ func TestGetAddrDescFromAddress(t *testing.T) {
 			want:    "002003973a40ec94c0d10f6f6f0e7a62ba2044b7d19db6ff2bf60651e17fb29d8d29",
 			wantErr: false,
 		},
+		{
+			name:    "P2TR",
+			args:    args{address: "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"},
+			want:    "5120a60869f0dbcf1dc659c9cecbaf8050135ea9e8cdc487053f1dc6880949dc684c",
+			wantErr: false,
+		},
+		{
+			name:    "P2TR uppercase",
+			args:    args{address: "BC1P0XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQZK5JJ0"},
+			want:    "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+			wantErr: false,
+		},
+		{
+			name:    "witness v16",
+			args:    args{address: "bc1sw50qgdz25j"},
+			want:    "6002751e",
+			wantErr: false,
+		},
+		{
+			name:    "witness v1 with bech32 checksum",
+			args:    args{address: "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd"},
+			want:    "",
+			wantErr: true,
+		},
+		{
+			name:    "witness v0 with bech32m checksum",
+			args:    args{address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh"},
+			want:    "",
+			wantErr: true,
+		},
 	}
 	parser := NewBitcoinParser(GetChainParams("main"), &Configuration{})
 
@@ -194,6 +224,20 @@ func TestGetAddressesFromAddrDesc(t *testing.T) {
 			want2:   true,
 			wantErr: false,
 		},
+		{
+			name:    "P2TR",
+			args:    args{script: "5120a60869f0dbcf1dc659c9cecbaf8050135ea9e8cdc487053f1dc6880949dc684c"},
+			want:    []string{"bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"},
+			want2:   true,
+			wantErr: false,
+		},
+		{
+			name:    "witness v16",
+			args:    args{script: "6002751e"},
+			want:    []string{"bc1sw50qgdz25j"},
+			want2:   false,
+			wantErr: false,
+		},
 		{
 			name:    "OP_RETURN ascii",
 			args:    args{script: "6a0461686f6a"},
@@ -337,6 +381,55 @@ func init() {
 	}
 }
 
+func TestGetScriptType(t *testing.T) {
+	tests := []struct {
+		name     string
+		addrDesc string
+		want     bchain.ScriptType
+	}{
+		{
+			name:     "P2PKH",
+			addrDesc: "76a914be027bf3eac907bd4ac8cb9c5293b6f37662722088ac",
+			want:     bchain.ScriptTypeP2PKH,
+		},
+		{
+			name:     "P2SH",
+			addrDesc: "a9140394b3cf9a44782c10105b93962daa8dba304d7f87",
+			want:     bchain.ScriptTypeP2SH,
+		},
+		{
+			name:     "P2WPKH",
+			addrDesc: "00141c12afc6b2602607fdbc209f2a053c54ecd2c673",
+			want:     bchain.ScriptTypeP2WPKH,
+		},
+		{
+			name:     "P2WSH",
+			addrDesc: "002003973a40ec94c0d10f6f6f0e7a62ba2044b7d19db6ff2bf60651e17fb29d8d29",
+			want:     bchain.ScriptTypeP2WSH,
+		},
+		{
+			name:     "P2TR",
+			addrDesc: "5120a60869f0dbcf1dc659c9cecbaf8050135ea9e8cdc487053f1dc6880949dc684c",
+			want:     bchain.ScriptTypeP2TR,
+		},
+		{
+			name:     "OP_RETURN",
+			addrDesc: "6a072020f1686f6a20",
+			want:     bchain.ScriptTypeUnknown,
+		},
+	}
+	parser := NewBitcoinParser(GetChainParams("main"), &Configuration{})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := hex.DecodeString(tt.addrDesc)
+			if got := parser.GetScriptType(b); got != tt.want {
+				t.Errorf("GetScriptType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestPackTx(t *testing.T) {
 	type args struct {
 		tx        bchain.Tx
@@ -483,6 +576,96 @@ func TestDeriveAddressDescriptors(t *testing.T) {
 			},
 			want: []string{"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", "bc1q4nm6g46ujzyjaeusralaz2nfv2rf04jjfyamkw"},
 		},
+		{
+			name: "m/86'/0'/0'",
+			args: args{
+				xpub:    "tr(xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ)",
+				change:  0,
+				indexes: []uint32{0, 1},
+				parser:  btcMainParser,
+			},
+			want: []string{"bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr", "bc1p4qhjn9zdvkux4e44uhx8tc55attvtyu358kutcqkudyccelu0was9fqzwh"},
+		},
+		{
+			name: "tr descriptor with checksum",
+			args: args{
+				xpub:    "tr(xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ)#9uqpxtcg",
+				change:  0,
+				indexes: []uint32{0},
+				parser:  btcMainParser,
+			},
+			want: []string{"bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"},
+		},
+		{
+			name: "tr descriptor with invalid checksum",
+			args: args{
+				xpub:    "tr(xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ)#9uqpxtcq",
+				change:  0,
+				indexes: []uint32{0},
+				parser:  btcMainParser,
+			},
+			wantErr: true,
+		},
+		{
+			name: "sh(wpkh) descriptor",
+			args: args{
+				xpub:    "sh(wpkh(xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj))",
+				change:  0,
+				indexes: []uint32{0, 1},
+				parser:  btcMainParser,
+			},
+			want: []string{"3HkzTaFbEMWeJPLyNCNhPyGfZsVLDwdD3G", "3FYpNH4eWWmqqrvcbjWpvSJYybEaGmCwZi"},
+		},
+		{
+			name: "pkh descriptor",
+			args: args{
+				xpub:    "pkh(xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj)",
+				change:  0,
+				indexes: []uint32{0, 1234},
+				parser:  btcMainParser,
+			},
+			want: []string{"1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA", "1P9w11dXAmG3QBjKLAvCsek8izs1iR2iFi"},
+		},
+		{
+			name: "sh(multi) descriptor",
+			args: args{
+				xpub:    "sh(multi(1,xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj,xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ))#zvsh9n6p",
+				change:  0,
+				indexes: []uint32{0, 1},
+				parser:  btcMainParser,
+			},
+			want: []string{"3AEVe4VgqAjDM5g59ApWLHrPgmJkX83Ah1", "3Mb2V9tewh3PdgLRtrvNLZwdZGJK7yzBKE"},
+		},
+		{
+			name: "sh(wsh(multi)) descriptor",
+			args: args{
+				xpub:    "sh(wsh(multi(1,xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj,xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ)))#zs0k7pws",
+				change:  0,
+				indexes: []uint32{0, 1},
+				parser:  btcMainParser,
+			},
+			want: []string{"3BEjGrscCuowRP4LFDbXiseaLLqXrRwCuv", "381rLAF1cQFyb6s6xrEhMxAZqkEB4286qt"},
+		},
+		{
+			name: "multi descriptor with too many required signatures",
+			args: args{
+				xpub:    "wsh(multi(3,xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj,xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ))",
+				change:  0,
+				indexes: []uint32{0},
+				parser:  btcMainParser,
+			},
+			wantErr: true,
+		},
+		{
+			name: "descriptor with hardened derivation",
+			args: args{
+				xpub:    "wpkh(xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj/0h/*)",
+				change:  0,
+				indexes: []uint32{0},
+				parser:  btcMainParser,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -567,6 +750,39 @@ func TestDeriveAddressDescriptorsFromTo(t *testing.T) {
 			},
 			want: []string{"2N4Q5FhU2497BryFfUgbqkAJE87aKHUhXMp", "2Mt7P2BAfE922zmfXrdcYTLyR7GUvbwSEns", "2N6aUMgQk8y1zvoq6FeWFyotyj75WY9BGsu", "2NA7tbZWM9BcRwBuebKSQe2xbhhF1paJwBM", "2N8RZMzvrUUnpLmvACX9ysmJ2MX3GK5jcQM", "2MvUUSiQZDSqyeSdofKX9KrSCio1nANPDTe", "2NBXaWu1HazjoUVgrXgcKNoBLhtkkD9Gmet", "2N791Ttf89tMVw2maj86E1Y3VgxD9Mc7PU7", "2NCJmwEq8GJm8t8GWWyBXAfpw7F2qZEVP5Y", "2NEgW71hWKer2XCSA8ZCC2VnWpB77L6bk68"},
 		},
+		{
+			name: "m/86'/0'/0' change",
+			args: args{
+				xpub:      "tr(xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ)",
+				change:    1,
+				fromIndex: 0,
+				toIndex:   1,
+				parser:    btcMainParser,
+			},
+			want: []string{"bc1p3qkhfews2uk44qtvauqyr2ttdsw7svhkl9nkm9s9c3x4ax5h60wqwruhk7"},
+		},
+		{
+			name: "wsh(sortedmulti) descriptor",
+			args: args{
+				xpub:      "wsh(sortedmulti(1,[d34db33f/48h/0h/0h/2h]xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj/<0;1>/*,xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/0/*))#2jpunfmn",
+				change:    0,
+				fromIndex: 0,
+				toIndex:   2,
+				parser:    btcMainParser,
+			},
+			want: []string{"bc1qluwx3a8sh2mnucvn48490m9j6mc62x4ru3pj25t6yt7klcl9gpzqqqm5k9", "bc1qv56k8j8k57xjf47jfdd7y2q7xkghtg8zncwgh6r0ncp89h86yaeqe4t5ep"},
+		},
+		{
+			name: "wsh(sortedmulti) descriptor change",
+			args: args{
+				xpub:      "wsh(sortedmulti(1,[d34db33f/48h/0h/0h/2h]xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj/<0;1>/*,xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/0/*))#2jpunfmn",
+				change:    1,
+				fromIndex: 0,
+				toIndex:   1,
+				parser:    btcMainParser,
+			},
+			want: []string{"bc1qgkdy4pupdf7m8zwed9rg9tehjdljfp6nsmzemcetywsaskhh4q6sanqnt0"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -666,6 +882,30 @@ func TestBitcoinParser_DerivationBasePath(t *testing.T) {
 			},
 			want: "m/44'/133'/12'",
 		},
+		{
+			name: "m/86'/0'/0'",
+			args: args{
+				xpub:   "tr(xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ)",
+				parser: btcMainParser,
+			},
+			want: "m/86'/0'/0'",
+		},
+		{
+			name: "m/48'/0'/0'/2' from key origin",
+			args: args{
+				xpub:   "wsh(sortedmulti(1,[d34db33f/48h/0h/0h/2h]xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj/<0;1>/*,xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/0/*))",
+				parser: btcMainParser,
+			},
+			want: "m/48'/0'/0'/2'",
+		},
+		{
+			name: "multisig without key origin",
+			args: args{
+				xpub:   "sh(multi(1,xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj,xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ))",
+				parser: btcMainParser,
+			},
+			want: "unknown/0'",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -680,3 +920,36 @@ func TestBitcoinParser_DerivationBasePath(t *testing.T) {
 		})
 	}
 }
+
+func Test_descriptorChecksum(t *testing.T) {
+	tests := []struct {
+		descriptor string
+		want       string
+		wantErr    bool
+	}{
+		{
+			descriptor: "raw(deadbeef)",
+			want:       "89f8spxm",
+		},
+		{
+			descriptor: "tr(xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ)",
+			want:       "9uqpxtcg",
+		},
+		{
+			descriptor: "raw(deadbeef)é",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.descriptor, func(t *testing.T) {
+			got, err := descriptorChecksum(tt.descriptor)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("descriptorChecksum() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("descriptorChecksum() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -12,10 +12,12 @@ import (
 	"net"
 	"net/http"
 	"runtime/debug"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/juju/errors"
+	"github.com/martinboehm/btcd/chaincfg/chainhash"
 	"github.com/martinboehm/btcd/wire"
 )
 
@@ -23,40 +25,47 @@ import (
 type BitcoinRPC struct {
 	*bchain.BaseChain
 	client       http.Client
-	rpcURL       string
+	pool         *bchain.RPCPool
 	user         string
 	password     string
 	Mempool      *bchain.MempoolBitcoinType
 	ParseBlocks  bool
 	pushHandler  func(bchain.NotificationType)
 	mq           *bchain.MQ
+	p2p          *bchain.P2P
 	ChainConfig  *Configuration
 	RPCMarshaler RPCMarshaler
+	rawBlocks    map[string][]byte
+	rawBlocksMux sync.Mutex
 }
 
 // Configuration represents json config file
 type Configuration struct {
-	CoinName                     string `json:"coin_name"`
-	CoinShortcut                 string `json:"coin_shortcut"`
-	RPCURL                       string `json:"rpc_url"`
-	RPCUser                      string `json:"rpc_user"`
-	RPCPass                      string `json:"rpc_pass"`
-	RPCTimeout                   int    `json:"rpc_timeout"`
-	Parse                        bool   `json:"parse"`
-	MessageQueueBinding          string `json:"message_queue_binding"`
-	Subversion                   string `json:"subversion"`
-	BlockAddressesToKeep         int    `json:"block_addresses_to_keep"`
-	MempoolWorkers               int    `json:"mempool_workers"`
-	MempoolSubWorkers            int    `json:"mempool_sub_workers"`
-	AddressFormat                string `json:"address_format"`
-	SupportsEstimateFee          bool   `json:"supports_estimate_fee"`
-	SupportsEstimateSmartFee     bool   `json:"supports_estimate_smart_fee"`
-	XPubMagic                    uint32 `json:"xpub_magic,omitempty"`
-	XPubMagicSegwitP2sh          uint32 `json:"xpub_magic_segwit_p2sh,omitempty"`
-	XPubMagicSegwitNative        uint32 `json:"xpub_magic_segwit_native,omitempty"`
-	Slip44                       uint32 `json:"slip44,omitempty"`
-	AlternativeEstimateFee       string `json:"alternativeEstimateFee,omitempty"`
-	AlternativeEstimateFeeParams string `json:"alternativeEstimateFeeParams,omitempty"`
+	CoinName                     string   `json:"coin_name"`
+	CoinShortcut                 string   `json:"coin_shortcut"`
+	RPCURL                       string   `json:"rpc_url"`
+	RPCURLs                      []string `json:"rpc_urls,omitempty"`
+	RPCUser                      string   `json:"rpc_user"`
+	RPCPass                      string   `json:"rpc_pass"`
+	RPCTimeout                   int      `json:"rpc_timeout"`
+	RPCBatchSize                 int      `json:"rpc_batch_size,omitempty"`
+	Parse                        bool     `json:"parse"`
+	MessageQueueBinding          string   `json:"message_queue_binding"`
+	MessageQueueRaw              bool     `json:"message_queue_raw,omitempty"`
+	P2PAddress                   string   `json:"p2p_address,omitempty"`
+	Subversion                   string   `json:"subversion"`
+	BlockAddressesToKeep         int      `json:"block_addresses_to_keep"`
+	MempoolWorkers               int      `json:"mempool_workers"`
+	MempoolSubWorkers            int      `json:"mempool_sub_workers"`
+	AddressFormat                string   `json:"address_format"`
+	SupportsEstimateFee          bool     `json:"supports_estimate_fee"`
+	SupportsEstimateSmartFee     bool     `json:"supports_estimate_smart_fee"`
+	XPubMagic                    uint32   `json:"xpub_magic,omitempty"`
+	XPubMagicSegwitP2sh          uint32   `json:"xpub_magic_segwit_p2sh,omitempty"`
+	XPubMagicSegwitNative        uint32   `json:"xpub_magic_segwit_native,omitempty"`
+	Slip44                       uint32   `json:"slip44,omitempty"`
+	AlternativeEstimateFee       string   `json:"alternativeEstimateFee,omitempty"`
+	AlternativeEstimateFeeParams string   `json:"alternativeEstimateFeeParams,omitempty"`
 }
 
 // NewBitcoinRPC returns new BitcoinRPC instance.
@@ -91,22 +100,45 @@ func NewBitcoinRPC(config json.RawMessage, pushHandler func(bchain.NotificationT
 	s := &BitcoinRPC{
 		BaseChain:    &bchain.BaseChain{},
 		client:       http.Client{Timeout: time.Duration(c.RPCTimeout) * time.Second, Transport: transport},
-		rpcURL:       c.RPCURL,
 		user:         c.RPCUser,
 		password:     c.RPCPass,
 		ParseBlocks:  c.Parse,
 		ChainConfig:  &c,
 		pushHandler:  pushHandler,
 		RPCMarshaler: JSONMarshalerV2{},
+		rawBlocks:    make(map[string][]byte),
+	}
+	urls := c.RPCURLs
+	if len(urls) == 0 {
+		urls = []string{c.RPCURL}
+	}
+	s.pool, err = bchain.NewRPCPool(urls, s.getBlockCountAt)
+	if err != nil {
+		return nil, err
 	}
 
 	return s, nil
 }
 
+// RPCPool returns the pool of the backend endpoints
+func (b *BitcoinRPC) RPCPool() *bchain.RPCPool {
+	return b.pool
+}
+
+// RPCBatchSize returns the maximal number of requests sent to the backend in one batch request
+func (b *BitcoinRPC) RPCBatchSize() int {
+	return b.ChainConfig.RPCBatchSize
+}
+
 // Initialize initializes BitcoinRPC instance.
 func (b *BitcoinRPC) Initialize() error {
 	b.ChainConfig.SupportsEstimateFee = false
 
+	if b.pool.Len() > 1 {
+		b.pool.CheckHealth()
+		b.pool.Start(bchain.RPCPoolCheckInterval)
+	}
+
 	ci, err := b.GetChainInfo()
 	if err != nil {
 		return err
@@ -129,6 +161,11 @@ func (b *BitcoinRPC) Initialize() error {
 
 	glog.Info("rpc: block chain ", params.Name)
 
+	if b.ChainConfig.P2PAddress != "" && b.p2p == nil {
+		b.p2p = bchain.NewP2P(b.ChainConfig.P2PAddress, uint32(params.Net), b.client.Timeout)
+		b.p2p.Start()
+	}
+
 	if b.ChainConfig.AlternativeEstimateFee == "whatthefee" {
 		if err = InitWhatTheFee(b, b.ChainConfig.AlternativeEstimateFeeParams); err != nil {
 			glog.Error("InitWhatTheFee error ", err, " Reverting to default estimateFee functionality")
@@ -148,15 +185,24 @@ func (b *BitcoinRPC) CreateMempool(chain bchain.BlockChain) (bchain.Mempool, err
 	return b.Mempool, nil
 }
 
-// InitializeMempool creates ZeroMQ subscription and sets AddrDescForOutpointFunc to the Mempool
+// InitializeMempool creates ZeroMQ subscription, or subscribes the announcements of the p2p connection, and sets AddrDescForOutpointFunc to the Mempool
 func (b *BitcoinRPC) InitializeMempool(addrDescForOutpoint bchain.AddrDescForOutpointFunc, onNewTxAddr bchain.OnNewTxAddrFunc) error {
 	if b.Mempool == nil {
 		return errors.New("Mempool not created")
 	}
 	b.Mempool.AddrDescForOutpoint = addrDescForOutpoint
 	b.Mempool.OnNewTxAddr = onNewTxAddr
+	if b.p2p != nil {
+		// the announcements received over the p2p connection replace the ZeroMQ notifications
+		b.p2p.Subscribe(b.pushHandler, b.onRawNotification)
+		return nil
+	}
 	if b.mq == nil {
-		mq, err := bchain.NewMQ(b.ChainConfig.MessageQueueBinding, b.pushHandler)
+		var rawCallback bchain.OnRawNotificationFunc
+		if b.ChainConfig.MessageQueueRaw {
+			rawCallback = b.onRawNotification
+		}
+		mq, err := bchain.NewMQ(b.ChainConfig.MessageQueueBinding, b.pushHandler, rawCallback)
 		if err != nil {
 			glog.Error("mq: ", err)
 			return err
@@ -166,8 +212,52 @@ func (b *BitcoinRPC) InitializeMempool(addrDescForOutpoint bchain.AddrDescForOut
 	return nil
 }
 
+// maxRawBlocks limits the number of blocks received from the message queue which were not yet used by the sync
+const maxRawBlocks = 16
+
+// onRawNotification stores the blocks and passes the transactions from the message queue to the mempool
+func (b *BitcoinRPC) onRawNotification(nt bchain.NotificationType, payload []byte) {
+	switch nt {
+	case bchain.NotificationNewBlock:
+		b.addRawBlock(payload)
+	case bchain.NotificationNewTx:
+		b.Mempool.AddRawTx(payload)
+	}
+}
+
+// addRawBlock stores the block so that GetBlockRaw does not have to get it from the backend
+// the block is identified by the double sha256 hash of its header, for coins with a different block hash the stored blocks are never used
+func (b *BitcoinRPC) addRawBlock(data []byte) {
+	if len(data) < wire.MaxBlockHeaderPayload {
+		glog.Error("rpc: invalid raw block of length ", len(data))
+		return
+	}
+	hash := chainhash.DoubleHashH(data[:wire.MaxBlockHeaderPayload]).String()
+	b.rawBlocksMux.Lock()
+	defer b.rawBlocksMux.Unlock()
+	// the blocks which were not used are not in the main chain, drop them
+	if len(b.rawBlocks) >= maxRawBlocks {
+		b.rawBlocks = make(map[string][]byte)
+	}
+	b.rawBlocks[hash] = data
+}
+
+func (b *BitcoinRPC) takeRawBlock(hash string) []byte {
+	b.rawBlocksMux.Lock()
+	defer b.rawBlocksMux.Unlock()
+	data, found := b.rawBlocks[hash]
+	if found {
+		delete(b.rawBlocks, hash)
+	}
+	return data
+}
+
 // Shutdown ZeroMQ and other resources
 func (b *BitcoinRPC) Shutdown(ctx context.Context) error {
+	b.pool.Stop()
+	if b.p2p != nil {
+		b.p2p.Close()
+	}
 	if b.mq != nil {
 		if err := b.mq.Shutdown(ctx); err != nil {
 			glog.Error("MQ.Shutdown error: ", err)
@@ -502,6 +592,36 @@ func (b *BitcoinRPC) GetBlockHash(height uint32) (string, error) {
 	return res.Result, nil
 }
 
+// GetBlockHashes returns hashes of blocks in best-block-chain at given heights, using batch requests.
+func (b *BitcoinRPC) GetBlockHashes(heights []uint32) ([]string, error) {
+	glog.V(1).Info("rpc: getblockhash ", len(heights), " heights")
+
+	req := make([]interface{}, len(heights))
+	res := make([]ResGetBlockHash, len(heights))
+	resp := make([]interface{}, len(heights))
+	for i, height := range heights {
+		r := CmdGetBlockHash{Method: "getblockhash"}
+		r.Params.Height = height
+		req[i] = &r
+		resp[i] = &res[i]
+	}
+	err := b.callBatch(b.pool.SyncURLs(), req, resp)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(heights))
+	for i := range res {
+		if res[i].Error != nil {
+			if IsErrBlockNotFound(res[i].Error) {
+				return nil, bchain.ErrBlockNotFound
+			}
+			return nil, errors.Annotatef(res[i].Error, "height %v", heights[i])
+		}
+		hashes[i] = res[i].Result
+	}
+	return hashes, nil
+}
+
 // GetBlockHeader returns header of block with given hash.
 func (b *BitcoinRPC) GetBlockHeader(hash string) (*bchain.BlockHeader, error) {
 	glog.V(1).Info("rpc: getblockheader")
@@ -524,6 +644,33 @@ func (b *BitcoinRPC) GetBlockHeader(hash string) (*bchain.BlockHeader, error) {
 	return &res.Result, nil
 }
 
+// RawBlockHeaders returns true, bitcoind returns the serialized block header by getblockheader
+func (b *BitcoinRPC) RawBlockHeaders() bool {
+	return true
+}
+
+// GetBlockHeaderRaw returns the serialized header of block with given hash.
+func (b *BitcoinRPC) GetBlockHeaderRaw(hash string) ([]byte, error) {
+	glog.V(1).Info("rpc: getblockheader (verbose=false) ", hash)
+
+	res := ResGetBlockRaw{}
+	req := CmdGetBlockHeader{Method: "getblockheader"}
+	req.Params.BlockHash = hash
+	req.Params.Verbose = false
+	err := b.Call(&req, &res)
+
+	if err != nil {
+		return nil, errors.Annotatef(err, "hash %v", hash)
+	}
+	if res.Error != nil {
+		if IsErrBlockNotFound(res.Error) {
+			return nil, bchain.ErrBlockNotFound
+		}
+		return nil, errors.Annotatef(res.Error, "hash %v", hash)
+	}
+	return hex.DecodeString(res.Result)
+}
+
 // GetBlock returns block with given hash.
 func (b *BitcoinRPC) GetBlock(hash string, height uint32) (*bchain.Block, error) {
 	var err error
@@ -538,7 +685,12 @@ func (b *BitcoinRPC) GetBlock(hash string, height uint32) (*bchain.Block, error)
 	}
 	// optimization
 	if height > 0 {
-		return b.GetBlockWithoutHeader(hash, height)
+		block, err := b.GetBlockWithoutHeader(hash, height)
+		if err == nil && b.p2p != nil {
+			// the sync follows the links to the next blocks, they are taken from the block headers received over the p2p connection
+			block.Next = b.p2p.NextBlockHash(hash)
+		}
+		return block, err
 	}
 	header, err := b.GetBlockHeader(hash)
 	if err != nil {
@@ -564,7 +716,12 @@ func (b *BitcoinRPC) GetBlockInfo(hash string) (*bchain.BlockInfo, error) {
 	req := CmdGetBlock{Method: "getblock"}
 	req.Params.BlockHash = hash
 	req.Params.Verbosity = 1
-	err := b.Call(&req, &res)
+	err := b.callRead(&req, &res)
+	if err == nil && res.Error != nil && IsErrBlockNotFound(res.Error) && b.pool.Len() > 1 {
+		// the block can be on a fork not known to the other endpoints, ask the endpoint used by the sync
+		res = ResGetBlockInfo{}
+		err = b.Call(&req, &res)
+	}
 
 	if err != nil {
 		return nil, errors.Annotatef(err, "hash %v", hash)
@@ -578,6 +735,44 @@ func (b *BitcoinRPC) GetBlockInfo(hash string) (*bchain.BlockInfo, error) {
 	return &res.Result, nil
 }
 
+// GetBlockInfos returns extended headers of blocks with given hashes, using batch requests.
+func (b *BitcoinRPC) GetBlockInfos(hashes []string) ([]*bchain.BlockInfo, error) {
+	glog.V(1).Info("rpc: getblock (verbosity=1) ", len(hashes), " blocks")
+
+	req := make([]interface{}, len(hashes))
+	res := make([]ResGetBlockInfo, len(hashes))
+	resp := make([]interface{}, len(hashes))
+	for i, hash := range hashes {
+		r := CmdGetBlock{Method: "getblock"}
+		r.Params.BlockHash = hash
+		r.Params.Verbosity = 1
+		req[i] = &r
+		resp[i] = &res[i]
+	}
+	err := b.callBatch(b.pool.ReadURLs(), req, resp)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*bchain.BlockInfo, len(hashes))
+	for i := range res {
+		if res[i].Error != nil {
+			if IsErrBlockNotFound(res[i].Error) && b.pool.Len() > 1 {
+				// GetBlockInfo asks also the endpoint used by the sync
+				if infos[i], err = b.GetBlockInfo(hashes[i]); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if IsErrBlockNotFound(res[i].Error) {
+				return nil, bchain.ErrBlockNotFound
+			}
+			return nil, errors.Annotatef(res[i].Error, "hash %v", hashes[i])
+		}
+		infos[i] = &res[i].Result
+	}
+	return infos, nil
+}
+
 // GetBlockWithoutHeader is an optimization - it does not call GetBlockHeader to get prev, next hashes
 // instead it sets to header only block hash and height passed in parameters
 func (b *BitcoinRPC) GetBlockWithoutHeader(hash string, height uint32) (*bchain.Block, error) {
@@ -596,6 +791,19 @@ func (b *BitcoinRPC) GetBlockWithoutHeader(hash string, height uint32) (*bchain.
 
 // GetBlockRaw returns block with given hash as bytes
 func (b *BitcoinRPC) GetBlockRaw(hash string) ([]byte, error) {
+	if data := b.takeRawBlock(hash); data != nil {
+		glog.V(1).Info("rpc: block ", hash, " received from message queue")
+		return data, nil
+	}
+	if b.p2p != nil {
+		data, err := b.p2p.GetBlock(hash)
+		if err == nil {
+			return data, nil
+		}
+		if err != bchain.ErrP2PNotConnected {
+			glog.Warning("p2p: getdata block ", hash, " error ", err, ", using rpc")
+		}
+	}
 	glog.V(1).Info("rpc: getblock (verbosity=0) ", hash)
 
 	res := ResGetBlockRaw{}
@@ -707,6 +915,46 @@ func (b *BitcoinRPC) GetTransactionForMempool(txid string) (*bchain.Tx, error) {
 	return tx, nil
 }
 
+// GetTransactionsBatch returns transactions by the transaction IDs in the same form as GetTransactionForMempool,
+// using batch requests. The transactions which are not found are omitted from the result.
+func (b *BitcoinRPC) GetTransactionsBatch(txids []string) (map[string]*bchain.Tx, error) {
+	glog.V(1).Info("rpc: getrawtransaction nonverbose ", len(txids), " txs")
+
+	req := make([]interface{}, len(txids))
+	res := make([]ResGetRawTransactionNonverbose, len(txids))
+	resp := make([]interface{}, len(txids))
+	for i, txid := range txids {
+		r := CmdGetRawTransaction{Method: "getrawtransaction"}
+		r.Params.Txid = txid
+		r.Params.Verbose = false
+		req[i] = &r
+		resp[i] = &res[i]
+	}
+	err := b.callBatch(b.pool.SyncURLs(), req, resp)
+	if err != nil {
+		return nil, err
+	}
+	txs := make(map[string]*bchain.Tx, len(txids))
+	for i := range res {
+		if res[i].Error != nil {
+			if IsMissingTx(res[i].Error) {
+				continue
+			}
+			return nil, errors.Annotatef(res[i].Error, "txid %v", txids[i])
+		}
+		data, err := hex.DecodeString(res[i].Result)
+		if err != nil {
+			return nil, errors.Annotatef(err, "txid %v", txids[i])
+		}
+		tx, err := b.Parser.ParseTx(data)
+		if err != nil {
+			return nil, errors.Annotatef(err, "txid %v", txids[i])
+		}
+		txs[txids[i]] = tx
+	}
+	return txs, nil
+}
+
 // GetTransaction returns a transaction by the transaction ID
 func (b *BitcoinRPC) GetTransaction(txid string) (*bchain.Tx, error) {
 	r, err := b.getRawTransaction(txid)
@@ -737,7 +985,12 @@ func (b *BitcoinRPC) getRawTransaction(txid string) (json.RawMessage, error) {
 	req := CmdGetRawTransaction{Method: "getrawtransaction"}
 	req.Params.Txid = txid
 	req.Params.Verbose = true
-	err := b.Call(&req, &res)
+	err := b.callRead(&req, &res)
+	if err == nil && res.Error != nil && IsMissingTx(res.Error) && b.pool.Len() > 1 {
+		// a mempool transaction may not be propagated to the other endpoints yet, ask the endpoint used by the sync
+		res = ResGetRawTransaction{}
+		err = b.Call(&req, &res)
+	}
 
 	if err != nil {
 		return nil, errors.Annotatef(err, "txid %v", txid)
@@ -768,7 +1021,7 @@ func (b *BitcoinRPC) EstimateSmartFee(blocks int, conservative bool) (big.Int, e
 	} else {
 		req.Params.EstimateMode = "ECONOMICAL"
 	}
-	err := b.Call(&req, &res)
+	err := b.callRead(&req, &res)
 
 	var r big.Int
 	if err != nil {
@@ -796,7 +1049,7 @@ func (b *BitcoinRPC) EstimateFee(blocks int) (big.Int, error) {
 	res := ResEstimateFee{}
 	req := CmdEstimateFee{Method: "estimatefee"}
 	req.Params.Blocks = blocks
-	err := b.Call(&req, &res)
+	err := b.callRead(&req, &res)
 
 	var r big.Int
 	if err != nil {
@@ -878,14 +1131,39 @@ func safeDecodeResponse(body io.ReadCloser, res interface{}) (err error) {
 }
 
 // Call calls Backend RPC interface, using RPCMarshaler interface to marshall the request
+// the request is sent to the endpoint pinned for the synchronization, the other endpoints are tried only if it cannot be reached,
+// which also makes sendrawtransaction fail over to the next endpoint
 func (b *BitcoinRPC) Call(req interface{}, res interface{}) error {
+	return b.callURLs(b.pool.SyncURLs(), req, res)
+}
+
+// callRead calls Backend RPC interface for the requests which do not have to be consistent with the synchronization,
+// the request is sent to the healthy endpoint with the lowest latency
+func (b *BitcoinRPC) callRead(req interface{}, res interface{}) error {
+	return b.callURLs(b.pool.ReadURLs(), req, res)
+}
+
+func (b *BitcoinRPC) callURLs(urls []string, req interface{}, res interface{}) error {
 	httpData, err := b.RPCMarshaler.Marshal(req)
 	if err != nil {
 		return err
 	}
-	httpReq, err := http.NewRequest("POST", b.rpcURL, bytes.NewBuffer(httpData))
+	for _, url := range urls {
+		var unreachable bool
+		unreachable, err = b.callURL(url, httpData, res)
+		if !unreachable {
+			return err
+		}
+		b.pool.ReportFailure(url, err)
+	}
+	return err
+}
+
+// callURL sends the request to the endpoint, unreachable is true if the endpoint did not return a json response
+func (b *BitcoinRPC) callURL(url string, httpData []byte, res interface{}) (bool, error) {
+	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(httpData))
 	if err != nil {
-		return err
+		return false, err
 	}
 	httpReq.SetBasicAuth(b.user, b.password)
 	httpRes, err := b.client.Do(httpReq)
@@ -895,16 +1173,111 @@ func (b *BitcoinRPC) Call(req interface{}, res interface{}) error {
 		defer httpRes.Body.Close()
 	}
 	if err != nil {
-		return err
+		return true, err
 	}
 	// if server returns HTTP error code it might not return json with response
 	// handle both cases
 	if httpRes.StatusCode != 200 {
 		err = safeDecodeResponse(httpRes.Body, &res)
 		if err != nil {
-			return errors.Errorf("%v %v", httpRes.Status, err)
+			return true, errors.Errorf("%v %v", httpRes.Status, err)
 		}
-		return nil
+		return false, nil
+	}
+	return false, safeDecodeResponse(httpRes.Body, &res)
+}
+
+// rpcBatchRequest is a request in the batch request, the responses are matched to the requests by the id
+type rpcBatchRequest struct {
+	ID     int             `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// callBatch sends the requests in batch requests of at most RPCBatchSize requests,
+// the response to the request req[i] is stored to res[i]
+func (b *BitcoinRPC) callBatch(urls []string, req []interface{}, res []interface{}) error {
+	size := b.ChainConfig.RPCBatchSize
+	if size < 1 {
+		size = 1
+	}
+	for from := 0; from < len(req); from += size {
+		to := from + size
+		if to > len(req) {
+			to = len(req)
+		}
+		if err := b.callBatchURLs(urls, req[from:to], res[from:to]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *BitcoinRPC) callBatchURLs(urls []string, req []interface{}, res []interface{}) error {
+	batch := make([]rpcBatchRequest, len(req))
+	for i := range req {
+		// the request is marshalled by RPCMarshaler, the batch request only adds the id to it
+		d, err := b.RPCMarshaler.Marshal(req[i])
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(d, &batch[i]); err != nil {
+			return err
+		}
+		batch[i].ID = i
+	}
+	httpData, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	var responses []json.RawMessage
+	for _, url := range urls {
+		var unreachable bool
+		responses = nil
+		unreachable, err = b.callURL(url, httpData, &responses)
+		if !unreachable {
+			break
+		}
+		b.pool.ReportFailure(url, err)
+	}
+	if err != nil {
+		return err
+	}
+	if len(responses) != len(req) {
+		return errors.Errorf("Batch request returned %v responses, expected %v", len(responses), len(req))
+	}
+	// the backend is not required to return the responses in the order of the requests
+	done := make([]bool, len(req))
+	for _, r := range responses {
+		var id struct {
+			ID *int `json:"id"`
+		}
+		if err = json.Unmarshal(r, &id); err != nil {
+			return err
+		}
+		if id.ID == nil || *id.ID < 0 || *id.ID >= len(req) || done[*id.ID] {
+			return errors.Errorf("Unexpected response in batch request: %v", string(r))
+		}
+		if err = json.Unmarshal(r, res[*id.ID]); err != nil {
+			return err
+		}
+		done[*id.ID] = true
+	}
+	return nil
+}
+
+// getBlockCountAt returns the best height of the endpoint, it is used for the health checks of the endpoints
+func (b *BitcoinRPC) getBlockCountAt(url string) (uint32, error) {
+	res := ResGetBlockCount{}
+	httpData, err := b.RPCMarshaler.Marshal(&CmdGetBlockCount{Method: "getblockcount"})
+	if err != nil {
+		return 0, err
+	}
+	if _, err = b.callURL(url, httpData, &res); err != nil {
+		return 0, err
 	}
-	return safeDecodeResponse(httpRes.Body, &res)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return res.Result, nil
 }
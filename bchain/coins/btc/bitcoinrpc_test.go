@@ -0,0 +1,326 @@
+// +build unittest
+
+package btc
+
+import (
+	"blockbook/bchain"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	genesisBlockHash = "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
+	genesisBlockTxid = "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+	genesisBlockRaw  = "0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a29ab5f49ffff001d1dac2b7c" +
+		"01" +
+		"01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff4d04ffff001d0104455468652054696d65732030332f4a616e2f32303039204368616e63656c6c6f72206f6e206272696e6b206f66207365636f6e64206261696c6f757420666f722062616e6b73ffffffff0100f2052a01000000434104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac00000000"
+)
+
+func TestBitcoinRPC_RawBlocks(t *testing.T) {
+	b := &BitcoinRPC{
+		BaseChain: &bchain.BaseChain{
+			Parser: NewBitcoinParser(GetChainParams("main"), &Configuration{}),
+		},
+		rawBlocks: make(map[string][]byte),
+	}
+	data, err := hex.DecodeString(genesisBlockRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.addRawBlock(data)
+	// too short block is ignored
+	b.addRawBlock(data[:10])
+	if len(b.rawBlocks) != 1 {
+		t.Fatalf("len(rawBlocks) = %v, want 1", len(b.rawBlocks))
+	}
+	// the block is taken from the message queue, there is no backend to get it from
+	block, err := b.GetBlockWithoutHeader(genesisBlockHash, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Hash != genesisBlockHash || len(block.Txs) != 1 || block.Txs[0].Txid != genesisBlockTxid {
+		t.Errorf("GetBlockWithoutHeader() = %+v, want genesis block", block)
+	}
+	if hex.EncodeToString(block.RawHeader) != genesisBlockRaw[:160] {
+		t.Errorf("RawHeader = %x, want %v", block.RawHeader, genesisBlockRaw[:160])
+	}
+	// the block is used only once
+	if d := b.takeRawBlock(genesisBlockHash); d != nil {
+		t.Error("block used twice")
+	}
+	// unused blocks are dropped when the limit is reached
+	for i := 0; i <= maxRawBlocks; i++ {
+		d := append([]byte(nil), data...)
+		d[4] = byte(i)
+		b.addRawBlock(d)
+	}
+	if len(b.rawBlocks) > maxRawBlocks {
+		t.Errorf("len(rawBlocks) = %v, want at most %v", len(b.rawBlocks), maxRawBlocks)
+	}
+}
+
+// testBackend is a stand-in of a bitcoind backend, which answers getblockcount, getblockhash, getblock,
+// getrawtransaction of the genesis transaction and sendrawtransaction, also in batch requests
+type testBackend struct {
+	*httptest.Server
+	height   uint32
+	sendErr  *bchain.RPCError
+	requests int32
+}
+
+type testBackendRequest struct {
+	ID     interface{}     `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// firstParam returns the first of the positional params or the value of the first known named param
+func (req *testBackendRequest) firstParam() json.RawMessage {
+	var positional []json.RawMessage
+	if err := json.Unmarshal(req.Params, &positional); err == nil {
+		if len(positional) > 0 {
+			return positional[0]
+		}
+		return nil
+	}
+	var named map[string]json.RawMessage
+	json.Unmarshal(req.Params, &named)
+	for _, k := range []string{"height", "blockhash", "txid"} {
+		if v, ok := named[k]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+func newTestBackend(height uint32) *testBackend {
+	tb := &testBackend{height: height}
+	tb.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&tb.requests, 1)
+		var body json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(body) > 0 && body[0] == '[' {
+			var reqs []testBackendRequest
+			if err := json.Unmarshal(body, &reqs); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			// the responses are returned in the reverse order, they must be matched by the id
+			res := make([]map[string]interface{}, len(reqs))
+			for i := range reqs {
+				res[len(reqs)-1-i] = tb.handle(&reqs[i])
+			}
+			json.NewEncoder(w).Encode(res)
+			return
+		}
+		var req testBackendRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(tb.handle(&req))
+	}))
+	return tb
+}
+
+func (tb *testBackend) handle(req *testBackendRequest) map[string]interface{} {
+	res := map[string]interface{}{"id": req.ID, "error": nil}
+	var param string
+	var height uint32
+	if p := req.firstParam(); p != nil {
+		if err := json.Unmarshal(p, &param); err != nil {
+			json.Unmarshal(p, &height)
+		}
+	}
+	switch req.Method {
+	case "getblockcount":
+		res["result"] = tb.height
+	case "getblockhash":
+		if height > tb.height {
+			res["error"] = &bchain.RPCError{Code: -8, Message: "Block height out of range"}
+		} else {
+			res["result"] = fmt.Sprintf("hash-of-%d", height)
+		}
+	case "getblock":
+		if _, err := fmt.Sscanf(param, "hash-of-%d", &height); err != nil || height > tb.height {
+			res["error"] = &bchain.RPCError{Code: -5, Message: "Block not found"}
+		} else {
+			res["result"] = map[string]interface{}{"hash": param, "height": height, "tx": []string{fmt.Sprintf("tx-of-%d", height)}}
+		}
+	case "getblockheader":
+		if param != genesisBlockHash {
+			res["error"] = &bchain.RPCError{Code: -5, Message: "Block not found"}
+		} else {
+			res["result"] = genesisBlockRaw[:160]
+		}
+	case "getrawtransaction":
+		if param != genesisBlockTxid {
+			res["error"] = &bchain.RPCError{Code: -5, Message: "No such mempool or blockchain transaction"}
+		} else {
+			res["result"] = genesisBlockRaw[162:]
+		}
+	case "sendrawtransaction":
+		if tb.sendErr != nil {
+			res["error"] = tb.sendErr
+		} else {
+			res["result"] = "txid-of-" + param
+		}
+	default:
+		res["error"] = &bchain.RPCError{Code: -32601, Message: "Method not found"}
+	}
+	return res
+}
+
+func newTestBitcoinRPC(t *testing.T, backends ...*testBackend) *BitcoinRPC {
+	urls := make([]string, len(backends))
+	for i := range backends {
+		urls[i] = backends[i].URL
+	}
+	config, err := json.Marshal(map[string]interface{}{"rpc_urls": urls, "rpc_timeout": 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := NewBitcoinRPC(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc.(*BitcoinRPC)
+}
+
+func TestBitcoinRPC_GetBlockHeaderRaw(t *testing.T) {
+	tb := newTestBackend(10)
+	defer tb.Close()
+	b := newTestBitcoinRPC(t, tb)
+
+	header, err := b.GetBlockHeaderRaw(genesisBlockHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(header) != genesisBlockRaw[:160] {
+		t.Errorf("GetBlockHeaderRaw() = %x, want %v", header, genesisBlockRaw[:160])
+	}
+	if _, err = b.GetBlockHeaderRaw("hash-of-11"); err != bchain.ErrBlockNotFound {
+		t.Errorf("GetBlockHeaderRaw() error = %v, want %v", err, bchain.ErrBlockNotFound)
+	}
+}
+
+func TestBitcoinRPC_Failover(t *testing.T) {
+	b1, b2, b3 := newTestBackend(100), newTestBackend(105), newTestBackend(105)
+	// the servers closed during the test can be closed again safely
+	defer b1.Close()
+	defer b2.Close()
+	defer b3.Close()
+	b := newTestBitcoinRPC(t, b1, b2, b3)
+
+	// before the health check the first endpoint is used
+	h, err := b.GetBestBlockHeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h != 100 {
+		t.Errorf("GetBestBlockHeight() = %v, want 100", h)
+	}
+
+	// the first endpoint is behind, the sync is switched to a synchronized endpoint
+	b.pool.CheckHealth()
+	pinned := b.pool.Pinned()
+	if pinned == b1.URL {
+		t.Fatal("sync still pinned to the endpoint which is behind")
+	}
+	if h, err = b.GetBestBlockHeight(); err != nil {
+		t.Fatal(err)
+	}
+	if h != 105 {
+		t.Errorf("GetBestBlockHeight() = %v, want 105", h)
+	}
+
+	// the pinned endpoint goes down, sendrawtransaction fails over to the next endpoint
+	other := b3
+	if pinned == b3.URL {
+		other = b2
+		b3.Close()
+	} else {
+		b2.Close()
+	}
+	b1.Close()
+	txid, err := b.SendRawTransaction("0102")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txid != "txid-of-0102" {
+		t.Errorf("SendRawTransaction() = %v, want txid-of-0102", txid)
+	}
+	if got := b.pool.Pinned(); got != other.URL {
+		t.Errorf("Pinned() = %v, want %v", got, other.URL)
+	}
+
+	// the transaction rejected by the backend is not sent to the other endpoints
+	other.sendErr = &bchain.RPCError{Code: -26, Message: "txn-mempool-conflict"}
+	requests := atomic.LoadInt32(&other.requests)
+	if _, err = b.SendRawTransaction("0102"); err == nil || err.Error() != "-26: txn-mempool-conflict" {
+		t.Errorf("SendRawTransaction() error = %v, want -26: txn-mempool-conflict", err)
+	}
+	if got := atomic.LoadInt32(&other.requests) - requests; got != 1 {
+		t.Errorf("requests to the endpoint = %v, want 1", got)
+	}
+}
+
+func TestBitcoinRPC_Batch(t *testing.T) {
+	tb := newTestBackend(10)
+	defer tb.Close()
+	b := newTestBitcoinRPC(t, tb)
+	b.Parser = NewBitcoinParser(GetChainParams("main"), b.ChainConfig)
+	b.ChainConfig.RPCBatchSize = 2
+
+	// the requests are split to batches of at most RPCBatchSize requests
+	requests := atomic.LoadInt32(&tb.requests)
+	hashes, err := b.GetBlockHashes([]uint32{0, 1, 2, 3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"hash-of-0", "hash-of-1", "hash-of-2", "hash-of-3", "hash-of-4"}
+	if !reflect.DeepEqual(hashes, want) {
+		t.Errorf("GetBlockHashes() = %v, want %v", hashes, want)
+	}
+	if got := atomic.LoadInt32(&tb.requests) - requests; got != 3 {
+		t.Errorf("requests to the backend = %v, want 3", got)
+	}
+	if _, err = b.GetBlockHashes([]uint32{3, 11}); err != bchain.ErrBlockNotFound {
+		t.Errorf("GetBlockHashes() error = %v, want ErrBlockNotFound", err)
+	}
+
+	infos, err := b.GetBlockInfos([]string{"hash-of-5", "hash-of-6"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Height != 5 || infos[1].Hash != "hash-of-6" || !reflect.DeepEqual(infos[1].Txids, []string{"tx-of-6"}) {
+		t.Errorf("GetBlockInfos() = %+v, want blocks 5 and 6", infos)
+	}
+	if _, err = b.GetBlockInfos([]string{"hash-of-5", "hash-of-11"}); err != bchain.ErrBlockNotFound {
+		t.Errorf("GetBlockInfos() error = %v, want ErrBlockNotFound", err)
+	}
+
+	// the transactions which are not found are omitted
+	txs, err := b.GetTransactionsBatch([]string{"f00d", genesisBlockTxid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 1 || txs[genesisBlockTxid] == nil || txs[genesisBlockTxid].Txid != genesisBlockTxid {
+		t.Errorf("GetTransactionsBatch() = %+v, want the genesis transaction", txs)
+	}
+
+	// the batch requests are marshalled also by the legacy marshaler
+	b.RPCMarshaler = JSONMarshalerV1{}
+	if hashes, err = b.GetBlockHashes([]uint32{7}); err != nil || !reflect.DeepEqual(hashes, []string{"hash-of-7"}) {
+		t.Errorf("GetBlockHashes() = %v %v, want [hash-of-7]", hashes, err)
+	}
+}
@@ -0,0 +1,218 @@
+package btc
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/martinboehm/btcutil/hdkeychain"
+)
+
+type descriptorScriptType int
+
+const (
+	descriptorP2PKH = descriptorScriptType(iota)
+	descriptorP2SHWPKH
+	descriptorP2WPKH
+	descriptorP2TR
+	descriptorP2SHMultisig
+	descriptorP2WSHMultisig
+	descriptorP2SHWSHMultisig
+)
+
+// maxMultisigKeys is the limit of keys of OP_CHECKMULTISIG
+const maxMultisigKeys = 20
+
+// xpubDescriptor is an output descriptor (BIP380) of an account given by extended public keys,
+// the addresses are derived from the keys using the path <change>/<index>
+type xpubDescriptor struct {
+	scriptType   descriptorScriptType
+	keys         []*hdkeychain.ExtendedKey
+	requiredSigs int
+	sortedMulti  bool
+	// originPath is the derivation path of the first key from the key origin info, if it is specified
+	originPath string
+}
+
+const descriptorInputCharset = "0123456789()[],'/*abcdefgh@:$%{}" +
+	"IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~" +
+	"ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+
+var descriptorChecksumGenerator = [5]uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd}
+
+func descriptorPolymod(c uint64, v int) uint64 {
+	c0 := c >> 35
+	c = (c&0x7ffffffff)<<5 ^ uint64(v)
+	for i := 0; i < 5; i++ {
+		if (c0>>uint(i))&1 == 1 {
+			c ^= descriptorChecksumGenerator[i]
+		}
+	}
+	return c
+}
+
+// descriptorChecksum computes the 8 character checksum of the descriptor
+func descriptorChecksum(s string) (string, error) {
+	c := uint64(1)
+	cls := 0
+	clsCount := 0
+	for i := 0; i < len(s); i++ {
+		pos := strings.IndexByte(descriptorInputCharset, s[i])
+		if pos < 0 {
+			return "", errors.Errorf("Invalid character '%c' in descriptor", s[i])
+		}
+		c = descriptorPolymod(c, pos&31)
+		cls = cls*3 + pos>>5
+		clsCount++
+		if clsCount == 3 {
+			c = descriptorPolymod(c, cls)
+			cls = 0
+			clsCount = 0
+		}
+	}
+	if clsCount > 0 {
+		c = descriptorPolymod(c, cls)
+	}
+	for i := 0; i < 8; i++ {
+		c = descriptorPolymod(c, 0)
+	}
+	c ^= 1
+	r := make([]byte, 8)
+	for i := range r {
+		r[i] = bech32Charset[(c>>uint(5*(7-i)))&31]
+	}
+	return string(r), nil
+}
+
+// unwrapDescriptorFunction returns the argument of the descriptor function fn(<argument>)
+func unwrapDescriptorFunction(s string, fn string) (string, bool) {
+	if strings.HasPrefix(s, fn+"(") && strings.HasSuffix(s, ")") {
+		return s[len(fn)+1 : len(s)-1], true
+	}
+	return "", false
+}
+
+// parseXpubDescriptor parses a bare xpub (the script type is derived from its version) or one of the descriptors
+// pkh(KEY), sh(wpkh(KEY)), wpkh(KEY), tr(KEY), sh(multi(k,KEY,...)), wsh(multi(k,KEY,...)), sh(wsh(multi(k,KEY,...))),
+// multi can be replaced by sortedmulti, the descriptor can be followed by #checksum
+func (p *BitcoinParser) parseXpubDescriptor(descriptor string) (*xpubDescriptor, error) {
+	s := descriptor
+	if i := strings.IndexByte(s, '#'); i >= 0 {
+		checksum, err := descriptorChecksum(s[:i])
+		if err != nil {
+			return nil, err
+		}
+		if checksum != s[i+1:] {
+			return nil, errors.New("Invalid descriptor checksum")
+		}
+		s = s[:i]
+	}
+	d := &xpubDescriptor{}
+	var err error
+	if !strings.ContainsAny(s, "()") {
+		extKey, err := hdkeychain.NewKeyFromString(s, p.Params.Base58CksumHasher)
+		if err != nil {
+			return nil, err
+		}
+		if extKey.Version() == p.XPubMagicSegwitP2sh {
+			d.scriptType = descriptorP2SHWPKH
+		} else if extKey.Version() == p.XPubMagicSegwitNative {
+			d.scriptType = descriptorP2WPKH
+		} else {
+			d.scriptType = descriptorP2PKH
+		}
+		d.keys = []*hdkeychain.ExtendedKey{extKey}
+		return d, nil
+	}
+	if inner, ok := unwrapDescriptorFunction(s, "sh"); ok {
+		if key, ok := unwrapDescriptorFunction(inner, "wpkh"); ok {
+			d.scriptType = descriptorP2SHWPKH
+			err = p.addDescriptorKey(d, key)
+		} else if multi, ok := unwrapDescriptorFunction(inner, "wsh"); ok {
+			d.scriptType = descriptorP2SHWSHMultisig
+			err = p.parseDescriptorMultisig(d, multi)
+		} else {
+			d.scriptType = descriptorP2SHMultisig
+			err = p.parseDescriptorMultisig(d, inner)
+		}
+	} else if multi, ok := unwrapDescriptorFunction(s, "wsh"); ok {
+		d.scriptType = descriptorP2WSHMultisig
+		err = p.parseDescriptorMultisig(d, multi)
+	} else if key, ok := unwrapDescriptorFunction(s, "pkh"); ok {
+		d.scriptType = descriptorP2PKH
+		err = p.addDescriptorKey(d, key)
+	} else if key, ok := unwrapDescriptorFunction(s, "wpkh"); ok {
+		d.scriptType = descriptorP2WPKH
+		err = p.addDescriptorKey(d, key)
+	} else if key, ok := unwrapDescriptorFunction(s, "tr"); ok {
+		d.scriptType = descriptorP2TR
+		err = p.addDescriptorKey(d, key)
+	} else {
+		err = errors.New("Unsupported descriptor")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (p *BitcoinParser) parseDescriptorMultisig(d *xpubDescriptor, s string) error {
+	args, ok := unwrapDescriptorFunction(s, "sortedmulti")
+	if ok {
+		d.sortedMulti = true
+	} else if args, ok = unwrapDescriptorFunction(s, "multi"); !ok {
+		return errors.New("Unsupported descriptor")
+	}
+	parts := strings.Split(args, ",")
+	if len(parts) < 2 || len(parts) > maxMultisigKeys+1 {
+		return errors.New("Invalid number of keys in multisig descriptor")
+	}
+	var err error
+	d.requiredSigs, err = strconv.Atoi(parts[0])
+	if err != nil || d.requiredSigs < 1 || d.requiredSigs > len(parts)-1 {
+		return errors.New("Invalid number of required signatures in multisig descriptor")
+	}
+	for _, key := range parts[1:] {
+		if err = p.addDescriptorKey(d, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addDescriptorKey parses the key expression [fingerprint/origin/path]xpub[/<0;1>/*] and adds the key to the descriptor,
+// the derivation suffix /0/* of the receiving addresses is accepted as the account, the change addresses are derived too
+func (p *BitcoinParser) addDescriptorKey(d *xpubDescriptor, s string) error {
+	if strings.HasPrefix(s, "[") {
+		i := strings.IndexByte(s, ']')
+		if i < 0 {
+			return errors.New("Invalid key origin in descriptor")
+		}
+		origin := strings.Split(s[1:i], "/")
+		if fp, err := hex.DecodeString(origin[0]); err != nil || len(fp) != 4 {
+			return errors.New("Invalid key origin fingerprint in descriptor")
+		}
+		if len(d.keys) == 0 && len(origin) > 1 {
+			d.originPath = "m/" + strings.Replace(strings.Join(origin[1:], "/"), "h", "'", -1)
+		}
+		s = s[i+1:]
+	}
+	if strings.HasSuffix(s, "/<0;1>/*") {
+		s = s[:len(s)-len("/<0;1>/*")]
+	} else if strings.HasSuffix(s, "/0/*") {
+		s = s[:len(s)-len("/0/*")]
+	}
+	if strings.ContainsAny(s, "/*") {
+		return errors.New("Unsupported derivation path in descriptor, expecting <xpub>/<0;1>/*")
+	}
+	extKey, err := hdkeychain.NewKeyFromString(s, p.Params.Base58CksumHasher)
+	if err != nil {
+		return err
+	}
+	if extKey.IsPrivate() {
+		return errors.New("Private keys are not supported in descriptor")
+	}
+	d.keys = append(d.keys, extKey)
+	return nil
+}
@@ -0,0 +1,48 @@
+package btc
+
+import (
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/juju/errors"
+	"github.com/martinboehm/btcd/btcec"
+)
+
+// taggedHash computes BIP340 hash SHA256(SHA256(tag) || SHA256(tag) || msg)
+func taggedHash(tag string, msg []byte) []byte {
+	th := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(th[:])
+	h.Write(th[:])
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+func pad32(i *big.Int) []byte {
+	b := i.Bytes()
+	r := make([]byte, 32)
+	copy(r[32-len(b):], b)
+	return r
+}
+
+// taprootOutputKey returns x-only output key of the P2TR output spendable by the internal key pubKey
+// using only the key path, i.e. without a script tree (BIP86)
+func taprootOutputKey(pubKey *btcec.PublicKey) ([]byte, error) {
+	curve := btcec.S256()
+	params := curve.Params()
+	x, y := pubKey.X, pubKey.Y
+	// the x-only internal key stands for the point with even y
+	if y.Bit(0) == 1 {
+		y = new(big.Int).Sub(params.P, y)
+	}
+	t := taggedHash("TapTweak", pad32(x))
+	if new(big.Int).SetBytes(t).Cmp(params.N) >= 0 {
+		return nil, errors.New("Invalid taproot tweak")
+	}
+	tx, ty := curve.ScalarBaseMult(t)
+	qx, qy := curve.Add(x, y, tx, ty)
+	if qx.Sign() == 0 && qy.Sign() == 0 {
+		return nil, errors.New("Invalid taproot output key")
+	}
+	return pad32(qx), nil
+}
@@ -93,6 +93,7 @@ func (p *BGoldParser) ParseBlock(b []byte) (*bchain.Block, error) {
 	}
 
 	w := wire.MsgBlock{}
+	rawHeader := utils.RawHeader(b, r)
 	err = utils.DecodeTransactions(r, 0, wire.WitnessEncoding, &w)
 	if err != nil {
 		return nil, err
@@ -108,7 +109,8 @@ func (p *BGoldParser) ParseBlock(b []byte) (*bchain.Block, error) {
 			Size: len(b),
 			Time: time,
 		},
-		Txs: txs,
+		Txs:       txs,
+		RawHeader: rawHeader,
 	}, nil
 }
 
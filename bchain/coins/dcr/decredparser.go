@@ -92,6 +92,7 @@ func (p *DecredParser) ParseBlock(b []byte) (*bchain.Block, error) {
 	}
 
 	var w wire.MsgBlock
+	rawHeader := utils.RawHeader(b, r)
 	if err := utils.DecodeTransactions(r, 0, wire.WitnessEncoding, &w); err != nil {
 		return nil, err
 	}
@@ -106,7 +107,8 @@ func (p *DecredParser) ParseBlock(b []byte) (*bchain.Block, error) {
 			Size: len(b),
 			Time: h.Timestamp.Unix(),
 		},
-		Txs: txs,
+		Txs:       txs,
+		RawHeader: rawHeader,
 	}, nil
 }
 
@@ -461,6 +461,11 @@ func (d *DecredRPC) getBlockHashByHeight(height uint32) (*GetBlockHashResult, er
 	return &blockHashResult, nil
 }
 
+// RawBlockHeaders returns false, the serialized block headers are not read from dcrd
+func (d *DecredRPC) RawBlockHeaders() bool {
+	return false
+}
+
 // GetBlockHeader returns the block header of the block the provided block hash.
 func (d *DecredRPC) GetBlockHeader(hash string) (*bchain.BlockHeader, error) {
 	blockHeaderRequest := GenericCmd{
@@ -2,7 +2,7 @@ package eth
 
 import (
 	"blockbook/bchain"
-	"context"
+	"container/list"
 	"encoding/hex"
 	"math/big"
 	"strings"
@@ -36,9 +36,62 @@ const erc20NameSignature = "0x06fdde03"
 const erc20SymbolSignature = "0x95d89b41"
 const erc20DecimalsSignature = "0x313ce567"
 const erc20BalanceOf = "0x70a08231"
+const erc1155TransferSingleEventSignature = "0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62"
+const erc1155TransferBatchEventSignature = "0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb"
 
-var cachedContracts = make(map[string]*bchain.Erc20Contract)
-var cachedContractsMux sync.Mutex
+// maxCachedContracts is the maximum number of addresses in the cache of the contract infos,
+// the cache contains also the addresses which are not contracts, therefore it must be bounded
+const maxCachedContracts = 100000
+
+var cachedContracts = newContractCache(maxCachedContracts)
+
+type contractCacheEntry struct {
+	key      string
+	contract *bchain.Erc20Contract
+}
+
+// contractCache is a LRU cache of the contract infos, nil contract info means that the address is not a contract
+type contractCache struct {
+	mux     sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+func newContractCache(size int) *contractCache {
+	return &contractCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (c *contractCache) get(key string) (*bchain.Erc20Contract, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	e, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*contractCacheEntry).contract, true
+}
+
+func (c *contractCache) put(key string, contract *bchain.Erc20Contract) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if e, found := c.entries[key]; found {
+		e.Value.(*contractCacheEntry).contract = contract
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&contractCacheEntry{key: key, contract: contract})
+	if c.lru.Len() > c.size {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.entries, e.Value.(*contractCacheEntry).key)
+	}
+}
 
 func addressFromPaddedHex(s string) (string, error) {
 	var t big.Int
@@ -55,30 +108,127 @@ func addressFromPaddedHex(s string) (string, error) {
 	return a.String(), nil
 }
 
+// parseUint256Array returns the uint256[] array of the abi encoded data, offset is the position of the array in data in bytes
+func parseUint256Array(data string, offset int) ([]big.Int, error) {
+	if offset < 0 || offset > len(data)/2-32 {
+		return nil, errors.New("Data is too short")
+	}
+	data = data[2*offset:]
+	var l big.Int
+	if _, ok := l.SetString(data[:64], 16); !ok || !l.IsInt64() {
+		return nil, errors.New("Invalid array length")
+	}
+	n := l.Int64()
+	if n < 0 || n > int64(len(data)-64)/64 {
+		return nil, errors.New("Data is too short")
+	}
+	r := make([]big.Int, n)
+	for i := range r {
+		if _, ok := r[i].SetString(data[64+i*64:128+i*64], 16); !ok {
+			return nil, errors.New("Data is not a number")
+		}
+	}
+	return r, nil
+}
+
+// erc1155GetIDValuesFromLog returns ids and values of ERC1155 TransferSingle or TransferBatch event
+func erc1155GetIDValuesFromLog(l *rpcLog) ([]bchain.TokenIDValue, error) {
+	data := l.Data
+	if has0xPrefix(data) {
+		data = data[2:]
+	}
+	if l.Topics[0] == erc1155TransferSingleEventSignature {
+		if len(data) != 128 {
+			return nil, errors.New("Invalid TransferSingle data")
+		}
+		var idValue bchain.TokenIDValue
+		_, ok := idValue.ID.SetString(data[:64], 16)
+		if ok {
+			_, ok = idValue.Value.SetString(data[64:], 16)
+		}
+		if !ok {
+			return nil, errors.New("Data is not a number")
+		}
+		return []bchain.TokenIDValue{idValue}, nil
+	}
+	// TransferBatch data contain offsets of the arrays of ids and values followed by the arrays
+	if len(data) < 128 {
+		return nil, errors.New("Invalid TransferBatch data")
+	}
+	var idsOffset, valuesOffset big.Int
+	_, ok := idsOffset.SetString(data[:64], 16)
+	if ok {
+		_, ok = valuesOffset.SetString(data[64:128], 16)
+	}
+	if !ok || !idsOffset.IsInt64() || !valuesOffset.IsInt64() {
+		return nil, errors.New("Invalid TransferBatch data")
+	}
+	ids, err := parseUint256Array(data, int(idsOffset.Int64()))
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseUint256Array(data, int(valuesOffset.Int64()))
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) != len(values) {
+		return nil, errors.New("Different number of ids and values in TransferBatch")
+	}
+	r := make([]bchain.TokenIDValue, len(ids))
+	for i := range r {
+		r[i].ID = ids[i]
+		r[i].Value = values[i]
+	}
+	return r, nil
+}
+
 func erc20GetTransfersFromLog(logs []*rpcLog) ([]bchain.Erc20Transfer, error) {
 	var r []bchain.Erc20Transfer
 	for _, l := range logs {
+		var t bchain.Erc20Transfer
+		var fromTopic, toTopic string
 		if len(l.Topics) == 3 && l.Topics[0] == erc20TransferEventSignature {
-			var t big.Int
-			_, ok := t.SetString(l.Data, 0)
+			// ERC20 Transfer event has the amount of tokens in data
+			_, ok := t.Tokens.SetString(l.Data, 0)
 			if !ok {
 				return nil, errors.New("Data is not a number")
 			}
-			from, err := addressFromPaddedHex(l.Topics[1])
-			if err != nil {
-				return nil, err
+			t.Type = bchain.ERC20TokenType
+			fromTopic, toTopic = l.Topics[1], l.Topics[2]
+		} else if len(l.Topics) == 4 && l.Topics[0] == erc20TransferEventSignature {
+			// ERC721 Transfer event has the same signature as ERC20 but the token id is indexed
+			var id big.Int
+			_, ok := id.SetString(l.Topics[3], 0)
+			if !ok {
+				return nil, errors.New("TokenId is not a number")
 			}
-			to, err := addressFromPaddedHex(l.Topics[2])
+			t.Type = bchain.ERC721TokenType
+			t.IDValues = []bchain.TokenIDValue{{ID: id, Value: *big.NewInt(1)}}
+			fromTopic, toTopic = l.Topics[1], l.Topics[2]
+		} else if len(l.Topics) == 4 && (l.Topics[0] == erc1155TransferSingleEventSignature || l.Topics[0] == erc1155TransferBatchEventSignature) {
+			// ERC1155 events have operator, from and to indexed, ids and values in data
+			idValues, err := erc1155GetIDValuesFromLog(l)
 			if err != nil {
 				return nil, err
 			}
-			r = append(r, bchain.Erc20Transfer{
-				Contract: strings.ToLower(l.Address),
-				From:     strings.ToLower(from),
-				To:       strings.ToLower(to),
-				Tokens:   t,
-			})
+			t.Type = bchain.ERC1155TokenType
+			t.IDValues = idValues
+			fromTopic, toTopic = l.Topics[2], l.Topics[3]
+		} else {
+			continue
+		}
+		from, err := addressFromPaddedHex(fromTopic)
+		if err != nil {
+			return nil, err
+		}
+		to, err := addressFromPaddedHex(toTopic)
+		if err != nil {
+			return nil, err
 		}
+		t.Contract = strings.ToLower(l.Address)
+		t.From = strings.ToLower(from)
+		t.To = strings.ToLower(to)
+		r = append(r, t)
 	}
 	return r, nil
 }
@@ -106,10 +256,8 @@ func erc20GetTransfersFromTx(tx *rpcTransaction) ([]bchain.Erc20Transfer, error)
 }
 
 func (b *EthereumRPC) ethCall(data, to string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
-	defer cancel()
 	var r string
-	err := b.rpc.CallContext(ctx, &r, "eth_call", map[string]interface{}{
+	err := b.callReadContext(&r, "eth_call", map[string]interface{}{
 		"data": data,
 		"to":   to,
 	}, "latest")
@@ -161,9 +309,7 @@ func parseErc20StringProperty(contractDesc bchain.AddressDescriptor, data string
 // EthereumTypeGetErc20ContractInfo returns information about ERC20 contract
 func (b *EthereumRPC) EthereumTypeGetErc20ContractInfo(contractDesc bchain.AddressDescriptor) (*bchain.Erc20Contract, error) {
 	cds := string(contractDesc)
-	cachedContractsMux.Lock()
-	contract, found := cachedContracts[cds]
-	cachedContractsMux.Unlock()
+	contract, found := cachedContracts.get(cds)
 	if !found {
 		address := hexutil.Encode(contractDesc)
 		data, err := b.ethCall(erc20NameSignature, address)
@@ -195,9 +341,7 @@ func (b *EthereumRPC) EthereumTypeGetErc20ContractInfo(contractDesc bchain.Addre
 		} else {
 			contract = nil
 		}
-		cachedContractsMux.Lock()
-		cachedContracts[cds] = contract
-		cachedContractsMux.Unlock()
+		cachedContracts.put(cds, contract)
 	}
 	return contract, nil
 }
@@ -96,6 +96,97 @@ func TestErc20_erc20GetTransfersFromLog(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "ERC721 Transfer",
+			args: []*rpcLog{
+				{
+					Address: "0x06012c8cf97bead5deae237070f9587f8e7a266d",
+					Topics: []string{
+						"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef",
+						"0x0000000000000000000000006f44cceb49b4a5812d54b6f494fc2febf25511ed",
+						"0x0000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d",
+						"0x00000000000000000000000000000000000000000000000000000000000e3a9b",
+					},
+					Data: "0x",
+				},
+			},
+			want: []bchain.Erc20Transfer{
+				{
+					Type:     bchain.ERC721TokenType,
+					Contract: "0x06012c8cf97bead5deae237070f9587f8e7a266d",
+					From:     "0x6f44cceb49b4a5812d54b6f494fc2febf25511ed",
+					To:       "0x4bda106325c335df99eab7fe363cac8a0ba2a24d",
+					IDValues: []bchain.TokenIDValue{{ID: *big.NewInt(0xe3a9b), Value: *big.NewInt(1)}},
+				},
+			},
+		},
+		{
+			name: "ERC1155 TransferSingle and TransferBatch",
+			args: []*rpcLog{
+				{
+					Address: "0x495f947276749ce646f68ac8c248420045cb7b5e",
+					Topics: []string{
+						"0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62",
+						"0x0000000000000000000000007b62eb7fe80350dc7ec945c0b73242cb9877fb1b",
+						"0x0000000000000000000000006f44cceb49b4a5812d54b6f494fc2febf25511ed",
+						"0x0000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d",
+					},
+					Data: "0x000000000000000000000000000000000000000000000000000000000000002a0000000000000000000000000000000000000000000000000000000000000005",
+				},
+				{
+					Address: "0x495f947276749ce646f68ac8c248420045cb7b5e",
+					Topics: []string{
+						"0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb",
+						"0x0000000000000000000000007b62eb7fe80350dc7ec945c0b73242cb9877fb1b",
+						"0x0000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d",
+						"0x0000000000000000000000000000000000000000000000000000000000000000",
+					},
+					Data: "0x0000000000000000000000000000000000000000000000000000000000000040" +
+						"00000000000000000000000000000000000000000000000000000000000000a0" +
+						"0000000000000000000000000000000000000000000000000000000000000002" +
+						"000000000000000000000000000000000000000000000000000000000000002a" +
+						"0000000000000000000000000000000000000000000000000000000000000100" +
+						"0000000000000000000000000000000000000000000000000000000000000002" +
+						"0000000000000000000000000000000000000000000000000000000000000001" +
+						"0000000000000000000000000000000000000000000000000000000000000003",
+				},
+			},
+			want: []bchain.Erc20Transfer{
+				{
+					Type:     bchain.ERC1155TokenType,
+					Contract: "0x495f947276749ce646f68ac8c248420045cb7b5e",
+					From:     "0x6f44cceb49b4a5812d54b6f494fc2febf25511ed",
+					To:       "0x4bda106325c335df99eab7fe363cac8a0ba2a24d",
+					IDValues: []bchain.TokenIDValue{{ID: *big.NewInt(0x2a), Value: *big.NewInt(5)}},
+				},
+				{
+					Type:     bchain.ERC1155TokenType,
+					Contract: "0x495f947276749ce646f68ac8c248420045cb7b5e",
+					From:     "0x4bda106325c335df99eab7fe363cac8a0ba2a24d",
+					To:       "0x0000000000000000000000000000000000000000",
+					IDValues: []bchain.TokenIDValue{{ID: *big.NewInt(0x2a), Value: *big.NewInt(1)}, {ID: *big.NewInt(0x100), Value: *big.NewInt(3)}},
+				},
+			},
+		},
+		{
+			name: "ERC1155 TransferBatch with invalid data",
+			args: []*rpcLog{
+				{
+					Address: "0x495f947276749ce646f68ac8c248420045cb7b5e",
+					Topics: []string{
+						"0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb",
+						"0x0000000000000000000000007b62eb7fe80350dc7ec945c0b73242cb9877fb1b",
+						"0x0000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d",
+						"0x0000000000000000000000000000000000000000000000000000000000000000",
+					},
+					Data: "0x0000000000000000000000000000000000000000000000000000000000000040" +
+						"00000000000000000000000000000000000000000000000000000000000000a0" +
+						"0000000000000000000000000000000000000000000000000000000000000002" +
+						"000000000000000000000000000000000000000000000000000000000000002a",
+				},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -181,3 +272,27 @@ func TestErc20_erc20GetTransfersFromTx(t *testing.T) {
 		})
 	}
 }
+
+func TestErc20_contractCache(t *testing.T) {
+	c := newContractCache(2)
+	contract := &bchain.Erc20Contract{Contract: "0x1", Name: "Token"}
+	c.put("0x1", contract)
+	c.put("0x2", nil)
+	if got, found := c.get("0x1"); !found || got != contract {
+		t.Errorf("get(0x1) = %v %v, want %v true", got, found, contract)
+	}
+	// 0x2 is the least recently used address
+	c.put("0x3", nil)
+	if got, found := c.get("0x2"); found {
+		t.Errorf("get(0x2) = %v %v, want evicted", got, found)
+	}
+	if got, found := c.get("0x3"); !found || got != nil {
+		t.Errorf("get(0x3) = %v %v, want nil true", got, found)
+	}
+	if got, found := c.get("0x1"); !found || got != contract {
+		t.Errorf("get(0x1) = %v %v, want %v true", got, found, contract)
+	}
+	if len(c.entries) != 2 || c.lru.Len() != 2 {
+		t.Errorf("cache size %v %v, want 2", len(c.entries), c.lru.Len())
+	}
+}
@@ -81,9 +81,31 @@ type rpcEtcReceipt struct {
 	Logs    []*rpcLog `json:"logs"`
 }
 
+type rpcInternalTransfer struct {
+	Type  bchain.EthereumInternalTransferType `json:"type"`
+	From  string                              `json:"from"`
+	To    string                              `json:"to"`
+	Value string                              `json:"value"`
+}
+
+// rpcCallTrace is the result of the callTracer of debug_traceBlockByHash and debug_traceTransaction
+type rpcCallTrace struct {
+	Type  string         `json:"type"`
+	From  string         `json:"from"`
+	To    string         `json:"to"`
+	Value string         `json:"value"`
+	Error string         `json:"error"`
+	Calls []rpcCallTrace `json:"calls"`
+}
+
+type rpcTraceResult struct {
+	Result rpcCallTrace `json:"result"`
+}
+
 type completeTransaction struct {
-	Tx      *rpcTransaction `json:"tx"`
-	Receipt *rpcReceipt     `json:"receipt,omitempty"`
+	Tx                *rpcTransaction       `json:"tx"`
+	Receipt           *rpcReceipt           `json:"receipt,omitempty"`
+	InternalTransfers []rpcInternalTransfer `json:"internalTransfers,omitempty"`
 }
 
 type rpcBlockTransactions struct {
@@ -101,7 +123,7 @@ func ethNumber(n string) (int64, error) {
 	return 0, errors.Errorf("Not a number: '%v'", n)
 }
 
-func (p *EthereumParser) ethTxToTx(tx *rpcTransaction, receipt *rpcReceipt, blocktime int64, confirmations uint32) (*bchain.Tx, error) {
+func (p *EthereumParser) ethTxToTx(tx *rpcTransaction, receipt *rpcReceipt, internalTransfers []rpcInternalTransfer, blocktime int64, confirmations uint32) (*bchain.Tx, error) {
 	txid := tx.Hash
 	var (
 		fa, ta []string
@@ -114,8 +136,9 @@ func (p *EthereumParser) ethTxToTx(tx *rpcTransaction, receipt *rpcReceipt, bloc
 		ta = []string{tx.To}
 	}
 	ct := completeTransaction{
-		Tx:      tx,
-		Receipt: receipt,
+		Tx:                tx,
+		Receipt:           receipt,
+		InternalTransfers: internalTransfers,
 	}
 	vs, err := hexutil.DecodeBig(tx.Value)
 	if err != nil {
@@ -295,6 +318,23 @@ func (p *EthereumParser) PackTx(tx *bchain.Tx, height uint32, blockTime int64) (
 		}
 		pt.Receipt.Log = ptLogs
 	}
+	if len(r.InternalTransfers) > 0 {
+		pt.InternalTransfers = make([]*ProtoCompleteTransaction_InternalTransferType, len(r.InternalTransfers))
+		for i := range r.InternalTransfers {
+			it := &r.InternalTransfers[i]
+			pit := &ProtoCompleteTransaction_InternalTransferType{Type: uint32(it.Type)}
+			if pit.From, err = hexDecode(it.From); err != nil {
+				return nil, errors.Annotatef(err, "InternalTransfer From %v", it.From)
+			}
+			if pit.To, err = hexDecode(it.To); err != nil {
+				return nil, errors.Annotatef(err, "InternalTransfer To %v", it.To)
+			}
+			if pit.Value, err = hexDecodeBig(it.Value); err != nil {
+				return nil, errors.Annotatef(err, "InternalTransfer Value %v", it.Value)
+			}
+			pt.InternalTransfers[i] = pit
+		}
+	}
 	return proto.Marshal(pt)
 }
 
@@ -340,7 +380,19 @@ func (p *EthereumParser) UnpackTx(buf []byte) (*bchain.Tx, uint32, error) {
 			Logs:    logs,
 		}
 	}
-	tx, err := p.ethTxToTx(&rt, rr, int64(pt.BlockTime), 0)
+	var its []rpcInternalTransfer
+	if len(pt.InternalTransfers) > 0 {
+		its = make([]rpcInternalTransfer, len(pt.InternalTransfers))
+		for i, it := range pt.InternalTransfers {
+			its[i] = rpcInternalTransfer{
+				Type:  bchain.EthereumInternalTransferType(it.Type),
+				From:  hexutil.Encode(it.From),
+				To:    hexutil.Encode(it.To),
+				Value: hexEncodeBig(it.Value),
+			}
+		}
+	}
+	tx, err := p.ethTxToTx(&rt, rr, its, int64(pt.BlockTime), 0)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -416,6 +468,64 @@ func (p *EthereumParser) EthereumTypeGetErc20FromTx(tx *bchain.Tx) ([]bchain.Erc
 	return r, nil
 }
 
+// EthereumTypeGetInternalTransfersFromTx returns ETH transfers done by contract calls inside the transaction
+func (p *EthereumParser) EthereumTypeGetInternalTransfersFromTx(tx *bchain.Tx) ([]bchain.EthereumInternalTransfer, error) {
+	csd, ok := tx.CoinSpecificData.(completeTransaction)
+	if !ok || len(csd.InternalTransfers) == 0 {
+		return nil, nil
+	}
+	r := make([]bchain.EthereumInternalTransfer, len(csd.InternalTransfers))
+	for i := range csd.InternalTransfers {
+		it := &csd.InternalTransfers[i]
+		v, err := hexutil.DecodeBig(it.Value)
+		if err != nil {
+			return nil, errors.Annotatef(err, "InternalTransfer Value %v", it.Value)
+		}
+		r[i] = bchain.EthereumInternalTransfer{
+			Type:  it.Type,
+			From:  it.From,
+			To:    it.To,
+			Value: *v,
+		}
+	}
+	return r, nil
+}
+
+// getInternalTransfers returns the value transfers from the call trace of a transaction
+// the top level call is the transaction itself, it is not returned, the reverted calls are skipped
+func getInternalTransfers(trace *rpcCallTrace) []rpcInternalTransfer {
+	var r []rpcInternalTransfer
+	if trace.Error != "" {
+		return r
+	}
+	var process func(calls []rpcCallTrace)
+	process = func(calls []rpcCallTrace) {
+		for i := range calls {
+			c := &calls[i]
+			if c.Error != "" {
+				continue
+			}
+			value := c.Value
+			if value == "" {
+				value = "0x0"
+			}
+			switch c.Type {
+			case "CALL":
+				if value != "0x0" {
+					r = append(r, rpcInternalTransfer{Type: bchain.InternalTransferTypeCall, From: c.From, To: c.To, Value: value})
+				}
+			case "CREATE", "CREATE2":
+				r = append(r, rpcInternalTransfer{Type: bchain.InternalTransferTypeCreate, From: c.From, To: c.To, Value: value})
+			case "SELFDESTRUCT":
+				r = append(r, rpcInternalTransfer{Type: bchain.InternalTransferTypeSelfDestruct, From: c.From, To: c.To, Value: value})
+			}
+			process(c.Calls)
+		}
+	}
+	process(trace.Calls)
+	return r
+}
+
 const (
 	txStatusUnknown = iota - 2
 	txStatusPending
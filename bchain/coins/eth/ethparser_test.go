@@ -6,6 +6,7 @@ import (
 	"blockbook/bchain"
 	"blockbook/tests/dbtestdata"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"reflect"
@@ -67,7 +68,7 @@ func TestEthParser_GetAddrDescFromAddress(t *testing.T) {
 	}
 }
 
-var testTx1, testTx2 bchain.Tx
+var testTx1, testTx2, testTx5 bchain.Tx
 
 func init() {
 
@@ -155,6 +156,64 @@ func init() {
 			},
 		},
 	}
+
+	testTx5 = bchain.Tx{
+		Blocktime: 1534860545,
+		Time:      1534860545,
+		Txid:      "0x7f1f4e2fa7b6c3a8d5e9c0b1a2f3e4d5c6b7a8f9e0d1c2b3a4f5e6d7c8b9a0f1",
+		Vin: []bchain.Vin{
+			{
+				Addresses: []string{"0x3e3a3d69dc66ba10737f531ed088954a9ec89d97"},
+			},
+		},
+		Vout: []bchain.Vout{
+			{
+				ValueSat: *big.NewInt(0),
+				ScriptPubKey: bchain.ScriptPubKey{
+					Addresses: []string{"0x479cc461fecd078f766ecc58533d6f69580cf3ac"},
+				},
+			},
+		},
+		CoinSpecificData: completeTransaction{
+			Tx: &rpcTransaction{
+				AccountNonce:     "0xb26d",
+				GasPrice:         "0x3b9aca00",
+				GasLimit:         "0x30d40",
+				To:               "0x479cc461fecd078f766ecc58533d6f69580cf3ac",
+				Value:            "0x0",
+				Payload:          "0x3ccfd60b",
+				Hash:             "0x7f1f4e2fa7b6c3a8d5e9c0b1a2f3e4d5c6b7a8f9e0d1c2b3a4f5e6d7c8b9a0f1",
+				BlockNumber:      "0x41eeea",
+				From:             "0x3e3a3d69dc66ba10737f531ed088954a9ec89d97",
+				TransactionIndex: "0x0",
+			},
+			Receipt: &rpcReceipt{
+				GasUsed: "0x9c40",
+				Status:  "0x1",
+				Logs:    []*rpcLog{},
+			},
+			InternalTransfers: []rpcInternalTransfer{
+				{
+					Type:  bchain.InternalTransferTypeCall,
+					From:  "0x479cc461fecd078f766ecc58533d6f69580cf3ac",
+					To:    "0x9f4981531fda132e83c44680787dfa7ee31e4f8d",
+					Value: "0x1bc16d674ec80000",
+				},
+				{
+					Type:  bchain.InternalTransferTypeCall,
+					From:  "0x479cc461fecd078f766ecc58533d6f69580cf3ac",
+					To:    "0x3e3a3d69dc66ba10737f531ed088954a9ec89d97",
+					Value: "0x2386f26fc10000",
+				},
+				{
+					Type:  bchain.InternalTransferTypeSelfDestruct,
+					From:  "0x479cc461fecd078f766ecc58533d6f69580cf3ac",
+					To:    "0x7b62eb7fe80350dc7ec945c0b73242cb9877fb1b",
+					Value: "0x0",
+				},
+			},
+		},
+	}
 }
 
 func TestEthereumParser_PackTx(t *testing.T) {
@@ -188,6 +247,15 @@ func TestEthereumParser_PackTx(t *testing.T) {
 			},
 			want: dbtestdata.EthTx2Packed,
 		},
+		{
+			name: "with internal transfers",
+			args: args{
+				tx:        &testTx5,
+				height:    4321002,
+				blockTime: 1534860545,
+			},
+			want: dbtestdata.EthTx5Packed,
+		},
 	}
 	p := NewEthereumParser(1)
 	for _, tt := range tests {
@@ -229,6 +297,12 @@ func TestEthereumParser_UnpackTx(t *testing.T) {
 			want:  &testTx2,
 			want1: 4321000,
 		},
+		{
+			name:  "with internal transfers",
+			args:  args{hex: dbtestdata.EthTx5Packed},
+			want:  &testTx5,
+			want1: 4321002,
+		},
 	}
 	p := NewEthereumParser(1)
 	for _, tt := range tests {
@@ -259,9 +333,104 @@ func TestEthereumParser_UnpackTx(t *testing.T) {
 			if !reflect.DeepEqual(gs.Receipt, ws.Receipt) {
 				t.Errorf("EthereumParser.UnpackTx() gs.Receipt got = %+v, want %+v", gs.Receipt, ws.Receipt)
 			}
+			if !reflect.DeepEqual(gs.InternalTransfers, ws.InternalTransfers) {
+				t.Errorf("EthereumParser.UnpackTx() gs.InternalTransfers got = %+v, want %+v", gs.InternalTransfers, ws.InternalTransfers)
+			}
 			if got1 != tt.want1 {
 				t.Errorf("EthereumParser.UnpackTx() got1 = %v, want %v", got1, tt.want1)
 			}
 		})
 	}
 }
+
+func TestEthereumParser_EthereumTypeGetInternalTransfersFromTx(t *testing.T) {
+	p := NewEthereumParser(1)
+	got, err := p.EthereumTypeGetInternalTransfersFromTx(&testTx1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("EthereumTypeGetInternalTransfersFromTx() = %+v, want empty", got)
+	}
+	got, err = p.EthereumTypeGetInternalTransfersFromTx(&testTx5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bchain.EthereumInternalTransfer{
+		{
+			Type:  bchain.InternalTransferTypeCall,
+			From:  "0x479cc461fecd078f766ecc58533d6f69580cf3ac",
+			To:    "0x9f4981531fda132e83c44680787dfa7ee31e4f8d",
+			Value: *big.NewInt(2000000000000000000),
+		},
+		{
+			Type:  bchain.InternalTransferTypeCall,
+			From:  "0x479cc461fecd078f766ecc58533d6f69580cf3ac",
+			To:    "0x3e3a3d69dc66ba10737f531ed088954a9ec89d97",
+			Value: *big.NewInt(10000000000000000),
+		},
+		{
+			Type:  bchain.InternalTransferTypeSelfDestruct,
+			From:  "0x479cc461fecd078f766ecc58533d6f69580cf3ac",
+			To:    "0x7b62eb7fe80350dc7ec945c0b73242cb9877fb1b",
+			Value: *big.NewInt(0),
+		},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("EthereumTypeGetInternalTransfersFromTx() = %+v, want %+v", got, want)
+	}
+	for i := range got {
+		if got[i].Type != want[i].Type || got[i].From != want[i].From || got[i].To != want[i].To || got[i].Value.Cmp(&want[i].Value) != 0 {
+			t.Errorf("EthereumTypeGetInternalTransfersFromTx()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func Test_getInternalTransfers(t *testing.T) {
+	tests := []struct {
+		name  string
+		trace string
+		want  []rpcInternalTransfer
+	}{
+		{
+			name:  "no internal calls",
+			trace: `{"type":"CALL","from":"0x3e3a3d69dc66ba10737f531ed088954a9ec89d97","to":"0x555ee11fbddc0e49a9bab358a8941ad95ffdb48f","value":"0x1bc0159d530e6000"}`,
+			want:  nil,
+		},
+		{
+			name: "nested calls",
+			trace: `{"type":"CALL","from":"0x3e3a3d69dc66ba10737f531ed088954a9ec89d97","to":"0x479cc461fecd078f766ecc58533d6f69580cf3ac","value":"0x0","calls":[
+				{"type":"STATICCALL","from":"0x479cc461fecd078f766ecc58533d6f69580cf3ac","to":"0x4af4114f73d1c1c903ac9e0361b379d1291808a2"},
+				{"type":"CALL","from":"0x479cc461fecd078f766ecc58533d6f69580cf3ac","to":"0x4af4114f73d1c1c903ac9e0361b379d1291808a2","value":"0x0"},
+				{"type":"CALL","from":"0x479cc461fecd078f766ecc58533d6f69580cf3ac","to":"0x9f4981531fda132e83c44680787dfa7ee31e4f8d","value":"0x1bc16d674ec80000","calls":[
+					{"type":"CREATE2","from":"0x9f4981531fda132e83c44680787dfa7ee31e4f8d","to":"0x7b62eb7fe80350dc7ec945c0b73242cb9877fb1b","value":"0x0"}
+				]},
+				{"type":"CALL","from":"0x479cc461fecd078f766ecc58533d6f69580cf3ac","to":"0x555ee11fbddc0e49a9bab358a8941ad95ffdb48f","value":"0x1","error":"execution reverted","calls":[
+					{"type":"CALL","from":"0x555ee11fbddc0e49a9bab358a8941ad95ffdb48f","to":"0x20cd153de35d469ba46127a0c8f18626b59a256a","value":"0x1"}
+				]},
+				{"type":"SELFDESTRUCT","from":"0x479cc461fecd078f766ecc58533d6f69580cf3ac","to":"0x3e3a3d69dc66ba10737f531ed088954a9ec89d97"}
+			]}`,
+			want: []rpcInternalTransfer{
+				{Type: bchain.InternalTransferTypeCall, From: "0x479cc461fecd078f766ecc58533d6f69580cf3ac", To: "0x9f4981531fda132e83c44680787dfa7ee31e4f8d", Value: "0x1bc16d674ec80000"},
+				{Type: bchain.InternalTransferTypeCreate, From: "0x9f4981531fda132e83c44680787dfa7ee31e4f8d", To: "0x7b62eb7fe80350dc7ec945c0b73242cb9877fb1b", Value: "0x0"},
+				{Type: bchain.InternalTransferTypeSelfDestruct, From: "0x479cc461fecd078f766ecc58533d6f69580cf3ac", To: "0x3e3a3d69dc66ba10737f531ed088954a9ec89d97", Value: "0x0"},
+			},
+		},
+		{
+			name:  "failed transaction",
+			trace: `{"type":"CALL","from":"0x3e3a3d69dc66ba10737f531ed088954a9ec89d97","to":"0x479cc461fecd078f766ecc58533d6f69580cf3ac","value":"0x0","error":"out of gas","calls":[{"type":"CALL","from":"0x479cc461fecd078f766ecc58533d6f69580cf3ac","to":"0x9f4981531fda132e83c44680787dfa7ee31e4f8d","value":"0x1"}]}`,
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var trace rpcCallTrace
+			if err := json.Unmarshal([]byte(tt.trace), &trace); err != nil {
+				t.Fatal(err)
+			}
+			if got := getInternalTransfers(&trace); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getInternalTransfers() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 	ethereum "github.com/ethereum/go-ethereum"
 	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	ethtypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/rpc"
@@ -31,13 +32,15 @@ const (
 
 // Configuration represents json config file
 type Configuration struct {
-	CoinName                    string `json:"coin_name"`
-	CoinShortcut                string `json:"coin_shortcut"`
-	RPCURL                      string `json:"rpc_url"`
-	RPCTimeout                  int    `json:"rpc_timeout"`
-	BlockAddressesToKeep        int    `json:"block_addresses_to_keep"`
-	MempoolTxTimeoutHours       int    `json:"mempoolTxTimeoutHours"`
-	QueryBackendOnMempoolResync bool   `json:"queryBackendOnMempoolResync"`
+	CoinName                    string   `json:"coin_name"`
+	CoinShortcut                string   `json:"coin_shortcut"`
+	RPCURL                      string   `json:"rpc_url"`
+	RPCURLs                     []string `json:"rpc_urls,omitempty"`
+	RPCTimeout                  int      `json:"rpc_timeout"`
+	BlockAddressesToKeep        int      `json:"block_addresses_to_keep"`
+	MempoolTxTimeoutHours       int      `json:"mempoolTxTimeoutHours"`
+	QueryBackendOnMempoolResync bool     `json:"queryBackendOnMempoolResync"`
+	ProcessInternalTransfers    bool     `json:"processInternalTransfers"`
 }
 
 // EthereumRPC is an interface to JSON-RPC eth service.
@@ -45,6 +48,11 @@ type EthereumRPC struct {
 	*bchain.BaseChain
 	client               *ethclient.Client
 	rpc                  *rpc.Client
+	rpcURL               string
+	rpcMux               sync.RWMutex
+	pool                 *bchain.RPCPool
+	probeClients         map[string]*rpc.Client
+	probeClientsMux      sync.Mutex
 	timeout              time.Duration
 	Parser               *EthereumParser
 	Mempool              *bchain.MempoolEthereumType
@@ -73,22 +81,28 @@ func NewEthereumRPC(config json.RawMessage, pushHandler func(bchain.Notification
 		c.BlockAddressesToKeep = 100
 	}
 
-	rc, ec, err := openRPC(c.RPCURL)
-	if err != nil {
-		return nil, err
-	}
-
 	s := &EthereumRPC{
-		BaseChain:   &bchain.BaseChain{},
-		client:      ec,
-		rpc:         rc,
-		ChainConfig: &c,
+		BaseChain:    &bchain.BaseChain{},
+		ChainConfig:  &c,
+		probeClients: make(map[string]*rpc.Client),
 	}
 
 	// always create parser
 	s.Parser = NewEthereumParser(c.BlockAddressesToKeep)
 	s.timeout = time.Duration(c.RPCTimeout) * time.Second
 
+	urls := c.RPCURLs
+	if len(urls) == 0 {
+		urls = []string{c.RPCURL}
+	}
+	s.pool, err = bchain.NewRPCPool(urls, s.getBlockNumberAt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = s.openPinnedRPC(); err != nil {
+		return nil, err
+	}
+
 	// detect ethereum classic
 	s.isETC = s.ChainConfig.CoinName == "Ethereum Classic"
 
@@ -142,12 +156,140 @@ func openRPC(url string) (*rpc.Client, *ethclient.Client, error) {
 	return rc, ec, nil
 }
 
+// openPinnedRPC connects to the endpoint pinned for the synchronization and returns the previous client
+func (b *EthereumRPC) openPinnedRPC() (*rpc.Client, error) {
+	url := b.pool.Pinned()
+	rc, ec, err := openRPC(url)
+	if err != nil {
+		return nil, err
+	}
+	b.rpcMux.Lock()
+	defer b.rpcMux.Unlock()
+	prev := b.rpc
+	b.rpc = rc
+	b.client = ec
+	b.rpcURL = url
+	return prev, nil
+}
+
+// pinnedRPC returns the clients of the endpoint pinned for the synchronization,
+// the clients are replaced by reconnectRPC and must not be stored
+func (b *EthereumRPC) pinnedRPC() (*rpc.Client, *ethclient.Client, string) {
+	b.rpcMux.RLock()
+	defer b.rpcMux.RUnlock()
+	return b.rpc, b.client, b.rpcURL
+}
+
+// isUnreachable returns true if the error does not come from the backend, i.e. the endpoint could not be reached,
+// the errors returned by the backend and the not found results would be returned by the other endpoints too
+func isUnreachable(err error) bool {
+	cause := errors.Cause(err)
+	switch cause {
+	case nil, ethereum.NotFound, bchain.ErrBlockNotFound, bchain.ErrTxNotFound:
+		return false
+	}
+	_, isRPCError := cause.(rpc.Error)
+	return !isRPCError
+}
+
+// callRead calls f for the requests which do not have to be consistent with the synchronization,
+// f gets the client of the healthy endpoint with the lowest latency, the next endpoint is tried if the endpoint cannot be reached
+func (b *EthereumRPC) callRead(f func(ctx context.Context, c *rpc.Client) error) error {
+	var err error
+	for _, url := range b.pool.ReadURLs() {
+		var c *rpc.Client
+		rc, _, rpcURL := b.pinnedRPC()
+		if url == rpcURL {
+			c = rc
+		} else if c, err = b.probeClient(url); err != nil {
+			b.pool.ReportFailure(url, err)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+		err = f(ctx, c)
+		cancel()
+		if !isUnreachable(err) {
+			return err
+		}
+		b.pool.ReportFailure(url, err)
+	}
+	return err
+}
+
+// callReadContext is callRead of a single request
+func (b *EthereumRPC) callReadContext(result interface{}, method string, args ...interface{}) error {
+	return b.callRead(func(ctx context.Context, c *rpc.Client) error {
+		return c.CallContext(ctx, result, method, args...)
+	})
+}
+
+// RPCPool returns the pool of the backend endpoints
+func (b *EthereumRPC) RPCPool() *bchain.RPCPool {
+	return b.pool
+}
+
+// probeClient returns the client of the endpoint used for the health checks and for the failover of SendRawTransaction
+func (b *EthereumRPC) probeClient(url string) (*rpc.Client, error) {
+	b.probeClientsMux.Lock()
+	defer b.probeClientsMux.Unlock()
+	if c, found := b.probeClients[url]; found {
+		return c, nil
+	}
+	c, err := rpc.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	b.probeClients[url] = c
+	return c, nil
+}
+
+func (b *EthereumRPC) closeProbeClient(url string) {
+	b.probeClientsMux.Lock()
+	defer b.probeClientsMux.Unlock()
+	if c, found := b.probeClients[url]; found {
+		c.Close()
+		delete(b.probeClients, url)
+	}
+}
+
+// getBlockNumberAt returns the best height of the endpoint, it is used for the health checks of the endpoints
+func (b *EthereumRPC) getBlockNumberAt(url string) (uint32, error) {
+	c, err := b.probeClient(url)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	var result string
+	if err = c.CallContext(ctx, &result, "eth_blockNumber"); err != nil {
+		// connect again in the next health check
+		b.closeProbeClient(url)
+		return 0, err
+	}
+	n, err := hexutil.DecodeUint64(result)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(n), nil
+}
+
 // Initialize initializes ethereum rpc interface
 func (b *EthereumRPC) Initialize() error {
+	if b.pool.Len() > 1 {
+		b.pool.CheckHealth()
+		if _, _, rpcURL := b.pinnedRPC(); b.pool.Pinned() != rpcURL {
+			if err := b.reconnectRPC(); err != nil {
+				return err
+			}
+		}
+		b.pool.Start(bchain.RPCPoolCheckInterval)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
 
-	id, err := b.client.NetworkID(ctx)
+	_, ec, _ := b.pinnedRPC()
+	id, err := ec.NetworkID(ctx)
 	if err != nil {
 		return err
 	}
@@ -215,7 +357,8 @@ func (b *EthereumRPC) subscribeEvents() error {
 			b.newBlockSubscription = nil
 			ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 			defer cancel()
-			sub, err := b.rpc.EthSubscribe(ctx, b.chanNewBlock, "newHeads")
+			rc, _, _ := b.pinnedRPC()
+			sub, err := rc.EthSubscribe(ctx, b.chanNewBlock, "newHeads")
 			if err != nil {
 				return nil, errors.Annotatef(err, "EthSubscribe newHeads")
 			}
@@ -232,7 +375,8 @@ func (b *EthereumRPC) subscribeEvents() error {
 		b.newTxSubscription = nil
 		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 		defer cancel()
-		sub, err := b.rpc.EthSubscribe(ctx, b.chanNewTx, "newPendingTransactions")
+		rc, _, _ := b.pinnedRPC()
+		sub, err := rc.EthSubscribe(ctx, b.chanNewTx, "newPendingTransactions")
 		if err != nil {
 			return nil, errors.Annotatef(err, "EthSubscribe newPendingTransactions")
 		}
@@ -286,33 +430,49 @@ func (b *EthereumRPC) subscribe(f func() (*rpc.ClientSubscription, error)) error
 	return nil
 }
 
-func (b *EthereumRPC) closeRPC() {
+func (b *EthereumRPC) unsubscribeEvents() {
 	if b.newBlockSubscription != nil {
 		b.newBlockSubscription.Unsubscribe()
 	}
 	if b.newTxSubscription != nil {
 		b.newTxSubscription.Unsubscribe()
 	}
-	if b.rpc != nil {
-		b.rpc.Close()
+}
+
+func (b *EthereumRPC) closeRPC() {
+	b.unsubscribeEvents()
+	if rc, _, _ := b.pinnedRPC(); rc != nil {
+		rc.Close()
 	}
 }
 
+// reconnectRPC connects to the pinned endpoint, the previous client is closed after it was replaced by the new one
 func (b *EthereumRPC) reconnectRPC() error {
-	glog.Info("Reconnecting RPC")
-	b.closeRPC()
-	rc, ec, err := openRPC(b.ChainConfig.RPCURL)
+	glog.Info("Reconnecting RPC to ", bchain.EndpointName(b.pool.Pinned()))
+	b.unsubscribeEvents()
+	prev, err := b.openPinnedRPC()
 	if err != nil {
 		return err
 	}
-	b.rpc = rc
-	b.client = ec
+	if prev != nil {
+		prev.Close()
+	}
+	// the events are subscribed after the initialization of the mempool
+	if !b.mempoolInitialized {
+		return nil
+	}
 	return b.subscribeEvents()
 }
 
 // Shutdown cleans up rpc interface to ethereum
 func (b *EthereumRPC) Shutdown(ctx context.Context) error {
+	b.pool.Stop()
 	b.closeRPC()
+	b.probeClientsMux.Lock()
+	for _, c := range b.probeClients {
+		c.Close()
+	}
+	b.probeClientsMux.Unlock()
 	close(b.chanNewBlock)
 	glog.Info("rpc: shutdown")
 	return nil
@@ -336,15 +496,16 @@ func (b *EthereumRPC) GetChainInfo() (*bchain.ChainInfo, error) {
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
-	id, err := b.client.NetworkID(ctx)
+	rc, ec, _ := b.pinnedRPC()
+	id, err := ec.NetworkID(ctx)
 	if err != nil {
 		return nil, err
 	}
 	var ver, protocol string
-	if err := b.rpc.CallContext(ctx, &ver, "web3_clientVersion"); err != nil {
+	if err := rc.CallContext(ctx, &ver, "web3_clientVersion"); err != nil {
 		return nil, err
 	}
-	if err := b.rpc.CallContext(ctx, &protocol, "eth_protocolVersion"); err != nil {
+	if err := rc.CallContext(ctx, &protocol, "eth_protocolVersion"); err != nil {
 		return nil, err
 	}
 	rv := &bchain.ChainInfo{
@@ -381,11 +542,20 @@ func (b *EthereumRPC) getBestHeader() (*ethtypes.Header, error) {
 		}
 		b.bestHeader = nil
 	}
+	// the synchronization was switched to another endpoint by the health checks
+	if _, _, rpcURL := b.pinnedRPC(); b.pool.Pinned() != rpcURL {
+		err := b.reconnectRPC()
+		if err != nil {
+			return nil, err
+		}
+		b.bestHeader = nil
+	}
 	if b.bestHeader == nil {
 		var err error
 		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 		defer cancel()
-		b.bestHeader, err = b.client.HeaderByNumber(ctx, nil)
+		_, ec, _ := b.pinnedRPC()
+		b.bestHeader, err = ec.HeaderByNumber(ctx, nil)
 		if err != nil {
 			b.bestHeader = nil
 			return nil, err
@@ -419,7 +589,8 @@ func (b *EthereumRPC) GetBlockHash(height uint32) (string, error) {
 	n.SetUint64(uint64(height))
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
-	h, err := b.client.HeaderByNumber(ctx, &n)
+	_, ec, _ := b.pinnedRPC()
+	h, err := ec.HeaderByNumber(ctx, &n)
 	if err != nil {
 		if err == ethereum.NotFound {
 			return "", bchain.ErrBlockNotFound
@@ -479,19 +650,36 @@ func (b *EthereumRPC) computeConfirmations(n uint64) (uint32, error) {
 	return uint32(bn - n + 1), nil
 }
 
+// getBlockRaw gets the block from the endpoint pinned for the synchronization
 func (b *EthereumRPC) getBlockRaw(hash string, height uint32, fullTxs bool) (json.RawMessage, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
+	rc, _, _ := b.pinnedRPC()
+	return b.getBlockRawFrom(ctx, rc, hash, height, fullTxs)
+}
+
+// getBlockRawRead gets the block from the endpoint for the requests which do not have to be consistent with the synchronization
+func (b *EthereumRPC) getBlockRawRead(hash string, height uint32, fullTxs bool) (json.RawMessage, error) {
+	var raw json.RawMessage
+	err := b.callRead(func(ctx context.Context, c *rpc.Client) error {
+		var err error
+		raw, err = b.getBlockRawFrom(ctx, c, hash, height, fullTxs)
+		return err
+	})
+	return raw, err
+}
+
+func (b *EthereumRPC) getBlockRawFrom(ctx context.Context, c *rpc.Client, hash string, height uint32, fullTxs bool) (json.RawMessage, error) {
 	var raw json.RawMessage
 	var err error
 	if hash != "" {
 		if hash == "pending" {
-			err = b.rpc.CallContext(ctx, &raw, "eth_getBlockByNumber", hash, fullTxs)
+			err = c.CallContext(ctx, &raw, "eth_getBlockByNumber", hash, fullTxs)
 		} else {
-			err = b.rpc.CallContext(ctx, &raw, "eth_getBlockByHash", ethcommon.HexToHash(hash), fullTxs)
+			err = c.CallContext(ctx, &raw, "eth_getBlockByHash", ethcommon.HexToHash(hash), fullTxs)
 		}
 	} else {
-		err = b.rpc.CallContext(ctx, &raw, "eth_getBlockByNumber", fmt.Sprintf("%#x", height), fullTxs)
+		err = c.CallContext(ctx, &raw, "eth_getBlockByNumber", fmt.Sprintf("%#x", height), fullTxs)
 	}
 	if err != nil {
 		return nil, errors.Annotatef(err, "hash %v, height %v", hash, height)
@@ -501,14 +689,17 @@ func (b *EthereumRPC) getBlockRaw(hash string, height uint32, fullTxs bool) (jso
 	return raw, nil
 }
 
-func (b *EthereumRPC) getERC20EventsForBlock(blockNumber string) (map[string][]*rpcLog, error) {
+// getTokenEventsForBlock returns the ERC20, ERC721 and ERC1155 transfer events of the block by transaction hash
+func (b *EthereumRPC) getTokenEventsForBlock(blockNumber string) (map[string][]*rpcLog, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
 	var logs []rpcLogWithTxHash
-	err := b.rpc.CallContext(ctx, &logs, "eth_getLogs", map[string]interface{}{
+	rc, _, _ := b.pinnedRPC()
+	err := rc.CallContext(ctx, &logs, "eth_getLogs", map[string]interface{}{
 		"fromBlock": blockNumber,
 		"toBlock":   blockNumber,
-		"topics":    []string{erc20TransferEventSignature},
+		// ERC20 and ERC721 share the Transfer event signature, ERC1155 has its own events
+		"topics": [][]string{{erc20TransferEventSignature, erc1155TransferSingleEventSignature, erc1155TransferBatchEventSignature}},
 	})
 	if err != nil {
 		return nil, errors.Annotatef(err, "blockNumber %v", blockNumber)
@@ -521,6 +712,29 @@ func (b *EthereumRPC) getERC20EventsForBlock(blockNumber string) (map[string][]*
 	return r, nil
 }
 
+// getInternalTransfersForBlock returns internal transfers of the transactions in the block in the order of the transactions
+// it uses the callTracer of the debug API, which must be enabled in the backend
+func (b *EthereumRPC) getInternalTransfersForBlock(blockHash string, txCount int) ([][]rpcInternalTransfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	var trace []rpcTraceResult
+	rc, _, _ := b.pinnedRPC()
+	err := rc.CallContext(ctx, &trace, "debug_traceBlockByHash", ethcommon.HexToHash(blockHash), map[string]interface{}{
+		"tracer": "callTracer",
+	})
+	if err != nil {
+		return nil, errors.Annotatef(err, "blockHash %v", blockHash)
+	}
+	if len(trace) != txCount {
+		return nil, errors.Errorf("blockHash %v, trace returned %v results for %v transactions", blockHash, len(trace), txCount)
+	}
+	r := make([][]rpcInternalTransfer, len(trace))
+	for i := range trace {
+		r[i] = getInternalTransfers(&trace[i].Result)
+	}
+	return r, nil
+}
+
 // GetBlock returns block with given hash or height, hash has precedence if both passed
 func (b *EthereumRPC) GetBlock(hash string, height uint32) (*bchain.Block, error) {
 	raw, err := b.getBlockRaw(hash, height, true)
@@ -539,15 +753,27 @@ func (b *EthereumRPC) GetBlock(hash string, height uint32) (*bchain.Block, error
 	if err != nil {
 		return nil, errors.Annotatef(err, "hash %v, height %v", hash, height)
 	}
-	// get ERC20 events
-	logs, err := b.getERC20EventsForBlock(head.Number)
+	// get token transfer events
+	logs, err := b.getTokenEventsForBlock(head.Number)
 	if err != nil {
 		return nil, err
 	}
+	// get internal transfers
+	var internalTransfers [][]rpcInternalTransfer
+	if b.ChainConfig.ProcessInternalTransfers && len(body.Transactions) > 0 {
+		internalTransfers, err = b.getInternalTransfersForBlock(head.Hash, len(body.Transactions))
+		if err != nil {
+			return nil, err
+		}
+	}
 	btxs := make([]bchain.Tx, len(body.Transactions))
 	for i := range body.Transactions {
 		tx := &body.Transactions[i]
-		btx, err := b.Parser.ethTxToTx(tx, &rpcReceipt{Logs: logs[tx.Hash]}, bbh.Time, uint32(bbh.Confirmations))
+		var its []rpcInternalTransfer
+		if internalTransfers != nil {
+			its = internalTransfers[i]
+		}
+		btx, err := b.Parser.ethTxToTx(tx, &rpcReceipt{Logs: logs[tx.Hash]}, its, bbh.Time, uint32(bbh.Confirmations))
 		if err != nil {
 			return nil, errors.Annotatef(err, "hash %v, height %v, txid %v", hash, height, tx.Hash)
 		}
@@ -565,7 +791,7 @@ func (b *EthereumRPC) GetBlock(hash string, height uint32) (*bchain.Block, error
 
 // GetBlockInfo returns extended header (more info than in bchain.BlockHeader) with a list of txids
 func (b *EthereumRPC) GetBlockInfo(hash string) (*bchain.BlockInfo, error) {
-	raw, err := b.getBlockRaw(hash, 0, false)
+	raw, err := b.getBlockRawRead(hash, 0, false)
 	if err != nil {
 		return nil, err
 	}
@@ -597,11 +823,9 @@ func (b *EthereumRPC) GetTransactionForMempool(txid string) (*bchain.Tx, error)
 
 // GetTransaction returns a transaction by the transaction ID.
 func (b *EthereumRPC) GetTransaction(txid string) (*bchain.Tx, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
-	defer cancel()
 	var tx *rpcTransaction
 	hash := ethcommon.HexToHash(txid)
-	err := b.rpc.CallContext(ctx, &tx, "eth_getTransactionByHash", hash)
+	err := b.callReadContext(&tx, "eth_getTransactionByHash", hash)
 	if err != nil {
 		return nil, err
 	} else if tx == nil {
@@ -613,13 +837,13 @@ func (b *EthereumRPC) GetTransaction(txid string) (*bchain.Tx, error) {
 	var btx *bchain.Tx
 	if tx.BlockNumber == "" {
 		// mempool tx
-		btx, err = b.Parser.ethTxToTx(tx, nil, 0, 0)
+		btx, err = b.Parser.ethTxToTx(tx, nil, nil, 0, 0)
 		if err != nil {
 			return nil, errors.Annotatef(err, "txid %v", txid)
 		}
 	} else {
 		// non mempool tx - read the block header to get the block time
-		raw, err := b.getBlockRaw(tx.BlockHash, 0, false)
+		raw, err := b.getBlockRawRead(tx.BlockHash, 0, false)
 		if err != nil {
 			return nil, err
 		}
@@ -637,7 +861,7 @@ func (b *EthereumRPC) GetTransaction(txid string) (*bchain.Tx, error) {
 		if b.isETC {
 			var rawReceipt json.RawMessage
 			var etcReceipt rpcEtcReceipt
-			err = b.rpc.CallContext(ctx, &rawReceipt, "eth_getTransactionReceipt", hash)
+			err = b.callReadContext(&rawReceipt, "eth_getTransactionReceipt", hash)
 			if err != nil {
 				return nil, errors.Annotatef(err, "txid %v", txid)
 			}
@@ -657,7 +881,7 @@ func (b *EthereumRPC) GetTransaction(txid string) (*bchain.Tx, error) {
 				}
 			}
 		} else {
-			err = b.rpc.CallContext(ctx, &receipt, "eth_getTransactionReceipt", hash)
+			err = b.callReadContext(&receipt, "eth_getTransactionReceipt", hash)
 			if err != nil {
 				return nil, errors.Annotatef(err, "txid %v", txid)
 			}
@@ -670,7 +894,18 @@ func (b *EthereumRPC) GetTransaction(txid string) (*bchain.Tx, error) {
 		if err != nil {
 			return nil, errors.Annotatef(err, "txid %v", txid)
 		}
-		btx, err = b.Parser.ethTxToTx(tx, &receipt, time, confirmations)
+		var its []rpcInternalTransfer
+		if b.ChainConfig.ProcessInternalTransfers {
+			var trace rpcCallTrace
+			err = b.callReadContext(&trace, "debug_traceTransaction", hash, map[string]interface{}{
+				"tracer": "callTracer",
+			})
+			if err != nil {
+				return nil, errors.Annotatef(err, "txid %v", txid)
+			}
+			its = getInternalTransfers(&trace)
+		}
+		btx, err = b.Parser.ethTxToTx(tx, &receipt, its, time, confirmations)
 		if err != nil {
 			return nil, errors.Annotatef(err, "txid %v", txid)
 		}
@@ -721,13 +956,14 @@ func (b *EthereumRPC) EstimateFee(blocks int) (big.Int, error) {
 
 // EstimateSmartFee returns fee estimation
 func (b *EthereumRPC) EstimateSmartFee(blocks int, conservative bool) (big.Int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
-	defer cancel()
 	var r big.Int
-	gp, err := b.client.SuggestGasPrice(ctx)
-	if err == nil && b != nil {
-		r = *gp
-	}
+	err := b.callRead(func(ctx context.Context, c *rpc.Client) error {
+		gp, err := ethclient.NewClient(c).SuggestGasPrice(ctx)
+		if err == nil {
+			r = *gp
+		}
+		return err
+	})
 	return r, err
 }
 
@@ -742,8 +978,6 @@ func getStringFromMap(p string, params map[string]interface{}) (string, bool) {
 
 // EthereumTypeEstimateGas returns estimation of gas consumption for given transaction parameters
 func (b *EthereumRPC) EthereumTypeEstimateGas(params map[string]interface{}) (uint64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
-	defer cancel()
 	msg := ethereum.CallMsg{}
 	s, ok := getStringFromMap("from", params)
 	if ok && len(s) > 0 {
@@ -758,18 +992,45 @@ func (b *EthereumRPC) EthereumTypeEstimateGas(params map[string]interface{}) (ui
 	if ok && len(s) > 0 {
 		msg.Data = ethcommon.FromHex(s)
 	}
-	return b.client.EstimateGas(ctx, msg)
+	var gas uint64
+	err := b.callRead(func(ctx context.Context, c *rpc.Client) error {
+		var err error
+		gas, err = ethclient.NewClient(c).EstimateGas(ctx, msg)
+		return err
+	})
+	return gas, err
 }
 
 // SendRawTransaction sends raw transaction
 func (b *EthereumRPC) SendRawTransaction(hex string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
-	defer cancel()
-	var raw json.RawMessage
-	err := b.rpc.CallContext(ctx, &raw, "eth_sendRawTransaction", hex)
+	rc, _, rpcURL := b.pinnedRPC()
+	raw, err := b.sendRawTransaction(rc, hex)
 	if err != nil {
-		return "", err
-	} else if len(raw) == 0 {
+		// error returned by the backend would be returned by the other endpoints too, fail over only if the endpoint cannot be reached
+		if _, isRPCError := err.(rpc.Error); isRPCError || b.pool.Len() == 1 {
+			return "", err
+		}
+		b.pool.ReportFailure(rpcURL, err)
+		for _, url := range b.pool.SyncURLs() {
+			if url == rpcURL {
+				continue
+			}
+			var c *rpc.Client
+			if c, err = b.probeClient(url); err == nil {
+				if raw, err = b.sendRawTransaction(c, hex); err == nil {
+					break
+				}
+			}
+			if _, isRPCError := err.(rpc.Error); isRPCError {
+				return "", err
+			}
+			glog.Warning("rpc: SendRawTransaction to ", bchain.EndpointName(url), " failed: ", err)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(raw) == 0 {
 		return "", errors.New("SendRawTransaction: failed")
 	}
 	var result string
@@ -782,18 +1043,34 @@ func (b *EthereumRPC) SendRawTransaction(hex string) (string, error) {
 	return result, nil
 }
 
-// EthereumTypeGetBalance returns current balance of an address
-func (b *EthereumRPC) EthereumTypeGetBalance(addrDesc bchain.AddressDescriptor) (*big.Int, error) {
+func (b *EthereumRPC) sendRawTransaction(c *rpc.Client, hex string) (json.RawMessage, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
-	return b.client.BalanceAt(ctx, ethcommon.BytesToAddress(addrDesc), nil)
+	var raw json.RawMessage
+	err := c.CallContext(ctx, &raw, "eth_sendRawTransaction", hex)
+	return raw, err
+}
+
+// EthereumTypeGetBalance returns current balance of an address
+func (b *EthereumRPC) EthereumTypeGetBalance(addrDesc bchain.AddressDescriptor) (*big.Int, error) {
+	var balance *big.Int
+	err := b.callRead(func(ctx context.Context, c *rpc.Client) error {
+		var err error
+		balance, err = ethclient.NewClient(c).BalanceAt(ctx, ethcommon.BytesToAddress(addrDesc), nil)
+		return err
+	})
+	return balance, err
 }
 
 // EthereumTypeGetNonce returns current balance of an address
 func (b *EthereumRPC) EthereumTypeGetNonce(addrDesc bchain.AddressDescriptor) (uint64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
-	defer cancel()
-	return b.client.NonceAt(ctx, ethcommon.BytesToAddress(addrDesc), nil)
+	var nonce uint64
+	err := b.callRead(func(ctx context.Context, c *rpc.Client) error {
+		var err error
+		nonce, err = ethclient.NewClient(c).NonceAt(ctx, ethcommon.BytesToAddress(addrDesc), nil)
+		return err
+	})
+	return nonce, err
 }
 
 // GetChainParser returns ethereum BlockChainParser
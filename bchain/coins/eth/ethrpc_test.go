@@ -0,0 +1,253 @@
+// +build unittest
+
+package eth
+
+import (
+	"blockbook/bchain"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/juju/errors"
+)
+
+type testRPCError struct{}
+
+func (e testRPCError) Error() string  { return "execution reverted" }
+func (e testRPCError) ErrorCode() int { return -32000 }
+
+var _ rpc.Error = testRPCError{}
+
+func Test_isUnreachable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "not found", err: ethereum.NotFound, want: false},
+		{name: "block not found", err: bchain.ErrBlockNotFound, want: false},
+		{name: "annotated tx not found", err: errors.Annotatef(bchain.ErrTxNotFound, "txid %v", "0x1"), want: false},
+		{name: "backend error", err: testRPCError{}, want: false},
+		{name: "annotated backend error", err: errors.Annotatef(testRPCError{}, "hash %v", "0x1"), want: false},
+		{name: "closed client", err: rpc.ErrClientQuit, want: true},
+		{name: "timeout", err: context.DeadlineExceeded, want: true},
+		{name: "http status", err: errors.New("502 Bad Gateway"), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUnreachable(tt.err); got != tt.want {
+				t.Errorf("isUnreachable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+const testBlockTxid = "0xc2b5b6c2a7f1f6d1c8d9b08be4b14c8c0a4d9c2e4b7e0b2f8f0a8c1b6e3d2f1a"
+
+var testBlockLogs = []rpcLogWithTxHash{
+	{
+		Hash: testBlockTxid,
+		rpcLog: rpcLog{
+			Address: "0x4af4114f73d1c1c903ac9e0361b379d1291808a2",
+			Topics: []string{
+				erc20TransferEventSignature,
+				"0x000000000000000000000000d1a3e58d4abd0e1f7e2d5b3dcb5e0b5dfb1e0c45",
+				"0x0000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d",
+			},
+			Data: "0x00000000000000000000000000000000000000000000000000000000000003e8",
+		},
+	},
+	{
+		Hash: testBlockTxid,
+		rpcLog: rpcLog{
+			Address: "0x495f947276749ce646f68ac8c248420045cb7b5e",
+			Topics: []string{
+				erc1155TransferSingleEventSignature,
+				"0x0000000000000000000000007b62eb7fe80350dc7ec945c0b73242cb9877fb1b",
+				"0x0000000000000000000000006f44cceb49b4a5812d54b6f494fc2febf25511ed",
+				"0x0000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d",
+			},
+			Data: "0x000000000000000000000000000000000000000000000000000000000000002a0000000000000000000000000000000000000000000000000000000000000005",
+		},
+	},
+	{
+		Hash: testBlockTxid,
+		rpcLog: rpcLog{
+			Address: "0x495f947276749ce646f68ac8c248420045cb7b5e",
+			Topics: []string{
+				erc1155TransferBatchEventSignature,
+				"0x0000000000000000000000007b62eb7fe80350dc7ec945c0b73242cb9877fb1b",
+				"0x0000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d",
+				"0x0000000000000000000000000000000000000000000000000000000000000000",
+			},
+			Data: "0x0000000000000000000000000000000000000000000000000000000000000040" +
+				"0000000000000000000000000000000000000000000000000000000000000080" +
+				"0000000000000000000000000000000000000000000000000000000000000001" +
+				"0000000000000000000000000000000000000000000000000000000000000100" +
+				"0000000000000000000000000000000000000000000000000000000000000001" +
+				"0000000000000000000000000000000000000000000000000000000000000003",
+		},
+	},
+	{
+		// an event of the same contract which is not a token transfer
+		Hash: testBlockTxid,
+		rpcLog: rpcLog{
+			Address: "0x495f947276749ce646f68ac8c248420045cb7b5e",
+			Topics: []string{
+				"0x17307eab39ab6107e8899845ad3d59bd9653f200f220920489ca2b5937696c31",
+				"0x0000000000000000000000007b62eb7fe80350dc7ec945c0b73242cb9877fb1b",
+				"0x0000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d",
+			},
+			Data: "0x0000000000000000000000000000000000000000000000000000000000000001",
+		},
+	},
+}
+
+// filterTestLogs returns the logs matching the first position of the eth_getLogs topics filter,
+// which is either null, a single topic or a list of alternative topics
+func filterTestLogs(t *testing.T, params json.RawMessage) []rpcLogWithTxHash {
+	var filter []struct {
+		Topics []json.RawMessage `json:"topics"`
+	}
+	if err := json.Unmarshal(params, &filter); err != nil || len(filter) != 1 {
+		t.Errorf("eth_getLogs invalid params %s", params)
+		return nil
+	}
+	var topics []string
+	if len(filter[0].Topics) > 0 && string(filter[0].Topics[0]) != "null" {
+		if err := json.Unmarshal(filter[0].Topics[0], &topics); err != nil {
+			var topic string
+			if err = json.Unmarshal(filter[0].Topics[0], &topic); err != nil {
+				t.Errorf("eth_getLogs invalid topics %s", filter[0].Topics[0])
+				return nil
+			}
+			topics = []string{topic}
+		}
+	}
+	var r []rpcLogWithTxHash
+	for _, l := range testBlockLogs {
+		match := len(topics) == 0
+		for _, topic := range topics {
+			if l.Topics[0] == topic {
+				match = true
+			}
+		}
+		if match {
+			r = append(r, l)
+		}
+	}
+	return r
+}
+
+func newTestEthereumRPC(t *testing.T) (*EthereumRPC, func()) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+			return
+		}
+		var result interface{}
+		switch req.Method {
+		case "eth_getBlockByNumber":
+			result = map[string]interface{}{
+				"hash":       "0x2b57e15e93a0ed197417a34c2498b7187df79099572c04a6b6e6ff418f74e6ee",
+				"parentHash": "0x6b4ba1b8a1c4b2ae1f4e5cc1a6b4c4e2f6f0c2a8a9b8b3a3c1b0a8f1c2d3e4f5",
+				"difficulty": "0x1",
+				"number":     "0x64",
+				"timestamp":  "0x5c0f3c7a",
+				"size":       "0x2b4",
+				"nonce":      "0x0000000000000000",
+				"transactions": []rpcTransaction{{
+					AccountNonce:     "0x1",
+					GasPrice:         "0x3b9aca00",
+					GasLimit:         "0x30d40",
+					To:               "0x495f947276749ce646f68ac8c248420045cb7b5e",
+					Value:            "0x0",
+					Payload:          "0x",
+					Hash:             testBlockTxid,
+					BlockNumber:      "0x64",
+					From:             "0x7b62eb7fe80350dc7ec945c0b73242cb9877fb1b",
+					TransactionIndex: "0x0",
+				}},
+			}
+		case "eth_getLogs":
+			result = filterTestLogs(t, req.Params)
+		default:
+			t.Errorf("unexpected method %v", req.Method)
+			return
+		}
+		res, err := json.Marshal(result)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":` + string(req.ID) + `,"result":` + string(res) + `}`))
+	}))
+	c, err := NewEthereumRPC(json.RawMessage(`{"coin_name":"Ethereum","rpc_url":"`+ts.URL+`","rpc_timeout":5}`), func(bchain.NotificationType) {})
+	if err != nil {
+		ts.Close()
+		t.Fatal(err)
+	}
+	b := c.(*EthereumRPC)
+	// the best header is otherwise set by the new block subscription
+	b.bestHeader = &ethtypes.Header{Number: big.NewInt(101)}
+	return b, func() {
+		b.rpc.Close()
+		ts.Close()
+	}
+}
+
+func TestEthereumRPC_GetBlock(t *testing.T) {
+	b, closeRPC := newTestEthereumRPC(t)
+	defer closeRPC()
+	block, err := b.GetBlock("", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Height != 100 || block.Confirmations != 2 || len(block.Txs) != 1 {
+		t.Fatalf("GetBlock() = height %v, confirmations %v, %v txs, want 100, 2, 1 tx", block.Height, block.Confirmations, len(block.Txs))
+	}
+	got, err := b.Parser.EthereumTypeGetErc20FromTx(&block.Txs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bchain.Erc20Transfer{
+		{
+			Type:     bchain.ERC20TokenType,
+			Contract: "0x4af4114f73d1c1c903ac9e0361b379d1291808a2",
+			From:     "0xd1a3e58d4abd0e1f7e2d5b3dcb5e0b5dfb1e0c45",
+			To:       "0x4bda106325c335df99eab7fe363cac8a0ba2a24d",
+			Tokens:   *big.NewInt(1000),
+		},
+		{
+			Type:     bchain.ERC1155TokenType,
+			Contract: "0x495f947276749ce646f68ac8c248420045cb7b5e",
+			From:     "0x6f44cceb49b4a5812d54b6f494fc2febf25511ed",
+			To:       "0x4bda106325c335df99eab7fe363cac8a0ba2a24d",
+			IDValues: []bchain.TokenIDValue{{ID: *big.NewInt(0x2a), Value: *big.NewInt(5)}},
+		},
+		{
+			Type:     bchain.ERC1155TokenType,
+			Contract: "0x495f947276749ce646f68ac8c248420045cb7b5e",
+			From:     "0x4bda106325c335df99eab7fe363cac8a0ba2a24d",
+			To:       "0x0000000000000000000000000000000000000000",
+			IDValues: []bchain.TokenIDValue{{ID: *big.NewInt(0x100), Value: *big.NewInt(3)}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EthereumTypeGetErc20FromTx() = %+v, want %+v", got, want)
+	}
+}
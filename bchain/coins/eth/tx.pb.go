@@ -28,10 +28,11 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type ProtoCompleteTransaction struct {
-	BlockNumber uint32                                `protobuf:"varint,1,opt,name=BlockNumber" json:"BlockNumber,omitempty"`
-	BlockTime   uint64                                `protobuf:"varint,2,opt,name=BlockTime" json:"BlockTime,omitempty"`
-	Tx          *ProtoCompleteTransaction_TxType      `protobuf:"bytes,3,opt,name=Tx" json:"Tx,omitempty"`
-	Receipt     *ProtoCompleteTransaction_ReceiptType `protobuf:"bytes,4,opt,name=Receipt" json:"Receipt,omitempty"`
+	BlockNumber       uint32                                           `protobuf:"varint,1,opt,name=BlockNumber" json:"BlockNumber,omitempty"`
+	BlockTime         uint64                                           `protobuf:"varint,2,opt,name=BlockTime" json:"BlockTime,omitempty"`
+	Tx                *ProtoCompleteTransaction_TxType                 `protobuf:"bytes,3,opt,name=Tx" json:"Tx,omitempty"`
+	Receipt           *ProtoCompleteTransaction_ReceiptType            `protobuf:"bytes,4,opt,name=Receipt" json:"Receipt,omitempty"`
+	InternalTransfers []*ProtoCompleteTransaction_InternalTransferType `protobuf:"bytes,5,rep,name=InternalTransfers" json:"InternalTransfers,omitempty"`
 }
 
 func (m *ProtoCompleteTransaction) Reset()                    { *m = ProtoCompleteTransaction{} }
@@ -67,6 +68,13 @@ func (m *ProtoCompleteTransaction) GetReceipt() *ProtoCompleteTransaction_Receip
 	return nil
 }
 
+func (m *ProtoCompleteTransaction) GetInternalTransfers() []*ProtoCompleteTransaction_InternalTransferType {
+	if m != nil {
+		return m.InternalTransfers
+	}
+	return nil
+}
+
 type ProtoCompleteTransaction_TxType struct {
 	AccountNonce     uint64 `protobuf:"varint,1,opt,name=AccountNonce" json:"AccountNonce,omitempty"`
 	GasPrice         []byte `protobuf:"bytes,2,opt,name=GasPrice,proto3" json:"GasPrice,omitempty"`
@@ -221,40 +229,90 @@ func (m *ProtoCompleteTransaction_ReceiptType_LogType) GetTopics() [][]byte {
 	return nil
 }
 
+type ProtoCompleteTransaction_InternalTransferType struct {
+	Type  uint32 `protobuf:"varint,1,opt,name=Type" json:"Type,omitempty"`
+	From  []byte `protobuf:"bytes,2,opt,name=From,proto3" json:"From,omitempty"`
+	To    []byte `protobuf:"bytes,3,opt,name=To,proto3" json:"To,omitempty"`
+	Value []byte `protobuf:"bytes,4,opt,name=Value,proto3" json:"Value,omitempty"`
+}
+
+func (m *ProtoCompleteTransaction_InternalTransferType) Reset() {
+	*m = ProtoCompleteTransaction_InternalTransferType{}
+}
+func (m *ProtoCompleteTransaction_InternalTransferType) String() string {
+	return proto.CompactTextString(m)
+}
+func (*ProtoCompleteTransaction_InternalTransferType) ProtoMessage() {}
+func (*ProtoCompleteTransaction_InternalTransferType) Descriptor() ([]byte, []int) {
+	return fileDescriptor0, []int{0, 2}
+}
+
+func (m *ProtoCompleteTransaction_InternalTransferType) GetType() uint32 {
+	if m != nil {
+		return m.Type
+	}
+	return 0
+}
+
+func (m *ProtoCompleteTransaction_InternalTransferType) GetFrom() []byte {
+	if m != nil {
+		return m.From
+	}
+	return nil
+}
+
+func (m *ProtoCompleteTransaction_InternalTransferType) GetTo() []byte {
+	if m != nil {
+		return m.To
+	}
+	return nil
+}
+
+func (m *ProtoCompleteTransaction_InternalTransferType) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*ProtoCompleteTransaction)(nil), "eth.ProtoCompleteTransaction")
 	proto.RegisterType((*ProtoCompleteTransaction_TxType)(nil), "eth.ProtoCompleteTransaction.TxType")
 	proto.RegisterType((*ProtoCompleteTransaction_ReceiptType)(nil), "eth.ProtoCompleteTransaction.ReceiptType")
 	proto.RegisterType((*ProtoCompleteTransaction_ReceiptType_LogType)(nil), "eth.ProtoCompleteTransaction.ReceiptType.LogType")
+	proto.RegisterType((*ProtoCompleteTransaction_InternalTransferType)(nil), "eth.ProtoCompleteTransaction.InternalTransferType")
 }
 
 func init() { proto.RegisterFile("tx.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 393 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x92, 0xdf, 0x8a, 0xd4, 0x30,
-	0x14, 0xc6, 0xe9, 0x9f, 0xf9, 0xb3, 0xa7, 0x55, 0x24, 0x88, 0x84, 0xe2, 0x45, 0x59, 0xbc, 0xa8,
-	0x5e, 0x14, 0x5c, 0x7d, 0x81, 0x75, 0xc4, 0x55, 0x18, 0xd6, 0x21, 0x46, 0xef, 0xb3, 0x69, 0xd8,
-	0x29, 0xb6, 0x4d, 0x69, 0x52, 0xe8, 0xbe, 0x91, 0x2f, 0xe4, 0xbb, 0x78, 0x29, 0x39, 0x4d, 0xd7,
-	0x11, 0x51, 0xbc, 0x3b, 0xbf, 0x6f, 0xce, 0x37, 0xf9, 0xbe, 0xa4, 0xb0, 0xb5, 0x53, 0xd9, 0x0f,
-	0xda, 0x6a, 0x12, 0x29, 0x7b, 0x3c, 0xff, 0xb6, 0x02, 0x7a, 0x70, 0xb8, 0xd3, 0x6d, 0xdf, 0x28,
-	0xab, 0xf8, 0x20, 0x3a, 0x23, 0xa4, 0xad, 0x75, 0x47, 0x72, 0x48, 0xde, 0x34, 0x5a, 0x7e, 0xbd,
-	0x1e, 0xdb, 0x1b, 0x35, 0xd0, 0x20, 0x0f, 0x8a, 0x07, 0xec, 0x54, 0x22, 0x4f, 0xe1, 0x0c, 0x91,
-	0xd7, 0xad, 0xa2, 0x61, 0x1e, 0x14, 0x31, 0xfb, 0x25, 0x90, 0xd7, 0x10, 0xf2, 0x89, 0x46, 0x79,
-	0x50, 0x24, 0x17, 0xcf, 0x4a, 0x65, 0x8f, 0xe5, 0xdf, 0x8e, 0x2a, 0xf9, 0xc4, 0xef, 0x7a, 0xc5,
-	0x42, 0x3e, 0x91, 0x1d, 0x6c, 0x98, 0x92, 0xaa, 0xee, 0x2d, 0x8d, 0xd1, 0xfa, 0xfc, 0xdf, 0x56,
-	0xbf, 0x8c, 0xfe, 0xc5, 0x99, 0xfd, 0x08, 0x60, 0x3d, 0xff, 0x27, 0x39, 0x87, 0xf4, 0x52, 0x4a,
-	0x3d, 0x76, 0xf6, 0x5a, 0x77, 0x52, 0x61, 0x8d, 0x98, 0xfd, 0xa6, 0x91, 0x0c, 0xb6, 0x57, 0xc2,
-	0x1c, 0x86, 0x5a, 0xce, 0x35, 0x52, 0x76, 0xcf, 0xfe, 0xb7, 0x7d, 0xdd, 0xd6, 0x16, 0xbb, 0xc4,
-	0xec, 0x9e, 0xc9, 0x63, 0x58, 0x7d, 0x11, 0xcd, 0xa8, 0x30, 0x69, 0xca, 0x66, 0x20, 0x14, 0x36,
-	0x07, 0x71, 0xd7, 0x68, 0x51, 0xd1, 0x15, 0xea, 0x0b, 0x12, 0x02, 0xf1, 0x7b, 0x61, 0x8e, 0x74,
-	0x8d, 0x32, 0xce, 0xe4, 0x21, 0x84, 0x5c, 0xd3, 0x0d, 0x2a, 0x21, 0xd7, 0x6e, 0xe7, 0xdd, 0xa0,
-	0x5b, 0xba, 0x9d, 0x77, 0xdc, 0x4c, 0x5e, 0xc0, 0xa3, 0x93, 0xca, 0x1f, 0xba, 0x4a, 0x4d, 0xf4,
-	0x0c, 0x9f, 0xe3, 0x0f, 0x3d, 0xfb, 0x1e, 0x40, 0x72, 0x72, 0x27, 0x2e, 0xcd, 0x95, 0x30, 0x9f,
-	0x8d, 0xaa, 0xb0, 0x7a, 0xca, 0x16, 0x24, 0x4f, 0x60, 0xfd, 0xc9, 0x0a, 0x3b, 0x1a, 0xdf, 0xd9,
-	0x13, 0xd9, 0x41, 0xb4, 0xd7, 0xb7, 0x34, 0xca, 0xa3, 0x22, 0xb9, 0x78, 0xf9, 0xdf, 0xb7, 0x5f,
-	0xee, 0xf5, 0x2d, 0xbe, 0x82, 0x73, 0x67, 0x1f, 0x61, 0xe3, 0xd9, 0x25, 0xb8, 0xac, 0xaa, 0x41,
-	0x19, 0xb3, 0x24, 0xf0, 0xe8, 0xba, 0xbe, 0x15, 0x56, 0xf8, 0xf3, 0x71, 0x76, 0xa9, 0xb8, 0xee,
-	0x6b, 0x69, 0x30, 0x40, 0xca, 0x3c, 0xdd, 0xac, 0xf1, 0xb3, 0x7d, 0xf5, 0x33, 0x00, 0x00, 0xff,
-	0xff, 0xde, 0xd5, 0x28, 0xa3, 0xc2, 0x02, 0x00, 0x00,
+	// 446 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x53, 0x4d, 0x8f, 0xd3, 0x30,
+	0x10, 0x55, 0x3e, 0x9a, 0x76, 0xa7, 0x01, 0x81, 0xb5, 0x42, 0x56, 0xc4, 0x21, 0x5a, 0x71, 0x28,
+	0x1c, 0x22, 0x51, 0xf8, 0x03, 0x4b, 0x11, 0xcb, 0x4a, 0xd5, 0x52, 0x19, 0xc3, 0x19, 0x6f, 0x62,
+	0xb6, 0x11, 0x49, 0x1c, 0xc5, 0xae, 0x94, 0xfd, 0xa1, 0xfc, 0x0f, 0x8e, 0x1c, 0x91, 0x27, 0x4e,
+	0x29, 0xec, 0x52, 0x71, 0x8a, 0xdf, 0xcb, 0xbc, 0xf1, 0x9b, 0x37, 0x32, 0xcc, 0x4c, 0x9f, 0xb5,
+	0x9d, 0x32, 0x8a, 0x04, 0xd2, 0x6c, 0xcf, 0x7e, 0x44, 0x40, 0x37, 0x16, 0xae, 0x54, 0xdd, 0x56,
+	0xd2, 0x48, 0xde, 0x89, 0x46, 0x8b, 0xdc, 0x94, 0xaa, 0x21, 0x29, 0xcc, 0xdf, 0x54, 0x2a, 0xff,
+	0x76, 0xb5, 0xab, 0xaf, 0x65, 0x47, 0xbd, 0xd4, 0x5b, 0x3c, 0x60, 0x87, 0x14, 0x79, 0x0a, 0x27,
+	0x08, 0x79, 0x59, 0x4b, 0xea, 0xa7, 0xde, 0x22, 0x64, 0xbf, 0x09, 0xf2, 0x1a, 0x7c, 0xde, 0xd3,
+	0x20, 0xf5, 0x16, 0xf3, 0xe5, 0xb3, 0x4c, 0x9a, 0x6d, 0xf6, 0xaf, 0xab, 0x32, 0xde, 0xf3, 0xdb,
+	0x56, 0x32, 0x9f, 0xf7, 0x64, 0x05, 0x53, 0x26, 0x73, 0x59, 0xb6, 0x86, 0x86, 0x28, 0x7d, 0x7e,
+	0x5c, 0xea, 0x8a, 0x51, 0x3f, 0x2a, 0xc9, 0x17, 0x78, 0x7c, 0xd9, 0x18, 0xd9, 0x35, 0xa2, 0xc2,
+	0xda, 0xaf, 0xb2, 0xd3, 0x74, 0x92, 0x06, 0x8b, 0xf9, 0x72, 0x79, 0xbc, 0xdd, 0xdf, 0x32, 0xec,
+	0x7b, 0xb7, 0x59, 0xf2, 0xd3, 0x83, 0x68, 0x70, 0x4d, 0xce, 0x20, 0x3e, 0xcf, 0x73, 0xb5, 0x6b,
+	0xcc, 0x95, 0x6a, 0x72, 0x89, 0x41, 0x85, 0xec, 0x0f, 0x8e, 0x24, 0x30, 0xbb, 0x10, 0x7a, 0xd3,
+	0x95, 0xf9, 0x10, 0x54, 0xcc, 0xf6, 0xd8, 0xfd, 0x5b, 0x97, 0x75, 0x69, 0x30, 0xad, 0x90, 0xed,
+	0x31, 0x39, 0x85, 0xc9, 0x67, 0x51, 0xed, 0x24, 0x66, 0x11, 0xb3, 0x01, 0x10, 0x0a, 0xd3, 0x8d,
+	0xb8, 0xad, 0x94, 0x28, 0xe8, 0x04, 0xf9, 0x11, 0x12, 0x02, 0xe1, 0x7b, 0xa1, 0xb7, 0x34, 0x42,
+	0x1a, 0xcf, 0xe4, 0x21, 0xf8, 0x5c, 0xd1, 0x29, 0x32, 0x3e, 0x57, 0xb6, 0xe6, 0x5d, 0xa7, 0x6a,
+	0x3a, 0x1b, 0x6a, 0xec, 0x99, 0xbc, 0x80, 0x47, 0x07, 0x29, 0x5c, 0x36, 0x85, 0xec, 0xe9, 0x09,
+	0x2e, 0xfc, 0x0e, 0x9f, 0x7c, 0xf7, 0x60, 0x7e, 0x90, 0xba, 0x75, 0x73, 0x21, 0xf4, 0x27, 0x2d,
+	0x0b, 0x1c, 0x3d, 0x66, 0x23, 0x24, 0x4f, 0x20, 0xfa, 0x68, 0x84, 0xd9, 0x69, 0x37, 0xb3, 0x43,
+	0x64, 0x05, 0xc1, 0x5a, 0xdd, 0xd0, 0x00, 0x17, 0xf2, 0xf2, 0xbf, 0xf7, 0x9b, 0xad, 0xd5, 0x8d,
+	0xfd, 0x32, 0xab, 0x4e, 0x3e, 0xc0, 0xd4, 0x61, 0xeb, 0xe0, 0xbc, 0x28, 0x3a, 0xa9, 0xf5, 0xe8,
+	0xc0, 0x41, 0x3b, 0xeb, 0x5b, 0x61, 0x84, 0xbb, 0x1f, 0xcf, 0xd6, 0x15, 0x57, 0x6d, 0x99, 0x6b,
+	0x34, 0x10, 0x33, 0x87, 0x92, 0x02, 0x4e, 0xef, 0xdb, 0xbe, 0xed, 0x61, 0xbf, 0xee, 0x01, 0x84,
+	0x23, 0x87, 0x19, 0xfa, 0x07, 0x19, 0x0e, 0x39, 0x07, 0xfb, 0x9c, 0xef, 0xdd, 0xdd, 0x75, 0x84,
+	0xcf, 0xef, 0xd5, 0xaf, 0x01, 0x00, 0x93, 0x01, 0xd8, 0x24, 0x8a, 0x03, 0x00, 0x00,
 }
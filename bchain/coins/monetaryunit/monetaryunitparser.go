@@ -94,6 +94,7 @@ func (p *MonetaryUnitParser) ParseBlock(b []byte) (*bchain.Block, error) {
 		r.Seek(32, io.SeekCurrent)
 	}
 
+	rawHeader := utils.RawHeader(b, r)
 	err = utils.DecodeTransactions(r, 0, wire.WitnessEncoding, &w)
 	if err != nil {
 		return nil, errors.Annotatef(err, "DecodeTransactions")
@@ -109,7 +110,8 @@ func (p *MonetaryUnitParser) ParseBlock(b []byte) (*bchain.Block, error) {
 			Size: len(b),
 			Time: h.Timestamp.Unix(),
 		},
-		Txs: txs,
+		Txs:       txs,
+		RawHeader: rawHeader,
 	}, nil
 }
 
@@ -73,6 +73,7 @@ func (p *MyriadParser) ParseBlock(b []byte) (*bchain.Block, error) {
 		}
 	}
 
+	rawHeader := utils.RawHeader(b, r)
 	err = utils.DecodeTransactions(r, 0, wire.WitnessEncoding, &w)
 	if err != nil {
 		return nil, err
@@ -88,6 +89,7 @@ func (p *MyriadParser) ParseBlock(b []byte) (*bchain.Block, error) {
 			Size: len(b),
 			Time: h.Timestamp.Unix(),
 		},
-		Txs: txs,
+		Txs:       txs,
+		RawHeader: rawHeader,
 	}, nil
 }
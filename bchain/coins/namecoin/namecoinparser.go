@@ -68,6 +68,7 @@ func (p *NamecoinParser) ParseBlock(b []byte) (*bchain.Block, error) {
 		}
 	}
 
+	rawHeader := utils.RawHeader(b, r)
 	err = utils.DecodeTransactions(r, 0, wire.WitnessEncoding, &w)
 	if err != nil {
 		return nil, err
@@ -83,6 +84,7 @@ func (p *NamecoinParser) ParseBlock(b []byte) (*bchain.Block, error) {
 			Size: len(b),
 			Time: h.Timestamp.Unix(),
 		},
-		Txs: txs,
+		Txs:       txs,
+		RawHeader: rawHeader,
 	}, nil
 }
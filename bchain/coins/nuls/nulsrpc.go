@@ -264,6 +264,11 @@ func (n *NulsRPC) GetBlockHash(height uint32) (string, error) {
 	return blockHeader.Data.Hash, nil
 }
 
+// RawBlockHeaders returns false, the backend does not provide the serialized block headers
+func (n *NulsRPC) RawBlockHeaders() bool {
+	return false
+}
+
 func (n *NulsRPC) GetBlockHeader(hash string) (*bchain.BlockHeader, error) {
 	uri := "/api/block/header/hash/" + hash
 	return n.getBlobkHeader(uri)
@@ -110,6 +110,7 @@ func (p *QtumParser) ParseBlock(b []byte) (*bchain.Block, error) {
 		return nil, err
 	}
 
+	rawHeader := utils.RawHeader(b, r)
 	err = utils.DecodeTransactions(r, 0, wire.WitnessEncoding, &w)
 	if err != nil {
 		return nil, err
@@ -125,7 +126,8 @@ func (p *QtumParser) ParseBlock(b []byte) (*bchain.Block, error) {
 			Size: len(b),
 			Time: h.Timestamp.Unix(),
 		},
-		Txs: txs,
+		Txs:       txs,
+		RawHeader: rawHeader,
 	}, nil
 }
 
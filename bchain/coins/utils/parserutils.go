@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 
@@ -49,6 +50,12 @@ func DecodeTransactions(r io.Reader, pver uint32, enc wire.MessageEncoding, blk
 	return nil
 }
 
+// RawHeader returns a copy of the part of the raw block b before the transactions, i.e. the header including
+// the coin specific data like Auxpow, r is the reader of b positioned at the number of transactions
+func RawHeader(b []byte, r *bytes.Reader) []byte {
+	return append([]byte(nil), b[:len(b)-r.Len()]...)
+}
+
 // VersionAuxpow marks that block contains Auxpow
 const VersionAuxpow = (1 << 8)
 
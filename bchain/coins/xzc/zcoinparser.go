@@ -3,6 +3,7 @@ package xzc
 import (
 	"blockbook/bchain"
 	"blockbook/bchain/coins/btc"
+	"blockbook/bchain/coins/utils"
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
@@ -164,6 +165,8 @@ func (p *ZcoinParser) ParseBlock(b []byte) (*bchain.Block, error) {
 		}
 	}
 
+	rawHeader := utils.RawHeader(b, reader)
+
 	// parse txs
 	ntx, err := wire.ReadVarInt(reader, 0)
 	if err != nil {
@@ -192,7 +195,8 @@ func (p *ZcoinParser) ParseBlock(b []byte) (*bchain.Block, error) {
 			Size: len(b),
 			Time: header.Timestamp.Unix(),
 		},
-		Txs: txs,
+		Txs:       txs,
+		RawHeader: rawHeader,
 	}, nil
 }
 
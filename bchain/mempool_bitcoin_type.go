@@ -1,6 +1,7 @@
 package bchain
 
 import (
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
@@ -12,6 +13,15 @@ type MempoolBitcoinType struct {
 	chanTxid            chan string
 	chanAddrIndex       chan txidio
 	AddrDescForOutpoint AddrDescForOutpointFunc
+	rawTxs              map[string]rawTx
+	inputTxs            map[string]*Tx
+	rawTxsMux           sync.Mutex
+}
+
+// rawTx is a transaction received from the message queue, waiting for the next Resync
+type rawTx struct {
+	tx       *Tx
+	received time.Time
 }
 
 // NewMempoolBitcoinType creates new mempool handler.
@@ -25,6 +35,7 @@ func NewMempoolBitcoinType(chain BlockChain, workers int, subworkers int) *Mempo
 		},
 		chanTxid:      make(chan string, 1),
 		chanAddrIndex: make(chan txidio, 1),
+		rawTxs:        make(map[string]rawTx),
 	}
 	for i := 0; i < workers; i++ {
 		go func(i int) {
@@ -51,13 +62,138 @@ func NewMempoolBitcoinType(chain BlockChain, workers int, subworkers int) *Mempo
 	return m
 }
 
+// AddRawTx parses the serialized transaction from the rawtx notification of the message queue
+// the transaction is then used by the next Resync instead of getting it from the backend
+func (m *MempoolBitcoinType) AddRawTx(raw []byte) {
+	tx, err := m.chain.GetChainParser().ParseTx(raw)
+	if err != nil {
+		glog.Error("mempool: cannot parse raw transaction: ", err)
+		return
+	}
+	m.rawTxsMux.Lock()
+	m.rawTxs[tx.Txid] = rawTx{tx: tx, received: time.Now()}
+	m.rawTxsMux.Unlock()
+}
+
+// getTransaction returns the transaction received from the message queue, if it was not received, it gets it from the backend
+func (m *MempoolBitcoinType) getTransaction(txid string) (*Tx, error) {
+	m.rawTxsMux.Lock()
+	r, found := m.rawTxs[txid]
+	if found {
+		delete(m.rawTxs, txid)
+	}
+	m.rawTxsMux.Unlock()
+	if found {
+		return r.tx, nil
+	}
+	return m.chain.GetTransactionForMempool(txid)
+}
+
+// getInputTransaction returns the transaction spent by an input, if it was not prefetched by Resync, it gets it from the backend
+func (m *MempoolBitcoinType) getInputTransaction(txid string) (*Tx, error) {
+	m.rawTxsMux.Lock()
+	tx, found := m.inputTxs[txid]
+	m.rawTxsMux.Unlock()
+	if found {
+		return tx, nil
+	}
+	return m.chain.GetTransactionForMempool(txid)
+}
+
+// prefetchTxs gets the transactions and the not yet indexed transactions spent by their inputs using batch requests,
+// the workers then take them from rawTxs and inputTxs instead of getting them from the backend one by one
+func (m *MempoolBitcoinType) prefetchTxs(bc BatchBlockChain, txids []string) {
+	txs := make(map[string]*Tx, len(txids))
+	var missing []string
+	m.rawTxsMux.Lock()
+	for _, txid := range txids {
+		if r, found := m.rawTxs[txid]; found {
+			txs[txid] = r.tx
+		} else {
+			missing = append(missing, txid)
+		}
+	}
+	m.rawTxsMux.Unlock()
+	if len(missing) > 0 {
+		fetched, err := bc.GetTransactionsBatch(missing)
+		if err != nil {
+			// the workers get the transactions one by one
+			glog.Error("mempool: cannot get transactions in batch: ", err)
+			return
+		}
+		received := time.Now()
+		m.rawTxsMux.Lock()
+		for txid, tx := range fetched {
+			m.rawTxs[txid] = rawTx{tx: tx, received: received}
+			txs[txid] = tx
+		}
+		m.rawTxsMux.Unlock()
+	}
+	// the inputs, which are not found in the index, spend other mempool transactions
+	inputTxs := make(map[string]*Tx)
+	needed := make(map[string]struct{})
+	for _, tx := range txs {
+		for _, input := range tx.Vin {
+			if input.Coinbase != "" {
+				continue
+			}
+			if m.AddrDescForOutpoint != nil && m.AddrDescForOutpoint(Outpoint{input.Txid, int32(input.Vout)}) != nil {
+				continue
+			}
+			if itx, found := txs[input.Txid]; found {
+				inputTxs[input.Txid] = itx
+			} else {
+				needed[input.Txid] = struct{}{}
+			}
+		}
+	}
+	missing = missing[:0]
+	m.rawTxsMux.Lock()
+	if m.inputTxs == nil {
+		m.inputTxs = make(map[string]*Tx)
+	}
+	for txid, tx := range inputTxs {
+		m.inputTxs[txid] = tx
+	}
+	for txid := range needed {
+		if _, found := m.inputTxs[txid]; !found {
+			missing = append(missing, txid)
+		}
+	}
+	m.rawTxsMux.Unlock()
+	if len(missing) > 0 {
+		fetched, err := bc.GetTransactionsBatch(missing)
+		if err != nil {
+			glog.Error("mempool: cannot get input transactions in batch: ", err)
+			return
+		}
+		m.rawTxsMux.Lock()
+		for txid, tx := range fetched {
+			m.inputTxs[txid] = tx
+		}
+		m.rawTxsMux.Unlock()
+	}
+}
+
+// removeRawTxs removes the transactions received from the message queue before the time,
+// which were not used by Resync, typically the transactions of new blocks
+func (m *MempoolBitcoinType) removeRawTxs(before time.Time) {
+	m.rawTxsMux.Lock()
+	for txid, r := range m.rawTxs {
+		if r.received.Before(before) {
+			delete(m.rawTxs, txid)
+		}
+	}
+	m.rawTxsMux.Unlock()
+}
+
 func (m *MempoolBitcoinType) getInputAddress(input Outpoint) *addrIndex {
 	var addrDesc AddressDescriptor
 	if m.AddrDescForOutpoint != nil {
 		addrDesc = m.AddrDescForOutpoint(input)
 	}
 	if addrDesc == nil {
-		itx, err := m.chain.GetTransactionForMempool(input.Txid)
+		itx, err := m.getInputTransaction(input.Txid)
 		if err != nil {
 			glog.Error("cannot get transaction ", input.Txid, ": ", err)
 			return nil
@@ -77,7 +213,7 @@ func (m *MempoolBitcoinType) getInputAddress(input Outpoint) *addrIndex {
 }
 
 func (m *MempoolBitcoinType) getTxAddrs(txid string, chanInput chan Outpoint, chanResult chan *addrIndex) ([]addrIndex, bool) {
-	tx, err := m.chain.GetTransactionForMempool(txid)
+	tx, err := m.getTransaction(txid)
 	if err != nil {
 		glog.Error("cannot get transaction ", txid, ": ", err)
 		return nil, false
@@ -152,30 +288,55 @@ func (m *MempoolBitcoinType) Resync() (int, error) {
 	txsMap := make(map[string]struct{}, len(txs))
 	dispatched := 0
 	txTime := uint32(time.Now().Unix())
+	dispatch := func(txid string) {
+		for {
+			select {
+			// store as many processed transactions as possible
+			case tio := <-m.chanAddrIndex:
+				onNewEntry(tio.txid, txEntry{tio.io, txTime})
+				dispatched--
+			// send transaction to be processed
+			case m.chanTxid <- txid:
+				dispatched++
+				return
+			}
+		}
+	}
+	// if the backend supports batch requests, the new transactions are prefetched in batches before they are dispatched
+	bc := GetBatchBlockChain(m.chain)
+	var batch []string
+	dispatchBatch := func() {
+		m.prefetchTxs(bc, batch)
+		for _, txid := range batch {
+			dispatch(txid)
+		}
+		batch = batch[:0]
+	}
 	// get transaction in parallel using goroutines created in NewUTXOMempool
 	for _, txid := range txs {
 		txsMap[txid] = struct{}{}
 		_, exists := m.txEntries[txid]
 		if !exists {
-		loop:
-			for {
-				select {
-				// store as many processed transactions as possible
-				case tio := <-m.chanAddrIndex:
-					onNewEntry(tio.txid, txEntry{tio.io, txTime})
-					dispatched--
-				// send transaction to be processed
-				case m.chanTxid <- txid:
-					dispatched++
-					break loop
-				}
+			if bc == nil {
+				dispatch(txid)
+				continue
+			}
+			batch = append(batch, txid)
+			if len(batch) >= bc.RPCBatchSize() {
+				dispatchBatch()
 			}
 		}
 	}
+	if len(batch) > 0 {
+		dispatchBatch()
+	}
 	for i := 0; i < dispatched; i++ {
 		tio := <-m.chanAddrIndex
 		onNewEntry(tio.txid, txEntry{tio.io, txTime})
 	}
+	m.rawTxsMux.Lock()
+	m.inputTxs = nil
+	m.rawTxsMux.Unlock()
 
 	for txid, entry := range m.txEntries {
 		if _, exists := txsMap[txid]; !exists {
@@ -184,6 +345,8 @@ func (m *MempoolBitcoinType) Resync() (int, error) {
 			m.mux.Unlock()
 		}
 	}
+	// the transactions received before the start of the resync which were not used are not in the mempool anymore
+	m.removeRawTxs(start)
 	glog.Info("mempool: resync finished in ", time.Since(start), ", ", len(m.txEntries), " transactions in mempool")
 	return len(m.txEntries), nil
 }
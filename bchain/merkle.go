@@ -0,0 +1,97 @@
+package bchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/juju/errors"
+)
+
+// hashes in the merkle tree are in the internal byte order, the txids and the merkle root in the usual (reversed) hex form
+func decodeReversedHash(h string) ([]byte, error) {
+	b, err := hex.DecodeString(h)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != sha256.Size {
+		return nil, errors.Errorf("Invalid hash %v", h)
+	}
+	reverseBytes(b)
+	return b, nil
+}
+
+func encodeReversedHash(b []byte) string {
+	r := append([]byte(nil), b...)
+	reverseBytes(r)
+	return hex.EncodeToString(r)
+}
+
+func reverseBytes(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
+
+func merkleParent(left, right []byte) []byte {
+	b := make([]byte, 0, 2*sha256.Size)
+	b = append(b, left...)
+	b = append(b, right...)
+	h := sha256.Sum256(b)
+	h = sha256.Sum256(h[:])
+	return h[:]
+}
+
+// MerkleBranch computes the merkle branch of the transaction at the index in the list of the block txids
+// and the merkle root of the block, the last hash of a level with an odd number of hashes is paired with itself
+func MerkleBranch(txids []string, index int) ([]string, string, error) {
+	if index < 0 || index >= len(txids) {
+		return nil, "", errors.Errorf("Index %v out of range of %v txids", index, len(txids))
+	}
+	level := make([][]byte, len(txids))
+	for i, txid := range txids {
+		h, err := decodeReversedHash(txid)
+		if err != nil {
+			return nil, "", err
+		}
+		level[i] = h
+	}
+	var branch []string
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		branch = append(branch, encodeReversedHash(level[index^1]))
+		next := make([][]byte, len(level)/2)
+		for i := range next {
+			next[i] = merkleParent(level[2*i], level[2*i+1])
+		}
+		level = next
+		index >>= 1
+	}
+	return branch, encodeReversedHash(level[0]), nil
+}
+
+// MerkleRootFromBranch computes the merkle root from the txid, its index in the block and its merkle branch
+// the transaction is proven to be in the block if the returned root matches the merkle root in the block header
+func MerkleRootFromBranch(txid string, index int, branch []string) (string, error) {
+	if index < 0 || (len(branch) < 31 && index >= 1<<uint(len(branch))) {
+		return "", errors.Errorf("Index %v does not match the branch of length %v", index, len(branch))
+	}
+	h, err := decodeReversedHash(txid)
+	if err != nil {
+		return "", err
+	}
+	for _, b := range branch {
+		s, err := decodeReversedHash(b)
+		if err != nil {
+			return "", err
+		}
+		if index&1 == 0 {
+			h = merkleParent(h, s)
+		} else {
+			h = merkleParent(s, h)
+		}
+		index >>= 1
+	}
+	return encodeReversedHash(h), nil
+}
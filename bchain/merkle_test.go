@@ -0,0 +1,118 @@
+package bchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// transactions of the bitcoin block 100000
+var merkleTestTxids = []string{
+	"8c14f0db3df150123e6f3dbbf30f8b955a8249b62ac1d1ff16284aefa3d06d87",
+	"fff2525b8931402dd09222c50775608f75787bd2b87e56995a7bdd30f79702c4",
+	"6359f0868171b1d194cbee1af2f16ea598ae8fad666d9b012c8ed2b79a236ec4",
+	"e9a66845e05d5abc0ad04ec80f774a7e585c6e8db975962d069a522137b80c1d",
+}
+
+const merkleTestRoot = "f3e94742aca4b5ef85488dc37c06c3282295ffec960994b2c0d5ac2a25a95766"
+
+func TestMerkleBranch(t *testing.T) {
+	tests := []struct {
+		name       string
+		txids      []string
+		index      int
+		wantBranch []string
+		wantRoot   string
+		wantErr    bool
+	}{
+		{
+			name:       "block 100000 tx 2",
+			txids:      merkleTestTxids,
+			index:      2,
+			wantBranch: []string{merkleTestTxids[3], "ccdafb73d8dcd0173d5d5c3c9a0770d0b3953db889dab99ef05b1907518cb815"},
+			wantRoot:   merkleTestRoot,
+		},
+		{
+			name:       "block 100000 tx 1",
+			txids:      merkleTestTxids,
+			index:      1,
+			wantBranch: []string{merkleTestTxids[0], "8e30899078ca1813be036a073bbf80b86cdddde1c96e9e9c99e9e3782df4ae49"},
+			wantRoot:   merkleTestRoot,
+		},
+		{
+			name:     "only coinbase",
+			txids:    merkleTestTxids[:1],
+			index:    0,
+			wantRoot: merkleTestTxids[0],
+		},
+		{
+			name:    "index out of range",
+			txids:   merkleTestTxids,
+			index:   4,
+			wantErr: true,
+		},
+		{
+			name:    "invalid txid",
+			txids:   []string{"1234"},
+			index:   0,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			branch, root, err := MerkleBranch(tt.txids, tt.index)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MerkleBranch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(branch, tt.wantBranch) {
+				t.Errorf("MerkleBranch() branch = %v, want %v", branch, tt.wantBranch)
+			}
+			if root != tt.wantRoot {
+				t.Errorf("MerkleBranch() root = %v, want %v", root, tt.wantRoot)
+			}
+		})
+	}
+}
+
+func TestMerkleRootFromBranch(t *testing.T) {
+	// the branches of all transactions of trees of various sizes must lead to the root of the tree
+	for n := 1; n <= 9; n++ {
+		txids := make([]string, n)
+		for i := range txids {
+			h := sha256.Sum256([]byte{byte(n), byte(i)})
+			txids[i] = hex.EncodeToString(h[:])
+		}
+		for i := range txids {
+			branch, root, err := MerkleBranch(txids, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := MerkleRootFromBranch(txids[i], i, branch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != root {
+				t.Errorf("%d txs, index %d: MerkleRootFromBranch() = %v, want %v", n, i, got, root)
+			}
+			if i > 0 {
+				if got, _ = MerkleRootFromBranch(txids[i], i-1, branch); got == root {
+					t.Errorf("%d txs, index %d: proof with a wrong index verified", n, i)
+				}
+			}
+		}
+	}
+	branch, _, err := MerkleBranch(merkleTestTxids, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := MerkleRootFromBranch(merkleTestTxids[2], 3, branch); got == merkleTestRoot {
+		t.Error("proof of a wrong txid verified")
+	}
+	if _, err := MerkleRootFromBranch(merkleTestTxids[3], 4, branch); err == nil {
+		t.Error("index out of range of the branch accepted")
+	}
+}
@@ -16,6 +16,8 @@ type MQ struct {
 	isRunning bool
 	finished  chan error
 	binding   string
+	topics    []string
+	sequences map[string]uint32
 }
 
 // NotificationType is type of notification
@@ -30,9 +32,14 @@ const (
 	NotificationNewTx NotificationType = iota
 )
 
+// OnRawNotificationFunc receives the serialized block or transaction from the rawblock or rawtx notification
+type OnRawNotificationFunc func(nt NotificationType, payload []byte)
+
 // NewMQ creates new Bitcoind ZeroMQ listener
 // callback function receives messages
-func NewMQ(binding string, callback func(NotificationType)) (*MQ, error) {
+// if rawCallback is set, the rawblock and rawtx notifications are subscribed instead of hashblock and hashtx,
+// their payload is passed to rawCallback before callback is called
+func NewMQ(binding string, callback func(NotificationType), rawCallback OnRawNotificationFunc) (*MQ, error) {
 	context, err := zmq.NewContext()
 	if err != nil {
 		return nil, err
@@ -41,29 +48,37 @@ func NewMQ(binding string, callback func(NotificationType)) (*MQ, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = socket.SetSubscribe("hashblock")
-	if err != nil {
-		return nil, err
+	// on each notification we do sync or syncmempool respectively, the payloads of the raw notifications
+	// only save the rpc calls, the data of lost notifications are therefore loaded using rpc
+	topics := []string{"hashblock", "hashtx"}
+	if rawCallback != nil {
+		topics = []string{"rawblock", "rawtx"}
 	}
-	err = socket.SetSubscribe("hashtx")
-	if err != nil {
-		return nil, err
+	for _, t := range topics {
+		err = socket.SetSubscribe(t)
+		if err != nil {
+			return nil, err
+		}
 	}
-	// for now do not use raw subscriptions - we would have to handle skipped/lost notifications from zeromq
-	// on each notification we do sync or syncmempool respectively
-	// socket.SetSubscribe("rawblock")
-	// socket.SetSubscribe("rawtx")
 	err = socket.Connect(binding)
 	if err != nil {
 		return nil, err
 	}
-	glog.Info("MQ listening to ", binding)
-	mq := &MQ{context, socket, true, make(chan error), binding}
-	go mq.run(callback)
+	glog.Info("MQ listening to ", binding, ", topics ", topics)
+	mq := &MQ{context, socket, true, make(chan error), binding, topics, make(map[string]uint32)}
+	go mq.run(callback, rawCallback)
 	return mq, nil
 }
 
-func (mq *MQ) run(callback func(NotificationType)) {
+// checkSequence returns false if some notifications of the topic were lost
+// the sequence numbers are maintained by the backend separately for each topic
+func (mq *MQ) checkSequence(topic string, sequence uint32) bool {
+	last, ok := mq.sequences[topic]
+	mq.sequences[topic] = sequence
+	return !ok || sequence == last+1
+}
+
+func (mq *MQ) run(callback func(NotificationType), rawCallback OnRawNotificationFunc) {
 	defer func() {
 		if r := recover(); r != nil {
 			glog.Error("MQ loop recovered from ", r)
@@ -83,43 +98,62 @@ func (mq *MQ) run(callback func(NotificationType)) {
 			time.Sleep(100 * time.Millisecond)
 		}
 		if msg != nil && len(msg) >= 3 {
-			var nt NotificationType
-			switch string(msg[0]) {
-			case "hashblock":
-				nt = NotificationNewBlock
-				break
-			case "hashtx":
-				nt = NotificationNewTx
-				break
-			default:
-				nt = NotificationUnknown
-				glog.Infof("MQ: NotificationUnknown %v", string(msg[0]))
-			}
-			if glog.V(2) {
-				sequence := uint32(0)
-				if len(msg[len(msg)-1]) == 4 {
-					sequence = binary.LittleEndian.Uint32(msg[len(msg)-1])
-				}
-				glog.Infof("MQ: %v %s-%d", nt, string(msg[0]), sequence)
-			}
-			callback(nt)
+			mq.handleMessage(msg, callback, rawCallback)
 		}
 	}
 }
 
+// handleMessage passes the notification to the callbacks
+// if some notifications were lost, both the block sync and the mempool resync are requested right away,
+// the lost blocks and transactions are then loaded using rpc
+func (mq *MQ) handleMessage(msg [][]byte, callback func(NotificationType), rawCallback OnRawNotificationFunc) {
+	var nt NotificationType
+	topic := string(msg[0])
+	switch topic {
+	case "hashblock", "rawblock":
+		nt = NotificationNewBlock
+	case "hashtx", "rawtx":
+		nt = NotificationNewTx
+	default:
+		nt = NotificationUnknown
+		glog.Infof("MQ: NotificationUnknown %v", topic)
+	}
+	sequence := uint32(0)
+	lost := false
+	if len(msg[len(msg)-1]) == 4 {
+		sequence = binary.LittleEndian.Uint32(msg[len(msg)-1])
+		if !mq.checkSequence(topic, sequence) {
+			glog.Warningf("MQ: %s notifications lost before sequence %d, resynchronizing using rpc", topic, sequence)
+			lost = true
+		}
+	}
+	if glog.V(2) {
+		glog.Infof("MQ: %v %s-%d", nt, topic, sequence)
+	}
+	if rawCallback != nil && nt != NotificationUnknown {
+		rawCallback(nt, msg[1])
+	}
+	if lost {
+		// ZeroMQ drops the messages of all topics when the queue of the socket is full,
+		// the notifications of the other topic were probably lost too
+		callback(NotificationNewBlock)
+		callback(NotificationNewTx)
+		return
+	}
+	callback(nt)
+}
+
 // Shutdown stops listening to the ZeroMQ and closes the connection
 func (mq *MQ) Shutdown(ctx context.Context) error {
 	glog.Info("MQ server shutdown")
 	if mq.isRunning {
 		go func() {
 			// if errors in the closing sequence, let it close ungracefully
-			if err := mq.socket.SetUnsubscribe("hashtx"); err != nil {
-				mq.finished <- err
-				return
-			}
-			if err := mq.socket.SetUnsubscribe("hashblock"); err != nil {
-				mq.finished <- err
-				return
+			for _, t := range mq.topics {
+				if err := mq.socket.SetUnsubscribe(t); err != nil {
+					mq.finished <- err
+					return
+				}
 			}
 			if err := mq.socket.Unbind(mq.binding); err != nil {
 				mq.finished <- err
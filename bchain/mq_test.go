@@ -0,0 +1,62 @@
+package bchain
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestMQ_checkSequence(t *testing.T) {
+	mq := &MQ{sequences: make(map[string]uint32)}
+	tests := []struct {
+		topic    string
+		sequence uint32
+		want     bool
+	}{
+		{topic: "rawtx", sequence: 10, want: true},
+		{topic: "rawtx", sequence: 11, want: true},
+		{topic: "rawblock", sequence: 0, want: true},
+		{topic: "rawtx", sequence: 13, want: false},
+		{topic: "rawtx", sequence: 14, want: true},
+		{topic: "rawblock", sequence: 1, want: true},
+		{topic: "rawblock", sequence: math.MaxUint32, want: false},
+		{topic: "rawblock", sequence: 0, want: true},
+	}
+	for i, tt := range tests {
+		if got := mq.checkSequence(tt.topic, tt.sequence); got != tt.want {
+			t.Errorf("%d: checkSequence(%v, %v) = %v, want %v", i, tt.topic, tt.sequence, got, tt.want)
+		}
+	}
+}
+
+func TestMQ_handleMessage(t *testing.T) {
+	mq := &MQ{sequences: make(map[string]uint32)}
+	var notifications []NotificationType
+	var payloads []string
+	callback := func(nt NotificationType) {
+		notifications = append(notifications, nt)
+	}
+	rawCallback := func(nt NotificationType, payload []byte) {
+		payloads = append(payloads, string(payload))
+	}
+	message := func(topic, payload string, sequence uint32) [][]byte {
+		seq := make([]byte, 4)
+		binary.LittleEndian.PutUint32(seq, sequence)
+		return [][]byte{[]byte(topic), []byte(payload), seq}
+	}
+	mq.handleMessage(message("rawtx", "tx1", 5), callback, rawCallback)
+	mq.handleMessage(message("rawtx", "tx2", 6), callback, rawCallback)
+	if want := []NotificationType{NotificationNewTx, NotificationNewTx}; !reflect.DeepEqual(notifications, want) {
+		t.Errorf("notifications = %v, want %v", notifications, want)
+	}
+	// the lost notifications request both the block sync and the mempool resync
+	notifications = nil
+	mq.handleMessage(message("rawtx", "tx3", 9), callback, rawCallback)
+	if want := []NotificationType{NotificationNewBlock, NotificationNewTx}; !reflect.DeepEqual(notifications, want) {
+		t.Errorf("notifications after lost messages = %v, want %v", notifications, want)
+	}
+	if want := []string{"tx1", "tx2", "tx3"}; !reflect.DeepEqual(payloads, want) {
+		t.Errorf("payloads = %v, want %v", payloads, want)
+	}
+}
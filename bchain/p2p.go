@@ -0,0 +1,561 @@
+package bchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/martinboehm/btcd/chaincfg/chainhash"
+	"github.com/martinboehm/btcd/wire"
+)
+
+const (
+	p2pUserAgent         = "/blockbook/"
+	p2pReconnectInterval = 10 * time.Second
+	p2pDefaultTimeout    = 25 * time.Second
+	// p2pMaxNextHashes limits the number of the cached links to the next blocks
+	p2pMaxNextHashes = 10000
+)
+
+// ErrP2PNotConnected is returned when the P2P connection to the node is not established
+var ErrP2PNotConnected = errors.New("P2P not connected")
+
+// P2P is a connection to a bitcoind-like node over the Bitcoin P2P protocol, it downloads blocks using getdata
+// and follows the chain using getheaders without using the RPC threads of the node.
+// After Subscribe, the announced (inv) blocks and transactions are downloaded and passed to the callbacks.
+type P2P struct {
+	address           string
+	net               wire.BitcoinNet
+	timeout           time.Duration
+	reconnectInterval time.Duration
+	mux               sync.Mutex
+	conn              net.Conn
+	connDone          chan struct{}
+	witness           bool
+	writeMux          sync.Mutex
+	blockRequests     map[chainhash.Hash][]chan []byte
+	headersMux        sync.Mutex
+	headersRequest    chan []*wire.BlockHeader
+	nextHashes        map[string]string
+	callback          func(NotificationType)
+	rawCallback       OnRawNotificationFunc
+	notify            chan struct{}
+	newBlock, newTx   bool
+	done              chan struct{}
+}
+
+// NewP2P creates P2P connection to the node at the address, net is the magic of the network
+func NewP2P(address string, net uint32, timeout time.Duration) *P2P {
+	if timeout <= 0 {
+		timeout = p2pDefaultTimeout
+	}
+	return &P2P{
+		address:           address,
+		net:               wire.BitcoinNet(net),
+		timeout:           timeout,
+		reconnectInterval: p2pReconnectInterval,
+		blockRequests:     make(map[chainhash.Hash][]chan []byte),
+		nextHashes:        make(map[string]string),
+		notify:            make(chan struct{}, 1),
+		done:              make(chan struct{}),
+	}
+}
+
+// Start connects to the node in the background and reconnects if the connection is lost
+func (p *P2P) Start() {
+	go p.run()
+	go p.notificationLoop()
+}
+
+// Close closes the connection to the node
+func (p *P2P) Close() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	close(p.done)
+	if p.conn != nil {
+		p.conn.Close()
+	}
+}
+
+// Subscribe starts passing of the announced blocks and transactions, callback is called after the payload is passed to rawCallback,
+// without rawCallback the blocks and transactions are not downloaded
+func (p *P2P) Subscribe(callback func(NotificationType), rawCallback OnRawNotificationFunc) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.callback = callback
+	p.rawCallback = rawCallback
+}
+
+// notifyCallback schedules the call of the callback, the callback is not called directly by the reading goroutine,
+// the subscriber can wait for a block requested by GetBlock before it handles the notification
+func (p *P2P) notifyCallback(nt NotificationType) {
+	p.mux.Lock()
+	if nt == NotificationNewBlock {
+		p.newBlock = true
+	} else {
+		p.newTx = true
+	}
+	p.mux.Unlock()
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+// notificationLoop calls the callback, multiple notifications of the same type waiting for the callback are merged
+func (p *P2P) notificationLoop() {
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-p.notify:
+		}
+		p.mux.Lock()
+		callback, newBlock, newTx := p.callback, p.newBlock, p.newTx
+		p.newBlock, p.newTx = false, false
+		p.mux.Unlock()
+		if callback == nil {
+			continue
+		}
+		if newBlock {
+			callback(NotificationNewBlock)
+		}
+		if newTx {
+			callback(NotificationNewTx)
+		}
+	}
+}
+
+func (p *P2P) run() {
+	for {
+		conn, err := p.connect()
+		if err != nil {
+			glog.Error("p2p: ", p.address, " ", err)
+		} else {
+			err = p.readLoop(conn)
+			p.disconnect()
+			select {
+			case <-p.done:
+				return
+			default:
+				glog.Error("p2p: ", p.address, " connection lost: ", err)
+			}
+		}
+		select {
+		case <-p.done:
+			return
+		case <-time.After(p.reconnectInterval):
+		}
+	}
+}
+
+// connect establishes the connection and performs the version handshake
+func (p *P2P) connect() (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", p.address, p.timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(p.timeout))
+	me := wire.NewNetAddressIPPort(net.IPv4zero, 0, 0)
+	you := wire.NewNetAddressIPPort(net.IPv4zero, 0, 0)
+	if a, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		you = wire.NewNetAddressIPPort(a.IP, uint16(a.Port), 0)
+	}
+	nonce, err := wire.RandomUint64()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	v := wire.NewMsgVersion(me, you, nonce, 0)
+	v.UserAgent = p2pUserAgent
+	if err = writeP2PMessage(conn, p.net, v); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var remote *wire.MsgVersion
+	verack := false
+	for remote == nil || !verack {
+		cmd, payload, err := readP2PMessage(conn, p.net)
+		if err != nil {
+			conn.Close()
+			return nil, errors.Annotatef(err, "handshake")
+		}
+		switch cmd {
+		case wire.CmdVersion:
+			remote = &wire.MsgVersion{}
+			if err = remote.BtcDecode(bytes.NewReader(payload), wire.ProtocolVersion, wire.BaseEncoding); err != nil {
+				conn.Close()
+				return nil, errors.Annotatef(err, "version")
+			}
+			if err = writeP2PMessage(conn, p.net, wire.NewMsgVerAck()); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		case wire.CmdVerAck:
+			verack = true
+		}
+	}
+	conn.SetDeadline(time.Time{})
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	select {
+	case <-p.done:
+		conn.Close()
+		return nil, ErrP2PNotConnected
+	default:
+	}
+	p.conn = conn
+	p.connDone = make(chan struct{})
+	p.witness = remote.Services&wire.SFNodeWitness != 0
+	glog.Info("p2p: connected to ", p.address, " ", remote.UserAgent, ", height ", remote.LastBlock)
+	return conn, nil
+}
+
+func (p *P2P) disconnect() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+		close(p.connDone)
+	}
+}
+
+// connection returns the current connection and the channel closed when the connection is lost
+func (p *P2P) connection() (net.Conn, chan struct{}, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.conn == nil {
+		return nil, nil, ErrP2PNotConnected
+	}
+	return p.conn, p.connDone, nil
+}
+
+func (p *P2P) write(conn net.Conn, msg wire.Message) error {
+	p.writeMux.Lock()
+	defer p.writeMux.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(p.timeout))
+	return writeP2PMessage(conn, p.net, msg)
+}
+
+func (p *P2P) readLoop(conn net.Conn) error {
+	for {
+		cmd, payload, err := readP2PMessage(conn, p.net)
+		if err != nil {
+			return err
+		}
+		switch cmd {
+		case wire.CmdPing:
+			ping := wire.MsgPing{}
+			if err = ping.BtcDecode(bytes.NewReader(payload), wire.ProtocolVersion, wire.BaseEncoding); err != nil {
+				return err
+			}
+			if err = p.write(conn, wire.NewMsgPong(ping.Nonce)); err != nil {
+				return err
+			}
+		case wire.CmdInv:
+			if err = p.onInv(conn, payload); err != nil {
+				return err
+			}
+		case wire.CmdBlock:
+			p.onBlock(payload)
+		case wire.CmdTx:
+			p.onTx(payload)
+		case wire.CmdHeaders:
+			headers := wire.MsgHeaders{}
+			if err = headers.BtcDecode(bytes.NewReader(payload), wire.ProtocolVersion, wire.BaseEncoding); err != nil {
+				return err
+			}
+			p.mux.Lock()
+			if p.headersRequest != nil {
+				p.headersRequest <- headers.Headers
+				p.headersRequest = nil
+			}
+			p.mux.Unlock()
+		case wire.CmdNotFound:
+			notFound := wire.MsgNotFound{}
+			if err = notFound.BtcDecode(bytes.NewReader(payload), wire.ProtocolVersion, wire.BaseEncoding); err != nil {
+				return err
+			}
+			for _, iv := range notFound.InvList {
+				p.deliverBlock(iv.Hash, nil)
+			}
+		}
+	}
+}
+
+// onInv requests the announced blocks and transactions, if there is a subscriber
+func (p *P2P) onInv(conn net.Conn, payload []byte) error {
+	p.mux.Lock()
+	callback, rawCallback, witness := p.callback, p.rawCallback, p.witness
+	p.mux.Unlock()
+	if callback == nil {
+		return nil
+	}
+	inv := wire.MsgInv{}
+	if err := inv.BtcDecode(bytes.NewReader(payload), wire.ProtocolVersion, wire.BaseEncoding); err != nil {
+		return err
+	}
+	getData := wire.NewMsgGetData()
+	for _, iv := range inv.InvList {
+		var nt NotificationType
+		t := iv.Type
+		switch iv.Type {
+		case wire.InvTypeBlock:
+			nt = NotificationNewBlock
+			if witness {
+				t = wire.InvTypeWitnessBlock
+			}
+		case wire.InvTypeTx:
+			nt = NotificationNewTx
+			if witness {
+				t = wire.InvTypeWitnessTx
+			}
+		default:
+			continue
+		}
+		if rawCallback == nil {
+			p.notifyCallback(nt)
+			continue
+		}
+		if err := getData.AddInvVect(wire.NewInvVect(t, &iv.Hash)); err != nil {
+			break
+		}
+	}
+	if len(getData.InvList) == 0 {
+		return nil
+	}
+	return p.write(conn, getData)
+}
+
+// onBlock passes the block to the waiting requests, the block which was not requested was announced
+func (p *P2P) onBlock(payload []byte) {
+	if len(payload) < wire.MaxBlockHeaderPayload {
+		glog.Error("p2p: invalid block of length ", len(payload))
+		return
+	}
+	hash := chainhash.DoubleHashH(payload[:wire.MaxBlockHeaderPayload])
+	if p.deliverBlock(hash, payload) {
+		return
+	}
+	var prev chainhash.Hash
+	copy(prev[:], payload[4:4+chainhash.HashSize])
+	p.mux.Lock()
+	p.addNextHash(prev.String(), hash.String())
+	rawCallback := p.rawCallback
+	p.mux.Unlock()
+	if rawCallback != nil {
+		rawCallback(NotificationNewBlock, payload)
+	}
+	p.notifyCallback(NotificationNewBlock)
+}
+
+func (p *P2P) onTx(payload []byte) {
+	p.mux.Lock()
+	rawCallback := p.rawCallback
+	p.mux.Unlock()
+	if rawCallback != nil {
+		rawCallback(NotificationNewTx, payload)
+	}
+	p.notifyCallback(NotificationNewTx)
+}
+
+// deliverBlock passes the block to the requests waiting for it, nil if the node does not have the block
+func (p *P2P) deliverBlock(hash chainhash.Hash, payload []byte) bool {
+	p.mux.Lock()
+	chs, found := p.blockRequests[hash]
+	delete(p.blockRequests, hash)
+	p.mux.Unlock()
+	for _, ch := range chs {
+		ch <- payload
+	}
+	return found
+}
+
+func (p *P2P) cancelBlockRequest(hash chainhash.Hash, ch chan []byte) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	chs := p.blockRequests[hash]
+	for i := range chs {
+		if chs[i] == ch {
+			chs = append(chs[:i], chs[i+1:]...)
+			break
+		}
+	}
+	if len(chs) == 0 {
+		delete(p.blockRequests, hash)
+	} else {
+		p.blockRequests[hash] = chs
+	}
+}
+
+// addNextHash stores the link to the next block, it must be called with the lock held
+func (p *P2P) addNextHash(hash, next string) {
+	if len(p.nextHashes) >= p2pMaxNextHashes {
+		p.nextHashes = make(map[string]string)
+	}
+	p.nextHashes[hash] = next
+}
+
+// GetBlock downloads the serialized block, ErrBlockNotFound is returned if the node does not have the block
+func (p *P2P) GetBlock(hash string) ([]byte, error) {
+	h, err := chainhash.NewHashFromStr(hash)
+	if err != nil {
+		return nil, err
+	}
+	conn, connDone, err := p.connection()
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan []byte, 1)
+	p.mux.Lock()
+	p.blockRequests[*h] = append(p.blockRequests[*h], ch)
+	witness := p.witness
+	p.mux.Unlock()
+	defer p.cancelBlockRequest(*h, ch)
+	t := wire.InvTypeBlock
+	if witness {
+		t = wire.InvTypeWitnessBlock
+	}
+	getData := wire.NewMsgGetData()
+	getData.AddInvVect(wire.NewInvVect(t, h))
+	if err = p.write(conn, getData); err != nil {
+		return nil, err
+	}
+	select {
+	case data := <-ch:
+		if data == nil {
+			return nil, ErrBlockNotFound
+		}
+		return data, nil
+	case <-connDone:
+		return nil, ErrP2PNotConnected
+	case <-time.After(p.timeout):
+		return nil, errors.Errorf("Timeout getting block %v", hash)
+	}
+}
+
+// NextBlockHash returns the hash of the block following the block in the active chain of the node,
+// empty string if it is the best block or if it cannot be determined
+func (p *P2P) NextBlockHash(hash string) string {
+	p.mux.Lock()
+	next, found := p.nextHashes[hash]
+	p.mux.Unlock()
+	if found {
+		return next
+	}
+	hashes, err := p.getHeaders(hash)
+	if err != nil {
+		glog.V(1).Info("p2p: getheaders ", hash, " error ", err)
+		return ""
+	}
+	if len(hashes) == 0 {
+		return ""
+	}
+	return hashes[0]
+}
+
+// getHeaders gets the hashes of up to 2000 blocks following the block, the node answers only one getheaders at a time
+func (p *P2P) getHeaders(hash string) ([]string, error) {
+	h, err := chainhash.NewHashFromStr(hash)
+	if err != nil {
+		return nil, err
+	}
+	p.headersMux.Lock()
+	defer p.headersMux.Unlock()
+	conn, connDone, err := p.connection()
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan []*wire.BlockHeader, 1)
+	p.mux.Lock()
+	p.headersRequest = ch
+	p.mux.Unlock()
+	defer func() {
+		p.mux.Lock()
+		p.headersRequest = nil
+		p.mux.Unlock()
+	}()
+	getHeaders := wire.NewMsgGetHeaders()
+	getHeaders.ProtocolVersion = wire.ProtocolVersion
+	getHeaders.AddBlockLocatorHash(h)
+	if err = p.write(conn, getHeaders); err != nil {
+		return nil, err
+	}
+	var headers []*wire.BlockHeader
+	select {
+	case headers = <-ch:
+	case <-connDone:
+		return nil, ErrP2PNotConnected
+	case <-time.After(p.timeout):
+		return nil, errors.Errorf("Timeout getting headers after %v", hash)
+	}
+	// the node does not know the block or the block is not in its active chain
+	if len(headers) == 0 || headers[0].PrevBlock != *h {
+		return nil, nil
+	}
+	hashes := make([]string, len(headers))
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	prev := hash
+	for i, hd := range headers {
+		hashes[i] = hd.BlockHash().String()
+		p.addNextHash(prev, hashes[i])
+		prev = hashes[i]
+	}
+	return hashes, nil
+}
+
+// writeP2PMessage writes the message with the header containing the network magic, the command, the length and the checksum of the payload
+func writeP2PMessage(w io.Writer, net wire.BitcoinNet, msg wire.Message) error {
+	var payload bytes.Buffer
+	if err := msg.BtcEncode(&payload, wire.ProtocolVersion, wire.WitnessEncoding); err != nil {
+		return err
+	}
+	return writeP2PPayload(w, net, msg.Command(), payload.Bytes())
+}
+
+func writeP2PPayload(w io.Writer, net wire.BitcoinNet, cmd string, payload []byte) error {
+	hdr := make([]byte, wire.MessageHeaderSize, wire.MessageHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(hdr, uint32(net))
+	copy(hdr[4:4+wire.CommandSize], cmd)
+	binary.LittleEndian.PutUint32(hdr[16:], uint32(len(payload)))
+	copy(hdr[20:], chainhash.DoubleHashB(payload)[:4])
+	_, err := w.Write(append(hdr, payload...))
+	return err
+}
+
+// readP2PMessage reads the command and the payload of the next message, the payload is not decoded
+// so that the blocks and transactions can be passed to the parser as they were received
+func readP2PMessage(r io.Reader, net wire.BitcoinNet) (string, []byte, error) {
+	var hdr [wire.MessageHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return "", nil, err
+	}
+	if magic := wire.BitcoinNet(binary.LittleEndian.Uint32(hdr[:])); magic != net {
+		return "", nil, errors.Errorf("Unexpected network magic %v", magic)
+	}
+	cmd := string(bytes.TrimRight(hdr[4:4+wire.CommandSize], "\x00"))
+	length := binary.LittleEndian.Uint32(hdr[16:])
+	if length > wire.MaxMessagePayload {
+		return "", nil, errors.Errorf("Message %v of size %v exceeds the maximum size", cmd, length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return "", nil, err
+	}
+	if !bytes.Equal(chainhash.DoubleHashB(payload)[:4], hdr[20:]) {
+		return "", nil, errors.Errorf("Invalid checksum of message %v", cmd)
+	}
+	return cmd, payload, nil
+}
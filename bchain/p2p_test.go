@@ -0,0 +1,330 @@
+package bchain
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/martinboehm/btcd/chaincfg/chainhash"
+	"github.com/martinboehm/btcd/wire"
+)
+
+const testP2PNet = wire.TestNet3
+
+// testP2PNode is an in-process stand-in of a node, which serves the blocks of its chain over the p2p protocol
+type testP2PNode struct {
+	t          *testing.T
+	listener   net.Listener
+	mux        sync.Mutex
+	conn       net.Conn
+	blocks     []*wire.MsgBlock
+	txs        map[chainhash.Hash]*wire.MsgTx
+	getHeaders int32
+	getData    int32
+}
+
+func newTestP2PNode(t *testing.T, blocks []*wire.MsgBlock) *testP2PNode {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &testP2PNode{t: t, listener: l, blocks: blocks, txs: make(map[chainhash.Hash]*wire.MsgTx)}
+	go n.serve()
+	return n
+}
+
+func (n *testP2PNode) serve() {
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			return
+		}
+		n.mux.Lock()
+		n.conn = conn
+		n.mux.Unlock()
+		go n.handle(conn)
+	}
+}
+
+func (n *testP2PNode) send(msg wire.Message) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if n.conn != nil {
+		if err := writeP2PMessage(n.conn, testP2PNet, msg); err != nil {
+			n.t.Log("node: ", err)
+		}
+	}
+}
+
+func (n *testP2PNode) block(hash chainhash.Hash) (int, *wire.MsgBlock) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	for i, b := range n.blocks {
+		if b.BlockHash() == hash {
+			return i, b
+		}
+	}
+	return -1, nil
+}
+
+func (n *testP2PNode) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		cmd, payload, err := readP2PMessage(conn, testP2PNet)
+		if err != nil {
+			return
+		}
+		r := bytes.NewReader(payload)
+		switch cmd {
+		case wire.CmdVersion:
+			me := wire.NewNetAddressIPPort(net.IPv4(127, 0, 0, 1), 0, wire.SFNodeNetwork|wire.SFNodeWitness)
+			n.mux.Lock()
+			height := int32(len(n.blocks) - 1)
+			n.mux.Unlock()
+			v := wire.NewMsgVersion(me, me, 1, height)
+			v.Services = wire.SFNodeNetwork | wire.SFNodeWitness
+			n.send(v)
+			n.send(wire.NewMsgVerAck())
+			// messages which are not used must be ignored
+			n.send(&wire.MsgSendHeaders{})
+			n.send(wire.NewMsgPing(42))
+		case wire.CmdGetHeaders:
+			atomic.AddInt32(&n.getHeaders, 1)
+			gh := wire.MsgGetHeaders{}
+			if err = gh.BtcDecode(r, wire.ProtocolVersion, wire.BaseEncoding); err != nil {
+				n.t.Error(err)
+				return
+			}
+			headers := wire.NewMsgHeaders()
+			if i, _ := n.block(*gh.BlockLocatorHashes[0]); i >= 0 {
+				n.mux.Lock()
+				for _, b := range n.blocks[i+1:] {
+					h := b.Header
+					headers.AddBlockHeader(&h)
+				}
+				n.mux.Unlock()
+			}
+			n.send(headers)
+		case wire.CmdGetData:
+			atomic.AddInt32(&n.getData, 1)
+			gd := wire.MsgGetData{}
+			if err = gd.BtcDecode(r, wire.ProtocolVersion, wire.BaseEncoding); err != nil {
+				n.t.Error(err)
+				return
+			}
+			notFound := wire.NewMsgNotFound()
+			for _, iv := range gd.InvList {
+				switch iv.Type {
+				case wire.InvTypeWitnessBlock:
+					if _, b := n.block(iv.Hash); b != nil {
+						n.send(b)
+						continue
+					}
+				case wire.InvTypeWitnessTx:
+					n.mux.Lock()
+					tx := n.txs[iv.Hash]
+					n.mux.Unlock()
+					if tx != nil {
+						n.send(tx)
+						continue
+					}
+				default:
+					n.t.Errorf("unexpected inv type %v", iv.Type)
+				}
+				notFound.AddInvVect(iv)
+			}
+			if len(notFound.InvList) > 0 {
+				n.send(notFound)
+			}
+		}
+	}
+}
+
+// newTestP2PBlock creates a block with a single coinbase transaction
+func newTestP2PBlock(prev chainhash.Hash, i byte) *wire.MsgBlock {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		SignatureScript:  []byte{0x51, i},
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	tx.AddTxOut(&wire.TxOut{Value: 5000000000, PkScript: []byte{0x51}})
+	b := &wire.MsgBlock{Header: wire.BlockHeader{
+		Version:    1,
+		PrevBlock:  prev,
+		MerkleRoot: tx.TxHash(),
+		Timestamp:  time.Unix(1500000000+int64(i)*600, 0),
+		Bits:       0x207fffff,
+	}}
+	b.AddTransaction(tx)
+	return b
+}
+
+func waitForTestP2P(t *testing.T, what string, cond func() bool) {
+	for i := 0; i < 500; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timeout waiting for ", what)
+}
+
+func TestP2P(t *testing.T) {
+	var blocks []*wire.MsgBlock
+	var prev chainhash.Hash
+	for i := byte(0); i < 4; i++ {
+		b := newTestP2PBlock(prev, i)
+		blocks = append(blocks, b)
+		prev = b.BlockHash()
+	}
+	node := newTestP2PNode(t, blocks)
+	defer node.listener.Close()
+
+	p := NewP2P(node.listener.Addr().String(), uint32(testP2PNet), 5*time.Second)
+	p.reconnectInterval = 50 * time.Millisecond
+	p.Start()
+	defer p.Close()
+	waitForTestP2P(t, "connection", func() bool {
+		_, _, err := p.connection()
+		return err == nil
+	})
+
+	// blocks are downloaded as they were serialized by the node
+	for _, b := range blocks {
+		data, err := p.GetBlock(b.BlockHash().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want bytes.Buffer
+		if err = b.Serialize(&want); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, want.Bytes()) {
+			t.Errorf("GetBlock(%v) = %x, want %x", b.BlockHash(), data, want.Bytes())
+		}
+	}
+	if _, err := p.GetBlock(newTestP2PBlock(prev, 99).BlockHash().String()); err != ErrBlockNotFound {
+		t.Errorf("GetBlock() of unknown block error = %v, want ErrBlockNotFound", err)
+	}
+
+	// the links to the next blocks are taken from a single getheaders request
+	for i := 0; i < len(blocks)-1; i++ {
+		if got, want := p.NextBlockHash(blocks[i].BlockHash().String()), blocks[i+1].BlockHash().String(); got != want {
+			t.Errorf("NextBlockHash(%v) = %v, want %v", i, got, want)
+		}
+	}
+	if got := atomic.LoadInt32(&node.getHeaders); got != 1 {
+		t.Errorf("getheaders requests = %v, want 1", got)
+	}
+	if got := p.NextBlockHash(prev.String()); got != "" {
+		t.Errorf("NextBlockHash() of the best block = %v, want empty", got)
+	}
+
+	// without a subscriber the announcements are ignored
+	getData := atomic.LoadInt32(&node.getData)
+	tx := newTestP2PBlock(prev, 100).Transactions[0]
+	txHash := tx.TxHash()
+	node.mux.Lock()
+	node.txs[txHash] = tx
+	node.mux.Unlock()
+	inv := wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeTx, &txHash))
+	node.send(inv)
+	// the messages are processed in order, the inv is processed before the requested block is received
+	if _, err := p.GetBlock(blocks[0].BlockHash().String()); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&node.getData) - getData; got != 1 {
+		t.Errorf("getdata requests = %v, want 1", got)
+	}
+
+	// a new block and a transaction are announced, they are downloaded and passed to the subscriber
+	var notificationsMux sync.Mutex
+	var notifications []NotificationType
+	raw := make(map[NotificationType][]byte)
+	p.Subscribe(func(nt NotificationType) {
+		notificationsMux.Lock()
+		notifications = append(notifications, nt)
+		notificationsMux.Unlock()
+	}, func(nt NotificationType, payload []byte) {
+		notificationsMux.Lock()
+		raw[nt] = payload
+		notificationsMux.Unlock()
+	})
+	b4 := newTestP2PBlock(prev, 4)
+	b4Hash := b4.BlockHash()
+	node.mux.Lock()
+	node.blocks = append(node.blocks, b4)
+	node.mux.Unlock()
+	inv = wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, &b4Hash))
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeTx, &txHash))
+	node.send(inv)
+	waitForTestP2P(t, "notifications", func() bool {
+		notificationsMux.Lock()
+		defer notificationsMux.Unlock()
+		return len(raw) == 2 && len(notifications) >= 2
+	})
+	var wantBlock, wantTx bytes.Buffer
+	b4.Serialize(&wantBlock)
+	tx.Serialize(&wantTx)
+	notificationsMux.Lock()
+	if !bytes.Equal(raw[NotificationNewBlock], wantBlock.Bytes()) {
+		t.Errorf("raw block = %x, want %x", raw[NotificationNewBlock], wantBlock.Bytes())
+	}
+	if !bytes.Equal(raw[NotificationNewTx], wantTx.Bytes()) {
+		t.Errorf("raw tx = %x, want %x", raw[NotificationNewTx], wantTx.Bytes())
+	}
+	var newBlock, newTx bool
+	for _, nt := range notifications {
+		newBlock = newBlock || nt == NotificationNewBlock
+		newTx = newTx || nt == NotificationNewTx
+	}
+	if !newBlock || !newTx {
+		t.Errorf("notifications = %v, want NotificationNewBlock and NotificationNewTx", notifications)
+	}
+	notificationsMux.Unlock()
+	// the announced block extends the chain
+	if got := p.NextBlockHash(prev.String()); got != b4Hash.String() {
+		t.Errorf("NextBlockHash() of the announced block = %v, want %v", got, b4Hash)
+	}
+
+	// the connection is lost, the requests fail until it is reestablished
+	node.mux.Lock()
+	node.conn.Close()
+	node.mux.Unlock()
+	waitForTestP2P(t, "disconnection", func() bool {
+		_, err := p.GetBlock(b4Hash.String())
+		return err == ErrP2PNotConnected
+	})
+	waitForTestP2P(t, "reconnection", func() bool {
+		_, err := p.GetBlock(b4Hash.String())
+		return err == nil
+	})
+}
+
+func TestP2PMessage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeP2PMessage(&buf, testP2PNet, wire.NewMsgPing(7)); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	cmd, payload, err := readP2PMessage(bytes.NewReader(data), testP2PNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd != wire.CmdPing || len(payload) != 8 {
+		t.Errorf("readP2PMessage() = %v %x, want ping with 8 bytes payload", cmd, payload)
+	}
+	if _, _, err = readP2PMessage(bytes.NewReader(data), wire.MainNet); err == nil {
+		t.Error("message of other network accepted")
+	}
+	data[len(data)-1] ^= 1
+	if _, _, err = readP2PMessage(bytes.NewReader(data), testP2PNet); err == nil {
+		t.Error("message with invalid checksum accepted")
+	}
+}
@@ -0,0 +1,259 @@
+package bchain
+
+import (
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+const (
+	// RPCPoolCheckInterval is the interval of the health checks of the endpoints
+	RPCPoolCheckInterval = 10 * time.Second
+	// rpcPoolMaxLag is the number of blocks by which an endpoint can be behind the best endpoint and still be considered synchronized
+	rpcPoolMaxLag = 1
+)
+
+// RPCEndpointProbe returns the best height of the backend at the url, it is used for the health checks
+type RPCEndpointProbe func(url string) (uint32, error)
+
+// RPCPoolChain is implemented by the BlockChain types which use RPCPool
+type RPCPoolChain interface {
+	RPCPool() *RPCPool
+}
+
+type rpcEndpoint struct {
+	url        string
+	healthy    bool
+	bestHeight uint32
+	latency    time.Duration
+}
+
+// RPCPool tracks the health, best height and latency of multiple endpoints of the same backend.
+// The synchronization uses one pinned endpoint, which is changed only if it becomes unhealthy or falls behind,
+// so that the index does not flap between the forks seen by different endpoints.
+// The reads which do not have to be consistent with the synchronization use the healthy endpoint with the lowest latency.
+type RPCPool struct {
+	endpoints []*rpcEndpoint
+	pinned    int
+	mux       sync.Mutex
+	probe     RPCEndpointProbe
+	done      chan struct{}
+	// ObserveLatency, if set, receives the result of each health check of an endpoint
+	ObserveLatency func(url string, latency time.Duration, err error)
+}
+
+// NewRPCPool creates RPCPool of the urls, the first url is initially pinned
+func NewRPCPool(urls []string, probe RPCEndpointProbe) (*RPCPool, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("No rpc url configured")
+	}
+	p := &RPCPool{
+		endpoints: make([]*rpcEndpoint, len(urls)),
+		probe:     probe,
+	}
+	for i, u := range urls {
+		// the state of the endpoints is unknown until the first health check, assume they are healthy
+		p.endpoints[i] = &rpcEndpoint{url: u, healthy: true}
+	}
+	return p, nil
+}
+
+// EndpointName returns the host of the url, without the path, which can contain an api key
+func EndpointName(u string) string {
+	if pu, err := url.Parse(u); err == nil && pu.Host != "" {
+		return pu.Host
+	}
+	return u
+}
+
+// Len returns the number of endpoints
+func (p *RPCPool) Len() int {
+	return len(p.endpoints)
+}
+
+// Pinned returns the url of the endpoint used by the synchronization
+func (p *RPCPool) Pinned() string {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.endpoints[p.pinned].url
+}
+
+func (p *RPCPool) maxHeight() uint32 {
+	var max uint32
+	for _, e := range p.endpoints {
+		if e.healthy && e.bestHeight > max {
+			max = e.bestHeight
+		}
+	}
+	return max
+}
+
+func (p *RPCPool) inSync(e *rpcEndpoint, maxHeight uint32) bool {
+	return e.healthy && e.bestHeight+rpcPoolMaxLag >= maxHeight
+}
+
+// repin changes the pinned endpoint if it is not synchronized, to the endpoint with the highest best height
+// and the lowest latency, it must be called with the lock held
+func (p *RPCPool) repin() {
+	maxHeight := p.maxHeight()
+	if p.inSync(p.endpoints[p.pinned], maxHeight) {
+		return
+	}
+	best := -1
+	for i, e := range p.endpoints {
+		if !p.inSync(e, maxHeight) {
+			continue
+		}
+		if best < 0 || e.bestHeight > p.endpoints[best].bestHeight ||
+			(e.bestHeight == p.endpoints[best].bestHeight && e.latency < p.endpoints[best].latency) {
+			best = i
+		}
+	}
+	if best >= 0 && best != p.pinned {
+		glog.Warningf("rpc: endpoint %v not synchronized, synchronization switched to endpoint %v at height %v",
+			EndpointName(p.endpoints[p.pinned].url), EndpointName(p.endpoints[best].url), p.endpoints[best].bestHeight)
+		p.pinned = best
+	}
+}
+
+// SyncURLs returns the urls for the requests of the synchronization, the pinned endpoint first,
+// the other endpoints are used only if the pinned endpoint cannot be reached
+func (p *RPCPool) SyncURLs() []string {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	urls := make([]string, 0, len(p.endpoints))
+	urls = append(urls, p.endpoints[p.pinned].url)
+	for _, i := range p.orderByLatency() {
+		if i != p.pinned {
+			urls = append(urls, p.endpoints[i].url)
+		}
+	}
+	return urls
+}
+
+// ReadURLs returns the urls for the requests which do not have to be consistent with the synchronization,
+// the healthy endpoints which are not behind the pinned endpoint ordered by latency first
+func (p *RPCPool) ReadURLs() []string {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	pinnedHeight := p.endpoints[p.pinned].bestHeight
+	urls := make([]string, 0, len(p.endpoints))
+	var others []string
+	for _, i := range p.orderByLatency() {
+		e := p.endpoints[i]
+		if i == p.pinned || (e.healthy && e.bestHeight >= pinnedHeight) {
+			urls = append(urls, e.url)
+		} else {
+			others = append(others, e.url)
+		}
+	}
+	return append(urls, others...)
+}
+
+// orderByLatency returns the indexes of the endpoints, the healthy endpoints ordered by latency first
+func (p *RPCPool) orderByLatency() []int {
+	idx := make([]int, len(p.endpoints))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		ei, ej := p.endpoints[idx[i]], p.endpoints[idx[j]]
+		if ei.healthy != ej.healthy {
+			return ei.healthy
+		}
+		return ei.latency < ej.latency
+	})
+	return idx
+}
+
+// ReportFailure marks the endpoint which could not be reached as unhealthy until the next successful health check
+func (p *RPCPool) ReportFailure(u string, err error) {
+	if len(p.endpoints) == 1 {
+		return
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for _, e := range p.endpoints {
+		if e.url == u && e.healthy {
+			glog.Warning("rpc: endpoint ", EndpointName(u), " failed: ", err)
+			e.healthy = false
+		}
+	}
+	p.repin()
+}
+
+// CheckHealth probes all endpoints in parallel and updates their state
+func (p *RPCPool) CheckHealth() {
+	type result struct {
+		height  uint32
+		latency time.Duration
+		err     error
+	}
+	results := make([]result, len(p.endpoints))
+	var wg sync.WaitGroup
+	for i := range p.endpoints {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			start := time.Now()
+			h, err := p.probe(u)
+			results[i] = result{h, time.Since(start), err}
+			if p.ObserveLatency != nil {
+				p.ObserveLatency(u, results[i].latency, err)
+			}
+		}(i, p.endpoints[i].url)
+	}
+	wg.Wait()
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for i, e := range p.endpoints {
+		r := results[i]
+		if r.err != nil {
+			if e.healthy {
+				glog.Warning("rpc: endpoint ", EndpointName(e.url), " health check failed: ", r.err)
+			}
+			e.healthy = false
+			continue
+		}
+		if !e.healthy {
+			glog.Info("rpc: endpoint ", EndpointName(e.url), " is healthy at height ", r.height)
+		}
+		e.healthy = true
+		e.bestHeight = r.height
+		e.latency = r.latency
+	}
+	p.repin()
+}
+
+// Start runs the periodic health checks of the endpoints, there is nothing to check if there is only one endpoint
+func (p *RPCPool) Start(interval time.Duration) {
+	if len(p.endpoints) < 2 || p.done != nil {
+		return
+	}
+	done := make(chan struct{})
+	p.done = done
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				p.CheckHealth()
+			}
+		}
+	}()
+}
+
+// Stop stops the health checks
+func (p *RPCPool) Stop() {
+	if p.done != nil {
+		close(p.done)
+		p.done = nil
+	}
+}
@@ -0,0 +1,109 @@
+package bchain
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testEndpoint struct {
+	height uint32
+	err    error
+}
+
+func newTestRPCPool(t *testing.T, endpoints map[string]*testEndpoint, urls ...string) *RPCPool {
+	p, err := NewRPCPool(urls, func(url string) (uint32, error) {
+		e := endpoints[url]
+		return e.height, e.err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func setTestLatencies(p *RPCPool, latencies ...time.Duration) {
+	for i, l := range latencies {
+		p.endpoints[i].latency = l
+	}
+}
+
+func TestRPCPool(t *testing.T) {
+	if _, err := NewRPCPool(nil, nil); err == nil {
+		t.Fatal("NewRPCPool without urls must fail")
+	}
+	endpoints := map[string]*testEndpoint{
+		"http://a:8030": {height: 100},
+		"http://b:8030": {height: 100},
+		"http://c:8030": {height: 101},
+	}
+	p := newTestRPCPool(t, endpoints, "http://a:8030", "http://b:8030", "http://c:8030")
+	if got := p.Pinned(); got != "http://a:8030" {
+		t.Fatalf("Pinned() = %v, want http://a:8030", got)
+	}
+
+	// a is behind c by one block, which is tolerated, the sync stays pinned
+	p.CheckHealth()
+	setTestLatencies(p, 30*time.Millisecond, 10*time.Millisecond, 20*time.Millisecond)
+	if got := p.Pinned(); got != "http://a:8030" {
+		t.Errorf("Pinned() = %v, want http://a:8030", got)
+	}
+	if got, want := p.SyncURLs(), []string{"http://a:8030", "http://b:8030", "http://c:8030"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SyncURLs() = %v, want %v", got, want)
+	}
+	if got, want := p.ReadURLs(), []string{"http://b:8030", "http://c:8030", "http://a:8030"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadURLs() = %v, want %v", got, want)
+	}
+
+	// a falls behind, the sync is switched to the endpoint with the highest block
+	endpoints["http://c:8030"].height = 102
+	p.CheckHealth()
+	setTestLatencies(p, 30*time.Millisecond, 10*time.Millisecond, 20*time.Millisecond)
+	if got := p.Pinned(); got != "http://c:8030" {
+		t.Errorf("Pinned() = %v, want http://c:8030", got)
+	}
+	// the endpoints behind the pinned endpoint are used for reads only as the last resort
+	if got, want := p.ReadURLs(), []string{"http://c:8030", "http://b:8030", "http://a:8030"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadURLs() = %v, want %v", got, want)
+	}
+
+	// c cannot be reached, the sync is switched to a healthy endpoint
+	endpoints["http://b:8030"].height = 102
+	p.CheckHealth()
+	p.ReportFailure("http://c:8030", errors.New("connection refused"))
+	if got := p.Pinned(); got != "http://b:8030" {
+		t.Errorf("Pinned() = %v, want http://b:8030", got)
+	}
+
+	// c is healthy again, but the sync stays on b
+	p.CheckHealth()
+	if got := p.Pinned(); got != "http://b:8030" {
+		t.Errorf("Pinned() = %v, want http://b:8030", got)
+	}
+
+	// all endpoints fail, the pinned endpoint is kept
+	for _, e := range endpoints {
+		e.err = errors.New("timeout")
+	}
+	p.CheckHealth()
+	if got := p.Pinned(); got != "http://b:8030" {
+		t.Errorf("Pinned() = %v, want http://b:8030", got)
+	}
+}
+
+func TestEndpointName(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "http://127.0.0.1:8030", want: "127.0.0.1:8030"},
+		{url: "wss://mainnet.infura.io/ws/v3/secretkey", want: "mainnet.infura.io"},
+		{url: "invalid", want: "invalid"},
+	}
+	for _, tt := range tests {
+		if got := EndpointName(tt.url); got != tt.want {
+			t.Errorf("EndpointName(%v) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
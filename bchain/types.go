@@ -93,6 +93,9 @@ type Tx struct {
 type Block struct {
 	BlockHeader
 	Txs []Tx `json:"tx"`
+	// RawHeader is the serialized header of the block including the coin specific data preceding the transactions (e.g. Auxpow),
+	// it is set by the parsers of the raw blocks, otherwise the sync gets it from the backend
+	RawHeader []byte `json:"-"`
 }
 
 // BlockHeader contains limited data (as needed for indexing) from backend block header
@@ -167,6 +170,24 @@ func (ad AddressDescriptor) String() string {
 	return "ad:" + hex.EncodeToString(ad)
 }
 
+// ScriptType is the type of the output script of an address descriptor
+type ScriptType int
+
+const (
+	// ScriptTypeUnknown is a script that is not recognized by the parser
+	ScriptTypeUnknown = ScriptType(iota)
+	// ScriptTypeP2PKH is a pay to public key hash script
+	ScriptTypeP2PKH
+	// ScriptTypeP2SH is a pay to script hash script
+	ScriptTypeP2SH
+	// ScriptTypeP2WPKH is a segwit v0 pay to witness public key hash script
+	ScriptTypeP2WPKH
+	// ScriptTypeP2WSH is a segwit v0 pay to witness script hash script
+	ScriptTypeP2WSH
+	// ScriptTypeP2TR is a segwit v1 pay to taproot script
+	ScriptTypeP2TR
+)
+
 // EthereumType specific
 
 // Erc20Contract contains info about ERC20 contract
@@ -177,12 +198,53 @@ type Erc20Contract struct {
 	Decimals int    `json:"decimals"`
 }
 
-// Erc20Transfer contains a single ERC20 token transfer
+// TokenType - standard of the token contract
+type TokenType int
+
+const (
+	// ERC20TokenType is a fungible token
+	ERC20TokenType = TokenType(iota)
+	// ERC721TokenType is a non-fungible token, each token has its own id
+	ERC721TokenType
+	// ERC1155TokenType is a multi token, there can be any amount of tokens of each id
+	ERC1155TokenType
+)
+
+// TokenIDValue contains the id of ERC721 or ERC1155 token and the amount of tokens with this id
+type TokenIDValue struct {
+	ID    big.Int
+	Value big.Int
+}
+
+// Erc20Transfer contains a single ERC20, ERC721 or ERC1155 token transfer
+// Tokens is the amount of ERC20 tokens, IDValues contain the ids and amounts of ERC721 and ERC1155 tokens
 type Erc20Transfer struct {
+	Type     TokenType
 	Contract string
 	From     string
 	To       string
 	Tokens   big.Int
+	IDValues []TokenIDValue
+}
+
+// EthereumInternalTransferType - type of the internal transfer
+type EthereumInternalTransferType int
+
+const (
+	// InternalTransferTypeCall is ETH sent by a call to an address
+	InternalTransferTypeCall = EthereumInternalTransferType(iota)
+	// InternalTransferTypeCreate is a contract created by another contract
+	InternalTransferTypeCreate
+	// InternalTransferTypeSelfDestruct is the balance of a destroyed contract sent to the beneficiary
+	InternalTransferTypeSelfDestruct
+)
+
+// EthereumInternalTransfer contains a single ETH transfer done by a contract call inside a transaction
+type EthereumInternalTransfer struct {
+	Type  EthereumInternalTransferType
+	From  string
+	To    string
+	Value big.Int
 }
 
 // MempoolTxidEntry contains mempool txid with first seen time
@@ -245,6 +307,43 @@ type BlockChain interface {
 	EthereumTypeGetErc20ContractBalance(addrDesc, contractDesc AddressDescriptor) (*big.Int, error)
 }
 
+// BatchBlockChain is implemented by the BlockChain types which can send multiple requests to the backend at once
+type BatchBlockChain interface {
+	// RPCBatchSize returns the maximal number of requests sent at once, the batch requests are not used if it is less than 2
+	RPCBatchSize() int
+	// GetBlockHashes returns the hashes of the blocks at the heights, ErrBlockNotFound if any of the blocks does not exist
+	GetBlockHashes(heights []uint32) ([]string, error)
+	// GetBlockInfos returns the block infos of the blocks, ErrBlockNotFound if any of the blocks does not exist
+	GetBlockInfos(hashes []string) ([]*BlockInfo, error)
+	// GetTransactionsBatch returns the transactions as GetTransactionForMempool, the transactions not found are omitted
+	GetTransactionsBatch(txids []string) (map[string]*Tx, error)
+}
+
+// GetBatchBlockChain returns the chain as BatchBlockChain if it supports the batch requests, otherwise nil
+func GetBatchBlockChain(chain BlockChain) BatchBlockChain {
+	if bc, ok := chain.(BatchBlockChain); ok && bc.RPCBatchSize() > 1 {
+		return bc
+	}
+	return nil
+}
+
+// RawBlockHeaderChain is implemented by the BlockChain types which can get the serialized block header from the backend,
+// it is used for the blocks whose RawHeader is not set by the parser
+type RawBlockHeaderChain interface {
+	// RawBlockHeaders returns true if the backend supports GetBlockHeaderRaw
+	RawBlockHeaders() bool
+	// GetBlockHeaderRaw returns the serialized header of the block, ErrBlockNotFound if the block does not exist
+	GetBlockHeaderRaw(hash string) ([]byte, error)
+}
+
+// GetRawBlockHeaderChain returns the chain as RawBlockHeaderChain if it supports the raw block headers, otherwise nil
+func GetRawBlockHeaderChain(chain BlockChain) RawBlockHeaderChain {
+	if rc, ok := chain.(RawBlockHeaderChain); ok && rc.RawBlockHeaders() {
+		return rc
+	}
+	return nil
+}
+
 // BlockChainParser defines common interface to parsing and conversions of block chain data
 type BlockChainParser interface {
 	// type of the blockchain
@@ -265,6 +364,7 @@ type BlockChainParser interface {
 	GetAddressesFromAddrDesc(addrDesc AddressDescriptor) ([]string, bool, error)
 	GetScriptFromAddrDesc(addrDesc AddressDescriptor) ([]byte, error)
 	IsAddrDescIndexable(addrDesc AddressDescriptor) bool
+	GetScriptType(addrDesc AddressDescriptor) ScriptType
 	// transactions
 	PackedTxidLen() int
 	PackTxid(txid string) ([]byte, error)
@@ -284,6 +384,7 @@ type BlockChainParser interface {
 	DeriveAddressDescriptorsFromTo(xpub string, change uint32, fromIndex uint32, toIndex uint32) ([]AddressDescriptor, error)
 	// EthereumType specific
 	EthereumTypeGetErc20FromTx(tx *Tx) ([]Erc20Transfer, error)
+	EthereumTypeGetInternalTransfersFromTx(tx *Tx) ([]EthereumInternalTransfer, error)
 }
 
 // Mempool defines common interface to mempool
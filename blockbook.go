@@ -6,9 +6,12 @@ import (
 	"blockbook/bchain/coins"
 	"blockbook/common"
 	"blockbook/db"
+	"blockbook/fiat"
 	"blockbook/server"
 	"context"
+	"encoding/json"
 	"flag"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"net/http"
@@ -44,6 +47,7 @@ var (
 	dbPath         = flag.String("datadir", "./data", "path to database directory")
 	dbCache        = flag.Int("dbcache", 1<<29, "size of the rocksdb cache")
 	dbMaxOpenFiles = flag.Int("dbmaxopenfiles", 1<<14, "max open files by rocksdb")
+	blockFilter    = flag.Bool("blockfilter", false, "compute and store BIP158 block filters of the indexed blocks (Bitcoin type coins only)")
 
 	blockFrom      = flag.Int("blockheight", -1, "height of the starting block")
 	blockUntil     = flag.Int("blockuntil", -1, "height of the final block")
@@ -51,11 +55,17 @@ var (
 
 	synchronize = flag.Bool("sync", false, "synchronizes until tip, if together with zeromq, keeps index synchronized")
 	repair      = flag.Bool("repair", false, "repair the database")
+	checkpoint  = flag.String("checkpoint", "", "create a checkpoint of the database in the given directory and exit")
 	prof        = flag.String("prof", "", "http server binding [address]:port of the interface to profiling data /debug/pprof/ (default no profiling)")
 
+	exportSnapshot = flag.String("exportsnapshot", "", "export the database to a portable snapshot file and exit")
+	importSnapshot = flag.String("importsnapshot", "", "create the database in datadir from a portable snapshot file and exit")
+	migrate        = flag.Bool("migrate", false, "migrate the database to the current data format version and exit (the migration is run also on every start)")
+
 	syncChunk   = flag.Int("chunk", 100, "block chunk size for processing in bulk mode")
 	syncWorkers = flag.Int("workers", 8, "number of workers to process blocks in bulk mode")
 	dryRun      = flag.Bool("dryrun", false, "do not index blocks, only download")
+	blocksDir   = flag.String("blocksdir", "", "blocks directory of the backend, the initial sync imports the blocks from its block files (blk*.dat) instead of getting them using RPC (Bitcoin type coins only)")
 
 	debugMode = flag.Bool("debug", false, "debug mode, return more verbose errors, reload templates on each request")
 
@@ -67,9 +77,17 @@ var (
 
 	explorerURL = flag.String("explorer", "", "address of blockchain explorer")
 
+	aliasesFile = flag.String("aliases", "", "path to json file with aliases of addresses in the format {\"<address>\":\"<alias>\"} (default no aliases)")
+
 	noTxCache = flag.Bool("notxcache", false, "disable tx cache")
 
+	xpubCacheSize = flag.Int("xpubcachesize", 10000, "maximum number of xpubs stored in the persistent xpub cache, 0 disables the persistent cache (Bitcoin type coins only)")
+	xpubGap       = flag.Int("xpubgap", 20, "gap of unused addresses when deriving xpub addresses if the request does not specify it")
+	xpubMaxGap    = flag.Int("xpubmaxgap", 10000, "maximum gap of unused addresses allowed in xpub requests")
+
 	computeColumnStats  = flag.Bool("computedbstats", false, "compute column stats and exit")
+	checkDB             = flag.Bool("checkdb", false, "check consistency of the database in blockheight-blockuntil range (default the whole index) and exit")
+	checkDBRepair       = flag.Bool("checkdbrepair", false, "repair the balances of the addresses found inconsistent by -checkdb")
 	computeFeeStatsFlag = flag.Bool("computefeestats", false, "compute fee stats for blocks in blockheight-blockuntil range and exit")
 	dbStatsPeriodHours  = flag.Int("dbstatsperiod", 24, "period of db stats collection in hours, 0 disables stats collection")
 
@@ -78,6 +96,11 @@ var (
 
 	// resync mempool at least each resyncMempoolPeriodMs (could be more often if invoked by message from ZeroMQ)
 	resyncMempoolPeriodMs = flag.Int("resyncmempoolperiod", 60017, "resync mempool period in milliseconds")
+
+	readOnly = flag.Bool("readonly", false, "open the database in datadir read-only, the index is maintained by another blockbook instance with -sync running on the same datadir")
+
+	// catch up the read-only index at least each catchUpPeriodMs (could be more often if invoked by message from ZeroMQ)
+	catchUpPeriodMs = flag.Int("catchupperiod", 10007, "period in milliseconds of catching up the read-only index with the primary instance")
 )
 
 var (
@@ -96,6 +119,7 @@ var (
 	internalState              *common.InternalState
 	callbacksOnNewBlock        []bchain.OnNewBlockFunc
 	callbacksOnNewTxAddr       []bchain.OnNewTxAddrFunc
+	callbacksOnNewFiatRates    []fiat.OnNewFiatRatesTicker
 	chanOsSignal               chan os.Signal
 	inShutdown                 int32
 )
@@ -135,6 +159,12 @@ func mainWithExitCode() int {
 		}()
 	}
 
+	if *readOnly && (*synchronize || *repair || *migrate || *rollbackHeight >= 0 || (*blockFrom >= 0 && !*checkDB) || *checkDBRepair ||
+		*checkpoint != "" || *importSnapshot != "" || *computeColumnStats || *computeFeeStatsFlag) {
+		glog.Error("Parameter -readonly cannot be combined with parameters modifying the database")
+		return exitCodeFatal
+	}
+
 	if *repair {
 		if err := db.RepairRocksDB(*dbPath); err != nil {
 			glog.Errorf("RepairRocksDB %s: %v", *dbPath, err)
@@ -154,6 +184,18 @@ func mainWithExitCode() int {
 		return exitCodeFatal
 	}
 
+	if *aliasesFile != "" {
+		if err = api.LoadAddressAliases(*aliasesFile); err != nil {
+			glog.Error("aliases: ", err)
+			return exitCodeFatal
+		}
+	}
+
+	if err = api.SetXpubAddressesGap(*xpubGap, *xpubMaxGap); err != nil {
+		glog.Error("xpub: ", err)
+		return exitCodeFatal
+	}
+
 	// gspt.SetProcTitle("blockbook-" + normalizeName(coin))
 
 	metrics, err = common.GetMetrics(coin)
@@ -167,12 +209,37 @@ func mainWithExitCode() int {
 		return exitCodeFatal
 	}
 
-	index, err = db.NewRocksDB(*dbPath, *dbCache, *dbMaxOpenFiles, chain.GetChainParser(), metrics)
+	if *importSnapshot != "" {
+		if _, err = db.ImportSnapshot(*importSnapshot, *dbPath, *dbCache, *dbMaxOpenFiles, chain.GetChainParser(), coin); err != nil {
+			glog.Error("importSnapshot: ", err)
+			return exitCodeFatal
+		}
+		return exitCodeOK
+	}
+
+	if *readOnly {
+		index, err = db.NewRocksDBReadOnly(*dbPath, *dbCache, *dbMaxOpenFiles, chain.GetChainParser(), metrics)
+	} else {
+		index, err = db.NewRocksDB(*dbPath, *dbCache, *dbMaxOpenFiles, chain.GetChainParser(), metrics)
+	}
 	if err != nil {
 		glog.Error("rocksDB: ", err)
 		return exitCodeFatal
 	}
 	defer index.Close()
+	index.EnableBlockFilter(*blockFilter)
+	index.SetXpubCacheSize(*xpubCacheSize)
+
+	// read-only database is migrated by the primary instance
+	if !*readOnly {
+		if err = index.Migrate(coin, chanOsSignal); err != nil {
+			glog.Error("migrate: ", err)
+			return exitCodeFatal
+		}
+		if *migrate {
+			return exitCodeOK
+		}
+	}
 
 	internalState, err = newInternalState(coin, coinShortcut, coinLabel, index)
 	if err != nil {
@@ -180,12 +247,36 @@ func mainWithExitCode() int {
 		return exitCodeFatal
 	}
 	index.SetInternalState(internalState)
+
+	// the check is possible also in inconsistent state of the database
+	if *checkDB {
+		lower, higher := uint32(0), ^uint32(0)
+		if *blockFrom >= 0 {
+			lower = uint32(*blockFrom)
+		}
+		if *blockUntil >= 0 {
+			higher = uint32(*blockUntil)
+		}
+		result, err := index.CheckDB(lower, higher, *checkDBRepair, chanOsSignal)
+		if err != nil {
+			glog.Error("checkdb: ", err)
+			return exitCodeFatal
+		}
+		if result.Errors > 0 && !*checkDBRepair {
+			return exitCodeFatal
+		}
+		return exitCodeOK
+	}
+
 	if internalState.DbState != common.DbStateClosed {
 		if internalState.DbState == common.DbStateInconsistent {
 			glog.Error("internalState: database is in inconsistent state and cannot be used")
 			return exitCodeFatal
 		}
-		glog.Warning("internalState: database was left in open state, possibly previous ungraceful shutdown")
+		// the database is open by the running primary instance of the read-only database
+		if !*readOnly {
+			glog.Warning("internalState: database was left in open state, possibly previous ungraceful shutdown")
+		}
 	}
 
 	if *computeFeeStatsFlag {
@@ -198,6 +289,22 @@ func mainWithExitCode() int {
 		return exitCodeOK
 	}
 
+	if *checkpoint != "" {
+		if _, _, err = index.CreateCheckpoint(*checkpoint); err != nil {
+			glog.Error("checkpoint: ", err)
+			return exitCodeFatal
+		}
+		return exitCodeOK
+	}
+
+	if *exportSnapshot != "" {
+		if _, err = index.ExportSnapshot(*exportSnapshot); err != nil {
+			glog.Error("exportSnapshot: ", err)
+			return exitCodeFatal
+		}
+		return exitCodeOK
+	}
+
 	if *computeColumnStats {
 		internalState.DbState = common.DbStateOpen
 		err = index.ComputeInternalStateColumnStats(chanOsSignal)
@@ -209,18 +316,22 @@ func mainWithExitCode() int {
 		return exitCodeOK
 	}
 
-	syncWorker, err = db.NewSyncWorker(index, chain, *syncWorkers, *syncChunk, *blockFrom, *dryRun, chanOsSignal, metrics, internalState)
-	if err != nil {
-		glog.Errorf("NewSyncWorker %v", err)
-		return exitCodeFatal
-	}
+	// read-only database is synchronized by the primary instance
+	if !*readOnly {
+		syncWorker, err = db.NewSyncWorker(index, chain, *syncWorkers, *syncChunk, *blockFrom, *dryRun, chanOsSignal, metrics, internalState)
+		if err != nil {
+			glog.Errorf("NewSyncWorker %v", err)
+			return exitCodeFatal
+		}
+		syncWorker.SetBlocksDir(*blocksDir)
 
-	// set the DbState to open at this moment, after all important workers are initialized
-	internalState.DbState = common.DbStateOpen
-	err = index.StoreInternalState(internalState)
-	if err != nil {
-		glog.Error("internalState: ", err)
-		return exitCodeFatal
+		// set the DbState to open at this moment, after all important workers are initialized
+		internalState.DbState = common.DbStateOpen
+		err = index.StoreInternalState(internalState)
+		if err != nil {
+			glog.Error("internalState: ", err)
+			return exitCodeFatal
+		}
 	}
 
 	if *rollbackHeight >= 0 {
@@ -270,34 +381,42 @@ func mainWithExitCode() int {
 			return exitCodeOK
 		}
 		// initialize mempool after the initial sync is complete
-		var addrDescForOutpoint bchain.AddrDescForOutpointFunc
-		if chain.GetChainParser().GetChainType() == bchain.ChainBitcoinType {
-			addrDescForOutpoint = index.AddrDescForOutpoint
+		if err = initializeMempool(); err != nil {
+			return exitCodeFatal
 		}
-		err = chain.InitializeMempool(addrDescForOutpoint, onNewTxAddr)
+		go syncIndexLoop()
+		go syncMempoolLoop()
+		internalState.InitialSync = false
+	} else if *readOnly {
+		bestHeight, _, err := index.GetBestBlock()
 		if err != nil {
-			glog.Error("initializeMempool ", err)
+			glog.Error("rocksDB: ", err)
 			return exitCodeFatal
 		}
-		var mempoolCount int
-		if mempoolCount, err = mempool.Resync(); err != nil {
-			glog.Error("resyncMempool ", err)
+		internalState.FinishedSync(bestHeight)
+		if err = initializeMempool(); err != nil {
 			return exitCodeFatal
 		}
-		internalState.FinishedMempoolSync(mempoolCount)
-		go syncIndexLoop()
+		go catchUpIndexLoop()
 		go syncMempoolLoop()
-		internalState.InitialSync = false
 	}
-	go storeInternalStateLoop()
+	if !*readOnly {
+		go storeInternalStateLoop()
+	}
 
 	if publicServer != nil {
 		// start full public interface
 		callbacksOnNewBlock = append(callbacksOnNewBlock, publicServer.OnNewBlock)
 		callbacksOnNewTxAddr = append(callbacksOnNewTxAddr, publicServer.OnNewTxAddr)
+		callbacksOnNewFiatRates = append(callbacksOnNewFiatRates, publicServer.OnNewFiatRatesTicker)
 		publicServer.ConnectFullPublicInterface()
 	}
 
+	var fiatRates *fiat.RatesDownloader
+	if *synchronize {
+		fiatRates = initFiatRatesDownloader(index, *blockchain)
+	}
+
 	if *blockFrom >= 0 {
 		if *blockUntil < 0 {
 			*blockUntil = *blockFrom
@@ -327,10 +446,41 @@ func mainWithExitCode() int {
 		<-chanSyncIndexDone
 		<-chanSyncMempoolDone
 		<-chanStoreInternalStateDone
+		if fiatRates != nil {
+			fiatRates.Stop()
+		}
+	} else if *readOnly {
+		close(chanSyncIndex)
+		close(chanSyncMempool)
+		<-chanSyncIndexDone
+		<-chanSyncMempoolDone
 	}
 	return exitCodeOK
 }
 
+func initializeMempool() error {
+	var addrDescForOutpoint bchain.AddrDescForOutpointFunc
+	if chain.GetChainParser().GetChainType() == bchain.ChainBitcoinType {
+		addrDescForOutpoint = func(outpoint bchain.Outpoint) bchain.AddressDescriptor {
+			index.LockRead()
+			defer index.UnlockRead()
+			return index.AddrDescForOutpoint(outpoint)
+		}
+	}
+	err := chain.InitializeMempool(addrDescForOutpoint, onNewTxAddr)
+	if err != nil {
+		glog.Error("initializeMempool ", err)
+		return err
+	}
+	mempoolCount, err := mempool.Resync()
+	if err != nil {
+		glog.Error("resyncMempool ", err)
+		return err
+	}
+	internalState.FinishedMempoolSync(mempoolCount)
+	return nil
+}
+
 func getBlockChainWithRetry(coin string, configfile string, pushHandler func(bchain.NotificationType), metrics *common.Metrics, seconds int) (bchain.BlockChain, bchain.Mempool, error) {
 	var chain bchain.BlockChain
 	var mempool bchain.Mempool
@@ -356,7 +506,7 @@ func getBlockChainWithRetry(coin string, configfile string, pushHandler func(bch
 }
 
 func startInternalServer() (*server.InternalServer, error) {
-	internalServer, err := server.NewInternalServer(*internalBinding, *certFiles, index, chain, mempool, txCache, internalState)
+	internalServer, err := server.NewInternalServer(*internalBinding, *certFiles, index, chain, mempool, txCache, metrics, internalState)
 	if err != nil {
 		return nil, err
 	}
@@ -422,7 +572,7 @@ func performRollback() error {
 }
 
 func blockbookAppInfoMetric(db *db.RocksDB, chain bchain.BlockChain, txCache *db.TxCache, is *common.InternalState, metrics *common.Metrics) error {
-	api, err := api.NewWorker(db, chain, mempool, txCache, is)
+	api, err := api.NewWorker(db, chain, mempool, txCache, metrics, is)
 	if err != nil {
 		return err
 	}
@@ -515,6 +665,49 @@ func syncIndexLoop() {
 	glog.Info("syncIndexLoop stopped")
 }
 
+func catchUpIndexLoop() {
+	defer close(chanSyncIndexDone)
+	glog.Info("catchUpIndexLoop starting")
+	// catch up with the primary instance about every 10 seconds if there are no chanSyncIndex requests, with debounce 1 second
+	tickAndDebounce(time.Duration(*catchUpPeriodMs)*time.Millisecond, debounceResyncIndexMs*time.Millisecond, chanSyncIndex, catchUpIndex)
+	glog.Info("catchUpIndexLoop stopped")
+}
+
+// catchUpIndex switches the read-only index to the current data of the primary instance and notifies about the new blocks
+// the index is switched only by this function, therefore it can read the index without LockRead
+func catchUpIndex() {
+	_, lastHeight, _ := internalState.GetSyncState()
+	lastHash, err := index.GetBlockHash(lastHeight)
+	if err != nil {
+		glog.Error("catchUpIndex ", err)
+		return
+	}
+	if err = index.CatchUpWithPrimary(); err != nil {
+		glog.Error("catchUpIndex ", err)
+		return
+	}
+	height, hash, err := index.GetBestBlock()
+	if err != nil {
+		glog.Error("catchUpIndex ", err)
+		return
+	}
+	if height == lastHeight && hash == lastHash {
+		internalState.FinishedSyncNoChange()
+		return
+	}
+	internalState.FinishedSync(height)
+	// notify the blocks connected by the primary instance since the last catch up, after a rollback only the new best block
+	for h := lastHeight + 1; h < height; h++ {
+		blockHash, err := index.GetBlockHash(h)
+		if err != nil {
+			glog.Error("catchUpIndex ", err)
+			return
+		}
+		onNewBlockHash(blockHash, h)
+	}
+	onNewBlockHash(hash, height)
+}
+
 func onNewBlockHash(hash string, height uint32) {
 	for _, c := range callbacksOnNewBlock {
 		c(hash, height)
@@ -581,11 +774,49 @@ func storeInternalStateLoop() {
 }
 
 func onNewTxAddr(tx *bchain.Tx, desc bchain.AddressDescriptor) {
+	// the callbacks read the index outside of any request
+	index.LockRead()
+	defer index.UnlockRead()
 	for _, c := range callbacksOnNewTxAddr {
 		c(tx, desc)
 	}
 }
 
+func onNewFiatRatesTicker(ticker *db.CurrencyRatesTicker) {
+	for _, c := range callbacksOnNewFiatRates {
+		c(ticker)
+	}
+}
+
+// initFiatRatesDownloader starts the download of fiat rates if it is configured in the blockchain configuration,
+// returns nil if the download was not started
+func initFiatRatesDownloader(d *db.RocksDB, configfile string) *fiat.RatesDownloader {
+	data, err := ioutil.ReadFile(configfile)
+	if err != nil {
+		glog.Error("fiatRates: error reading file ", configfile, ": ", err)
+		return nil
+	}
+	var config struct {
+		FiatRates       string `json:"fiatRates"`
+		FiatRatesParams string `json:"fiatRatesParams"`
+	}
+	if err = json.Unmarshal(data, &config); err != nil {
+		glog.Error("fiatRates: error parsing file ", configfile, ": ", err)
+		return nil
+	}
+	if config.FiatRates == "" {
+		glog.Info("fiatRates: not configured, download of fiat rates is disabled")
+		return nil
+	}
+	rd, err := fiat.NewFiatRatesDownloader(d, config.FiatRates, config.FiatRatesParams, onNewFiatRatesTicker)
+	if err != nil {
+		glog.Error("fiatRates: ", err)
+		return nil
+	}
+	go rd.Run()
+	return rd
+}
+
 func pushSynchronizationHandler(nt bchain.NotificationType) {
 	glog.V(1).Info("MQ: notification ", nt)
 	if atomic.LoadInt32(&inShutdown) != 0 {
@@ -642,7 +873,7 @@ func normalizeName(s string) string {
 func computeFeeStats(stopCompute chan os.Signal, blockFrom, blockTo int, db *db.RocksDB, chain bchain.BlockChain, txCache *db.TxCache, is *common.InternalState, metrics *common.Metrics) error {
 	start := time.Now()
 	glog.Info("computeFeeStats start")
-	api, err := api.NewWorker(db, chain, mempool, txCache, is)
+	api, err := api.NewWorker(db, chain, mempool, txCache, metrics, is)
 	if err != nil {
 		return err
 	}
@@ -25,6 +25,14 @@ type InternalStateColumn struct {
 	Updated    time.Time `json:"updated"`
 }
 
+// MigrationState contains the progress of the migration of the db data from the version FromVersion
+type MigrationState struct {
+	FromVersion uint32 `json:"fromVersion"`
+	Task        int    `json:"task"`
+	LastKey     []byte `json:"lastKey,omitempty"`
+	Rows        int64  `json:"rows"`
+}
+
 // InternalState contains the data of the internal state
 type InternalState struct {
 	mux sync.Mutex
@@ -51,6 +59,15 @@ type InternalState struct {
 	LastMempoolSync       time.Time `json:"lastMempoolSync"`
 
 	DbColumns []InternalStateColumn `json:"dbColumns"`
+
+	// Migration is set while a migration of the db data is in progress
+	Migration *MigrationState `json:"migration,omitempty"`
+
+	// BlockFilterHeight is the lowest height from which the block filters of all blocks are stored, nil if they are not stored
+	BlockFilterHeight *uint32 `json:"blockFilterHeight,omitempty"`
+
+	// BlockHeadersHeight is the lowest height from which the raw headers of all blocks are stored, nil if they are not stored
+	BlockHeadersHeight *uint32 `json:"blockHeadersHeight,omitempty"`
 }
 
 // StartedSync signals start of synchronization
@@ -164,6 +181,50 @@ func (is *InternalState) DBSizeTotal() int64 {
 	return total
 }
 
+// updateStoredFromHeight updates the lowest height from which the data of all blocks are stored
+// when a block is connected with or without the data, a block connected without the data makes the data of the lower blocks unusable
+func updateStoredFromHeight(from **uint32, height uint32, stored bool) {
+	if !stored {
+		*from = nil
+	} else if *from == nil || height < **from {
+		*from = &height
+	}
+}
+
+// UpdateBlockFilterHeight updates BlockFilterHeight when a block is connected with or without its block filter
+func (is *InternalState) UpdateBlockFilterHeight(height uint32, filter bool) {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	updateStoredFromHeight(&is.BlockFilterHeight, height, filter)
+}
+
+// GetBlockFilterHeight returns the lowest height from which the block filters are stored, false if they are not stored
+func (is *InternalState) GetBlockFilterHeight() (uint32, bool) {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	if is.BlockFilterHeight == nil {
+		return 0, false
+	}
+	return *is.BlockFilterHeight, true
+}
+
+// UpdateBlockHeadersHeight updates BlockHeadersHeight when a block is connected with or without its raw header
+func (is *InternalState) UpdateBlockHeadersHeight(height uint32, header bool) {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	updateStoredFromHeight(&is.BlockHeadersHeight, height, header)
+}
+
+// GetBlockHeadersHeight returns the lowest height from which the raw block headers are stored, false if they are not stored
+func (is *InternalState) GetBlockHeadersHeight() (uint32, bool) {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	if is.BlockHeadersHeight == nil {
+		return 0, false
+	}
+	return *is.BlockHeadersHeight, true
+}
+
 // Pack marshals internal state to json
 func (is *InternalState) Pack() ([]byte, error) {
 	is.mux.Lock()
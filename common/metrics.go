@@ -19,6 +19,8 @@ type Metrics struct {
 	IndexResyncDuration   prometheus.Histogram
 	MempoolResyncDuration prometheus.Histogram
 	TxCacheEfficiency     *prometheus.CounterVec
+	XpubCacheEfficiency   *prometheus.CounterVec
+	XpubCacheSize         *prometheus.GaugeVec
 	RPCLatency            *prometheus.HistogramVec
 	IndexResyncErrors     *prometheus.CounterVec
 	IndexDBSize           prometheus.Gauge
@@ -124,6 +126,22 @@ func GetMetrics(coin string) (*Metrics, error) {
 		},
 		[]string{"status"},
 	)
+	metrics.XpubCacheEfficiency = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "blockbook_xpubcache_efficiency",
+			Help:        "Efficiency of xpub cache by status (memory hit, db hit, miss)",
+			ConstLabels: Labels{"coin": coin},
+		},
+		[]string{"status"},
+	)
+	metrics.XpubCacheSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "blockbook_xpubcache_size",
+			Help:        "Number of xpubs in the memory and db xpub cache",
+			ConstLabels: Labels{"coin": coin},
+		},
+		[]string{"cache"},
+	)
 	metrics.RPCLatency = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:        "blockbook_rpc_latency",
@@ -0,0 +1,187 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// maxBlockFilesTipLag is the number of the newest blocks of the backend, which may not be written to the block files yet
+const maxBlockFilesTipLag = 100
+
+// SetBlocksDir sets the blocks directory of the backend, the initial sync then imports the blocks
+// from the block files in the directory instead of getting them using RPC
+func (w *SyncWorker) SetBlocksDir(dir string) {
+	w.blocksDir = dir
+}
+
+// ConnectBlocksFromFiles connects the blocks from the height lower, read directly from the block files (blk*.dat)
+// in the blocks directory of the backend. The blocks are stored in the files in the order in which they were downloaded,
+// they are ordered by following the links to the previous blocks from the newest block of the active chain found in the files.
+// Returns the number of connected blocks, zero if the block files do not contain the chain from the height lower.
+func (w *SyncWorker) ConnectBlocksFromFiles(dir string, lower uint32) (int, error) {
+	if w.chain.GetChainParser().GetChainType() != bchain.ChainBitcoinType {
+		return 0, errors.New("Block files are supported only for Bitcoin type coins")
+	}
+	bf, err := bchain.OpenBlockFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	type blockFileEntry struct {
+		loc      bchain.BlockFileLocation
+		prevHash bchain.BlockFileHash
+	}
+	entries := make(map[bchain.BlockFileHash]blockFileEntry)
+	err = bf.Scan(func(loc bchain.BlockFileLocation, hash, prevHash bchain.BlockFileHash) error {
+		entries[hash] = blockFileEntry{loc, prevHash}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	glog.Info("blockfiles: found ", len(entries), " blocks in ", bf.Len(), " files, elapsed ", time.Since(start))
+
+	// find the newest block of the active chain in the block files
+	bestHeight, err := w.chain.GetBestBlockHeight()
+	if err != nil {
+		return 0, err
+	}
+	var higher uint32
+	var tip bchain.BlockFileHash
+	found := false
+	for h := bestHeight; h >= lower && h+maxBlockFilesTipLag >= bestHeight; h-- {
+		hash, err := w.chain.GetBlockHash(h)
+		if err != nil {
+			return 0, err
+		}
+		if tip, err = bchain.NewBlockFileHash(hash); err != nil {
+			return 0, err
+		}
+		if _, found = entries[tip]; found {
+			higher = h
+			break
+		}
+		if h == 0 {
+			break
+		}
+	}
+	if !found {
+		glog.Warning("blockfiles: the newest blocks of the backend not found in the block files")
+		return 0, nil
+	}
+
+	// follow the links to the previous blocks down to the height lower
+	locs := make([]bchain.BlockFileLocation, higher-lower+1)
+	hashes := make([]bchain.BlockFileHash, len(locs))
+	hash := tip
+	for i := len(locs) - 1; i >= 0; i-- {
+		e, ok := entries[hash]
+		if !ok {
+			glog.Warning("blockfiles: block ", hash, " at height ", lower+uint32(i), " not found in the block files")
+			return 0, nil
+		}
+		locs[i] = e.loc
+		hashes[i] = hash
+		hash = e.prevHash
+	}
+	entries = nil
+	lowerHash, err := w.chain.GetBlockHash(lower)
+	if err != nil {
+		return 0, err
+	}
+	if hashes[0].String() != lowerHash {
+		return 0, errors.Errorf("Block files contain block %v at height %v, backend block %v", hashes[0], lower, lowerHash)
+	}
+	glog.Infof("blockfiles: connecting blocks %d-%d, using %d workers", lower, higher, w.syncWorkers)
+	if err = w.connectBlocksFromFiles(bf, lower, locs, hashes); err != nil {
+		return 0, err
+	}
+	return len(locs), nil
+}
+
+// connectBlocksFromFiles reads and parses the blocks in parallel and connects them in bulk mode,
+// the block at index i is processed by the worker i % number of workers
+func (w *SyncWorker) connectBlocksFromFiles(bf *bchain.BlockFiles, lower uint32, locs []bchain.BlockFileLocation, hashes []bchain.BlockFileHash) error {
+	workers := w.syncWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	parser := w.chain.GetChainParser()
+	bch := make([]chan blockResult, workers)
+	for i := range bch {
+		bch[i] = make(chan blockResult, 1)
+	}
+	terminating := make(chan struct{})
+	defer close(terminating)
+	readBlockWorker := func(i int) {
+		for j := i; j < len(locs); j += workers {
+			var res blockResult
+			data, err := bf.ReadBlock(locs[j])
+			if err == nil {
+				res.block, err = parser.ParseBlock(data)
+			}
+			height := lower + uint32(j)
+			if err != nil {
+				res.err = errors.Annotatef(err, "%v %v", height, hashes[j])
+			} else {
+				res.block.Hash = hashes[j].String()
+				res.block.Height = height
+			}
+			select {
+			case bch[i] <- res:
+			case <-terminating:
+				return
+			}
+			if res.err != nil {
+				return
+			}
+		}
+	}
+	for i := 0; i < workers; i++ {
+		go readBlockWorker(i)
+	}
+
+	bc, err := w.db.InitBulkConnect()
+	if err != nil {
+		return err
+	}
+	keep := uint32(parser.KeepBlockAddresses())
+	higher := lower + uint32(len(locs)) - 1
+	start := time.Now()
+ConnectLoop:
+	for j := range locs {
+		var res blockResult
+		select {
+		case <-w.chanOsSignal:
+			glog.Info("connectBlocksFromFiles interrupted at height ", lower+uint32(j))
+			err = ErrOperationInterrupted
+			break ConnectLoop
+		case res = <-bch[j%workers]:
+		}
+		if res.err != nil {
+			err = res.err
+			break
+		}
+		if w.dryRun {
+			continue
+		}
+		if err = bc.ConnectBlock(res.block, res.block.Height+keep > higher); err != nil {
+			err = errors.Annotatef(err, "%v %v", res.block.Height, res.block.Hash)
+			break
+		}
+		if res.block.Height > 0 && res.block.Height%1000 == 0 {
+			glog.Info("connecting block ", res.block.Height, " ", res.block.Hash, ", elapsed ", time.Since(start), " ", w.db.GetAndResetConnectBlockStats())
+			start = time.Now()
+		}
+	}
+	if cerr := bc.Close(); cerr != nil {
+		glog.Error("sync: bulkconnect.Close error ", cerr)
+		if err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,208 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/bchain"
+	"blockbook/tests/dbtestdata"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/martinboehm/btcd/chaincfg/chainhash"
+	"github.com/martinboehm/btcd/wire"
+)
+
+// blockFilesTestChain returns the hashes of the active chain starting at the height of the test block 1
+type blockFilesTestChain struct {
+	bchain.BlockChain
+	hashes []string
+}
+
+func (c *blockFilesTestChain) GetBestBlockHeight() (uint32, error) {
+	return 225493 + uint32(len(c.hashes)) - 1, nil
+}
+
+func (c *blockFilesTestChain) GetBlockHash(height uint32) (string, error) {
+	if height < 225493 || height >= 225493+uint32(len(c.hashes)) {
+		return "", bchain.ErrBlockNotFound
+	}
+	return c.hashes[height-225493], nil
+}
+
+// blockFilesTestBlock serializes the test block, the transactions get real txids,
+// which are mapped from the txids of the test data in the map txids
+func blockFilesTestBlock(t *testing.T, b *bchain.Block, prev *chainhash.Hash, txids map[string]chainhash.Hash) *wire.MsgBlock {
+	mb := &wire.MsgBlock{}
+	if err := mb.Header.Deserialize(bytes.NewReader(b.RawHeader)); err != nil {
+		t.Fatal(err)
+	}
+	mb.Header.PrevBlock = *prev
+	var hashes []string
+	for i, tx := range b.Txs {
+		mtx := &wire.MsgTx{Version: 1}
+		if len(tx.Vin) == 0 {
+			// a transaction without inputs cannot be serialized, add a coinbase input
+			tx.Vin = []bchain.Vin{{Coinbase: hex.EncodeToString([]byte{0x51, byte(i)})}}
+		}
+		for _, vin := range tx.Vin {
+			in := &wire.TxIn{Sequence: wire.MaxTxInSequenceNum}
+			if vin.Coinbase != "" {
+				script, err := hex.DecodeString(vin.Coinbase)
+				if err != nil {
+					t.Fatal(err)
+				}
+				in.PreviousOutPoint.Index = wire.MaxPrevOutIndex
+				in.SignatureScript = script
+			} else {
+				h, ok := txids[vin.Txid]
+				if !ok {
+					t.Fatalf("unknown input tx %v", vin.Txid)
+				}
+				in.PreviousOutPoint.Hash = h
+				in.PreviousOutPoint.Index = vin.Vout
+			}
+			mtx.TxIn = append(mtx.TxIn, in)
+		}
+		for _, vout := range tx.Vout {
+			script, err := hex.DecodeString(vout.ScriptPubKey.Hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mtx.TxOut = append(mtx.TxOut, &wire.TxOut{Value: vout.ValueSat.Int64(), PkScript: script})
+		}
+		h := mtx.TxHash()
+		txids[tx.Txid] = h
+		hashes = append(hashes, h.String())
+		mb.Transactions = append(mb.Transactions, mtx)
+	}
+	_, root, err := bchain.MerkleBranch(hashes, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merkleRoot, err := chainhash.NewHashFromStr(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mb.Header.MerkleRoot = *merkleRoot
+	return mb
+}
+
+// writeBlockFile writes the blocks in the framing of the block files obfuscated by the xor key,
+// the last truncate bytes are cut off and padding zero bytes of the preallocated space are appended
+func writeBlockFile(t *testing.T, name string, key []byte, truncate, padding int, blocks ...*wire.MsgBlock) {
+	var buf bytes.Buffer
+	for _, b := range blocks {
+		var bb bytes.Buffer
+		if err := b.Serialize(&bb); err != nil {
+			t.Fatal(err)
+		}
+		var rh [8]byte
+		binary.LittleEndian.PutUint32(rh[:], uint32(wire.TestNet3))
+		binary.LittleEndian.PutUint32(rh[4:], uint32(bb.Len()))
+		buf.Write(rh[:])
+		buf.Write(bb.Bytes())
+	}
+	data := buf.Bytes()
+	for i := range data {
+		data[i] ^= key[i%len(key)]
+	}
+	data = append(data[:len(data)-truncate], make([]byte, padding)...)
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncWorker_ConnectBlocksFromFiles(t *testing.T) {
+	d := setupRocksDB(t, bitcoinTestnetParser())
+	defer closeAndDestroyRocksDB(t, d)
+	dir, err := ioutil.TempDir("", "testblocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	txids := make(map[string]chainhash.Hash)
+	b1 := blockFilesTestBlock(t, dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser), &chainhash.Hash{}, txids)
+	h1 := b1.Header.BlockHash()
+	// a block of a fork, which is not part of the active chain
+	b2 := dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)
+	stale := blockFilesTestBlock(t, &bchain.Block{Txs: b2.Txs[3:], RawHeader: b2.RawHeader}, &h1, txids)
+	b2m := blockFilesTestBlock(t, b2, &h1, txids)
+	h2 := b2m.Header.BlockHash()
+
+	key := []byte{0x8a, 0x01, 0x5f, 0x33, 0xc7, 0x00, 0x9e, 0x2d}
+	if err := ioutil.WriteFile(filepath.Join(dir, "xor.dat"), key, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the blocks are not stored in the order of the chain, the first file ends by preallocated space,
+	// the second file by an incompletely written block
+	writeBlockFile(t, filepath.Join(dir, "blk00000.dat"), key, 0, 256, b2m, stale)
+	writeBlockFile(t, filepath.Join(dir, "blk00001.dat"), key, 10, 0, b1, stale)
+
+	// the newest block of the backend is not in the block files yet
+	chain := &blockFilesTestChain{hashes: []string{h1.String(), h2.String(), "00000000000000000000000000000000000000000000000000000000deadbeef"}}
+	chain.BlockChain, err = dbtestdata.NewFakeBlockChain(d.chainParser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewSyncWorker(d, chain, 3, 100, 225493, false, make(chan os.Signal), nil, d.is)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = w.ConnectBlocksFromFiles(filepath.Join(dir, "missing"), 225493); err == nil {
+		t.Error("ConnectBlocksFromFiles() of missing directory must fail")
+	}
+	n, err := w.ConnectBlocksFromFiles(dir, 225493)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("ConnectBlocksFromFiles() = %v, want 2", n)
+	}
+	height, hash, err := d.GetBestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 225494 || hash != h2.String() {
+		t.Errorf("GetBestBlock() = %v %v, want 225494 %v", height, hash, h2)
+	}
+	if hash, err = d.GetBlockHash(225493); err != nil || hash != h1.String() {
+		t.Errorf("GetBlockHash(225493) = %v %v, want %v", hash, err, h1)
+	}
+
+	// the inputs of the transactions in the block 2 were connected to the outputs in the block 1
+	tests := []struct {
+		addr    string
+		txs     uint32
+		balance int64
+	}{
+		{addr: dbtestdata.Addr3, txs: 2, balance: 0},
+		{addr: dbtestdata.Addr5, txs: 2, balance: dbtestdata.SatB2T3A5.Int64()},
+		{addr: dbtestdata.Addr8, txs: 1, balance: dbtestdata.SatB2T2A8.Int64()},
+		{addr: dbtestdata.AddrA, txs: 1, balance: dbtestdata.SatB2T4AA.Int64()},
+	}
+	for _, tt := range tests {
+		addrDesc, err := d.chainParser.GetAddrDescFromAddress(tt.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ab, err := d.GetAddrDescBalance(addrDesc, AddressBalanceDetailNoUTXO)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ab == nil || ab.Txs != tt.txs || ab.BalanceSat.Int64() != tt.balance {
+			t.Errorf("%v: GetAddrDescBalance() = %+v, want %v txs, balance %v", tt.addr, ab, tt.txs, tt.balance)
+		}
+	}
+
+	// all blocks from the files are already connected
+	if n, err = w.ConnectBlocksFromFiles(dir, 225495); err != nil || n != 0 {
+		t.Errorf("ConnectBlocksFromFiles() = %v %v, want 0", n, err)
+	}
+}
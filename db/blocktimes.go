@@ -0,0 +1,129 @@
+package db
+
+import (
+	"math"
+	"sort"
+
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// medianTimeBlocks is the number of blocks from which the median time past of a block is computed
+const medianTimeBlocks = 11
+
+type recentBlockTime struct {
+	height uint32
+	time   int64
+	valid  bool
+}
+
+// the times of blocks are not monotonic, the index is therefore keyed by the median time past of the block,
+// which does not decrease with the height of the block
+func packBlockTimeKey(medianTime int64, height uint32) []byte {
+	key := make([]byte, 0, 8)
+	key = append(key, packUint(uint32(medianTime))...)
+	return append(key, packUint(height)...)
+}
+
+func (d *RocksDB) setRecentBlockTime(height uint32, time int64, valid bool) {
+	d.recentBlockTimesMux.Lock()
+	d.recentBlockTimes[height%medianTimeBlocks] = recentBlockTime{height: height, time: time, valid: valid}
+	d.recentBlockTimesMux.Unlock()
+}
+
+// blockTime returns the time of the block at the height, found is false if the block is not in the db
+// the times of the recently indexed blocks are taken from memory, they may not be written to db yet in the bulk connect
+func (d *RocksDB) blockTime(height uint32) (int64, bool, error) {
+	d.recentBlockTimesMux.Lock()
+	r := d.recentBlockTimes[height%medianTimeBlocks]
+	d.recentBlockTimesMux.Unlock()
+	if r.valid && r.height == height {
+		return r.time, true, nil
+	}
+	bi, err := d.GetBlockInfo(height)
+	if err != nil || bi == nil {
+		return 0, false, err
+	}
+	return bi.Time, true, nil
+}
+
+// medianTimePast returns the median of the time of the block and of the times of up to 10 preceding blocks
+func (d *RocksDB) medianTimePast(height uint32, time int64) (int64, error) {
+	times := make([]int64, 1, medianTimeBlocks)
+	times[0] = time
+	for h := height; h > 0 && len(times) < medianTimeBlocks; {
+		h--
+		t, found, err := d.blockTime(h)
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			break
+		}
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times[len(times)/2], nil
+}
+
+// writeBlockTime inserts or deletes the row of the block in the blockTimes column
+func (d *RocksDB) writeBlockTime(wb *gorocksdb.WriteBatch, height uint32, time int64, op int) error {
+	// use the time as it is stored in the height column
+	time = int64(uint32(time))
+	mtp, err := d.medianTimePast(height, time)
+	if err != nil {
+		return err
+	}
+	key := packBlockTimeKey(mtp, height)
+	switch op {
+	case opInsert:
+		wb.PutCF(d.cfh[cfBlockTimes], key, []byte{})
+		d.setRecentBlockTime(height, time, true)
+	case opDelete:
+		wb.DeleteCF(d.cfh[cfBlockTimes], key)
+		d.setRecentBlockTime(height, 0, false)
+	}
+	return nil
+}
+
+// deleteBlockTime deletes the row of the block in the blockTimes column, the block must still be in the height column
+func (d *RocksDB) deleteBlockTime(wb *gorocksdb.WriteBatch, height uint32) error {
+	bi, err := d.GetBlockInfo(height)
+	if err != nil || bi == nil {
+		return err
+	}
+	return d.writeBlockTime(wb, height, bi.Time, opDelete)
+}
+
+// GetBlockMedianTimePast returns the median time past of the block at the height
+func (d *RocksDB) GetBlockMedianTimePast(height uint32) (int64, error) {
+	bi, err := d.GetBlockInfo(height)
+	if err != nil {
+		return 0, err
+	}
+	if bi == nil {
+		return 0, errors.Errorf("Block %v not found", height)
+	}
+	return d.medianTimePast(height, bi.Time)
+}
+
+// GetHeightByMedianTime returns the height of the first block with the median time past equal or newer than time,
+// found is false if there is no such block
+func (d *RocksDB) GetHeightByMedianTime(time int64) (uint32, bool, error) {
+	if time < 0 {
+		time = 0
+	} else if time > math.MaxUint32 {
+		return 0, false, nil
+	}
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfBlockTimes])
+	defer it.Close()
+	it.Seek(packUint(uint32(time)))
+	if !it.Valid() {
+		return 0, false, it.Err()
+	}
+	key := it.Key().Data()
+	if len(key) != 8 {
+		return 0, false, errors.Errorf("Invalid blockTimes key %x", key)
+	}
+	return unpackUint(key[4:]), true, nil
+}
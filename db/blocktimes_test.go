@@ -0,0 +1,67 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/tests/dbtestdata"
+	"testing"
+)
+
+func TestRocksDB_BlockTimes(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	// the median time past of the block 225494 is the median of the times of the blocks 225493 and 225494
+	if err := checkColumn(d, cfBlockTimes, []keyPair{
+		{uintToHex(1534858021) + "000370d5", "", nil},
+		{uintToHex(1534859123) + "000370d6", "", nil},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	mtp, err := d.GetBlockMedianTimePast(225494)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mtp != 1534859123 {
+		t.Errorf("GetBlockMedianTimePast(225494) = %v, want %v", mtp, 1534859123)
+	}
+
+	tests := []struct {
+		time   int64
+		height uint32
+		found  bool
+	}{
+		{0, 225493, true},
+		{1534858021, 225493, true},
+		{1534858022, 225494, true},
+		{1534859123, 225494, true},
+		{1534859124, 0, false},
+		{1 << 40, 0, false},
+	}
+	for _, tt := range tests {
+		height, found, err := d.GetHeightByMedianTime(tt.time)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if height != tt.height || found != tt.found {
+			t.Errorf("GetHeightByMedianTime(%v) = %v, %v, want %v, %v", tt.time, height, found, tt.height, tt.found)
+		}
+	}
+
+	if err = d.DisconnectBlockRangeBitcoinType(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkColumn(d, cfBlockTimes, []keyPair{
+		{uintToHex(1534858021) + "000370d5", "", nil},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -15,8 +15,11 @@ import (
 // 2) rocksdb seems to handle better fewer larger batches than continuous stream of smaller batches
 
 type bulkAddresses struct {
-	bi        BlockInfo
-	addresses addressesMap
+	bi           BlockInfo
+	addresses    addressesMap
+	blockFilter  []byte
+	spentOutputs map[string][]byte
+	rawHeader    []byte
 }
 
 // BulkConnect is used to connect blocks in bulk, faster but if interrupted inconsistent way
@@ -163,6 +166,11 @@ func (b *BulkConnect) storeBulkAddresses(wb *gorocksdb.WriteBatch) error {
 		if err := b.d.writeHeight(wb, ba.bi.Height, &ba.bi, opInsert); err != nil {
 			return err
 		}
+		if ba.blockFilter != nil {
+			b.d.storeBlockFilter(wb, ba.bi.Height, ba.blockFilter)
+		}
+		b.d.storeSpentOutputs(wb, ba.spentOutputs)
+		b.d.storeBlockHeader(wb, ba.bi.Height, ba.rawHeader)
 	}
 	b.bulkAddressesCount = 0
 	b.bulkAddresses = b.bulkAddresses[:0]
@@ -171,9 +179,20 @@ func (b *BulkConnect) storeBulkAddresses(wb *gorocksdb.WriteBatch) error {
 
 func (b *BulkConnect) connectBlockBitcoinType(block *bchain.Block, storeBlockTxs bool) error {
 	addresses := make(addressesMap)
-	if err := b.d.processAddressesBitcoinType(block, addresses, b.txAddressesMap, b.balances); err != nil {
+	spentOutputs := make(map[string][]byte)
+	if err := b.d.processAddressesBitcoinType(block, addresses, b.txAddressesMap, b.balances, spentOutputs); err != nil {
 		return err
 	}
+	var blockFilter []byte
+	if b.d.blockFilter {
+		// the filter must be computed before the txAddresses are partially stored and removed from the map
+		var err error
+		if blockFilter, err = b.d.computeBlockFilter(block, b.txAddressesMap); err != nil {
+			return err
+		}
+	}
+	b.d.updateBlockFilterHeight(block.Height)
+	b.d.updateBlockHeadersHeight(block.Height, block.RawHeader)
 	var storeAddressesChan, storeBalancesChan chan error
 	var sa bool
 	if len(b.txAddressesMap) > maxBulkTxAddresses || len(b.balances) > maxBulkBalances {
@@ -195,7 +214,10 @@ func (b *BulkConnect) connectBlockBitcoinType(block *bchain.Block, storeBlockTxs
 			Size:   uint32(block.Size),
 			Height: block.Height,
 		},
-		addresses: addresses,
+		addresses:    addresses,
+		blockFilter:  blockFilter,
+		spentOutputs: spentOutputs,
+		rawHeader:    block.RawHeader,
 	})
 	b.bulkAddressesCount += len(addresses)
 	// open WriteBatch only if going to write
@@ -298,11 +320,16 @@ func (b *BulkConnect) connectBlockEthereumType(block *bchain.Block, storeBlockTx
 		addresses: addresses,
 	})
 	b.bulkAddressesCount += len(addresses)
-	// open WriteBatch only if going to write
-	if sa || b.bulkAddressesCount > maxBulkAddresses || storeBlockTxs {
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	// transactions with internal transfers are not kept in memory, they are written with the block
+	internalTransfersTxs, err := b.d.storeTxsWithInternalTransfers(wb, block)
+	if err != nil {
+		return err
+	}
+	// write the WriteBatch only if there is something to write
+	if sa || b.bulkAddressesCount > maxBulkAddresses || storeBlockTxs || internalTransfersTxs > 0 {
 		start := time.Now()
-		wb := gorocksdb.NewWriteBatch()
-		defer wb.Destroy()
 		bac := b.bulkAddressesCount
 		if sa || b.bulkAddressesCount > maxBulkAddresses {
 			if err := b.storeBulkAddresses(wb); err != nil {
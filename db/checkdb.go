@@ -0,0 +1,447 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// CheckDBResult contains the statistics of the consistency check of the index
+type CheckDBResult struct {
+	Blocks    int
+	Addresses int
+	Errors    int
+	Repaired  int
+}
+
+// maxCheckDBRepairsInBatch is the number of repaired balances written to db in one write batch
+const maxCheckDBRepairsInBatch = 1000
+
+type checkDB struct {
+	d       *RocksDB
+	ro      *gorocksdb.ReadOptions
+	repair  bool
+	stop    chan os.Signal
+	wb      *gorocksdb.WriteBatch
+	result  CheckDBResult
+	buf     []byte
+	varBuf  []byte
+	pending int
+}
+
+type addressRow struct {
+	height uint32
+	txs    []txIndexes
+}
+
+var errCheckDBInterrupted = errors.New("Interrupted")
+
+// CheckDB verifies the consistency of the index of Bitcoin type coins in the block range lower-higher
+// it checks that the blocks and their transactions are indexed and that the balances of the addresses with transactions
+// in the range match the transactions in the addresses and txAddresses columns
+// if the whole index is checked, balances of addresses without any transaction are reported too
+// the discrepancies are logged, if repair is set, the balances are recomputed and stored
+func (d *RocksDB) CheckDB(lower, higher uint32, repair bool, stop chan os.Signal) (*CheckDBResult, error) {
+	if d.chainParser.GetChainType() != bchain.ChainBitcoinType {
+		return nil, errors.New("Check of the database is supported only for Bitcoin type coins")
+	}
+	bestHeight, bestHash, err := d.GetBestBlock()
+	if err != nil {
+		return nil, err
+	}
+	if bestHash == "" {
+		glog.Info("checkdb: the database is empty")
+		return &CheckDBResult{}, nil
+	}
+	if higher > bestHeight {
+		higher = bestHeight
+	}
+	// the index does not have to start at the genesis block
+	firstHeight, err := d.getFirstHeight()
+	if err != nil {
+		return nil, err
+	}
+	full := lower <= firstHeight && higher == bestHeight
+	if lower < firstHeight {
+		lower = firstHeight
+	}
+	start := time.Now()
+	glog.Infof("checkdb: checking blocks %d-%d, repair %v", lower, higher, repair)
+	c := &checkDB{
+		d:      d,
+		ro:     gorocksdb.NewDefaultReadOptions(),
+		repair: repair,
+		stop:   stop,
+		wb:     gorocksdb.NewWriteBatch(),
+		buf:    make([]byte, 1024),
+		varBuf: make([]byte, maxPackedBigintBytes),
+	}
+	defer c.ro.Destroy()
+	defer c.wb.Destroy()
+	// do not use cache
+	c.ro.SetFillCache(false)
+	if err = c.checkBlocks(lower, higher); err != nil {
+		return nil, err
+	}
+	if err = c.checkAddresses(lower, higher); err != nil {
+		return nil, err
+	}
+	if full {
+		if err = c.checkOrphanBalances(); err != nil {
+			return nil, err
+		}
+	}
+	if err = c.flush(); err != nil {
+		return nil, err
+	}
+	glog.Infof("checkdb: finished in %v, checked %d blocks and %d addresses, found %d errors, repaired %d balances",
+		time.Since(start), c.result.Blocks, c.result.Addresses, c.result.Errors, c.result.Repaired)
+	return &c.result, nil
+}
+
+func (d *RocksDB) getFirstHeight() (uint32, error) {
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfHeight])
+	defer it.Close()
+	it.SeekToFirst()
+	if !it.Valid() {
+		return 0, it.Err()
+	}
+	return unpackUint(it.Key().Data()), nil
+}
+
+func (c *checkDB) interrupted() bool {
+	select {
+	case <-c.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *checkDB) blockError(height uint32, format string, args ...interface{}) {
+	c.result.Errors++
+	glog.Warningf("checkdb: block %d: "+format, append([]interface{}{height}, args...)...)
+}
+
+func (c *checkDB) addressError(addrDesc bchain.AddressDescriptor, format string, args ...interface{}) {
+	c.result.Errors++
+	var address string
+	if a, _, err := c.d.chainParser.GetAddressesFromAddrDesc(addrDesc); err == nil && len(a) == 1 {
+		address = a[0]
+	} else {
+		address = hex.EncodeToString(addrDesc)
+	}
+	glog.Warningf("checkdb: address %s: "+format, append([]interface{}{address}, args...)...)
+}
+
+func (c *checkDB) txid(btxID []byte) string {
+	txid, err := c.d.chainParser.UnpackTxid(btxID)
+	if err != nil {
+		return hex.EncodeToString(btxID)
+	}
+	return txid
+}
+
+// checkBlocks checks that all blocks are in the height column and that the txs in blockTxs are in txAddresses
+func (c *checkDB) checkBlocks(lower, higher uint32) error {
+	for height := lower; height <= higher; height++ {
+		if c.interrupted() {
+			return errCheckDBInterrupted
+		}
+		c.result.Blocks++
+		bi, err := c.d.GetBlockInfo(height)
+		if err != nil {
+			return err
+		}
+		if bi == nil {
+			c.blockError(height, "not found in height column")
+		}
+		// blockTxs are stored only for the last blocks
+		bt, err := c.d.getBlockTxs(height)
+		if err != nil {
+			return err
+		}
+		for i := range bt {
+			ta, err := c.d.getTxAddresses(bt[i].btxID)
+			if err != nil {
+				return err
+			}
+			if ta == nil {
+				c.blockError(height, "tx %s from blockTxs not found in txAddresses", c.txid(bt[i].btxID))
+			} else if ta.Height != height {
+				c.blockError(height, "tx %s from blockTxs has height %d in txAddresses", c.txid(bt[i].btxID), ta.Height)
+			}
+		}
+		if height == higher {
+			// prevent overflow of height
+			break
+		}
+	}
+	return nil
+}
+
+func unpackTxIndexes(val []byte, txidLen int) ([]txIndexes, error) {
+	txs := make([]txIndexes, 0, 1)
+	for len(val) > txidLen {
+		t := txIndexes{btxID: append([]byte(nil), val[:txidLen]...)}
+		val = val[txidLen:]
+		for {
+			index, l := unpackVarint32(val)
+			if l <= 0 {
+				return nil, errors.New("Invalid addresses data")
+			}
+			t.indexes = append(t.indexes, index>>1)
+			val = val[l:]
+			if index&1 == 1 {
+				break
+			} else if len(val) == 0 {
+				return nil, errors.New("Invalid addresses data")
+			}
+		}
+		txs = append(txs, t)
+	}
+	if len(val) != 0 {
+		return nil, errors.New("Invalid addresses data")
+	}
+	return txs, nil
+}
+
+// checkAddresses walks the addresses column and checks the addresses having transactions in the block range
+func (c *checkDB) checkAddresses(lower, higher uint32) error {
+	txidLen := c.d.chainParser.PackedTxidLen()
+	var addrDesc bchain.AddressDescriptor
+	var rows []addressRow
+	inRange, invalidRows := false, false
+	it := c.d.db.NewIteratorCF(c.ro, c.d.cfh[cfAddresses])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		if c.interrupted() {
+			return errCheckDBInterrupted
+		}
+		key := it.Key().Data()
+		ad, height, err := unpackAddressKey(key)
+		if err != nil {
+			glog.Warning("checkdb: invalid key in addresses column ", hex.EncodeToString(key))
+			c.result.Errors++
+			continue
+		}
+		if !bytes.Equal(ad, addrDesc) {
+			if inRange {
+				if err = c.checkAddress(addrDesc, rows, invalidRows); err != nil {
+					return err
+				}
+			}
+			addrDesc = append(bchain.AddressDescriptor(nil), ad...)
+			rows = rows[:0]
+			inRange, invalidRows = false, false
+		}
+		txs, err := unpackTxIndexes(it.Value().Data(), txidLen)
+		if err != nil {
+			c.addressError(addrDesc, "invalid data in addresses column at height %d", height)
+			invalidRows = true
+			continue
+		}
+		rows = append(rows, addressRow{height: height, txs: txs})
+		if height >= lower && height <= higher {
+			inRange = true
+		}
+	}
+	if inRange {
+		return c.checkAddress(addrDesc, rows, invalidRows)
+	}
+	return nil
+}
+
+// checkAddress replays the transactions of the address and compares the result with the stored balance
+// rows are ordered from the newest to the oldest block
+// the balance is repaired only if the transactions of the address are consistent
+func (c *checkDB) checkAddress(addrDesc bchain.AddressDescriptor, rows []addressRow, invalidRows bool) error {
+	c.result.Addresses++
+	if c.result.Addresses%100000 == 0 {
+		glog.Info("checkdb: checked ", c.result.Addresses, " addresses, found ", c.result.Errors, " errors")
+	}
+	errs := c.result.Errors
+	computed := AddrBalance{}
+	for i := len(rows) - 1; i >= 0; i-- {
+		r := &rows[i]
+		for _, t := range r.txs {
+			computed.Txs++
+			ta, err := c.d.getTxAddresses(t.btxID)
+			if err != nil {
+				return err
+			}
+			if ta == nil {
+				c.addressError(addrDesc, "tx %s at height %d not found in txAddresses", c.txid(t.btxID), r.height)
+				continue
+			}
+			if ta.Height != r.height {
+				c.addressError(addrDesc, "tx %s at height %d has height %d in txAddresses", c.txid(t.btxID), r.height, ta.Height)
+			}
+			for _, index := range t.indexes {
+				if index < 0 {
+					vin := ^index
+					if int(vin) >= len(ta.Inputs) || !bytes.Equal(ta.Inputs[vin].AddrDesc, addrDesc) {
+						c.addressError(addrDesc, "input %d of tx %s does not match txAddresses", vin, c.txid(t.btxID))
+						continue
+					}
+					computed.SentSat.Add(&computed.SentSat, &ta.Inputs[vin].ValueSat)
+					computed.BalanceSat.Sub(&computed.BalanceSat, &ta.Inputs[vin].ValueSat)
+				} else {
+					if int(index) >= len(ta.Outputs) || !bytes.Equal(ta.Outputs[index].AddrDesc, addrDesc) {
+						c.addressError(addrDesc, "output %d of tx %s does not match txAddresses", index, c.txid(t.btxID))
+						continue
+					}
+					o := &ta.Outputs[index]
+					computed.BalanceSat.Add(&computed.BalanceSat, &o.ValueSat)
+					if !o.Spent {
+						computed.Utxos = append(computed.Utxos, Utxo{
+							BtxID:    t.btxID,
+							Vout:     index,
+							Height:   ta.Height,
+							ValueSat: o.ValueSat,
+						})
+					}
+				}
+			}
+		}
+	}
+	if computed.BalanceSat.Sign() < 0 {
+		c.addressError(addrDesc, "negative computed balance %v", computed.BalanceSat.String())
+	}
+	replayOK := !invalidRows && c.result.Errors == errs
+	ab, err := c.d.GetAddrDescBalance(addrDesc, AddressBalanceDetailUTXO)
+	if err != nil {
+		return err
+	}
+	balanceOK := true
+	if ab == nil {
+		c.addressError(addrDesc, "balance not found in addressBalance")
+		balanceOK = false
+	} else {
+		if ab.Txs != computed.Txs {
+			c.addressError(addrDesc, "number of txs %d, computed %d", ab.Txs, computed.Txs)
+			balanceOK = false
+		}
+		if ab.SentSat.Cmp(&computed.SentSat) != 0 {
+			c.addressError(addrDesc, "sent %v, computed %v", ab.SentSat.String(), computed.SentSat.String())
+			balanceOK = false
+		}
+		if ab.BalanceSat.Cmp(&computed.BalanceSat) != 0 {
+			c.addressError(addrDesc, "balance %v, computed %v", ab.BalanceSat.String(), computed.BalanceSat.String())
+			balanceOK = false
+		}
+		if !c.compareUtxos(addrDesc, ab.Utxos, computed.Utxos) {
+			balanceOK = false
+		}
+	}
+	if !balanceOK && replayOK && c.repair {
+		c.buf = packAddrBalance(&computed, c.buf, c.varBuf)
+		c.wb.PutCF(c.d.cfh[cfAddressBalance], addrDesc, c.buf)
+		c.result.Repaired++
+		c.pending++
+		if c.pending >= maxCheckDBRepairsInBatch {
+			return c.flush()
+		}
+	}
+	return nil
+}
+
+func utxoKey(u *Utxo) string {
+	return string(u.BtxID) + ":" + strconv.Itoa(int(u.Vout))
+}
+
+func sameUtxos(stored, computed []Utxo) bool {
+	if len(stored) != len(computed) {
+		return false
+	}
+	m := make(map[string]*Utxo, len(computed))
+	for i := range computed {
+		m[utxoKey(&computed[i])] = &computed[i]
+	}
+	for i := range stored {
+		u, found := m[utxoKey(&stored[i])]
+		if !found || u.Height != stored[i].Height || u.ValueSat.Cmp(&stored[i].ValueSat) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// compareUtxos compares the utxos regardless of their order
+func (c *checkDB) compareUtxos(addrDesc bchain.AddressDescriptor, stored, computed []Utxo) bool {
+	if sameUtxos(stored, computed) {
+		return true
+	}
+	m := make(map[string]*Utxo, len(stored))
+	for i := range stored {
+		m[utxoKey(&stored[i])] = &stored[i]
+	}
+	var missing, extra, different int
+	for i := range computed {
+		u, found := m[utxoKey(&computed[i])]
+		if !found {
+			missing++
+		} else {
+			if u.Height != computed[i].Height || u.ValueSat.Cmp(&computed[i].ValueSat) != 0 {
+				different++
+			}
+			delete(m, utxoKey(&computed[i]))
+		}
+	}
+	extra = len(m)
+	c.addressError(addrDesc, "utxos do not match unspent outputs, %d missing, %d extra, %d different", missing, extra, different)
+	return false
+}
+
+// checkOrphanBalances finds balances of addresses which do not have any transaction in the addresses column
+func (c *checkDB) checkOrphanBalances() error {
+	it := c.d.db.NewIteratorCF(c.ro, c.d.cfh[cfAddressBalance])
+	defer it.Close()
+	ait := c.d.db.NewIteratorCF(c.ro, c.d.cfh[cfAddresses])
+	defer ait.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		if c.interrupted() {
+			return errCheckDBInterrupted
+		}
+		addrDesc := bchain.AddressDescriptor(it.Key().Data())
+		ait.Seek(packAddressKey(addrDesc, ^uint32(0)))
+		if ait.Valid() {
+			key := ait.Key().Data()
+			if len(key) == len(addrDesc)+packedHeightBytes && bytes.HasPrefix(key, addrDesc) {
+				continue
+			}
+		}
+		addrDesc = append(bchain.AddressDescriptor(nil), addrDesc...)
+		c.addressError(addrDesc, "balance without transactions in addresses column")
+		if c.repair {
+			c.wb.DeleteCF(c.d.cfh[cfAddressBalance], addrDesc)
+			c.result.Repaired++
+			c.pending++
+			if c.pending >= maxCheckDBRepairsInBatch {
+				if err := c.flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *checkDB) flush() error {
+	if c.pending == 0 {
+		return nil
+	}
+	if err := c.d.db.Write(c.d.wo, c.wb); err != nil {
+		return err
+	}
+	c.wb.Clear()
+	c.pending = 0
+	return nil
+}
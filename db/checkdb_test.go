@@ -0,0 +1,68 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/tests/dbtestdata"
+	"math/big"
+	"testing"
+
+	"github.com/tecbot/gorocksdb"
+)
+
+func TestRocksDB_CheckDB(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+
+	checkDB := func(lower, higher uint32, repair bool, want CheckDBResult) {
+		t.Helper()
+		got, err := d.CheckDB(lower, higher, repair, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != want {
+			t.Errorf("CheckDB(%v, %v, %v) = %+v, want %+v", lower, higher, repair, *got, want)
+		}
+	}
+	checkDB(0, ^uint32(0), false, CheckDBResult{Blocks: 2, Addresses: 10})
+
+	// break the balances
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	buf := make([]byte, 1024)
+	varBuf := make([]byte, maxPackedBigintBytes)
+	ab, err := d.GetAddrDescBalance(addressToAddrDesc(dbtestdata.Addr5, d.chainParser), AddressBalanceDetailUTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ab.BalanceSat.Add(&ab.BalanceSat, big.NewInt(1))
+	ab.Txs++
+	wb.PutCF(d.cfh[cfAddressBalance], addressToAddrDesc(dbtestdata.Addr5, d.chainParser), packAddrBalance(ab, buf, varBuf))
+	wb.DeleteCF(d.cfh[cfAddressBalance], addressToAddrDesc(dbtestdata.Addr7, d.chainParser))
+	ab, err = d.GetAddrDescBalance(addressToAddrDesc(dbtestdata.Addr1, d.chainParser), AddressBalanceDetailUTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ab.Utxos = nil
+	wb.PutCF(d.cfh[cfAddressBalance], addressToAddrDesc(dbtestdata.Addr1, d.chainParser), packAddrBalance(ab, buf, varBuf))
+	wb.PutCF(d.cfh[cfAddressBalance], addressToAddrDesc(dbtestdata.AddrA, d.chainParser)[1:], packAddrBalance(ab, buf, varBuf))
+	if err := d.db.Write(d.wo, wb); err != nil {
+		t.Fatal(err)
+	}
+
+	// Addr1 has transactions only in the first block, the orphan balance is checked only in the full check
+	checkDB(225494, 225494, false, CheckDBResult{Blocks: 1, Addresses: 9, Errors: 3})
+	checkDB(0, ^uint32(0), false, CheckDBResult{Blocks: 2, Addresses: 10, Errors: 5})
+	checkDB(0, ^uint32(0), true, CheckDBResult{Blocks: 2, Addresses: 10, Errors: 5, Repaired: 4})
+	checkDB(0, ^uint32(0), false, CheckDBResult{Blocks: 2, Addresses: 10})
+	verifyAfterBitcoinTypeBlock2(t, d)
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"blockbook/common"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// CreateCheckpoint creates a consistent copy of the database in the directory dir, which must not exist
+// connecting of blocks is paused until the checkpoint is created
+// the internal state is stored to the checkpoint in the closed state so that blockbook can be started directly from it
+// the height and hash of the best block in the checkpoint are returned
+func (d *RocksDB) CreateCheckpoint(dir string) (uint32, string, error) {
+	if d.is == nil {
+		return 0, "", errors.New("Internal state not created")
+	}
+	if d.is.DbState == common.DbStateInconsistent {
+		return 0, "", errors.New("Cannot create checkpoint of database in inconsistent state")
+	}
+	if d.readOnly {
+		return 0, "", errors.New("Cannot create checkpoint of read-only database")
+	}
+	start := time.Now()
+	d.connectMux.Lock()
+	defer d.connectMux.Unlock()
+	height, hash, err := d.GetBestBlock()
+	if err != nil {
+		return 0, "", err
+	}
+	buf, err := d.packClosedInternalState()
+	if err != nil {
+		return 0, "", err
+	}
+	cp, err := d.db.NewCheckpoint()
+	if err != nil {
+		return 0, "", err
+	}
+	defer cp.Destroy()
+	// log_size_for_flush 0 flushes the memtables so that the checkpoint does not depend on the write ahead log
+	if err = cp.CreateCheckpoint(dir, 0); err != nil {
+		return 0, "", err
+	}
+	if err = storeCheckpointInternalState(dir, buf); err != nil {
+		return 0, "", err
+	}
+	glog.Infof("rocksdb: checkpoint of block %d %s created in %s, duration %v", height, hash, dir, time.Since(start))
+	return height, hash, nil
+}
+
+// packClosedInternalState packs a copy of the internal state in the closed state
+func (d *RocksDB) packClosedInternalState() ([]byte, error) {
+	buf, err := d.is.Pack()
+	if err != nil {
+		return nil, err
+	}
+	is, err := common.UnpackInternalState(buf)
+	if err != nil {
+		return nil, err
+	}
+	is.DbState = common.DbStateClosed
+	return is.Pack()
+}
+
+func storeCheckpointInternalState(dir string, buf []byte) error {
+	c := gorocksdb.NewLRUCache(1 << 20)
+	defer c.Destroy()
+	db, cfh, err := openDB(dir, c, 64, false)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, h := range cfh {
+			h.Destroy()
+		}
+		db.Close()
+	}()
+	wo := gorocksdb.NewDefaultWriteOptions()
+	defer wo.Destroy()
+	return db.PutCF(wo, cfh[cfDefault], []byte(internalStateKey), buf)
+}
@@ -0,0 +1,71 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/common"
+	"blockbook/tests/dbtestdata"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRocksDB_CreateCheckpoint(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	block1 := dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)
+	if err := d.ConnectBlock(block1); err != nil {
+		t.Fatal(err)
+	}
+	d.is.DbState = common.DbStateOpen
+
+	tmp, err := ioutil.TempDir("", "testcheckpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, "checkpoint")
+
+	height, hash, err := d.CreateCheckpoint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != block1.Height || hash != block1.Hash {
+		t.Errorf("CreateCheckpoint() = %v %v, want %v %v", height, hash, block1.Height, block1.Hash)
+	}
+	// the target directory must not exist
+	if _, _, err = d.CreateCheckpoint(dir); err == nil {
+		t.Error("CreateCheckpoint() to existing directory expected error")
+	}
+
+	// the block connected after the checkpoint is not in the checkpoint
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewRocksDB(dir, 100000, -1, d.chainParser, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	is, err := c.LoadInternalState("coin-unittest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if is.DbState != common.DbStateClosed {
+		t.Errorf("checkpoint DbState = %v, want %v", is.DbState, common.DbStateClosed)
+	}
+	c.SetInternalState(is)
+	verifyAfterBitcoinTypeBlock1(t, c, false)
+
+	// checkpoint cannot be created during the bulk import
+	d.is.DbState = common.DbStateInconsistent
+	if _, _, err = d.CreateCheckpoint(filepath.Join(tmp, "inconsistent")); err == nil {
+		t.Error("CreateCheckpoint() of inconsistent db expected error")
+	}
+	d.is.DbState = common.DbStateOpen
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// FiatRatesTimeFormat is the format of the keys of fiatRates column, the keys sort in time order
+const FiatRatesTimeFormat = "20060102150405"
+
+// CurrencyRatesTicker contains exchange rates of the coin to fiat currencies valid from Timestamp
+type CurrencyRatesTicker struct {
+	Timestamp time.Time
+	Rates     map[string]float64
+}
+
+func packTickerTime(t time.Time) []byte {
+	return []byte(t.UTC().Format(FiatRatesTimeFormat))
+}
+
+func unpackTicker(key, val []byte) (*CurrencyRatesTicker, error) {
+	t, err := time.Parse(FiatRatesTimeFormat, string(key))
+	if err != nil {
+		return nil, errors.Annotatef(err, "Invalid fiatRates key %v", string(key))
+	}
+	ticker := &CurrencyRatesTicker{Timestamp: t}
+	if err := json.Unmarshal(val, &ticker.Rates); err != nil {
+		return nil, errors.Annotatef(err, "Invalid fiatRates value for key %v", string(key))
+	}
+	return ticker, nil
+}
+
+// FiatRatesStoreTicker stores the ticker under its timestamp, an existing ticker with the same timestamp is overwritten
+func (d *RocksDB) FiatRatesStoreTicker(ticker *CurrencyRatesTicker) error {
+	if len(ticker.Rates) == 0 {
+		return errors.New("Cannot store ticker without rates")
+	}
+	if ticker.Timestamp.IsZero() {
+		return errors.New("Cannot store ticker without timestamp")
+	}
+	buf, err := json.Marshal(ticker.Rates)
+	if err != nil {
+		return err
+	}
+	return d.db.PutCF(d.wo, d.cfh[cfFiatRates], packTickerTime(ticker.Timestamp), buf)
+}
+
+// FiatRatesFindTicker returns the newest ticker with timestamp equal or older than the given time, nil if there is no such ticker
+func (d *RocksDB) FiatRatesFindTicker(t time.Time) (*CurrencyRatesTicker, error) {
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfFiatRates])
+	defer it.Close()
+	key := packTickerTime(t)
+	it.Seek(key)
+	if !it.Valid() {
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+		// all tickers are older than the time
+		it.SeekToLast()
+	} else if !bytes.Equal(it.Key().Data(), key) {
+		it.Prev()
+	}
+	if !it.Valid() {
+		return nil, it.Err()
+	}
+	return unpackTicker(it.Key().Data(), it.Value().Data())
+}
+
+// FiatRatesFindFirstTicker returns the oldest stored ticker, nil if there are no tickers
+func (d *RocksDB) FiatRatesFindFirstTicker() (*CurrencyRatesTicker, error) {
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfFiatRates])
+	defer it.Close()
+	it.SeekToFirst()
+	if !it.Valid() {
+		return nil, it.Err()
+	}
+	return unpackTicker(it.Key().Data(), it.Value().Data())
+}
+
+// FiatRatesFindLastTicker returns the newest stored ticker, nil if there are no tickers
+func (d *RocksDB) FiatRatesFindLastTicker() (*CurrencyRatesTicker, error) {
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfFiatRates])
+	defer it.Close()
+	it.SeekToLast()
+	if !it.Valid() {
+		return nil, it.Err()
+	}
+	return unpackTicker(it.Key().Data(), it.Value().Data())
+}
+
+// FiatRatesGetTicker returns the ticker valid at the given time: the newest ticker at or before the time,
+// as returned by the downloaders, or the oldest ticker if the time is older than all stored tickers
+func (d *RocksDB) FiatRatesGetTicker(t time.Time) (*CurrencyRatesTicker, error) {
+	ticker, err := d.FiatRatesFindTicker(t)
+	if err != nil {
+		return nil, err
+	}
+	if ticker == nil {
+		if ticker, err = d.FiatRatesFindFirstTicker(); err != nil {
+			return nil, err
+		}
+		if ticker != nil {
+			glog.V(1).Info("rocksdb: no fiat rates ticker before ", t, ", using the first ticker from ", ticker.Timestamp)
+		}
+	}
+	return ticker, nil
+}
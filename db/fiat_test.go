@@ -0,0 +1,115 @@
+// +build unittest
+
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRocksTickers(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	// no tickers stored
+	ticker, err := d.FiatRatesFindLastTicker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticker != nil {
+		t.Errorf("FiatRatesFindLastTicker() = %+v, want nil", ticker)
+	}
+
+	tickers := []CurrencyRatesTicker{
+		{
+			Timestamp: time.Date(2019, 11, 21, 0, 0, 0, 0, time.UTC),
+			Rates:     map[string]float64{"usd": 8100.5, "eur": 7300.25},
+		},
+		{
+			Timestamp: time.Date(2019, 11, 22, 0, 0, 0, 0, time.UTC),
+			Rates:     map[string]float64{"usd": 7600, "eur": 6900},
+		},
+		{
+			Timestamp: time.Date(2019, 11, 22, 14, 30, 10, 0, time.UTC),
+			Rates:     map[string]float64{"usd": 7250.75},
+		},
+	}
+	for i := range tickers {
+		if err := d.FiatRatesStoreTicker(&tickers[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.FiatRatesStoreTicker(&CurrencyRatesTicker{Timestamp: time.Now()}); err == nil {
+		t.Error("FiatRatesStoreTicker() without rates expected error")
+	}
+	if err := d.FiatRatesStoreTicker(&CurrencyRatesTicker{Rates: map[string]float64{"usd": 1}}); err == nil {
+		t.Error("FiatRatesStoreTicker() without timestamp expected error")
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		find *CurrencyRatesTicker
+		get  *CurrencyRatesTicker
+	}{
+		{
+			name: "before first",
+			t:    time.Date(2019, 11, 20, 0, 0, 0, 0, time.UTC),
+			find: nil,
+			get:  &tickers[0],
+		},
+		{
+			name: "exact",
+			t:    time.Date(2019, 11, 22, 0, 0, 0, 0, time.UTC),
+			find: &tickers[1],
+			get:  &tickers[1],
+		},
+		{
+			name: "between, local time",
+			t:    time.Date(2019, 11, 22, 10, 0, 0, 0, time.FixedZone("UTC+2", 2*3600)),
+			find: &tickers[1],
+			get:  &tickers[1],
+		},
+		{
+			name: "between, local time after the second ticker of the day",
+			t:    time.Date(2019, 11, 22, 16, 40, 0, 0, time.FixedZone("UTC+2", 2*3600)),
+			find: &tickers[2],
+			get:  &tickers[2],
+		},
+		{
+			name: "after last",
+			t:    time.Date(2019, 11, 23, 0, 0, 0, 0, time.UTC),
+			find: &tickers[2],
+			get:  &tickers[2],
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.FiatRatesFindTicker(tt.t)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.find) {
+				t.Errorf("FiatRatesFindTicker() = %+v, want %+v", got, tt.find)
+			}
+			got, err = d.FiatRatesGetTicker(tt.t)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.get) {
+				t.Errorf("FiatRatesGetTicker() = %+v, want %+v", got, tt.get)
+			}
+		})
+	}
+
+	ticker, err = d.FiatRatesFindLastTicker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ticker, &tickers[2]) {
+		t.Errorf("FiatRatesFindLastTicker() = %+v, want %+v", ticker, tickers[2])
+	}
+}
@@ -0,0 +1,381 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"blockbook/bchain/coins/eth"
+	"blockbook/common"
+	"bytes"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// migrationBatchSize is the number of converted rows written to db in one write batch
+var migrationBatchSize = 10000
+
+// migrationTask rewrites all rows of one column
+// convert returns the new value of the row or nil if the row does not change
+// index, if set instead of convert, writes the rows derived from the row to other columns
+type migrationTask struct {
+	column  int
+	convert func(d *RocksDB, key, val []byte) ([]byte, error)
+	index   func(d *RocksDB, wb *gorocksdb.WriteBatch, key, val []byte) error
+}
+
+// migration converts the data of the given chain type from the version fromVersion to the version fromVersion+1
+// migration without tasks only raises the version, the data of the chain type did not change
+type migration struct {
+	fromVersion uint32
+	chainType   bchain.ChainType
+	description string
+	tasks       []migrationTask
+}
+
+var migrations []migration
+
+// registerMigration adds the migration to the list of migrations, the migrations must be registered in the order of versions
+func registerMigration(m migration) {
+	migrations = append(migrations, m)
+}
+
+func init() {
+	registerMigration(migration{
+		fromVersion: 4,
+		chainType:   bchain.ChainBitcoinType,
+		description: "store utxos in addressBalance",
+		tasks: []migrationTask{
+			{column: cfAddressBalance, convert: migrateAddrBalanceUtxos},
+		},
+	})
+	registerMigration(migration{
+		fromVersion: 5,
+		chainType:   bchain.ChainBitcoinType,
+		description: "no change of data",
+	})
+	registerMigration(migration{
+		fromVersion: 5,
+		chainType:   bchain.ChainEthereumType,
+		description: "store token types in addressContracts and blockTxs",
+		tasks: []migrationTask{
+			{column: cfAddressContracts, convert: migrateAddressContractsTokenType},
+			{column: cfBlockTxs, convert: migrateBlockTxsEthereumTypeFlags},
+		},
+	})
+	for _, chainType := range []bchain.ChainType{bchain.ChainBitcoinType, bchain.ChainEthereumType} {
+		registerMigration(migration{
+			fromVersion: 6,
+			chainType:   chainType,
+			description: "create blockTimes index",
+			tasks: []migrationTask{
+				{column: cfHeight, index: migrateBlockTimes},
+			},
+		})
+	}
+}
+
+func findMigration(fromVersion uint32, chainType bchain.ChainType) *migration {
+	for i := range migrations {
+		if migrations[i].fromVersion == fromVersion && migrations[i].chainType == chainType {
+			return &migrations[i]
+		}
+	}
+	return nil
+}
+
+// storedDataVersion returns the lowest version of the stored columns, columns not yet stored are ignored
+func storedDataVersion(is *common.InternalState) uint32 {
+	version := uint32(dbVersion)
+	for i := range is.DbColumns {
+		if is.DbColumns[i].Version < version {
+			version = is.DbColumns[i].Version
+		}
+	}
+	return version
+}
+
+// Migrate converts the data of the db to the version dbVersion using the registered migrations
+// the progress of the migration is written together with the converted rows, interrupted migration continues where it stopped
+// it must be called before LoadInternalState, new db or db in the current version is not changed
+func (d *RocksDB) Migrate(rpcCoin string, stop chan os.Signal) error {
+	val, err := d.db.GetCF(d.ro, d.cfh[cfDefault], []byte(internalStateKey))
+	if err != nil {
+		return err
+	}
+	data := append([]byte(nil), val.Data()...)
+	val.Free()
+	if len(data) == 0 {
+		return nil
+	}
+	is, err := common.UnpackInternalState(data)
+	if err != nil {
+		return err
+	}
+	if is.Coin != "" && is.Coin != rpcCoin {
+		return errors.Errorf("Coins do not match. DB coin %v, RPC coin %v", is.Coin, rpcCoin)
+	}
+	version := storedDataVersion(is)
+	if version == dbVersion {
+		return nil
+	}
+	if is.DbState == common.DbStateInconsistent {
+		return errors.New("Cannot migrate database in inconsistent state")
+	}
+	chainType := d.chainParser.GetChainType()
+	for ; version < dbVersion; version++ {
+		m := findMigration(version, chainType)
+		if m == nil {
+			return errors.Errorf("DB version %v cannot be migrated to version %v, the index must be rebuilt", version, version+1)
+		}
+		if is.Migration == nil || is.Migration.FromVersion != version {
+			is.Migration = &common.MigrationState{FromVersion: version}
+		} else {
+			glog.Info("migration: resuming migration from version ", version, ", task ", is.Migration.Task, ", ", is.Migration.Rows, " rows converted")
+		}
+		start := time.Now()
+		glog.Info("migration: migrating DB from version ", version, " to ", version+1, ": ", m.description)
+		if err = d.runMigration(m, is, stop); err != nil {
+			return err
+		}
+		for i := range is.DbColumns {
+			is.DbColumns[i].Version = version + 1
+		}
+		rows := is.Migration.Rows
+		is.Migration = nil
+		if err = d.storeState(is); err != nil {
+			return err
+		}
+		glog.Info("migration: DB migrated to version ", version+1, ", ", rows, " rows converted, duration ", time.Since(start))
+	}
+	return nil
+}
+
+func (d *RocksDB) runMigration(m *migration, is *common.InternalState, stop chan os.Signal) error {
+	ro := gorocksdb.NewDefaultReadOptions()
+	defer ro.Destroy()
+	ro.SetFillCache(false)
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	p := is.Migration
+	for p.Task < len(m.tasks) {
+		t := &m.tasks[p.Task]
+		if err := d.runMigrationTask(t, is, ro, wb, stop); err != nil {
+			return err
+		}
+		glog.Info("migration: column ", cfNames[t.column], " converted")
+		// the completion of the task is stored together with the last converted rows
+		p.Task++
+		p.LastKey = nil
+		if err := d.writeMigrationBatch(wb, is); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runMigrationTask converts the rows of the column following the last converted key
+// the converted rows are written to db in batches, the last batch is left to the caller
+func (d *RocksDB) runMigrationTask(t *migrationTask, is *common.InternalState, ro *gorocksdb.ReadOptions, wb *gorocksdb.WriteBatch, stop chan os.Signal) error {
+	p := is.Migration
+	it := d.db.NewIteratorCF(ro, d.cfh[t.column])
+	defer it.Close()
+	if p.LastKey == nil {
+		it.SeekToFirst()
+	} else {
+		it.Seek(p.LastKey)
+		if it.Valid() && bytes.Equal(it.Key().Data(), p.LastKey) {
+			it.Next()
+		}
+	}
+	count := 0
+	for ; it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if t.index != nil {
+			if err := t.index(d, wb, key, it.Value().Data()); err != nil {
+				return errors.Annotatef(err, "column %v, key %x", cfNames[t.column], key)
+			}
+		} else {
+			val, err := t.convert(d, key, it.Value().Data())
+			if err != nil {
+				return errors.Annotatef(err, "column %v, key %x", cfNames[t.column], key)
+			}
+			if val != nil {
+				wb.PutCF(d.cfh[t.column], key, val)
+			}
+		}
+		p.Rows++
+		count++
+		if count >= migrationBatchSize {
+			p.LastKey = append([]byte(nil), key...)
+			if err := d.writeMigrationBatch(wb, is); err != nil {
+				return err
+			}
+			count = 0
+			glog.Info("migration: column ", cfNames[t.column], ", ", p.Rows, " rows converted")
+			select {
+			case <-stop:
+				return ErrOperationInterrupted
+			default:
+			}
+		}
+	}
+	return it.Err()
+}
+
+// writeMigrationBatch writes the converted rows together with the progress of the migration
+func (d *RocksDB) writeMigrationBatch(wb *gorocksdb.WriteBatch, is *common.InternalState) error {
+	buf, err := is.Pack()
+	if err != nil {
+		return err
+	}
+	wb.PutCF(d.cfh[cfDefault], []byte(internalStateKey), buf)
+	if err = d.db.Write(d.wo, wb); err != nil {
+		return err
+	}
+	wb.Clear()
+	return nil
+}
+
+// migrateAddrBalanceUtxos adds the unspent outputs to the balance of the address
+func migrateAddrBalanceUtxos(d *RocksDB, key, val []byte) ([]byte, error) {
+	ab, err := unpackAddrBalance(val, d.chainParser.PackedTxidLen(), AddressBalanceDetailNoUTXO)
+	if err != nil {
+		return nil, err
+	}
+	ab.Utxos, err = d.addrDescUtxos(key)
+	if err != nil {
+		return nil, err
+	}
+	return packAddrBalance(ab, nil, make([]byte, maxPackedBigintBytes)), nil
+}
+
+// addrDescUtxos replays the transactions of the address from the addresses and txAddresses columns
+// the utxos are returned in the order in which they are stored by ConnectBlock
+func (d *RocksDB) addrDescUtxos(addrDesc bchain.AddressDescriptor) ([]Utxo, error) {
+	txidLen := d.chainParser.PackedTxidLen()
+	stopKey := packAddressKey(addrDesc, 0)
+	var rows []addressRow
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfAddresses])
+	defer it.Close()
+	for it.Seek(packAddressKey(addrDesc, ^uint32(0))); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if bytes.Compare(key, stopKey) > 0 {
+			break
+		}
+		// skip the keys of other addresses having this address as prefix
+		if len(key) != len(addrDesc)+packedHeightBytes {
+			continue
+		}
+		_, height, err := unpackAddressKey(key)
+		if err != nil {
+			return nil, err
+		}
+		txs, err := unpackTxIndexes(it.Value().Data(), txidLen)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, addressRow{height: height, txs: txs})
+	}
+	var utxos []Utxo
+	// rows are ordered from the newest to the oldest block
+	for i := len(rows) - 1; i >= 0; i-- {
+		for _, t := range rows[i].txs {
+			var ta *TxAddresses
+			for _, index := range t.indexes {
+				if index < 0 {
+					continue
+				}
+				if ta == nil {
+					var err error
+					if ta, err = d.getTxAddresses(t.btxID); err != nil {
+						return nil, err
+					}
+					if ta == nil {
+						return nil, errors.Errorf("Tx %x not found in txAddresses", t.btxID)
+					}
+				}
+				if int(index) >= len(ta.Outputs) {
+					return nil, errors.Errorf("Output %d of tx %x not found in txAddresses", index, t.btxID)
+				}
+				o := &ta.Outputs[index]
+				if !o.Spent {
+					utxos = append(utxos, Utxo{
+						BtxID:    t.btxID,
+						Vout:     index,
+						Height:   ta.Height,
+						ValueSat: o.ValueSat,
+					})
+				}
+			}
+		}
+	}
+	return utxos, nil
+}
+
+// migrateAddressContractsTokenType stores the token type in the lowest 2 bits of the number of transactions of the contracts
+// before version 6 all contracts were ERC20 tokens
+func migrateAddressContractsTokenType(d *RocksDB, key, val []byte) ([]byte, error) {
+	varBuf := make([]byte, maxPackedBigintBytes)
+	_, l := unpackVaruint(val)
+	_, ll := unpackVaruint(val[l:])
+	l += ll
+	buf := append(make([]byte, 0, len(val)+8), val[:l]...)
+	for val = val[l:]; len(val) > 0; {
+		if len(val) < eth.EthereumTypeAddressDescriptorLen {
+			return nil, errors.New("Invalid data in addressContracts")
+		}
+		txs, l := unpackVaruint(val[eth.EthereumTypeAddressDescriptorLen:])
+		if l == 0 {
+			return nil, errors.New("Invalid data in addressContracts")
+		}
+		buf = append(buf, val[:eth.EthereumTypeAddressDescriptorLen]...)
+		l2 := packVaruint(uint(bchain.ERC20TokenType)+txs<<2, varBuf)
+		buf = append(buf, varBuf[:l2]...)
+		val = val[eth.EthereumTypeAddressDescriptorLen+l:]
+	}
+	return buf, nil
+}
+
+// migrateBlockTxsEthereumTypeFlags adds the flags of ERC20 token type to the contracts of the block transactions
+// the direction of the transfer is not known, it is used only for tokens with ids
+func migrateBlockTxsEthereumTypeFlags(d *RocksDB, key, val []byte) ([]byte, error) {
+	pl := d.chainParser.PackedTxidLen()
+	al := eth.EthereumTypeAddressDescriptorLen
+	varBuf := make([]byte, maxPackedBigintBytes)
+	flags := packVaruint(uint(bchain.ERC20TokenType)<<2, varBuf)
+	buf := make([]byte, 0, len(val)+16)
+	for i := 0; i < len(val); {
+		if len(val)-i < pl+2*al {
+			return nil, errors.New("Inconsistent data in blockTxs")
+		}
+		cc, l := unpackVaruint(val[i+pl+2*al:])
+		if l == 0 {
+			return nil, errors.New("Inconsistent data in blockTxs")
+		}
+		buf = append(buf, val[i:i+pl+2*al+l]...)
+		i += pl + 2*al + l
+		for j := uint(0); j < cc; j++ {
+			if len(val)-i < 2*al {
+				return nil, errors.New("Inconsistent data in blockTxs")
+			}
+			buf = append(buf, val[i:i+2*al]...)
+			buf = append(buf, varBuf[:flags]...)
+			i += 2 * al
+		}
+	}
+	return buf, nil
+}
+
+// migrateBlockTimes creates the row of the block from the height column in the blockTimes column
+func migrateBlockTimes(d *RocksDB, wb *gorocksdb.WriteBatch, key, val []byte) error {
+	bi, err := d.unpackBlockInfo(val)
+	if err != nil {
+		return err
+	}
+	if bi == nil || len(key) != 4 {
+		return errors.New("Invalid height data")
+	}
+	return d.writeBlockTime(wb, unpackUint(key), bi.Time, opInsert)
+}
@@ -0,0 +1,166 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/common"
+	"blockbook/tests/dbtestdata"
+	"encoding/hex"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/tecbot/gorocksdb"
+)
+
+func getStoredInternalState(t *testing.T, d *RocksDB) *common.InternalState {
+	val, err := d.db.GetCF(d.ro, d.cfh[cfDefault], []byte(internalStateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer val.Free()
+	is, err := common.UnpackInternalState(val.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return is
+}
+
+// makeBitcoinTypeV4Fixture converts the db to the data format of the version 4, in which the balances do not contain utxos
+// and the blockTimes index does not exist
+func makeBitcoinTypeV4Fixture(t *testing.T, d *RocksDB) {
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	varBuf := make([]byte, maxPackedBigintBytes)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfAddressBalance])
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		ab, err := unpackAddrBalance(it.Value().Data(), d.chainParser.PackedTxidLen(), AddressBalanceDetailNoUTXO)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wb.PutCF(d.cfh[cfAddressBalance], it.Key().Data(), packAddrBalance(ab, nil, varBuf))
+	}
+	it.Close()
+	it = d.db.NewIteratorCF(d.ro, d.cfh[cfBlockTimes])
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		wb.DeleteCF(d.cfh[cfBlockTimes], it.Key().Data())
+	}
+	it.Close()
+	if err := d.db.Write(d.wo, wb); err != nil {
+		t.Fatal(err)
+	}
+	for i := range d.is.DbColumns {
+		d.is.DbColumns[i].Version = 4
+	}
+	if err := d.storeState(d.is); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRocksDB_Migrate(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	// db in the current version is not changed
+	if err := d.Migrate("coin-unittest", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.storeState(d.is); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Migrate("coin-unittest", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	makeBitcoinTypeV4Fixture(t, d)
+	if _, err := d.LoadInternalState("coin-unittest"); err == nil {
+		t.Fatal("LoadInternalState() of version 4 db expected error")
+	}
+	if err := d.Migrate("other-coin", nil); err == nil {
+		t.Fatal("Migrate() of different coin expected error")
+	}
+
+	// interrupt the migration after the first batch
+	defer func(size int) { migrationBatchSize = size }(migrationBatchSize)
+	migrationBatchSize = 3
+	stop := make(chan os.Signal, 1)
+	stop <- syscall.SIGINT
+	if err := d.Migrate("coin-unittest", stop); err != ErrOperationInterrupted {
+		t.Fatalf("Migrate() = %v, want %v", err, ErrOperationInterrupted)
+	}
+	is := getStoredInternalState(t, d)
+	if is.Migration == nil || is.Migration.FromVersion != 4 || is.Migration.Task != 0 || is.Migration.Rows != 3 || len(is.Migration.LastKey) == 0 {
+		t.Fatalf("interrupted migration state %+v", is.Migration)
+	}
+	if _, err := d.LoadInternalState("coin-unittest"); err == nil {
+		t.Fatal("LoadInternalState() of partially migrated db expected error")
+	}
+
+	// resume the migration
+	if err := d.Migrate("coin-unittest", nil); err != nil {
+		t.Fatal(err)
+	}
+	is = getStoredInternalState(t, d)
+	if is.Migration != nil {
+		t.Errorf("migration state %+v, want nil", is.Migration)
+	}
+	is, err := d.LoadInternalState("coin-unittest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range is.DbColumns {
+		if c.Version != dbVersion {
+			t.Errorf("column %v version %v, want %v", c.Name, c.Version, dbVersion)
+		}
+	}
+	d.SetInternalState(is)
+	verifyAfterBitcoinTypeBlock2(t, d)
+	if err := checkColumn(d, cfBlockTimes, []keyPair{
+		{uintToHex(1534858021) + "000370d5", "", nil},
+		{uintToHex(1534859123) + "000370d6", "", nil},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_migrateEthereumType(t *testing.T) {
+	d := &RocksDB{chainParser: ethereumTestnetParser()}
+	contract := strings.Repeat("ab", 20)
+	// total txs 2, non contract txs 1, contract with 5 txs
+	got, err := migrateAddressContractsTokenType(d, nil, hexToBytes("0201"+contract+"05"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "0201" + contract + "14"; hex.EncodeToString(got) != want {
+		t.Errorf("migrateAddressContractsTokenType() = %v, want %v", hex.EncodeToString(got), want)
+	}
+	if _, err = migrateAddressContractsTokenType(d, nil, hexToBytes("0201"+contract[:20])); err == nil {
+		t.Error("migrateAddressContractsTokenType() of invalid data expected error")
+	}
+
+	txid := strings.Repeat("cd", 32)
+	from := strings.Repeat("01", 20)
+	to := strings.Repeat("02", 20)
+	// tx with 2 token transfers and tx without token transfers
+	v5 := txid + from + to + "02" + to + contract + from + contract + txid + from + to + "00"
+	got, err = migrateBlockTxsEthereumTypeFlags(d, nil, hexToBytes(v5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := txid + from + to + "02" + to + contract + "00" + from + contract + "00" + txid + from + to + "00"
+	if hex.EncodeToString(got) != want {
+		t.Errorf("migrateBlockTxsEthereumTypeFlags() = %v, want %v", hex.EncodeToString(got), want)
+	}
+	if _, err = migrateBlockTxsEthereumTypeFlags(d, nil, hexToBytes(txid+from+to+"01"+to)); err == nil {
+		t.Error("migrateBlockTxsEthereumTypeFlags() of invalid data expected error")
+	}
+}
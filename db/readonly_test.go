@@ -0,0 +1,56 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/tests/dbtestdata"
+	"testing"
+)
+
+func TestRocksDB_ReadOnly(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRocksDBReadOnly(d.path, 100000, -1, d.chainParser, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	is, err := r.LoadInternalState("coin-unittest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetInternalState(is)
+	if !r.IsReadOnly() || d.IsReadOnly() {
+		t.Fatalf("IsReadOnly() = %v, %v", r.IsReadOnly(), d.IsReadOnly())
+	}
+	verifyAfterBitcoinTypeBlock1(t, r, false)
+
+	// the read-only db does not see the block connected by the primary until it catches up
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	verifyAfterBitcoinTypeBlock1(t, r, false)
+	if err = r.CatchUpWithPrimary(); err != nil {
+		t.Fatal(err)
+	}
+	verifyAfterBitcoinTypeBlock2(t, r)
+
+	// the read-only db cannot be written
+	if err = r.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err == nil {
+		t.Error("ConnectBlock() to read-only db expected error")
+	}
+	r.SetXpubCacheSize(100)
+	if r.XpubCacheEnabled() {
+		t.Error("XpubCacheEnabled() of read-only db = true")
+	}
+	if err = d.CatchUpWithPrimary(); err == nil {
+		t.Error("CatchUpWithPrimary() of writable db expected error")
+	}
+}
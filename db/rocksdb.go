@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
+	"sync"
 	"time"
 	"unsafe"
 
@@ -21,7 +22,7 @@ import (
 	"github.com/tecbot/gorocksdb"
 )
 
-const dbVersion = 5
+const dbVersion = 7
 
 const packedHeightBytes = 4
 const maxAddrDescLen = 1024
@@ -58,17 +59,27 @@ const (
 
 // RocksDB handle
 type RocksDB struct {
-	path         string
-	db           *gorocksdb.DB
-	wo           *gorocksdb.WriteOptions
-	ro           *gorocksdb.ReadOptions
-	cfh          []*gorocksdb.ColumnFamilyHandle
-	chainParser  bchain.BlockChainParser
-	is           *common.InternalState
-	metrics      *common.Metrics
-	cache        *gorocksdb.Cache
-	maxOpenFiles int
-	cbs          connectBlockStats
+	path          string
+	db            *gorocksdb.DB
+	wo            *gorocksdb.WriteOptions
+	ro            *gorocksdb.ReadOptions
+	cfh           []*gorocksdb.ColumnFamilyHandle
+	chainParser   bchain.BlockChainParser
+	is            *common.InternalState
+	metrics       *common.Metrics
+	cache         *gorocksdb.Cache
+	maxOpenFiles  int
+	cbs           connectBlockStats
+	blockFilter   bool
+	xpubCacheSize int
+	// connectMux serializes connecting and disconnecting of blocks with the creation of checkpoints
+	connectMux sync.Mutex
+	readOnly   bool
+	// readMux guards the reads of read-only db against switching to the reopened db in CatchUpWithPrimary
+	readMux sync.RWMutex
+	// recentBlockTimes keeps the times of the last connected blocks for the computation of the median time past
+	recentBlockTimes    [medianTimeBlocks]recentBlockTime
+	recentBlockTimesMux sync.Mutex
 }
 
 const (
@@ -77,35 +88,49 @@ const (
 	cfAddresses
 	cfBlockTxs
 	cfTransactions
+	cfFiatRates
+	cfBlockTimes
 	// BitcoinType
 	cfAddressBalance
 	cfTxAddresses
+	cfBlockFilter
+	cfXpubCache
+	cfSpentOutputs
+	cfBlockHeaders
 	// EthereumType
 	cfAddressContracts = cfAddressBalance
 )
 
 // common columns
 var cfNames []string
-var cfBaseNames = []string{"default", "height", "addresses", "blockTxs", "transactions"}
+var cfBaseNames = []string{"default", "height", "addresses", "blockTxs", "transactions", "fiatRates", "blockTimes"}
 
 // type specific columns
-var cfNamesBitcoinType = []string{"addressBalance", "txAddresses"}
+var cfNamesBitcoinType = []string{"addressBalance", "txAddresses", "blockFilter", "xpubCache", "spentOutputs", "blockHeaders"}
 var cfNamesEthereumType = []string{"addressContracts"}
 
-func openDB(path string, c *gorocksdb.Cache, openFiles int) (*gorocksdb.DB, []*gorocksdb.ColumnFamilyHandle, error) {
+func openDB(path string, c *gorocksdb.Cache, openFiles int, readOnly bool) (*gorocksdb.DB, []*gorocksdb.ColumnFamilyHandle, error) {
 	// opts with bloom filter
 	opts := createAndSetDBOptions(10, c, openFiles)
 	// opts for addresses without bloom filter
 	// from documentation: if most of your queries are executed using iterators, you shouldn't set bloom filter
 	optsAddresses := createAndSetDBOptions(0, c, openFiles)
-	// default, height, addresses, blockTxids, transactions
-	cfOptions := []*gorocksdb.Options{opts, opts, optsAddresses, opts, opts}
+	// default, height, addresses, blockTxids, transactions, fiatRates, blockTimes
+	cfOptions := []*gorocksdb.Options{opts, opts, optsAddresses, opts, opts, opts, optsAddresses}
 	// append type specific options
 	count := len(cfNames) - len(cfOptions)
 	for i := 0; i < count; i++ {
 		cfOptions = append(cfOptions, opts)
 	}
-	db, cfh, err := gorocksdb.OpenDbColumnFamilies(opts, path, cfNames, cfOptions)
+	var db *gorocksdb.DB
+	var cfh []*gorocksdb.ColumnFamilyHandle
+	var err error
+	if readOnly {
+		// the write ahead log of the primary instance is expected to exist
+		db, cfh, err = gorocksdb.OpenDbForReadOnlyColumnFamilies(opts, path, cfNames, cfOptions, false)
+	} else {
+		db, cfh, err = gorocksdb.OpenDbColumnFamilies(opts, path, cfNames, cfOptions)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
@@ -115,7 +140,17 @@ func openDB(path string, c *gorocksdb.Cache, openFiles int) (*gorocksdb.DB, []*g
 // NewRocksDB opens an internal handle to RocksDB environment.  Close
 // needs to be called to release it.
 func NewRocksDB(path string, cacheSize, maxOpenFiles int, parser bchain.BlockChainParser, metrics *common.Metrics) (d *RocksDB, err error) {
-	glog.Infof("rocksdb: opening %s, required data version %v, cache size %v, max open files %v", path, dbVersion, cacheSize, maxOpenFiles)
+	return newRocksDB(path, cacheSize, maxOpenFiles, parser, metrics, false)
+}
+
+// NewRocksDBReadOnly opens the db of another (primary) blockbook instance in read-only mode
+// the opened db does not see the data written by the primary instance until CatchUpWithPrimary is called
+func NewRocksDBReadOnly(path string, cacheSize, maxOpenFiles int, parser bchain.BlockChainParser, metrics *common.Metrics) (d *RocksDB, err error) {
+	return newRocksDB(path, cacheSize, maxOpenFiles, parser, metrics, true)
+}
+
+func newRocksDB(path string, cacheSize, maxOpenFiles int, parser bchain.BlockChainParser, metrics *common.Metrics, readOnly bool) (d *RocksDB, err error) {
+	glog.Infof("rocksdb: opening %s, required data version %v, cache size %v, max open files %v, read-only %v", path, dbVersion, cacheSize, maxOpenFiles, readOnly)
 
 	cfNames = append([]string{}, cfBaseNames...)
 	chainType := parser.GetChainType()
@@ -128,13 +163,19 @@ func NewRocksDB(path string, cacheSize, maxOpenFiles int, parser bchain.BlockCha
 	}
 
 	c := gorocksdb.NewLRUCache(cacheSize)
-	db, cfh, err := openDB(path, c, maxOpenFiles)
+	db, cfh, err := openDB(path, c, maxOpenFiles, readOnly)
 	if err != nil {
 		return nil, err
 	}
 	wo := gorocksdb.NewDefaultWriteOptions()
 	ro := gorocksdb.NewDefaultReadOptions()
-	return &RocksDB{path, db, wo, ro, cfh, parser, nil, metrics, c, maxOpenFiles, connectBlockStats{}}, nil
+	return &RocksDB{path, db, wo, ro, cfh, parser, nil, metrics, c, maxOpenFiles, connectBlockStats{}, false, 0, sync.Mutex{}, readOnly, sync.RWMutex{}, [medianTimeBlocks]recentBlockTime{}, sync.Mutex{}}, nil
+}
+
+// EnableBlockFilter switches on/off computation of BIP158 block filters of the connected blocks
+// the filters are computed only for Bitcoin type coins
+func (d *RocksDB) EnableBlockFilter(enable bool) {
+	d.blockFilter = enable && d.chainParser.GetChainType() == bchain.ChainBitcoinType
 }
 
 func (d *RocksDB) closeDB() error {
@@ -149,8 +190,8 @@ func (d *RocksDB) closeDB() error {
 // Close releases the RocksDB environment opened in NewRocksDB.
 func (d *RocksDB) Close() error {
 	if d.db != nil {
-		// store the internal state of the app
-		if d.is != nil && d.is.DbState == common.DbStateOpen {
+		// store the internal state of the app, the internal state of read-only db belongs to the primary instance
+		if d.is != nil && d.is.DbState == common.DbStateOpen && !d.readOnly {
 			d.is.DbState = common.DbStateClosed
 			if err := d.StoreInternalState(d.is); err != nil {
 				glog.Info("internalState: ", err)
@@ -172,7 +213,7 @@ func (d *RocksDB) Reopen() error {
 		return err
 	}
 	d.db = nil
-	db, cfh, err := openDB(d.path, d.cache, d.maxOpenFiles)
+	db, cfh, err := openDB(d.path, d.cache, d.maxOpenFiles, d.readOnly)
 	if err != nil {
 		return err
 	}
@@ -180,6 +221,43 @@ func (d *RocksDB) Reopen() error {
 	return nil
 }
 
+// IsReadOnly returns true if the db was opened by NewRocksDBReadOnly
+func (d *RocksDB) IsReadOnly() bool {
+	return d.readOnly
+}
+
+// CatchUpWithPrimary opens the db of the primary instance again and switches to it so that the read-only db sees the latest data
+// the switch waits until all reads started by LockRead are finished, the previous db is kept if the db cannot be opened
+func (d *RocksDB) CatchUpWithPrimary() error {
+	if !d.readOnly {
+		return errors.New("Database is not read-only")
+	}
+	db, cfh, err := openDB(d.path, d.cache, d.maxOpenFiles, true)
+	if err != nil {
+		return err
+	}
+	d.readMux.Lock()
+	defer d.readMux.Unlock()
+	d.closeDB()
+	d.db, d.cfh = db, cfh
+	return nil
+}
+
+// LockRead prevents CatchUpWithPrimary from switching the read-only db until UnlockRead is called
+// all requests reading read-only db must be done under this lock, for a writable db it does nothing
+func (d *RocksDB) LockRead() {
+	if d.readOnly {
+		d.readMux.RLock()
+	}
+}
+
+// UnlockRead releases the lock acquired by LockRead
+func (d *RocksDB) UnlockRead() {
+	if d.readOnly {
+		d.readMux.RUnlock()
+	}
+}
+
 func atoi(s string) int {
 	i, err := strconv.Atoi(s)
 	if err != nil {
@@ -302,6 +380,8 @@ const (
 
 // ConnectBlock indexes addresses in the block and stores them in db
 func (d *RocksDB) ConnectBlock(block *bchain.Block) error {
+	d.connectMux.Lock()
+	defer d.connectMux.Unlock()
 	wb := gorocksdb.NewWriteBatch()
 	defer wb.Destroy()
 
@@ -318,15 +398,27 @@ func (d *RocksDB) ConnectBlock(block *bchain.Block) error {
 	if chainType == bchain.ChainBitcoinType {
 		txAddressesMap := make(map[string]*TxAddresses)
 		balances := make(map[string]*AddrBalance)
-		if err := d.processAddressesBitcoinType(block, addresses, txAddressesMap, balances); err != nil {
+		spentOutputs := make(map[string][]byte)
+		if err := d.processAddressesBitcoinType(block, addresses, txAddressesMap, balances, spentOutputs); err != nil {
 			return err
 		}
+		if d.blockFilter {
+			filter, err := d.computeBlockFilter(block, txAddressesMap)
+			if err != nil {
+				return err
+			}
+			d.storeBlockFilter(wb, block.Height, filter)
+		}
+		d.updateBlockFilterHeight(block.Height)
 		if err := d.storeTxAddresses(wb, txAddressesMap); err != nil {
 			return err
 		}
 		if err := d.storeBalances(wb, balances); err != nil {
 			return err
 		}
+		d.storeSpentOutputs(wb, spentOutputs)
+		d.storeBlockHeader(wb, block.Height, block.RawHeader)
+		d.updateBlockHeadersHeight(block.Height, block.RawHeader)
 		if err := d.storeAndCleanupBlockTxs(wb, block); err != nil {
 			return err
 		}
@@ -339,6 +431,9 @@ func (d *RocksDB) ConnectBlock(block *bchain.Block) error {
 		if err := d.storeAddressContracts(wb, addressContracts); err != nil {
 			return err
 		}
+		if _, err := d.storeTxsWithInternalTransfers(wb, block); err != nil {
+			return err
+		}
 		if err := d.storeAndCleanupBlockTxsEthereumType(wb, block, blockTxs); err != nil {
 			return err
 		}
@@ -499,7 +594,7 @@ func (d *RocksDB) GetAndResetConnectBlockStats() string {
 	return s
 }
 
-func (d *RocksDB) processAddressesBitcoinType(block *bchain.Block, addresses addressesMap, txAddressesMap map[string]*TxAddresses, balances map[string]*AddrBalance) error {
+func (d *RocksDB) processAddressesBitcoinType(block *bchain.Block, addresses addressesMap, txAddressesMap map[string]*TxAddresses, balances map[string]*AddrBalance, spentOutputs map[string][]byte) error {
 	blockTxIDs := make([][]byte, len(block.Txs))
 	blockTxAddresses := make([]*TxAddresses, len(block.Txs))
 	// first process all outputs so that inputs can refer to txs in this block
@@ -577,6 +672,7 @@ func (d *RocksDB) processAddressesBitcoinType(block *bchain.Block, addresses add
 				}
 				return err
 			}
+			spentOutputs[string(packSpentOutputKey(btxID, input.Vout))] = packSpendingInput(spendingTxid, uint32(i), block.Height)
 			stxID := string(btxID)
 			ita, e := txAddressesMap[stxID]
 			if !e {
@@ -668,6 +764,93 @@ func addToAddressesMap(addresses addressesMap, strAddrDesc string, btxID []byte,
 	return false
 }
 
+// computeBlockFilter computes BIP158 block filter from the output scripts of the block transactions
+// and the scripts of the outputs spent by them, the scripts are taken from TxAddresses of the block
+func (d *RocksDB) computeBlockFilter(block *bchain.Block, txAddressesMap map[string]*TxAddresses) ([]byte, error) {
+	scripts := make([][]byte, 0, 4*len(block.Txs))
+	for i := range block.Txs {
+		btxID, err := d.chainParser.PackTxid(block.Txs[i].Txid)
+		if err != nil {
+			return nil, err
+		}
+		ta, found := txAddressesMap[string(btxID)]
+		if !found {
+			continue
+		}
+		for j := range ta.Inputs {
+			scripts = append(scripts, ta.Inputs[j].AddrDesc)
+		}
+		for j := range ta.Outputs {
+			if bchain.IsBlockFilterScript(ta.Outputs[j].AddrDesc) {
+				scripts = append(scripts, ta.Outputs[j].AddrDesc)
+			}
+		}
+	}
+	return bchain.ComputeBlockFilter(block.Hash, scripts)
+}
+
+func (d *RocksDB) storeBlockFilter(wb *gorocksdb.WriteBatch, height uint32, filter []byte) {
+	wb.PutCF(d.cfh[cfBlockFilter], packUint(height), filter)
+}
+
+// updateBlockFilterHeight records in the internal state from which height the block filters are stored,
+// the db upgraded from a version without the block filters or with the filters disabled for some time has no filters of the older blocks
+func (d *RocksDB) updateBlockFilterHeight(height uint32) {
+	if d.is != nil {
+		d.is.UpdateBlockFilterHeight(height, d.blockFilter)
+	}
+}
+
+// updateBlockHeadersHeight records in the internal state from which height the raw block headers are stored,
+// the headers of the blocks indexed by older versions of Blockbook are not stored
+func (d *RocksDB) updateBlockHeadersHeight(height uint32, header []byte) {
+	if d.is != nil {
+		d.is.UpdateBlockHeadersHeight(height, len(header) > 0)
+	}
+}
+
+func (d *RocksDB) storeBlockHeader(wb *gorocksdb.WriteBatch, height uint32, header []byte) {
+	if len(header) > 0 {
+		wb.PutCF(d.cfh[cfBlockHeaders], packUint(height), header)
+	}
+}
+
+// GetBlockHeaders returns the raw headers of up to count consecutive blocks starting at the height
+// the headers are stored only for the blocks parsed from the raw data by Blockbook version supporting them,
+// the returned list ends before the first block without the header
+func (d *RocksDB) GetBlockHeaders(height uint32, count int) ([][]byte, error) {
+	if d.chainParser.GetChainType() != bchain.ChainBitcoinType {
+		return nil, nil
+	}
+	r := make([][]byte, 0, count)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfBlockHeaders])
+	defer it.Close()
+	for it.Seek(packUint(height)); it.Valid() && len(r) < count; it.Next() {
+		if unpackUint(it.Key().Data()) != height {
+			break
+		}
+		r = append(r, append([]byte(nil), it.Value().Data()...))
+		height++
+	}
+	return r, it.Err()
+}
+
+// GetBlockFilter returns BIP158 block filter of the block at given height, nil if the filter is not stored
+func (d *RocksDB) GetBlockFilter(height uint32) ([]byte, error) {
+	if d.chainParser.GetChainType() != bchain.ChainBitcoinType {
+		return nil, nil
+	}
+	val, err := d.db.GetCF(d.ro, d.cfh[cfBlockFilter], packUint(height))
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	if val.Data() == nil {
+		return nil, nil
+	}
+	return append([]byte(nil), val.Data()...), nil
+}
+
 func (d *RocksDB) storeAddresses(wb *gorocksdb.WriteBatch, height uint32, addresses addressesMap) error {
 	for addrDesc, txi := range addresses {
 		ba := bchain.AddressDescriptor(addrDesc)
@@ -838,6 +1021,79 @@ func (d *RocksDB) GetTxAddresses(txid string) (*TxAddresses, error) {
 	return d.getTxAddresses(btxID)
 }
 
+// SpendingInput is the input of the transaction which spent an output
+type SpendingInput struct {
+	Txid   string
+	Vin    uint32
+	Height uint32
+}
+
+func packSpentOutputKey(btxID []byte, vout uint32) []byte {
+	varBuf := make([]byte, vlq.MaxLen64)
+	l := packVaruint(uint(vout), varBuf)
+	buf := make([]byte, 0, len(btxID)+l)
+	buf = append(buf, btxID...)
+	return append(buf, varBuf[:l]...)
+}
+
+func packSpendingInput(btxID []byte, vin uint32, height uint32) []byte {
+	varBuf := make([]byte, vlq.MaxLen64)
+	buf := make([]byte, 0, len(btxID)+2*vlq.MaxLen32)
+	buf = append(buf, btxID...)
+	l := packVaruint(uint(vin), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(height), varBuf)
+	return append(buf, varBuf[:l]...)
+}
+
+var errInvalidSpentOutputsData = errors.New("Invalid spentOutputs data")
+
+func (d *RocksDB) unpackSpendingInput(buf []byte) (*SpendingInput, error) {
+	pl := d.chainParser.PackedTxidLen()
+	if len(buf) < pl+2 {
+		return nil, errInvalidSpentOutputsData
+	}
+	txid, err := d.chainParser.UnpackTxid(buf[:pl])
+	if err != nil {
+		return nil, err
+	}
+	vin, l := unpackVaruint(buf[pl:])
+	if l <= 0 {
+		return nil, errInvalidSpentOutputsData
+	}
+	height, hl := unpackVaruint(buf[pl+l:])
+	if hl <= 0 {
+		return nil, errInvalidSpentOutputsData
+	}
+	return &SpendingInput{Txid: txid, Vin: uint32(vin), Height: uint32(height)}, nil
+}
+
+func (d *RocksDB) storeSpentOutputs(wb *gorocksdb.WriteBatch, spentOutputs map[string][]byte) {
+	for key, val := range spentOutputs {
+		wb.PutCF(d.cfh[cfSpentOutputs], []byte(key), val)
+	}
+}
+
+// GetSpendingInput returns the input which spent the output vout of the transaction txid or nil if the output is not spent
+func (d *RocksDB) GetSpendingInput(txid string, vout uint32) (*SpendingInput, error) {
+	if d.chainParser.GetChainType() != bchain.ChainBitcoinType {
+		return nil, nil
+	}
+	btxID, err := d.chainParser.PackTxid(txid)
+	if err != nil {
+		return nil, err
+	}
+	val, err := d.db.GetCF(d.ro, d.cfh[cfSpentOutputs], packSpentOutputKey(btxID, vout))
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	if len(val.Data()) == 0 {
+		return nil, nil
+	}
+	return d.unpackSpendingInput(val.Data())
+}
+
 // AddrDescForOutpoint defines function that returns address descriptorfor given outpoint or nil if outpoint not found
 func (d *RocksDB) AddrDescForOutpoint(outpoint bchain.Outpoint) bchain.AddressDescriptor {
 	ta, err := d.GetTxAddresses(outpoint.Txid)
@@ -1163,8 +1419,14 @@ func (d *RocksDB) writeHeight(wb *gorocksdb.WriteBatch, height uint32, bi *Block
 			return err
 		}
 		wb.PutCF(d.cfh[cfHeight], key, val)
+		if err = d.writeBlockTime(wb, height, bi.Time, opInsert); err != nil {
+			return err
+		}
 		d.is.UpdateBestHeight(height)
 	case opDelete:
+		if err := d.deleteBlockTime(wb, height); err != nil {
+			return err
+		}
 		wb.DeleteCF(d.cfh[cfHeight], key)
 		d.is.UpdateBestHeight(height - 1)
 	}
@@ -1191,6 +1453,9 @@ func (d *RocksDB) disconnectTxAddresses(wb *gorocksdb.WriteBatch, height uint32,
 		}
 		return b, nil
 	}
+	for i := range inputs {
+		wb.DeleteCF(d.cfh[cfSpentOutputs], packSpentOutputKey(inputs[i].btxID, uint32(inputs[i].index)))
+	}
 	for i, t := range txa.Inputs {
 		if len(t.AddrDesc) > 0 {
 			input := &inputs[i]
@@ -1282,6 +1547,8 @@ func (d *RocksDB) disconnectTxAddresses(wb *gorocksdb.WriteBatch, height uint32,
 // DisconnectBlockRangeBitcoinType removes all data belonging to blocks in range lower-higher
 // it is able to disconnect only blocks for which there are data in the blockTxs column
 func (d *RocksDB) DisconnectBlockRangeBitcoinType(lower uint32, higher uint32) error {
+	d.connectMux.Lock()
+	defer d.connectMux.Unlock()
 	blocks := make([][]blockTxs, higher-lower+1)
 	for height := lower; height <= higher; height++ {
 		blockTxs, err := d.getBlockTxs(height)
@@ -1321,9 +1588,14 @@ func (d *RocksDB) DisconnectBlockRangeBitcoinType(lower uint32, higher uint32) e
 				return err
 			}
 		}
+		if err := d.deleteBlockTime(wb, height); err != nil {
+			return err
+		}
 		key := packUint(height)
 		wb.DeleteCF(d.cfh[cfBlockTxs], key)
 		wb.DeleteCF(d.cfh[cfHeight], key)
+		wb.DeleteCF(d.cfh[cfBlockFilter], key)
+		wb.DeleteCF(d.cfh[cfBlockHeaders], key)
 	}
 	d.storeTxAddresses(wb, txAddressesToUpdate)
 	d.storeBalancesDisconnect(wb, balances)
@@ -1480,9 +1752,9 @@ func (d *RocksDB) LoadInternalState(rpcCoin string) (*common.InternalState, erro
 		nc[i].Version = dbVersion
 		for j := 0; j < len(sc); j++ {
 			if sc[j].Name == nc[i].Name {
-				// check the version of the column, if it does not match, the db is not compatible
+				// check the version of the column, if it does not match, the db must be migrated first
 				if sc[j].Version != dbVersion {
-					return nil, errors.Errorf("DB version %v of column '%v' does not match the required version %v. DB is not compatible.", sc[j].Version, sc[j].Name, dbVersion)
+					return nil, errors.Errorf("DB version %v of column '%v' does not match the required version %v. DB is not compatible, migrate it using -migrate.", sc[j].Version, sc[j].Name, dbVersion)
 				}
 				nc[i].Rows = sc[j].Rows
 				nc[i].KeyBytes = sc[j].KeyBytes
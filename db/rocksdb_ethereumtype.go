@@ -5,6 +5,7 @@ import (
 	"blockbook/bchain/coins/eth"
 	"bytes"
 	"encoding/hex"
+	"math/big"
 
 	vlq "github.com/bsm/go-vlq"
 	"github.com/golang/glog"
@@ -13,9 +14,12 @@ import (
 )
 
 // AddrContract is Contract address with number of transactions done by given address
+// IDValues contain the ids of ERC721 tokens or the ids and amounts of ERC1155 tokens held by the address
 type AddrContract struct {
+	Type     bchain.TokenType
 	Contract bchain.AddressDescriptor
 	Txs      uint
+	IDValues []bchain.TokenIDValue
 }
 
 // AddrContracts contains number of transactions and contracts for an address
@@ -25,9 +29,59 @@ type AddrContracts struct {
 	Contracts      []AddrContract
 }
 
+// packIDValues packs the ids of ERC721 tokens or the ids and values of ERC1155 tokens, ERC20 tokens do not have ids
+func packIDValues(tokenType bchain.TokenType, idValues []bchain.TokenIDValue, buf []byte, varBuf []byte) []byte {
+	if tokenType == bchain.ERC20TokenType {
+		return buf
+	}
+	l := packVaruint(uint(len(idValues)), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	for i := range idValues {
+		l = packBigint(&idValues[i].ID, varBuf)
+		buf = append(buf, varBuf[:l]...)
+		if tokenType == bchain.ERC1155TokenType {
+			l = packBigint(&idValues[i].Value, varBuf)
+			buf = append(buf, varBuf[:l]...)
+		}
+	}
+	return buf
+}
+
+func unpackIDValues(tokenType bchain.TokenType, buf []byte) ([]bchain.TokenIDValue, int, error) {
+	if tokenType == bchain.ERC20TokenType {
+		return nil, 0, nil
+	}
+	n, l := unpackVaruint(buf)
+	if l == 0 {
+		return nil, 0, errors.New("Invalid packed token ids")
+	}
+	// do not preallocate n items, n is read from the data and could be corrupted
+	var idValues []bchain.TokenIDValue
+	for i := uint(0); i < n; i++ {
+		if l >= len(buf) || l+int(buf[l])+1 > len(buf) {
+			return nil, 0, errors.New("Invalid packed token ids")
+		}
+		var idValue bchain.TokenIDValue
+		var ll int
+		idValue.ID, ll = unpackBigint(buf[l:])
+		l += ll
+		if tokenType == bchain.ERC1155TokenType {
+			if l >= len(buf) || l+int(buf[l])+1 > len(buf) {
+				return nil, 0, errors.New("Invalid packed token ids")
+			}
+			idValue.Value, ll = unpackBigint(buf[l:])
+			l += ll
+		} else {
+			idValue.Value.SetInt64(1)
+		}
+		idValues = append(idValues, idValue)
+	}
+	return idValues, l, nil
+}
+
 func (d *RocksDB) storeAddressContracts(wb *gorocksdb.WriteBatch, acm map[string]*AddrContracts) error {
 	buf := make([]byte, 64)
-	varBuf := make([]byte, vlq.MaxLen64)
+	varBuf := make([]byte, maxPackedBigintBytes)
 	for addrDesc, acs := range acm {
 		// address with 0 contracts is removed from db - happens on disconnect
 		if acs == nil || (acs.NonContractTxs == 0 && len(acs.Contracts) == 0) {
@@ -38,10 +92,13 @@ func (d *RocksDB) storeAddressContracts(wb *gorocksdb.WriteBatch, acm map[string
 			buf = append(buf, varBuf[:l]...)
 			l = packVaruint(acs.NonContractTxs, varBuf)
 			buf = append(buf, varBuf[:l]...)
-			for _, ac := range acs.Contracts {
+			for i := range acs.Contracts {
+				ac := &acs.Contracts[i]
 				buf = append(buf, ac.Contract...)
-				l = packVaruint(ac.Txs, varBuf)
+				// the token type is stored in the lowest 2 bits of the number of transactions
+				l = packVaruint(uint(ac.Type)+ac.Txs<<2, varBuf)
 				buf = append(buf, varBuf[:l]...)
+				buf = packIDValues(ac.Type, ac.IDValues, buf, varBuf)
 			}
 			wb.PutCF(d.cfh[cfAddressContracts], bchain.AddressDescriptor(addrDesc), buf)
 		}
@@ -71,11 +128,19 @@ func (d *RocksDB) GetAddrDescContracts(addrDesc bchain.AddressDescriptor) (*Addr
 		}
 		txs, l := unpackVaruint(buf[eth.EthereumTypeAddressDescriptorLen:])
 		contract := append(bchain.AddressDescriptor(nil), buf[:eth.EthereumTypeAddressDescriptorLen]...)
+		buf = buf[eth.EthereumTypeAddressDescriptorLen+l:]
+		tokenType := bchain.TokenType(txs & 3)
+		idValues, l, err := unpackIDValues(tokenType, buf)
+		if err != nil {
+			return nil, errors.Annotatef(err, "cfAddressContracts for AddrDesc %v", addrDesc)
+		}
 		c = append(c, AddrContract{
+			Type:     tokenType,
 			Contract: contract,
-			Txs:      txs,
+			Txs:      txs >> 2,
+			IDValues: idValues,
 		})
-		buf = buf[eth.EthereumTypeAddressDescriptorLen+l:]
+		buf = buf[l:]
 	}
 	return &AddrContracts{
 		TotalTxs:       tt,
@@ -102,7 +167,60 @@ func isZeroAddress(addrDesc bchain.AddressDescriptor) bool {
 	return true
 }
 
-func (d *RocksDB) addToAddressesAndContractsEthereumType(addrDesc bchain.AddressDescriptor, btxID []byte, index int32, contract bchain.AddressDescriptor, addresses addressesMap, addressContracts map[string]*AddrContracts, addTxCount bool) error {
+// addIDValues adds the token ids (and amounts in case of ERC1155) to the tokens held by the address
+func addIDValues(ac *AddrContract, idValues []bchain.TokenIDValue) {
+	for i := range idValues {
+		iv := &idValues[i]
+		j := findIDValue(ac.IDValues, &iv.ID)
+		if j < 0 {
+			ac.IDValues = append(ac.IDValues, bchain.TokenIDValue{ID: *new(big.Int).Set(&iv.ID), Value: *new(big.Int).Set(&iv.Value)})
+		} else if ac.Type == bchain.ERC1155TokenType {
+			ac.IDValues[j].Value.Add(&ac.IDValues[j].Value, &iv.Value)
+		}
+	}
+}
+
+// removeIDValues removes the token ids (or subtracts the amounts in case of ERC1155) from the tokens held by the address
+func removeIDValues(ac *AddrContract, idValues []bchain.TokenIDValue) {
+	for i := range idValues {
+		iv := &idValues[i]
+		j := findIDValue(ac.IDValues, &iv.ID)
+		if j < 0 {
+			continue
+		}
+		if ac.Type == bchain.ERC1155TokenType {
+			ac.IDValues[j].Value.Sub(&ac.IDValues[j].Value, &iv.Value)
+			if ac.IDValues[j].Value.Sign() > 0 {
+				continue
+			}
+		}
+		ac.IDValues = append(ac.IDValues[:j], ac.IDValues[j+1:]...)
+	}
+}
+
+func findIDValue(idValues []bchain.TokenIDValue, id *big.Int) int {
+	for i := range idValues {
+		if idValues[i].ID.Cmp(id) == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// updateIDValues changes the tokens held by the address in the direction of the transfer,
+// reverse is used on disconnect, transfer from and to the same address does not change anything
+func updateIDValues(ac *AddrContract, c *ethBlockTxContract, reverse bool) {
+	if ac.Type == bchain.ERC20TokenType || c.received == c.sent {
+		return
+	}
+	if c.received != reverse {
+		addIDValues(ac, c.idValues)
+	} else {
+		removeIDValues(ac, c.idValues)
+	}
+}
+
+func (d *RocksDB) addToAddressesAndContractsEthereumType(addrDesc bchain.AddressDescriptor, btxID []byte, index int32, contract *ethBlockTxContract, addresses addressesMap, addressContracts map[string]*AddrContracts, addTxCount bool) error {
 	var err error
 	strAddrDesc := string(addrDesc)
 	ac, e := addressContracts[strAddrDesc]
@@ -127,11 +245,12 @@ func (d *RocksDB) addToAddressesAndContractsEthereumType(addrDesc bchain.Address
 		// do not store contracts for 0x0000000000000000000000000000000000000000 address
 		if !isZeroAddress(addrDesc) {
 			// locate the contract and set i to the index in the array of contracts
-			i, found := findContractInAddressContracts(contract, ac.Contracts)
+			i, found := findContractInAddressContracts(contract.contract, ac.Contracts)
 			if !found {
 				i = len(ac.Contracts)
-				ac.Contracts = append(ac.Contracts, AddrContract{Contract: contract})
+				ac.Contracts = append(ac.Contracts, AddrContract{Type: contract.tokenType, Contract: contract.contract})
 			}
+			updateIDValues(&ac.Contracts[i], contract, false)
 			// index 0 is for ETH transfers, contract indexes start with 1
 			if index < 0 {
 				index = ^int32(i + 1)
@@ -150,8 +269,13 @@ func (d *RocksDB) addToAddressesAndContractsEthereumType(addrDesc bchain.Address
 	return nil
 }
 
+// ethBlockTxContract is a token transfer from or to addr, received and sent specify the direction of the transfer
+// in case of ERC721 and ERC1155 tokens idValues are stored to be able to restore the held tokens on disconnect
 type ethBlockTxContract struct {
 	addr, contract bchain.AddressDescriptor
+	tokenType      bchain.TokenType
+	received, sent bool
+	idValues       []bchain.TokenIDValue
 }
 
 type ethBlockTx struct {
@@ -206,7 +330,8 @@ func (d *RocksDB) processAddressesEthereumType(block *bchain.Block, addresses ad
 		}
 		blockTx.contracts = make([]ethBlockTxContract, len(erc20)*2)
 		j := 0
-		for i, t := range erc20 {
+		for i := range erc20 {
+			t := &erc20[i]
 			var contract, from, to bchain.AddressDescriptor
 			contract, err = d.chainParser.GetAddrDescFromAddress(t.Contract)
 			if err == nil {
@@ -219,34 +344,106 @@ func (d *RocksDB) processAddressesEthereumType(block *bchain.Block, addresses ad
 				glog.Warningf("rocksdb: GetErc20FromTx %v - height %d, tx %v, transfer %v", err, block.Height, tx.Txid, t)
 				continue
 			}
-			if err = d.addToAddressesAndContractsEthereumType(to, btxID, int32(i), contract, addresses, addressContracts, true); err != nil {
-				return nil, err
-			}
 			eq := bytes.Equal(from, to)
 			bc := &blockTx.contracts[j]
 			j++
-			bc.addr = from
-			bc.contract = contract
-			if err = d.addToAddressesAndContractsEthereumType(from, btxID, ^int32(i), contract, addresses, addressContracts, !eq); err != nil {
-				return nil, err
+			*bc = ethBlockTxContract{
+				addr:      from,
+				contract:  contract,
+				tokenType: t.Type,
+				received:  eq,
+				sent:      true,
+				idValues:  t.IDValues,
 			}
 			// add to address to blockTx.contracts only if it is different from from address
+			tc := bc
 			if !eq {
-				bc = &blockTx.contracts[j]
+				tc = &blockTx.contracts[j]
 				j++
-				bc.addr = to
-				bc.contract = contract
+				*tc = ethBlockTxContract{
+					addr:      to,
+					contract:  contract,
+					tokenType: t.Type,
+					received:  true,
+					idValues:  t.IDValues,
+				}
+			}
+			if err = d.addToAddressesAndContractsEthereumType(to, btxID, int32(i), tc, addresses, addressContracts, true); err != nil {
+				return nil, err
+			}
+			if err = d.addToAddressesAndContractsEthereumType(from, btxID, ^int32(i), bc, addresses, addressContracts, !eq); err != nil {
+				return nil, err
 			}
 		}
 		blockTx.contracts = blockTx.contracts[:j]
+		// store internal transfers, they are ETH transfers and their addresses are indexed as the transaction from and to addresses
+		internalTransfers, err := d.chainParser.EthereumTypeGetInternalTransfersFromTx(&tx)
+		if err != nil {
+			glog.Warningf("rocksdb: GetInternalTransfersFromTx %v - height %d, tx %v", err, block.Height, tx.Txid)
+		}
+		if len(internalTransfers) > 0 {
+			// the address is counted only once in the transaction
+			// the newly counted addresses are stored in blockTx.contracts with nil contract to be able to disconnect them
+			counted := map[string]struct{}{string(blockTx.from): {}, string(blockTx.to): {}}
+			addInternalTransferAddress := func(address string, index int32) error {
+				addrDesc, err := d.chainParser.GetAddrDescFromAddress(address)
+				if err != nil {
+					glog.Warningf("rocksdb: addrDesc: %v - height %d, tx %v, internal transfer", err, block.Height, tx.Txid)
+					return nil
+				}
+				if _, found := counted[string(addrDesc)]; found {
+					return nil
+				}
+				counted[string(addrDesc)] = struct{}{}
+				if err = d.addToAddressesAndContractsEthereumType(addrDesc, btxID, index, nil, addresses, addressContracts, true); err != nil {
+					return err
+				}
+				blockTx.contracts = append(blockTx.contracts, ethBlockTxContract{addr: addrDesc})
+				return nil
+			}
+			for i := range internalTransfers {
+				it := &internalTransfers[i]
+				if err = addInternalTransferAddress(it.From, ^int32(0)); err != nil {
+					return nil, err
+				}
+				if err = addInternalTransferAddress(it.To, 0); err != nil {
+					return nil, err
+				}
+			}
+		}
 	}
 	return blockTxs, nil
 }
 
+// storeTxsWithInternalTransfers stores the transactions containing internal transfers in the transactions column,
+// the backend returns internal transfers only when tracing the transactions, which is slow
+func (d *RocksDB) storeTxsWithInternalTransfers(wb *gorocksdb.WriteBatch, block *bchain.Block) (int, error) {
+	count := 0
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		internalTransfers, err := d.chainParser.EthereumTypeGetInternalTransfersFromTx(tx)
+		if err != nil || len(internalTransfers) == 0 {
+			continue
+		}
+		key, err := d.chainParser.PackTxid(tx.Txid)
+		if err != nil {
+			return 0, err
+		}
+		buf, err := d.chainParser.PackTx(tx, block.Height, block.Time)
+		if err != nil {
+			return 0, err
+		}
+		wb.PutCF(d.cfh[cfTransactions], key, buf)
+		d.is.AddDBColumnStats(cfTransactions, 1, int64(len(key)), int64(len(buf)))
+		count++
+	}
+	return count, nil
+}
+
 func (d *RocksDB) storeAndCleanupBlockTxsEthereumType(wb *gorocksdb.WriteBatch, block *bchain.Block, blockTxs []ethBlockTx) error {
 	pl := d.chainParser.PackedTxidLen()
 	buf := make([]byte, 0, (pl+2*eth.EthereumTypeAddressDescriptorLen)*len(blockTxs))
-	varBuf := make([]byte, vlq.MaxLen64)
+	varBuf := make([]byte, maxPackedBigintBytes)
 	zeroAddress := make([]byte, eth.EthereumTypeAddressDescriptorLen)
 	appendAddress := func(a bchain.AddressDescriptor) {
 		if len(a) != eth.EthereumTypeAddressDescriptorLen {
@@ -266,6 +463,17 @@ func (d *RocksDB) storeAndCleanupBlockTxsEthereumType(wb *gorocksdb.WriteBatch,
 			c := &blockTx.contracts[j]
 			appendAddress(c.addr)
 			appendAddress(c.contract)
+			// token type and the direction of the transfer are packed as flags
+			flags := uint(c.tokenType) << 2
+			if c.sent {
+				flags |= 2
+			}
+			if c.received {
+				flags |= 1
+			}
+			l = packVaruint(flags, varBuf)
+			buf = append(buf, varBuf[:l]...)
+			buf = packIDValues(c.tokenType, c.idValues, buf, varBuf)
 		}
 	}
 	key := packUint(block.Height)
@@ -321,14 +529,30 @@ func (d *RocksDB) getBlockTxsEthereumType(height uint32) ([]ethBlockTx, error) {
 		i += l
 		contracts := make([]ethBlockTxContract, cc)
 		for j := range contracts {
-			contracts[j].addr, i, err = getAddress(i)
+			c := &contracts[j]
+			c.addr, i, err = getAddress(i)
 			if err != nil {
 				return nil, err
 			}
-			contracts[j].contract, i, err = getAddress(i)
+			c.contract, i, err = getAddress(i)
 			if err != nil {
 				return nil, err
 			}
+			flags, l := unpackVaruint(buf[i:])
+			if l == 0 {
+				glog.Error("rocksdb: Inconsistent data in blockTxs ", hex.EncodeToString(buf))
+				return nil, errors.New("Inconsistent data in blockTxs")
+			}
+			i += l
+			c.tokenType = bchain.TokenType(flags >> 2)
+			c.sent = flags&2 != 0
+			c.received = flags&1 != 0
+			c.idValues, l, err = unpackIDValues(c.tokenType, buf[i:])
+			if err != nil {
+				glog.Error("rocksdb: Inconsistent data in blockTxs ", hex.EncodeToString(buf))
+				return nil, errors.New("Inconsistent data in blockTxs")
+			}
+			i += l
 		}
 		bt = append(bt, ethBlockTx{
 			btxID:     txid,
@@ -343,7 +567,7 @@ func (d *RocksDB) getBlockTxsEthereumType(height uint32) ([]ethBlockTx, error) {
 func (d *RocksDB) disconnectBlockTxsEthereumType(wb *gorocksdb.WriteBatch, height uint32, blockTxs []ethBlockTx, contracts map[string]*AddrContracts) error {
 	glog.Info("Disconnecting block ", height, " containing ", len(blockTxs), " transactions")
 	addresses := make(map[string]map[string]struct{})
-	disconnectAddress := func(btxID []byte, addrDesc, contract bchain.AddressDescriptor) error {
+	disconnectAddress := func(btxID []byte, addrDesc bchain.AddressDescriptor, contract *ethBlockTxContract) error {
 		var err error
 		// do not process empty address
 		if len(addrDesc) == 0 {
@@ -375,15 +599,16 @@ func (d *RocksDB) disconnectBlockTxsEthereumType(wb *gorocksdb.WriteBatch, heigh
 			if !ftx {
 				c.TotalTxs--
 			}
-			if contract == nil {
+			if contract == nil || contract.contract == nil {
 				if c.NonContractTxs > 0 {
 					c.NonContractTxs--
 				} else {
 					glog.Warning("AddressContracts ", addrDesc, ", EthTxs would be negative, tx ", hex.EncodeToString(btxID))
 				}
 			} else {
-				i, found := findContractInAddressContracts(contract, c.Contracts)
+				i, found := findContractInAddressContracts(contract.contract, c.Contracts)
 				if found {
+					updateIDValues(&c.Contracts[i], contract, true)
 					if c.Contracts[i].Txs > 0 {
 						c.Contracts[i].Txs--
 						if c.Contracts[i].Txs == 0 {
@@ -393,7 +618,7 @@ func (d *RocksDB) disconnectBlockTxsEthereumType(wb *gorocksdb.WriteBatch, heigh
 						glog.Warning("AddressContracts ", addrDesc, ", contract ", i, " Txs would be negative, tx ", hex.EncodeToString(btxID))
 					}
 				} else {
-					glog.Warning("AddressContracts ", addrDesc, ", contract ", contract, " not found, tx ", hex.EncodeToString(btxID))
+					glog.Warning("AddressContracts ", addrDesc, ", contract ", contract.contract, " not found, tx ", hex.EncodeToString(btxID))
 				}
 			}
 		} else {
@@ -401,7 +626,8 @@ func (d *RocksDB) disconnectBlockTxsEthereumType(wb *gorocksdb.WriteBatch, heigh
 		}
 		return nil
 	}
-	for i := range blockTxs {
+	// process the transactions in the reverse order to restore the held ERC721 and ERC1155 tokens correctly
+	for i := len(blockTxs) - 1; i >= 0; i-- {
 		blockTx := &blockTxs[i]
 		if err := disconnectAddress(blockTx.btxID, blockTx.from, nil); err != nil {
 			return err
@@ -412,8 +638,9 @@ func (d *RocksDB) disconnectBlockTxsEthereumType(wb *gorocksdb.WriteBatch, heigh
 				return err
 			}
 		}
-		for _, c := range blockTx.contracts {
-			if err := disconnectAddress(blockTx.btxID, c.addr, c.contract); err != nil {
+		for j := len(blockTx.contracts) - 1; j >= 0; j-- {
+			c := &blockTx.contracts[j]
+			if err := disconnectAddress(blockTx.btxID, c.addr, c); err != nil {
 				return err
 			}
 		}
@@ -429,6 +656,8 @@ func (d *RocksDB) disconnectBlockTxsEthereumType(wb *gorocksdb.WriteBatch, heigh
 // DisconnectBlockRangeEthereumType removes all data belonging to blocks in range lower-higher
 // it is able to disconnect only blocks for which there are data in the blockTxs column
 func (d *RocksDB) DisconnectBlockRangeEthereumType(lower uint32, higher uint32) error {
+	d.connectMux.Lock()
+	defer d.connectMux.Unlock()
 	blocks := make([][]ethBlockTx, higher-lower+1)
 	for height := lower; height <= higher; height++ {
 		blockTxs, err := d.getBlockTxsEthereumType(height)
@@ -448,6 +677,9 @@ func (d *RocksDB) DisconnectBlockRangeEthereumType(lower uint32, higher uint32)
 		if err := d.disconnectBlockTxsEthereumType(wb, height, blocks[height-lower], contracts); err != nil {
 			return err
 		}
+		if err := d.deleteBlockTime(wb, height); err != nil {
+			return err
+		}
 		key := packUint(height)
 		wb.DeleteCF(d.cfh[cfBlockTxs], key)
 		wb.DeleteCF(d.cfh[cfHeight], key)
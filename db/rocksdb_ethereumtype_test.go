@@ -3,9 +3,11 @@
 package db
 
 import (
+	"blockbook/bchain"
 	"blockbook/bchain/coins/eth"
 	"blockbook/tests/dbtestdata"
 	"encoding/hex"
+	"math/big"
 	"reflect"
 	"testing"
 
@@ -45,8 +47,8 @@ func verifyAfterEthereumTypeBlock1(t *testing.T, d *RocksDB, afterDisconnect boo
 
 	if err := checkColumn(d, cfAddressContracts, []keyPair{
 		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr3e, d.chainParser), "0101", nil},
-		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser), "0201" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "01", nil},
-		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr20, d.chainParser), "0101" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "01", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser), "0201" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "04", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr20, d.chainParser), "0101" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "04", nil},
 		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser), "0101", nil},
 	}); err != nil {
 		{
@@ -66,8 +68,8 @@ func verifyAfterEthereumTypeBlock1(t *testing.T, d *RocksDB, afterDisconnect boo
 					dbtestdata.EthTxidB1T2 +
 					dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr20, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) +
 					"02" +
-					dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr20, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) +
-					dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser),
+					dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr20, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "02" +
+					dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "01",
 				nil,
 			},
 		}
@@ -114,12 +116,12 @@ func verifyAfterEthereumTypeBlock2(t *testing.T, d *RocksDB) {
 
 	if err := checkColumn(d, cfAddressContracts, []keyPair{
 		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr3e, d.chainParser), "0101", nil},
-		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser), "0402" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "02" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "01", nil},
-		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr20, d.chainParser), "0101" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "01", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser), "0402" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "08" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "04", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr20, d.chainParser), "0101" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "04", nil},
 		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser), "0101", nil},
 		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr9f, d.chainParser), "0101", nil},
-		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser), "0101" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "02" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "02", nil},
-		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr7b, d.chainParser), "0100" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "01" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "01", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser), "0101" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "08" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "08", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr7b, d.chainParser), "0100" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "04" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "04", nil},
 		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract47, d.chainParser), "0101", nil},
 	}); err != nil {
 		{
@@ -135,14 +137,14 @@ func verifyAfterEthereumTypeBlock2(t *testing.T, d *RocksDB) {
 				dbtestdata.EthTxidB2T2 +
 				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract47, d.chainParser) +
 				"08" +
-				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) +
-				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) +
-				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) +
-				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) +
-				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr7b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) +
-				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) +
-				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) +
-				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr7b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser),
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "02" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "01" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "02" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "01" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr7b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "02" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "01" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "02" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr7b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "01",
 			nil,
 		},
 	}); err != nil {
@@ -282,3 +284,271 @@ func TestRocksDB_Index_EthereumType(t *testing.T) {
 	verifyAfterEthereumTypeBlock2(t, d)
 
 }
+
+// TestRocksDB_InternalTransfers_EthereumType connects a block with a transaction containing internal transfers,
+// checks the indexes of the addresses touched by the internal transfers and the stored transaction
+// and disconnects the block again
+func TestRocksDB_InternalTransfers_EthereumType(t *testing.T) {
+	// keep the blockTxs of two blocks so that block 3 can be disconnected and the state after block 2 verified
+	d := setupRocksDB(t, &testEthereumParser{
+		EthereumParser: eth.NewEthereumParser(2),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	for _, block := range []*bchain.Block{
+		dbtestdata.GetTestEthereumTypeBlock1(d.chainParser),
+		dbtestdata.GetTestEthereumTypeBlock2(d.chainParser),
+	} {
+		if err := d.ConnectBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	block3 := dbtestdata.GetTestEthereumTypeBlock3(d.chainParser)
+	if err := d.ConnectBlock(block3); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkColumn(d, cfAddresses, []keyPair{
+		{addressKeyHex(dbtestdata.EthAddr3e, 4321000, d), txIndexesHex(dbtestdata.EthTxidB1T1, []int32{^0}), nil},
+		{addressKeyHex(dbtestdata.EthAddr55, 4321000, d), txIndexesHex(dbtestdata.EthTxidB1T2, []int32{1}) + txIndexesHex(dbtestdata.EthTxidB1T1, []int32{0}), nil},
+		{addressKeyHex(dbtestdata.EthAddr20, 4321000, d), txIndexesHex(dbtestdata.EthTxidB1T2, []int32{^0, ^1}), nil},
+		{addressKeyHex(dbtestdata.EthAddrContract4a, 4321000, d), txIndexesHex(dbtestdata.EthTxidB1T2, []int32{0}), nil},
+		{addressKeyHex(dbtestdata.EthAddr55, 4321001, d), txIndexesHex(dbtestdata.EthTxidB2T2, []int32{^2, 1}) + txIndexesHex(dbtestdata.EthTxidB2T1, []int32{^0}), nil},
+		{addressKeyHex(dbtestdata.EthAddr9f, 4321001, d), txIndexesHex(dbtestdata.EthTxidB2T1, []int32{0}), nil},
+		{addressKeyHex(dbtestdata.EthAddr4b, 4321001, d), txIndexesHex(dbtestdata.EthTxidB2T2, []int32{^0, 1, ^2, 2, ^1}), nil},
+		{addressKeyHex(dbtestdata.EthAddr7b, 4321001, d), txIndexesHex(dbtestdata.EthTxidB2T2, []int32{^1, 2}), nil},
+		{addressKeyHex(dbtestdata.EthAddrContract47, 4321001, d), txIndexesHex(dbtestdata.EthTxidB2T2, []int32{0}), nil},
+		{addressKeyHex(dbtestdata.EthAddr3e, 4321002, d), txIndexesHex(dbtestdata.EthTxidB3T1, []int32{^0}), nil},
+		{addressKeyHex(dbtestdata.EthAddr9f, 4321002, d), txIndexesHex(dbtestdata.EthTxidB3T1, []int32{0}), nil},
+		{addressKeyHex(dbtestdata.EthAddr7b, 4321002, d), txIndexesHex(dbtestdata.EthTxidB3T1, []int32{0}), nil},
+		{addressKeyHex(dbtestdata.EthAddrContract47, 4321002, d), txIndexesHex(dbtestdata.EthTxidB3T1, []int32{0}), nil},
+	}); err != nil {
+		{
+			t.Fatal(err)
+		}
+	}
+
+	// the internal transfers are counted as non contract transactions, each address only once per transaction
+	if err := checkColumn(d, cfAddressContracts, []keyPair{
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr3e, d.chainParser), "0202", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser), "0402" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "08" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "04", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr20, d.chainParser), "0101" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "04", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser), "0101", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr9f, d.chainParser), "0202", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser), "0101" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "08" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "08", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr7b, d.chainParser), "0201" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "04" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "04", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract47, d.chainParser), "0202", nil},
+	}); err != nil {
+		{
+			t.Fatal(err)
+		}
+	}
+
+	// the addresses of the internal transfers are stored with zero contract
+	zeroAddress := hex.EncodeToString(make([]byte, eth.EthereumTypeAddressDescriptorLen))
+	if err := checkColumn(d, cfBlockTxs, []keyPair{
+		{
+			"0041eee9",
+			dbtestdata.EthTxidB2T1 +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr9f, d.chainParser) + "00" +
+				dbtestdata.EthTxidB2T2 +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract47, d.chainParser) +
+				"08" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "02" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "01" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "02" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "01" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr7b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "02" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "01" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "02" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr7b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "01",
+			nil,
+		},
+		{
+			"0041eeea",
+			dbtestdata.EthTxidB3T1 +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr3e, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract47, d.chainParser) +
+				"02" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr9f, d.chainParser) + zeroAddress + "00" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr7b, d.chainParser) + zeroAddress + "00",
+			nil,
+		},
+	}); err != nil {
+		{
+			t.Fatal(err)
+		}
+	}
+
+	// the transaction with internal transfers is stored in the transactions column
+	if err := checkColumn(d, cfTransactions, []keyPair{
+		{dbtestdata.EthTxidB3T1, dbtestdata.EthTx5Packed, nil},
+	}); err != nil {
+		{
+			t.Fatal(err)
+		}
+	}
+	tx, height, err := d.GetTx("0x" + dbtestdata.EthTxidB3T1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 4321002 {
+		t.Errorf("GetTx() height = %v, want %v", height, 4321002)
+	}
+	its, err := d.chainParser.EthereumTypeGetInternalTransfersFromTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(its) != 3 {
+		t.Errorf("EthereumTypeGetInternalTransfersFromTx() = %+v, want 3 internal transfers", its)
+	}
+
+	verifyGetTransactions(t, d, "0x"+dbtestdata.EthAddr9f, 0, 10000000, []txidIndex{
+		{"0x" + dbtestdata.EthTxidB3T1, 0},
+		{"0x" + dbtestdata.EthTxidB2T1, 0},
+	}, nil)
+
+	// disconnect the 3rd block, the state after the 2nd block must be restored and the stored transaction removed
+	if err := d.DisconnectBlockRangeEthereumType(4321002, 4321002); err != nil {
+		t.Fatal(err)
+	}
+	verifyAfterEthereumTypeBlock2(t, d)
+	if err := checkColumn(d, cfTransactions, []keyPair{}); err != nil {
+		{
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestRocksDB_NFT_EthereumType connects a block with ERC721 and ERC1155 transfers,
+// checks the token standards and the token ids held by the addresses and disconnects the block again
+func TestRocksDB_NFT_EthereumType(t *testing.T) {
+	d := setupRocksDB(t, &testEthereumParser{
+		EthereumParser: eth.NewEthereumParser(2),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	for _, block := range []*bchain.Block{
+		dbtestdata.GetTestEthereumTypeBlock1(d.chainParser),
+		dbtestdata.GetTestEthereumTypeBlock2(d.chainParser),
+		dbtestdata.GetTestEthereumTypeBlock3NFT(d.chainParser),
+	} {
+		if err := d.ConnectBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the ERC721 token 0x1a4 is transferred 7b->4b->55, ERC1155 tokens are transferred 7b->4b (ids 1 and 2) and 4b->55 (id 1)
+	// the contract txs are packed as txs<<2+token type, followed by the number of ids and the packed ids (and values)
+	if err := checkColumn(d, cfAddressContracts, []keyPair{
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr3e, d.chainParser), "0101", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser), "0502" +
+			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "08" +
+			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "04" +
+			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContractCd, d.chainParser) + "05" + "01" + "0201a4" +
+			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract6f, d.chainParser) + "06" + "01" + "0101" + "0102", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr20, d.chainParser), "0101" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "04", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser), "0101", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr9f, d.chainParser), "0101", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser), "0202" +
+			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "08" +
+			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "08" +
+			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContractCd, d.chainParser) + "09" + "00" +
+			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract6f, d.chainParser) + "0a" + "02" + "0101" + "0103" + "0102" + "0101", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr7b, d.chainParser), "0200" +
+			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "04" +
+			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "04" +
+			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContractCd, d.chainParser) + "05" + "00" +
+			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract6f, d.chainParser) + "06" + "00", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract47, d.chainParser), "0101", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContractCd, d.chainParser), "0101", nil},
+	}); err != nil {
+		{
+			t.Fatal(err)
+		}
+	}
+
+	// the blockTxs contain the token type and the direction of the transfer and the transferred ids
+	if err := checkColumn(d, cfBlockTxs, []keyPair{
+		{
+			"0041eee9",
+			dbtestdata.EthTxidB2T1 +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr9f, d.chainParser) + "00" +
+				dbtestdata.EthTxidB2T2 +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract47, d.chainParser) +
+				"08" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "02" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "01" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "02" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "01" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr7b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "02" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "01" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "02" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr7b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + "01",
+			nil,
+		},
+		{
+			"0041eeea",
+			dbtestdata.EthTxidB3T2 +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContractCd, d.chainParser) +
+				"08" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr7b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContractCd, d.chainParser) + "06" + "01" + "0201a4" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContractCd, d.chainParser) + "05" + "01" + "0201a4" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContractCd, d.chainParser) + "06" + "01" + "0201a4" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContractCd, d.chainParser) + "05" + "01" + "0201a4" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr7b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract6f, d.chainParser) + "0a" + "02" + "0101" + "0105" + "0102" + "0101" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract6f, d.chainParser) + "09" + "02" + "0101" + "0105" + "0102" + "0101" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract6f, d.chainParser) + "0a" + "01" + "0101" + "0102" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract6f, d.chainParser) + "09" + "01" + "0101" + "0102",
+			nil,
+		},
+	}); err != nil {
+		{
+			t.Fatal(err)
+		}
+	}
+
+	verifyGetTransactions(t, d, "0x"+dbtestdata.EthAddr4b, 4321002, 4321002, []txidIndex{
+		{"0x" + dbtestdata.EthTxidB3T2, ^0},
+		{"0x" + dbtestdata.EthTxidB3T2, 3},
+		{"0x" + dbtestdata.EthTxidB3T2, ^3},
+		{"0x" + dbtestdata.EthTxidB3T2, 4},
+		{"0x" + dbtestdata.EthTxidB3T2, ^4},
+	}, nil)
+
+	addrDesc, err := d.chainParser.GetAddrDescFromAddress(dbtestdata.EthAddr4b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ac, err := d.GetAddrDescContracts(addrDesc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ac == nil || len(ac.Contracts) != 4 {
+		t.Fatalf("GetAddrDescContracts() = %+v, want 4 contracts", ac)
+	}
+	want := []AddrContract{
+		{
+			Type:     bchain.ERC721TokenType,
+			Contract: addressToAddrDesc(dbtestdata.EthAddrContractCd, d.chainParser),
+			Txs:      2,
+		},
+		{
+			Type:     bchain.ERC1155TokenType,
+			Contract: addressToAddrDesc(dbtestdata.EthAddrContract6f, d.chainParser),
+			Txs:      2,
+			IDValues: []bchain.TokenIDValue{
+				{ID: *big.NewInt(1), Value: *big.NewInt(3)},
+				{ID: *big.NewInt(2), Value: *big.NewInt(1)},
+			},
+		},
+	}
+	if !reflect.DeepEqual(ac.Contracts[2:], want) {
+		t.Errorf("GetAddrDescContracts() = %+v, want %+v", ac.Contracts[2:], want)
+	}
+
+	// disconnect the 3rd block, the held tokens must be restored to the state after the 2nd block
+	if err := d.DisconnectBlockRangeEthereumType(4321002, 4321002); err != nil {
+		t.Fatal(err)
+	}
+	verifyAfterEthereumTypeBlock2(t, d)
+}
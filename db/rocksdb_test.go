@@ -262,6 +262,12 @@ func verifyAfterBitcoinTypeBlock1(t *testing.T, d *RocksDB, afterDisconnect bool
 		}
 	}
 
+	if err := checkColumn(d, cfSpentOutputs, []keyPair{}); err != nil {
+		{
+			t.Fatal(err)
+		}
+	}
+
 	var blockTxsKp []keyPair
 	if afterDisconnect {
 		blockTxsKp = []keyPair{}
@@ -447,6 +453,17 @@ func verifyAfterBitcoinTypeBlock2(t *testing.T, d *RocksDB) {
 			t.Fatal(err)
 		}
 	}
+	if err := checkColumn(d, cfSpentOutputs, []keyPair{
+		{dbtestdata.TxidB1T1 + varuintToHex(1), dbtestdata.TxidB2T1 + varuintToHex(1) + varuintToHex(225494), nil},
+		{dbtestdata.TxidB1T2 + varuintToHex(0), dbtestdata.TxidB2T1 + varuintToHex(0) + varuintToHex(225494), nil},
+		{dbtestdata.TxidB1T2 + varuintToHex(1), dbtestdata.TxidB2T2 + varuintToHex(1) + varuintToHex(225494), nil},
+		{dbtestdata.TxidB1T2 + varuintToHex(2), dbtestdata.TxidB2T3 + varuintToHex(0) + varuintToHex(225494), nil},
+		{dbtestdata.TxidB2T1 + varuintToHex(0), dbtestdata.TxidB2T2 + varuintToHex(0) + varuintToHex(225494), nil},
+	}); err != nil {
+		{
+			t.Fatal(err)
+		}
+	}
 	if err := checkColumn(d, cfBlockTxs, []keyPair{
 		{
 			"000370d6",
@@ -727,6 +744,172 @@ func TestRocksDB_Index_BitcoinType(t *testing.T) {
 		t.Errorf("GetTxAddresses().Inputs[0].Addresses() = %v, want %v", ia, []string{dbtestdata.Addr3})
 	}
 
+	si, err := d.GetSpendingInput(dbtestdata.TxidB1T2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siw := &SpendingInput{Txid: dbtestdata.TxidB2T2, Vin: 1, Height: 225494}
+	if !reflect.DeepEqual(si, siw) {
+		t.Errorf("GetSpendingInput() = %+v, want %+v", si, siw)
+	}
+	si, err = d.GetSpendingInput(dbtestdata.TxidB2T1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if si != nil {
+		t.Errorf("GetSpendingInput() of unspent output = %+v, want nil", si)
+	}
+
+}
+
+func verifyBlockFilter(t *testing.T, d *RocksDB, block *bchain.Block, match []string, noMatch []string) {
+	filter, err := d.GetBlockFilter(block.Height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter == nil {
+		t.Fatalf("GetBlockFilter(%v) filter not found", block.Height)
+	}
+	for _, h := range match {
+		m, err := bchain.BlockFilterMatch(filter, block.Hash, hexToBytes(h))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !m {
+			t.Errorf("GetBlockFilter(%v) script %v not matched", block.Height, h)
+		}
+	}
+	for _, h := range noMatch {
+		m, err := bchain.BlockFilterMatch(filter, block.Hash, hexToBytes(h))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m {
+			t.Errorf("GetBlockFilter(%v) script %v unexpectedly matched", block.Height, h)
+		}
+	}
+}
+
+func TestRocksDB_BlockFilter_BitcoinType(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	d.EnableBlockFilter(true)
+
+	block1 := dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)
+	if err := d.ConnectBlock(block1); err != nil {
+		t.Fatal(err)
+	}
+	block2 := dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)
+	if err := d.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+	verifyBlockFilter(t, d, block1, []string{
+		dbtestdata.AddressToPubKeyHex(dbtestdata.Addr1, d.chainParser),
+		dbtestdata.AddressToPubKeyHex(dbtestdata.Addr2, d.chainParser),
+		dbtestdata.AddressToPubKeyHex(dbtestdata.Addr5, d.chainParser),
+	}, []string{
+		dbtestdata.AddressToPubKeyHex(dbtestdata.Addr6, d.chainParser),
+	})
+	// block2 spends outputs of Addr3 from block1, OP_RETURN output is not part of the filter
+	verifyBlockFilter(t, d, block2, []string{
+		dbtestdata.AddressToPubKeyHex(dbtestdata.Addr3, d.chainParser),
+		dbtestdata.AddressToPubKeyHex(dbtestdata.Addr6, d.chainParser),
+		dbtestdata.AddressToPubKeyHex(dbtestdata.Addr7, d.chainParser),
+	}, []string{
+		dbtestdata.TxidB2T1Output3OpReturn,
+	})
+
+	// disconnect the 2nd block, its filter must be removed
+	if err := d.DisconnectBlockRangeBitcoinType(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	verifyBlockFilter(t, d, block1, []string{
+		dbtestdata.AddressToPubKeyHex(dbtestdata.Addr1, d.chainParser),
+	}, nil)
+	filter, err := d.GetBlockFilter(225494)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter != nil {
+		t.Errorf("GetBlockFilter(225494) = %x, want nil", filter)
+	}
+	if h, stored := d.is.GetBlockFilterHeight(); !stored || h != 225493 {
+		t.Errorf("GetBlockFilterHeight() = %v %v, want 225493 true", h, stored)
+	}
+
+	// a block connected without the filter invalidates the filters of the lower blocks,
+	// after enabling the filters again they are available from the next connected block
+	d.EnableBlockFilter(false)
+	if err := d.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+	if h, stored := d.is.GetBlockFilterHeight(); stored {
+		t.Errorf("GetBlockFilterHeight() = %v %v, want not stored", h, stored)
+	}
+	if err := d.DisconnectBlockRangeBitcoinType(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	d.EnableBlockFilter(true)
+	if err := d.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+	if h, stored := d.is.GetBlockFilterHeight(); !stored || h != 225494 {
+		t.Errorf("GetBlockFilterHeight() = %v %v, want 225494 true", h, stored)
+	}
+}
+
+func verifyBlockHeaders(t *testing.T, d *RocksDB, height uint32, count int, want []string) {
+	headers, err := d.GetBlockHeaders(height, count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, len(headers))
+	for i := range headers {
+		got[i] = hex.EncodeToString(headers[i])
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetBlockHeaders(%v, %v) = %v, want %v", height, count, got, want)
+	}
+}
+
+func TestRocksDB_BlockHeaders_BitcoinType(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	verifyBlockHeaders(t, d, 225493, 2016, []string{dbtestdata.HeaderB1, dbtestdata.HeaderB2})
+	verifyBlockHeaders(t, d, 225493, 1, []string{dbtestdata.HeaderB1})
+	if h, stored := d.is.GetBlockHeadersHeight(); !stored || h != 225493 {
+		t.Errorf("GetBlockHeadersHeight() = %v %v, want 225493 true", h, stored)
+	}
+	verifyBlockHeaders(t, d, 225494, 10, []string{dbtestdata.HeaderB2})
+	verifyBlockHeaders(t, d, 225492, 10, []string{})
+	verifyBlockHeaders(t, d, 225495, 10, []string{})
+
+	// disconnect the 2nd block, its header must be removed
+	if err := d.DisconnectBlockRangeBitcoinType(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	verifyBlockHeaders(t, d, 225493, 2016, []string{dbtestdata.HeaderB1})
+
+	// a block without the header makes the headers of the lower blocks unavailable
+	block2 := dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)
+	block2.RawHeader = nil
+	if err := d.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+	if h, stored := d.is.GetBlockHeadersHeight(); stored {
+		t.Errorf("GetBlockHeadersHeight() = %v %v, want not stored", h, stored)
+	}
 }
 
 func Test_BulkConnect_BitcoinType(t *testing.T) {
@@ -734,6 +917,7 @@ func Test_BulkConnect_BitcoinType(t *testing.T) {
 		BitcoinParser: bitcoinTestnetParser(),
 	})
 	defer closeAndDestroyRocksDB(t, d)
+	d.EnableBlockFilter(true)
 
 	bc, err := d.InitBulkConnect()
 	if err != nil {
@@ -766,6 +950,11 @@ func Test_BulkConnect_BitcoinType(t *testing.T) {
 	}
 
 	verifyAfterBitcoinTypeBlock2(t, d)
+	verifyBlockHeaders(t, d, 225493, 2016, []string{dbtestdata.HeaderB1, dbtestdata.HeaderB2})
+	verifyBlockFilter(t, d, dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser), []string{
+		dbtestdata.AddressToPubKeyHex(dbtestdata.Addr3, d.chainParser),
+		dbtestdata.AddressToPubKeyHex(dbtestdata.Addr6, d.chainParser),
+	}, nil)
 }
 
 func Test_packBigint_unpackBigint(t *testing.T) {
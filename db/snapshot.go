@@ -0,0 +1,342 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"blockbook/common"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// snapshot is a portable copy of the index, independent of the version of RocksDB
+// the file is gzip compressed, it starts with the magic string followed by the length of the json header (uint32) and the header
+// then follow the columns in the order given by the header, each column is a sequence of rows
+// (key_len+1 uvarint)+(key []byte)+(value_len uvarint)+(value []byte), terminated by a zero byte,
+// the number of rows (uvarint) and SHA-256 checksum of the rows including the terminating byte
+
+const snapshotMagic = "BLOCKBOOK-SNAPSHOT"
+const snapshotFormatVersion = 1
+
+// maxSnapshotItemLen limits the length of keys and values read from snapshot
+const maxSnapshotItemLen = 1 << 28
+
+// importSnapshotBatchSize is the number of rows written to db in one write batch during import
+const importSnapshotBatchSize = 10000
+
+// SnapshotHeader describes the content of the snapshot
+type SnapshotHeader struct {
+	FormatVersion int       `json:"formatVersion"`
+	Coin          string    `json:"coin"`
+	DbVersion     uint32    `json:"dbVersion"`
+	Height        uint32    `json:"height"`
+	Hash          string    `json:"hash"`
+	Created       time.Time `json:"created"`
+	Columns       []string  `json:"columns"`
+}
+
+var errInvalidSnapshot = errors.New("Invalid snapshot")
+
+// ExportSnapshot writes the content of all columns to a new file
+// connecting of blocks is paused only until a RocksDB snapshot of the db is taken
+func (d *RocksDB) ExportSnapshot(file string) (*SnapshotHeader, error) {
+	if d.is == nil {
+		return nil, errors.New("Internal state not created")
+	}
+	if d.is.DbState == common.DbStateInconsistent {
+		return nil, errors.New("Cannot export snapshot of database in inconsistent state")
+	}
+	start := time.Now()
+	d.connectMux.Lock()
+	height, hash, err := d.GetBestBlock()
+	if err != nil {
+		d.connectMux.Unlock()
+		return nil, err
+	}
+	is, err := d.packClosedInternalState()
+	if err != nil {
+		d.connectMux.Unlock()
+		return nil, err
+	}
+	snap := d.db.NewSnapshot()
+	d.connectMux.Unlock()
+	defer d.db.ReleaseSnapshot(snap)
+
+	h := &SnapshotHeader{
+		FormatVersion: snapshotFormatVersion,
+		Coin:          d.is.Coin,
+		DbVersion:     dbVersion,
+		Height:        height,
+		Hash:          hash,
+		Created:       time.Now().UTC(),
+		Columns:       append([]string{}, cfNames...),
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.writeSnapshot(f, h, snap, is); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(file)
+		return nil, err
+	}
+	glog.Infof("rocksdb: snapshot of block %d %s exported to %s, duration %v", height, hash, file, time.Since(start))
+	return h, nil
+}
+
+func (d *RocksDB) writeSnapshot(f io.Writer, h *SnapshotHeader, snap *gorocksdb.Snapshot, is []byte) error {
+	ro := gorocksdb.NewDefaultReadOptions()
+	defer ro.Destroy()
+	ro.SetFillCache(false)
+	ro.SetSnapshot(snap)
+	zw := gzip.NewWriter(f)
+	w := bufio.NewWriterSize(zw, 1<<20)
+	hb, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	w.WriteString(snapshotMagic)
+	w.Write(packUint(uint32(len(hb))))
+	w.Write(hb)
+	varBuf := make([]byte, binary.MaxVarintLen64)
+	for c := range h.Columns {
+		sum := sha256.New()
+		cw := io.MultiWriter(w, sum)
+		writeItem := func(b []byte, l int) {
+			n := binary.PutUvarint(varBuf, uint64(l))
+			cw.Write(varBuf[:n])
+			cw.Write(b)
+		}
+		var rows uint64
+		it := d.db.NewIteratorCF(ro, d.cfh[c])
+		for it.SeekToFirst(); it.Valid(); it.Next() {
+			key := it.Key().Data()
+			val := it.Value().Data()
+			// the stored internal state is replaced by the current one
+			if c == cfDefault && bytes.Equal(key, []byte(internalStateKey)) {
+				val = is
+			}
+			writeItem(key, len(key)+1)
+			writeItem(val, len(val))
+			rows++
+		}
+		err := it.Err()
+		it.Close()
+		if err != nil {
+			return err
+		}
+		cw.Write([]byte{0})
+		n := binary.PutUvarint(varBuf, rows)
+		w.Write(varBuf[:n])
+		if _, err = w.Write(sum.Sum(nil)); err != nil {
+			return err
+		}
+		glog.Info("rocksdb: snapshot column ", h.Columns[c], ", exported ", rows, " rows")
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// snapshotReader computes the checksum of the read data
+type snapshotReader struct {
+	r   *bufio.Reader
+	sum hash.Hash
+}
+
+func (r *snapshotReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.sum.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (r *snapshotReader) readItem(l uint64) ([]byte, error) {
+	if l > maxSnapshotItemLen {
+		return nil, errInvalidSnapshot
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return nil, err
+	}
+	r.sum.Write(b)
+	return b, nil
+}
+
+func readSnapshotHeader(r *bufio.Reader) (*SnapshotHeader, error) {
+	b := make([]byte, len(snapshotMagic)+4)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	if string(b[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, errInvalidSnapshot
+	}
+	l := unpackUint(b[len(snapshotMagic):])
+	if l > maxSnapshotItemLen {
+		return nil, errInvalidSnapshot
+	}
+	b = make([]byte, l)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	var h SnapshotHeader
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// ImportSnapshot creates a new database in the directory path from the snapshot in file
+// the snapshot must be of the given coin and of the current version of the db, the checksums of all columns are verified
+// in case of any error the directory path is removed
+func ImportSnapshot(file, path string, cacheSize, maxOpenFiles int, parser bchain.BlockChainParser, coin string) (*SnapshotHeader, error) {
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return nil, errors.Errorf("Database directory %v already exists", path)
+	}
+	start := time.Now()
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	r := bufio.NewReaderSize(zr, 1<<20)
+	h, err := readSnapshotHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if h.FormatVersion != snapshotFormatVersion {
+		return nil, errors.Errorf("Unsupported snapshot format version %v", h.FormatVersion)
+	}
+	if h.Coin != coin {
+		return nil, errors.Errorf("Coins do not match. Snapshot coin %v, RPC coin %v", h.Coin, coin)
+	}
+	if h.DbVersion != dbVersion {
+		return nil, errors.Errorf("Snapshot DB version %v does not match the required version %v", h.DbVersion, dbVersion)
+	}
+	glog.Infof("rocksdb: importing snapshot of block %d %s created %v", h.Height, h.Hash, h.Created)
+	d, err := NewRocksDB(path, cacheSize, maxOpenFiles, parser, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = d.readSnapshot(r, h, coin)
+	d.Close()
+	if err != nil {
+		os.RemoveAll(path)
+		return nil, err
+	}
+	glog.Infof("rocksdb: snapshot imported to %s, duration %v", path, time.Since(start))
+	return h, nil
+}
+
+func (d *RocksDB) readSnapshot(br *bufio.Reader, h *SnapshotHeader, coin string) error {
+	columns := make(map[string]int, len(cfNames))
+	for i, n := range cfNames {
+		columns[n] = i
+	}
+	var is []byte
+	for _, name := range h.Columns {
+		c, found := columns[name]
+		if !found {
+			return errors.Errorf("Snapshot column %v is not supported", name)
+		}
+		r := &snapshotReader{r: br, sum: sha256.New()}
+		wb := gorocksdb.NewWriteBatch()
+		var rows uint64
+		for {
+			kl, err := binary.ReadUvarint(r)
+			if err != nil {
+				wb.Destroy()
+				return err
+			}
+			if kl == 0 {
+				break
+			}
+			key, err := r.readItem(kl - 1)
+			if err != nil {
+				wb.Destroy()
+				return err
+			}
+			vl, err := binary.ReadUvarint(r)
+			if err != nil {
+				wb.Destroy()
+				return err
+			}
+			val, err := r.readItem(vl)
+			if err != nil {
+				wb.Destroy()
+				return err
+			}
+			rows++
+			// the internal state is stored after all columns are verified
+			if c == cfDefault && bytes.Equal(key, []byte(internalStateKey)) {
+				is = val
+				continue
+			}
+			wb.PutCF(d.cfh[c], key, val)
+			if wb.Count() >= importSnapshotBatchSize {
+				if err = d.db.Write(d.wo, wb); err != nil {
+					wb.Destroy()
+					return err
+				}
+				wb.Clear()
+			}
+		}
+		err := d.db.Write(d.wo, wb)
+		wb.Destroy()
+		if err != nil {
+			return err
+		}
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return err
+		}
+		sum := make([]byte, sha256.Size)
+		if _, err = io.ReadFull(br, sum); err != nil {
+			return err
+		}
+		if n != rows || !bytes.Equal(sum, r.sum.Sum(nil)) {
+			return errors.Errorf("Checksum of snapshot column %v does not match", name)
+		}
+		glog.Info("rocksdb: snapshot column ", name, ", imported ", rows, " rows")
+	}
+	if is == nil {
+		return errors.New("Snapshot does not contain internal state")
+	}
+	if err := d.db.PutCF(d.wo, d.cfh[cfDefault], []byte(internalStateKey), is); err != nil {
+		return err
+	}
+	// the same checks as on the startup of blockbook
+	if _, err := d.LoadInternalState(coin); err != nil {
+		return err
+	}
+	height, hash, err := d.GetBestBlock()
+	if err != nil {
+		return err
+	}
+	if height != h.Height || hash != h.Hash {
+		return errors.Errorf("Best block %v %v of the imported snapshot does not match the header %v %v", height, hash, h.Height, h.Hash)
+	}
+	return nil
+}
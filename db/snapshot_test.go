@@ -0,0 +1,95 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/common"
+	"blockbook/tests/dbtestdata"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRocksDB_ExportImportSnapshot(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	block2 := dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)
+	if err := d.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+	d.is.DbState = common.DbStateOpen
+
+	tmp, err := ioutil.TempDir("", "testsnapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	file := filepath.Join(tmp, "snapshot.gz")
+
+	h, err := d.ExportSnapshot(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Coin != "coin-unittest" || h.DbVersion != dbVersion || h.Height != block2.Height || h.Hash != block2.Hash {
+		t.Errorf("ExportSnapshot() = %+v", h)
+	}
+	// existing file is not overwritten
+	if _, err = d.ExportSnapshot(file); err == nil {
+		t.Error("ExportSnapshot() to existing file expected error")
+	}
+
+	// snapshot of a different coin is refused and the db directory is not created
+	path := filepath.Join(tmp, "db")
+	if _, err = ImportSnapshot(file, path, 100000, -1, d.chainParser, "other-coin"); err == nil {
+		t.Error("ImportSnapshot() of different coin expected error")
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("ImportSnapshot() of different coin left directory %v", path)
+	}
+
+	// truncated snapshot is refused and the partially imported db is removed
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(tmp, "truncated.gz")
+	if err = ioutil.WriteFile(truncated, buf[:len(buf)*2/3], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ImportSnapshot(truncated, path, 100000, -1, d.chainParser, "coin-unittest"); err == nil {
+		t.Error("ImportSnapshot() of truncated snapshot expected error")
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("ImportSnapshot() of truncated snapshot left directory %v", path)
+	}
+
+	if _, err = ImportSnapshot(file, path, 100000, -1, d.chainParser, "coin-unittest"); err != nil {
+		t.Fatal(err)
+	}
+	i, err := NewRocksDB(path, 100000, -1, d.chainParser, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+	is, err := i.LoadInternalState("coin-unittest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if is.DbState != common.DbStateClosed {
+		t.Errorf("imported DbState = %v, want %v", is.DbState, common.DbStateClosed)
+	}
+	i.SetInternalState(is)
+	verifyAfterBitcoinTypeBlock2(t, i)
+
+	// the db directory must not exist
+	if _, err = ImportSnapshot(file, path, 100000, -1, d.chainParser, "coin-unittest"); err == nil {
+		t.Error("ImportSnapshot() to existing directory expected error")
+	}
+}
@@ -20,6 +20,7 @@ type SyncWorker struct {
 	dryRun                 bool
 	startHeight            uint32
 	startHash              string
+	blocksDir              string
 	chanOsSignal           chan os.Signal
 	metrics                *common.Metrics
 	is                     *common.InternalState
@@ -118,6 +119,20 @@ func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync b
 	if err != nil {
 		return err
 	}
+	// the initial sync can import the blocks directly from the block files of the backend,
+	// the blocks not found in the files are then synchronized using RPC
+	if w.blocksDir != "" && initialSync {
+		dir := w.blocksDir
+		w.blocksDir = ""
+		glog.Info("resync: import of blocks from height ", w.startHeight, " from block files in ", dir)
+		n, err := w.ConnectBlocksFromFiles(dir, w.startHeight)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return w.resyncIndex(onNewBlock, initialSync)
+		}
+	}
 	// if parallel operation is enabled and the number of blocks to be connected is large,
 	// use parallel routine to load majority of blocks
 	// use parallel sync only in case of initial sync because it puts the db to inconsistent state
@@ -292,7 +307,7 @@ func (w *SyncWorker) ConnectBlocksParallel(lower, higher uint32) error {
 	GetBlockLoop:
 		for hh := range hch {
 			for {
-				block, err = w.chain.GetBlock(hh.hash, hh.height)
+				block, err = w.getBlock(hh.hash, hh.height)
 				if err != nil {
 					// signal came while looping in the error loop
 					if hchClosed.Load() == true {
@@ -323,6 +338,7 @@ func (w *SyncWorker) ConnectBlocksParallel(lower, higher uint32) error {
 	}
 	go writeBlockWorker()
 	var hash string
+	var hashes []string
 	start := time.Now()
 	msTime := time.Now().Add(1 * time.Minute)
 ConnectLoop:
@@ -335,13 +351,16 @@ ConnectLoop:
 			close(terminating)
 			break ConnectLoop
 		default:
-			hash, err = w.chain.GetBlockHash(h)
-			if err != nil {
-				glog.Error("GetBlockHash error ", err)
-				w.metrics.IndexResyncErrors.With(common.Labels{"error": "failure"}).Inc()
-				time.Sleep(time.Millisecond * 500)
-				continue
+			if len(hashes) == 0 {
+				hashes, err = w.getBlockHashes(h, higher)
+				if err != nil {
+					glog.Error("GetBlockHash error ", err)
+					w.metrics.IndexResyncErrors.With(common.Labels{"error": "failure"}).Inc()
+					time.Sleep(time.Millisecond * 500)
+					continue
+				}
 			}
+			hash, hashes = hashes[0], hashes[1:]
 			hch <- hashHeight{hash, h}
 			if h > 0 && h%1000 == 0 {
 				glog.Info("connecting block ", h, " ", hash, ", elapsed ", time.Since(start), " ", w.db.GetAndResetConnectBlockStats())
@@ -367,6 +386,42 @@ ConnectLoop:
 	return err
 }
 
+// getBlockHashes returns the hashes of the blocks starting at the height lower, in one batch request if the backend supports it,
+// otherwise only the hash of the block at the height lower
+func (w *SyncWorker) getBlockHashes(lower, higher uint32) ([]string, error) {
+	bc := bchain.GetBatchBlockChain(w.chain)
+	if bc == nil {
+		hash, err := w.chain.GetBlockHash(lower)
+		if err != nil {
+			return nil, err
+		}
+		return []string{hash}, nil
+	}
+	if n := uint32(bc.RPCBatchSize()); higher-lower >= n {
+		higher = lower + n - 1
+	}
+	heights := make([]uint32, 0, higher-lower+1)
+	for h := lower; h <= higher; h++ {
+		heights = append(heights, h)
+	}
+	return bc.GetBlockHashes(heights)
+}
+
+// getBlock gets the block from the backend, the raw header of the block, which is not set by the parser
+// or which is not available because the block is not parsed from the raw data, is got by a separate request
+func (w *SyncWorker) getBlock(hash string, height uint32) (*bchain.Block, error) {
+	block, err := w.chain.GetBlock(hash, height)
+	if err != nil || len(block.RawHeader) > 0 || w.chain.GetChainParser().GetChainType() != bchain.ChainBitcoinType {
+		return block, err
+	}
+	if rc := bchain.GetRawBlockHeaderChain(w.chain); rc != nil {
+		if block.RawHeader, err = rc.GetBlockHeaderRaw(block.Hash); err != nil {
+			return nil, errors.Annotatef(err, "GetBlockHeaderRaw %v %v", height, block.Hash)
+		}
+	}
+	return block, nil
+}
+
 type blockResult struct {
 	block *bchain.Block
 	err   error
@@ -386,7 +441,7 @@ func (w *SyncWorker) getBlockChain(out chan blockResult, done chan struct{}) {
 			return
 		default:
 		}
-		block, err := w.chain.GetBlock(hash, height)
+		block, err := w.getBlock(hash, height)
 		if err != nil {
 			if err == bchain.ErrBlockNotFound {
 				break
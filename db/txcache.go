@@ -35,7 +35,7 @@ func NewTxCache(db *RocksDB, chain bchain.BlockChain, metrics *common.Metrics, i
 }
 
 // GetTransaction returns transaction either from RocksDB or if not present from blockchain
-// it the transaction is confirmed, it is stored in the RocksDB
+// it the transaction is confirmed, it is stored in the RocksDB, unless the RocksDB is read-only
 func (c *TxCache) GetTransaction(txid string) (*bchain.Tx, uint32, error) {
 	var tx *bchain.Tx
 	var h uint32
@@ -82,7 +82,7 @@ func (c *TxCache) GetTransaction(txid string) (*bchain.Tx, uint32, error) {
 		} else {
 			return nil, 0, errors.New("Unknown chain type")
 		}
-		if c.enabled {
+		if c.enabled && !c.db.IsReadOnly() {
 			err = c.db.PutTx(tx, h, tx.Blocktime)
 			// do not return caching error, only log it
 			if err != nil {
@@ -0,0 +1,312 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"blockbook/common"
+	"sort"
+	"time"
+
+	vlq "github.com/bsm/go-vlq"
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// xpubCacheExpirationSeconds is the time after which a not accessed xpub is evicted from the persistent cache
+const xpubCacheExpirationSeconds = 30 * 24 * 3600
+
+// XpubCacheTxid is a transaction of a derived address of the xpub
+type XpubCacheTxid struct {
+	Txid        string
+	Height      uint32
+	InputOutput byte
+}
+
+// XpubCacheAddress is a derived address of the xpub with its transactions loaded up to MaxHeight
+type XpubCacheAddress struct {
+	AddrDesc  bchain.AddressDescriptor
+	Txs       uint32
+	MaxHeight uint32
+	Complete  bool
+	Txids     []XpubCacheTxid
+}
+
+// XpubCacheData is the state of the derivation of the xpub stored in the xpubCache column
+type XpubCacheData struct {
+	Accessed        int64
+	BasePath        string
+	DataHeight      uint32
+	DataHash        string
+	Addresses       []XpubCacheAddress
+	ChangeAddresses []XpubCacheAddress
+}
+
+// SetXpubCacheSize sets the maximum number of items in the persistent xpub cache, zero disables the cache
+// the cache cannot be used by read-only db
+func (d *RocksDB) SetXpubCacheSize(size int) {
+	if d.chainParser.GetChainType() != bchain.ChainBitcoinType || d.readOnly {
+		size = 0
+	}
+	d.xpubCacheSize = size
+}
+
+// XpubCacheEnabled returns true if the xpubs are stored in the persistent cache
+func (d *RocksDB) XpubCacheEnabled() bool {
+	return d.xpubCacheSize > 0
+}
+
+func packXpubCacheKey(xpub string, gap int) []byte {
+	return append([]byte(xpub), packUint(uint32(gap))...)
+}
+
+// GetXpubCacheData returns the cached data of the xpub derived with the gap or nil if the xpub is not in the cache
+func (d *RocksDB) GetXpubCacheData(xpub string, gap int) (*XpubCacheData, error) {
+	if !d.XpubCacheEnabled() {
+		return nil, nil
+	}
+	val, err := d.db.GetCF(d.ro, d.cfh[cfXpubCache], packXpubCacheKey(xpub, gap))
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	buf := val.Data()
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	return d.unpackXpubCacheData(buf)
+}
+
+// StoreXpubCacheData stores the data of the xpub derived with the gap to the cache
+func (d *RocksDB) StoreXpubCacheData(xpub string, gap int, data *XpubCacheData) error {
+	if !d.XpubCacheEnabled() {
+		return nil
+	}
+	buf, err := d.packXpubCacheData(data)
+	if err != nil {
+		return err
+	}
+	return d.db.PutCF(d.wo, d.cfh[cfXpubCache], packXpubCacheKey(xpub, gap), buf)
+}
+
+// DeleteXpubCacheData removes the xpub derived with the gap from the cache
+func (d *RocksDB) DeleteXpubCacheData(xpub string, gap int) error {
+	if !d.XpubCacheEnabled() {
+		return nil
+	}
+	return d.db.DeleteCF(d.wo, d.cfh[cfXpubCache], packXpubCacheKey(xpub, gap))
+}
+
+type xpubCacheItem struct {
+	key      []byte
+	accessed int64
+}
+
+// EvictXpubCacheItems removes the items not accessed for a long time from the cache
+// and, if there are more items than the size of the cache, the least recently accessed items
+func (d *RocksDB) EvictXpubCacheItems() (int, error) {
+	if !d.XpubCacheEnabled() {
+		return 0, nil
+	}
+	expired := time.Now().Unix() - xpubCacheExpirationSeconds
+	items := make([]xpubCacheItem, 0)
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	count := 0
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfXpubCache])
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		key := append([]byte{}, it.Key().Data()...)
+		val := it.Value().Data()
+		var accessed int64
+		// the access time is stored in the first 4 bytes of the value
+		if len(val) >= 4 {
+			accessed = int64(unpackUint(val))
+		}
+		if accessed < expired {
+			wb.DeleteCF(d.cfh[cfXpubCache], key)
+			count++
+		} else {
+			items = append(items, xpubCacheItem{key, accessed})
+		}
+	}
+	it.Close()
+	if len(items) > d.xpubCacheSize {
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].accessed < items[j].accessed
+		})
+		for _, item := range items[:len(items)-d.xpubCacheSize] {
+			wb.DeleteCF(d.cfh[cfXpubCache], item.key)
+			count++
+		}
+		items = items[len(items)-d.xpubCacheSize:]
+	}
+	if count > 0 {
+		if err := d.db.Write(d.wo, wb); err != nil {
+			return 0, err
+		}
+		glog.Info("xpubCache: evicted ", count, " items, cache size ", len(items))
+	}
+	if d.metrics != nil {
+		d.metrics.XpubCacheSize.With(common.Labels{"cache": "db"}).Set(float64(len(items)))
+	}
+	return count, nil
+}
+
+func appendXpubCacheAddresses(buf []byte, varBuf []byte, addresses []XpubCacheAddress, p bchain.BlockChainParser) ([]byte, error) {
+	l := packVaruint(uint(len(addresses)), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	for i := range addresses {
+		ad := &addresses[i]
+		l = packVaruint(uint(len(ad.AddrDesc)), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		buf = append(buf, ad.AddrDesc...)
+		l = packVaruint(uint(ad.Txs), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		l = packVaruint(uint(ad.MaxHeight), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		if ad.Complete {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+		l = packVaruint(uint(len(ad.Txids)), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		for j := range ad.Txids {
+			btxID, err := p.PackTxid(ad.Txids[j].Txid)
+			if err != nil {
+				return nil, err
+			}
+			buf = append(buf, btxID...)
+			l = packVaruint(uint(ad.Txids[j].Height), varBuf)
+			buf = append(buf, varBuf[:l]...)
+			buf = append(buf, ad.Txids[j].InputOutput)
+		}
+	}
+	return buf, nil
+}
+
+func (d *RocksDB) packXpubCacheData(data *XpubCacheData) ([]byte, error) {
+	varBuf := make([]byte, vlq.MaxLen64)
+	buf := make([]byte, 0, 256)
+	buf = append(buf, packUint(uint32(data.Accessed))...)
+	l := packVaruint(uint(len(data.BasePath)), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	buf = append(buf, data.BasePath...)
+	l = packVaruint(uint(data.DataHeight), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	b, err := d.chainParser.PackBlockHash(data.DataHash)
+	if err != nil {
+		return nil, err
+	}
+	// the length of the packed block hash depends on the parser, it is stored with the hash
+	l = packVaruint(uint(len(b)), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	buf = append(buf, b...)
+	if buf, err = appendXpubCacheAddresses(buf, varBuf, data.Addresses, d.chainParser); err != nil {
+		return nil, err
+	}
+	return appendXpubCacheAddresses(buf, varBuf, data.ChangeAddresses, d.chainParser)
+}
+
+var errInvalidXpubCacheData = errors.New("Invalid xpubCache data")
+
+func unpackXpubCacheAddresses(buf []byte, p bchain.BlockChainParser) ([]XpubCacheAddress, int, error) {
+	txidLen := p.PackedTxidLen()
+	n, pos := unpackVaruint(buf)
+	if pos <= 0 || n > uint(len(buf)) {
+		return nil, 0, errInvalidXpubCacheData
+	}
+	addresses := make([]XpubCacheAddress, n)
+	for i := range addresses {
+		ad := &addresses[i]
+		al, l := unpackVaruint(buf[pos:])
+		pos += l
+		if l <= 0 || pos+int(al) > len(buf) {
+			return nil, 0, errInvalidXpubCacheData
+		}
+		ad.AddrDesc = append(bchain.AddressDescriptor{}, buf[pos:pos+int(al)]...)
+		pos += int(al)
+		txs, l := unpackVaruint(buf[pos:])
+		pos += l
+		if l <= 0 {
+			return nil, 0, errInvalidXpubCacheData
+		}
+		ad.Txs = uint32(txs)
+		maxHeight, l := unpackVaruint(buf[pos:])
+		pos += l
+		ad.MaxHeight = uint32(maxHeight)
+		if l <= 0 || pos >= len(buf) {
+			return nil, 0, errInvalidXpubCacheData
+		}
+		ad.Complete = buf[pos] != 0
+		pos++
+		nt, l := unpackVaruint(buf[pos:])
+		pos += l
+		if l <= 0 || nt > uint(len(buf)-pos) {
+			return nil, 0, errInvalidXpubCacheData
+		}
+		if nt > 0 {
+			ad.Txids = make([]XpubCacheTxid, nt)
+		}
+		for j := range ad.Txids {
+			if pos+txidLen > len(buf) {
+				return nil, 0, errInvalidXpubCacheData
+			}
+			txid, err := p.UnpackTxid(buf[pos : pos+txidLen])
+			if err != nil {
+				return nil, 0, err
+			}
+			pos += txidLen
+			height, l := unpackVaruint(buf[pos:])
+			pos += l
+			if l <= 0 || pos >= len(buf) {
+				return nil, 0, errInvalidXpubCacheData
+			}
+			ad.Txids[j] = XpubCacheTxid{Txid: txid, Height: uint32(height), InputOutput: buf[pos]}
+			pos++
+		}
+	}
+	return addresses, pos, nil
+}
+
+func (d *RocksDB) unpackXpubCacheData(buf []byte) (*XpubCacheData, error) {
+	if len(buf) < 5 {
+		return nil, errInvalidXpubCacheData
+	}
+	data := &XpubCacheData{Accessed: int64(unpackUint(buf))}
+	pos := 4
+	bl, l := unpackVaruint(buf[pos:])
+	pos += l
+	if l <= 0 || pos+int(bl) > len(buf) {
+		return nil, errInvalidXpubCacheData
+	}
+	data.BasePath = string(buf[pos : pos+int(bl)])
+	pos += int(bl)
+	height, l := unpackVaruint(buf[pos:])
+	pos += l
+	data.DataHeight = uint32(height)
+	if l <= 0 {
+		return nil, errInvalidXpubCacheData
+	}
+	bhl, l := unpackVaruint(buf[pos:])
+	pos += l
+	hl := int(bhl)
+	if l <= 0 || bhl > uint(len(buf)) || pos+hl > len(buf) {
+		return nil, errInvalidXpubCacheData
+	}
+	var err error
+	if data.DataHash, err = d.chainParser.UnpackBlockHash(buf[pos : pos+hl]); err != nil {
+		return nil, err
+	}
+	pos += hl
+	if data.Addresses, l, err = unpackXpubCacheAddresses(buf[pos:], d.chainParser); err != nil {
+		return nil, err
+	}
+	pos += l
+	if data.ChangeAddresses, l, err = unpackXpubCacheAddresses(buf[pos:], d.chainParser); err != nil {
+		return nil, err
+	}
+	if pos+l != len(buf) {
+		return nil, errInvalidXpubCacheData
+	}
+	return data, nil
+}
@@ -0,0 +1,135 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/bchain"
+	"blockbook/tests/dbtestdata"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRocksXpubCache(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	addrDesc := func(address string) bchain.AddressDescriptor {
+		ad, err := d.chainParser.GetAddrDescFromAddress(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ad
+	}
+	now := time.Now().Unix()
+	data := &XpubCacheData{
+		Accessed:   now,
+		BasePath:   "m/49'/1'/33'",
+		DataHeight: 225494,
+		DataHash:   "00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6",
+		Addresses: []XpubCacheAddress{
+			{
+				AddrDesc:  addrDesc(dbtestdata.Addr4),
+				Txs:       2,
+				MaxHeight: 225494,
+				Complete:  true,
+				Txids: []XpubCacheTxid{
+					{Txid: dbtestdata.TxidB2T1, Height: 225494, InputOutput: 1},
+					{Txid: dbtestdata.TxidB1T2, Height: 225493, InputOutput: 2},
+				},
+			},
+			{
+				AddrDesc: addrDesc(dbtestdata.Addr5),
+			},
+		},
+		ChangeAddresses: []XpubCacheAddress{
+			{
+				AddrDesc: addrDesc(dbtestdata.Addr8),
+				Txs:      1,
+			},
+		},
+	}
+
+	// the cache is disabled by default
+	if err := d.StoreXpubCacheData(dbtestdata.Xpub, 21, data); err != nil {
+		t.Fatal(err)
+	}
+	got, err := d.GetXpubCacheData(dbtestdata.Xpub, 21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("GetXpubCacheData() with disabled cache = %+v, want nil", got)
+	}
+
+	d.SetXpubCacheSize(2)
+	if err := d.StoreXpubCacheData(dbtestdata.Xpub, 21, data); err != nil {
+		t.Fatal(err)
+	}
+	got, err = d.GetXpubCacheData(dbtestdata.Xpub, 21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("GetXpubCacheData() = %+v, want %+v", got, data)
+	}
+	// the data are stored for each gap separately
+	got, err = d.GetXpubCacheData(dbtestdata.Xpub, 31)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("GetXpubCacheData() for different gap = %+v, want nil", got)
+	}
+
+	if _, err = d.unpackXpubCacheData([]byte{1, 2, 3, 4, 5, 6}); err == nil {
+		t.Error("unpackXpubCacheData() expected error for invalid data")
+	}
+
+	// items over the size of the cache and expired items are evicted, the least recently accessed first
+	items := []struct {
+		gap      int
+		accessed int64
+	}{
+		{41, now - 100},
+		{51, now - 200},
+		{61, now - xpubCacheExpirationSeconds - 1},
+	}
+	for _, item := range items {
+		if err := d.StoreXpubCacheData(dbtestdata.Xpub, item.gap, &XpubCacheData{Accessed: item.accessed, DataHash: data.DataHash}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count, err := d.EvictXpubCacheItems()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("EvictXpubCacheItems() = %v, want 2", count)
+	}
+	for _, tt := range []struct {
+		gap   int
+		found bool
+	}{{21, true}, {41, true}, {51, false}, {61, false}} {
+		got, err = d.GetXpubCacheData(dbtestdata.Xpub, tt.gap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (got != nil) != tt.found {
+			t.Errorf("GetXpubCacheData() gap %v after eviction = %+v, want found %v", tt.gap, got, tt.found)
+		}
+	}
+
+	if err = d.DeleteXpubCacheData(dbtestdata.Xpub, 21); err != nil {
+		t.Fatal(err)
+	}
+	got, err = d.GetXpubCacheData(dbtestdata.Xpub, 21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("GetXpubCacheData() after delete = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,100 @@
+package fiat
+
+import (
+	"blockbook/db"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// https://api.coingecko.com/api/v3/coins/bitcoin/history?date=30-12-2019 returns
+// {"id":"bitcoin","symbol":"btc","name":"Bitcoin",...,
+// "market_data":{"current_price":{"aed":26989.3,"eur":6545.2,"usd":7347.9,...},...}}
+// the current rates are returned in the same structure by https://api.coingecko.com/api/v3/coins/bitcoin
+
+type coinGeckoParams struct {
+	URL  string `json:"url"`
+	Coin string `json:"coin"`
+}
+
+type coinGeckoResult struct {
+	MarketData *struct {
+		CurrentPrice map[string]float64 `json:"current_price"`
+	} `json:"market_data"`
+}
+
+// CoinGeckoDownloader gets the exchange rates from https://www.coingecko.com API
+type CoinGeckoDownloader struct {
+	url    string
+	coin   string
+	client *http.Client
+}
+
+// NewCoinGeckoDownloader creates CoinGeckoDownloader, params must contain url of the API and coin id used by CoinGecko
+func NewCoinGeckoDownloader(params string) (*CoinGeckoDownloader, error) {
+	var p coinGeckoParams
+	if err := json.Unmarshal([]byte(params), &p); err != nil {
+		return nil, errors.Annotatef(err, "Invalid coingecko params")
+	}
+	if p.URL == "" || p.Coin == "" {
+		return nil, errors.New("Missing coingecko parameters url or coin")
+	}
+	return &CoinGeckoDownloader{
+		url:    p.URL,
+		coin:   p.Coin,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// GetTicker returns the current rates if t is today, otherwise the historical rates valid at the start of the day of t
+func (cg *CoinGeckoDownloader) GetTicker(t time.Time) (*db.CurrencyRatesTicker, error) {
+	t = t.UTC()
+	day := t.Truncate(24 * time.Hour)
+	var u string
+	if day.Equal(time.Now().UTC().Truncate(24 * time.Hour)) {
+		u = cg.url + "/coins/" + url.PathEscape(cg.coin) + "?localization=false&tickers=false&market_data=true&community_data=false&developer_data=false&sparkline=false"
+	} else {
+		u = cg.url + "/coins/" + url.PathEscape(cg.coin) + "/history?localization=false&date=" + day.Format("02-01-2006")
+		t = day
+	}
+	var res coinGeckoResult
+	if err := cg.getData(u, &res); err != nil {
+		return nil, err
+	}
+	// coingecko returns no market data for the days before the coin was listed
+	if res.MarketData == nil || len(res.MarketData.CurrentPrice) == 0 {
+		return nil, nil
+	}
+	return &db.CurrencyRatesTicker{
+		Timestamp: t,
+		Rates:     res.MarketData.CurrentPrice,
+	}, nil
+}
+
+func (cg *CoinGeckoDownloader) getData(u string, res interface{}) error {
+	httpReq, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	httpRes, err := cg.client.Do(httpReq)
+	if httpRes != nil {
+		defer httpRes.Body.Close()
+	}
+	if err != nil {
+		return &temporaryError{err}
+	}
+	if httpRes.StatusCode != 200 {
+		err = errors.New("coingecko returned status " + strconv.Itoa(httpRes.StatusCode))
+		// the rate limit was exceeded or the service is unavailable
+		if httpRes.StatusCode == http.StatusTooManyRequests || httpRes.StatusCode >= 500 {
+			return &temporaryError{err}
+		}
+		return err
+	}
+	return json.NewDecoder(httpRes.Body).Decode(res)
+}
@@ -0,0 +1,195 @@
+package fiat
+
+import (
+	"blockbook/db"
+	"encoding/json"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// OnNewFiatRatesTicker is used to send notification about a new fiat rates ticker
+type OnNewFiatRatesTicker func(ticker *db.CurrencyRatesTicker)
+
+// RatesDownloaderInterface is implemented by the sources of the exchange rates
+type RatesDownloaderInterface interface {
+	// GetTicker returns the exchange rates valid at time t, nil if the source has no data for the time
+	GetTicker(t time.Time) (*db.CurrencyRatesTicker, error)
+}
+
+// historyRetries is the number of repeated attempts to download a historical ticker after a temporary error of the source
+const historyRetries = 5
+
+// historyRetryDelay is the delay before the first repeated attempt, it doubles with each next attempt
+const historyRetryDelay = 10 * time.Second
+
+// temporaryError is returned by the sources if the request can succeed when it is repeated later,
+// e.g. the rate limit was exceeded or the source could not be reached
+type temporaryError struct {
+	error
+}
+
+func isTemporary(err error) bool {
+	_, ok := errors.Cause(err).(*temporaryError)
+	return ok
+}
+
+// RatesDownloader periodically gets the exchange rates from the source and stores them to db
+type RatesDownloader struct {
+	db            *db.RocksDB
+	downloader    RatesDownloaderInterface
+	period        time.Duration
+	startTime     time.Time
+	lastTimestamp time.Time
+	onNewTicker   OnNewFiatRatesTicker
+	retryDelay    time.Duration
+	chanStop      chan struct{}
+	chanDone      chan struct{}
+}
+
+type ratesDownloaderParams struct {
+	PeriodSeconds int    `json:"periodSeconds"`
+	StartDate     string `json:"startDate"`
+}
+
+// NewFiatRatesDownloader creates RatesDownloader with the source specified by apiType
+// params is a json string with the parameters of the downloader and of the source
+func NewFiatRatesDownloader(d *db.RocksDB, apiType string, params string, onNewTicker OnNewFiatRatesTicker) (*RatesDownloader, error) {
+	var p ratesDownloaderParams
+	if err := json.Unmarshal([]byte(params), &p); err != nil {
+		return nil, errors.Annotatef(err, "Invalid fiat rates params")
+	}
+	if p.PeriodSeconds <= 0 {
+		return nil, errors.New("Missing parameter periodSeconds")
+	}
+	rd := &RatesDownloader{
+		db:          d,
+		period:      time.Duration(p.PeriodSeconds) * time.Second,
+		onNewTicker: onNewTicker,
+		retryDelay:  historyRetryDelay,
+		chanStop:    make(chan struct{}),
+		chanDone:    make(chan struct{}),
+	}
+	if p.StartDate != "" {
+		t, err := time.Parse("2006-01-02", p.StartDate)
+		if err != nil {
+			return nil, errors.Annotatef(err, "Invalid parameter startDate")
+		}
+		rd.startTime = t
+	}
+	var err error
+	switch apiType {
+	case "coingecko":
+		rd.downloader, err = NewCoinGeckoDownloader(params)
+	case "file":
+		rd.downloader, err = NewFileDownloader(params)
+	default:
+		err = errors.Errorf("Unknown fiat rates source %v", apiType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rd, nil
+}
+
+// Run downloads the missing historical tickers with daily granularity starting from startDate
+// and then periodically the current ticker, it returns after Stop is called
+func (rd *RatesDownloader) Run() {
+	defer close(rd.chanDone)
+	if last, err := rd.db.FiatRatesFindLastTicker(); err != nil {
+		glog.Error("fiatRates: FiatRatesFindLastTicker ", err)
+	} else if last != nil {
+		rd.lastTimestamp = last.Timestamp
+	}
+	if !rd.startTime.IsZero() && !rd.syncHistory(time.Now().UTC()) {
+		return
+	}
+	timer := time.NewTimer(rd.period)
+	defer timer.Stop()
+	for {
+		if err := rd.downloadTicker(time.Now().UTC(), true); err != nil {
+			glog.Error("fiatRates: ", err)
+		}
+		select {
+		case <-timer.C:
+			timer.Reset(rd.period)
+		case <-rd.chanStop:
+			return
+		}
+	}
+}
+
+// Stop stops the download and waits until Run returns, it must be called only if Run was started
+func (rd *RatesDownloader) Stop() {
+	close(rd.chanStop)
+	<-rd.chanDone
+}
+
+// wait waits for the duration d, returns false if the downloader was stopped in the meantime
+func (rd *RatesDownloader) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-rd.chanStop:
+		return false
+	}
+}
+
+// syncHistory gets one ticker per day for the days from startTime (or from the last stored ticker) until yesterday,
+// returns false if the downloader was stopped
+func (rd *RatesDownloader) syncHistory(now time.Time) bool {
+	today := now.Truncate(24 * time.Hour)
+	t := rd.startTime
+	if !rd.lastTimestamp.Before(t) {
+		t = rd.lastTimestamp.Truncate(24 * time.Hour).Add(24 * time.Hour)
+	}
+	start := time.Now()
+	count, skipped := 0, 0
+	for ; t.Before(today); t = t.Add(24 * time.Hour) {
+		select {
+		case <-rd.chanStop:
+			return false
+		default:
+		}
+		err := rd.downloadTicker(t, false)
+		// the sources limit the request rate, repeat the same day with increasing delays
+		for retry := 0; err != nil && isTemporary(err) && retry < historyRetries; retry++ {
+			delay := rd.retryDelay << uint(retry)
+			glog.Warning("fiatRates: ", err, ", retrying in ", delay)
+			if !rd.wait(delay) {
+				return false
+			}
+			err = rd.downloadTicker(t, false)
+		}
+		if err != nil {
+			glog.Error("fiatRates: ", err, ", skipping the day")
+			skipped++
+			continue
+		}
+		count++
+	}
+	glog.Info("fiatRates: history of ", count, " days synchronized, ", skipped, " days skipped, in ", time.Since(start))
+	return true
+}
+
+// downloadTicker gets ticker valid at time t from the source and stores it if it is newer than the last stored one
+func (rd *RatesDownloader) downloadTicker(t time.Time, notify bool) error {
+	ticker, err := rd.downloader.GetTicker(t)
+	if err != nil {
+		return errors.Annotatef(err, "GetTicker %v", t)
+	}
+	if ticker == nil || !ticker.Timestamp.After(rd.lastTimestamp) {
+		return nil
+	}
+	if err = rd.db.FiatRatesStoreTicker(ticker); err != nil {
+		return errors.Annotatef(err, "FiatRatesStoreTicker %v", ticker.Timestamp)
+	}
+	rd.lastTimestamp = ticker.Timestamp
+	if notify && rd.onNewTicker != nil {
+		rd.onNewTicker(ticker)
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+// +build unittest
+
+package fiat
+
+import (
+	"blockbook/bchain/coins/btc"
+	"blockbook/db"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/martinboehm/btcutil/chaincfg"
+)
+
+func TestMain(m *testing.M) {
+	c := m.Run()
+	chaincfg.ResetParams()
+	os.Exit(c)
+}
+
+func setupRocksDB(t *testing.T) (*db.RocksDB, string) {
+	tmp, err := ioutil.TempDir("", "testdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := btc.NewBitcoinParser(btc.GetChainParams("test"), &btc.Configuration{BlockAddressesToKeep: 1})
+	d, err := db.NewRocksDB(tmp, 100000, -1, parser, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	is, err := d.LoadInternalState("fakecoin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetInternalState(is)
+	return d, tmp
+}
+
+func closeAndDestroyRocksDB(t *testing.T, d *db.RocksDB, dbpath string) {
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll(dbpath)
+}
+
+const testRatesFile = `[
+	{"ts":1574380800,"rates":{"usd":7600,"eur":6900}},
+	{"ts":1574294400,"rates":{"usd":8100.5,"eur":7300.25}},
+	{"ts":1574433010,"rates":{"usd":7250.75}}
+]`
+
+func writeRatesFile(t *testing.T) string {
+	f, err := ioutil.TempFile("", "rates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.WriteString(testRatesFile); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestFileDownloader(t *testing.T) {
+	file := writeRatesFile(t)
+	defer os.Remove(file)
+	fd, err := NewFileDownloader(`{"file":"` + filepath.ToSlash(file) + `"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		t    time.Time
+		want *db.CurrencyRatesTicker
+	}{
+		{
+			name: "before first",
+			t:    time.Unix(1574294399, 0),
+			want: nil,
+		},
+		{
+			name: "exact",
+			t:    time.Unix(1574294400, 0),
+			want: &db.CurrencyRatesTicker{
+				Timestamp: time.Unix(1574294400, 0).UTC(),
+				Rates:     map[string]float64{"usd": 8100.5, "eur": 7300.25},
+			},
+		},
+		{
+			name: "between",
+			t:    time.Unix(1574433000, 0),
+			want: &db.CurrencyRatesTicker{
+				Timestamp: time.Unix(1574380800, 0).UTC(),
+				Rates:     map[string]float64{"usd": 7600, "eur": 6900},
+			},
+		},
+		{
+			name: "after last",
+			t:    time.Unix(1600000000, 0),
+			want: &db.CurrencyRatesTicker{
+				Timestamp: time.Unix(1574433010, 0).UTC(),
+				Rates:     map[string]float64{"usd": 7250.75},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fd.GetTicker(tt.t)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetTicker() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRatesDownloader(t *testing.T) {
+	d, dbpath := setupRocksDB(t)
+	defer closeAndDestroyRocksDB(t, d, dbpath)
+	file := writeRatesFile(t)
+	defer os.Remove(file)
+
+	var notified []*db.CurrencyRatesTicker
+	rd, err := NewFiatRatesDownloader(d, "file", `{"file":"`+filepath.ToSlash(file)+`","periodSeconds":60,"startDate":"2019-11-20"}`, func(ticker *db.CurrencyRatesTicker) {
+		notified = append(notified, ticker)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// synchronize history until 2019-11-23, the days 11-21 and 11-22 have tickers
+	rd.syncHistory(time.Date(2019, 11, 23, 12, 0, 0, 0, time.UTC))
+	ticker, err := d.FiatRatesFindTicker(time.Date(2019, 11, 20, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticker == nil || ticker.Timestamp.Unix() != 1574294400 {
+		t.Errorf("FiatRatesFindTicker() = %+v, want ticker from 1574294400", ticker)
+	}
+	ticker, err = d.FiatRatesFindLastTicker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticker == nil || ticker.Timestamp.Unix() != 1574380800 {
+		t.Errorf("FiatRatesFindLastTicker() = %+v, want ticker from 1574380800", ticker)
+	}
+	if len(notified) != 0 {
+		t.Errorf("historical tickers must not be notified, got %d notifications", len(notified))
+	}
+
+	// the current ticker is stored and notified only once
+	for i := 0; i < 2; i++ {
+		if err := rd.downloadTicker(time.Unix(1574433100, 0), true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ticker, err = d.FiatRatesFindLastTicker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &db.CurrencyRatesTicker{
+		Timestamp: time.Unix(1574433010, 0).UTC(),
+		Rates:     map[string]float64{"usd": 7250.75},
+	}
+	if !reflect.DeepEqual(ticker, want) {
+		t.Errorf("FiatRatesFindLastTicker() = %+v, want %+v", ticker, want)
+	}
+	if len(notified) != 1 || !reflect.DeepEqual(notified[0], want) {
+		t.Errorf("notified = %+v, want [%+v]", notified, want)
+	}
+
+	if _, err := NewFiatRatesDownloader(d, "unknown", `{"periodSeconds":60}`, nil); err == nil {
+		t.Error("NewFiatRatesDownloader() with unknown source expected error")
+	}
+	if _, err := NewFiatRatesDownloader(d, "file", `{"file":"`+filepath.ToSlash(file)+`"}`, nil); err == nil {
+		t.Error("NewFiatRatesDownloader() without periodSeconds expected error")
+	}
+}
+
+// testErrorsDownloader returns the errors set for the day before it returns the ticker of the day
+type testErrorsDownloader struct {
+	errs  map[string][]error
+	calls map[string]int
+}
+
+func (td *testErrorsDownloader) GetTicker(t time.Time) (*db.CurrencyRatesTicker, error) {
+	day := t.Format("2006-01-02")
+	i := td.calls[day]
+	td.calls[day]++
+	if i < len(td.errs[day]) {
+		return nil, td.errs[day][i]
+	}
+	return &db.CurrencyRatesTicker{Timestamp: t, Rates: map[string]float64{"usd": 7000}}, nil
+}
+
+func TestRatesDownloader_syncHistoryErrors(t *testing.T) {
+	d, dbpath := setupRocksDB(t)
+	defer closeAndDestroyRocksDB(t, d, dbpath)
+	file := writeRatesFile(t)
+	defer os.Remove(file)
+
+	rd, err := NewFiatRatesDownloader(d, "file", `{"file":"`+filepath.ToSlash(file)+`","periodSeconds":60,"startDate":"2019-11-20"}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	temporary := &temporaryError{errors.New("coingecko returned status 429")}
+	tooMany := make([]error, historyRetries+1)
+	for i := range tooMany {
+		tooMany[i] = temporary
+	}
+	td := &testErrorsDownloader{
+		errs: map[string][]error{
+			"2019-11-20": {temporary, temporary},
+			"2019-11-21": {errors.New("coingecko returned status 404")},
+			"2019-11-22": tooMany,
+		},
+		calls: make(map[string]int),
+	}
+	rd.downloader = td
+	rd.retryDelay = time.Millisecond
+	if !rd.syncHistory(time.Date(2019, 11, 24, 12, 0, 0, 0, time.UTC)) {
+		t.Fatal("syncHistory() = false, want true")
+	}
+	// the temporary errors are retried, the days with a permanent error or too many temporary errors are skipped
+	wantCalls := map[string]int{
+		"2019-11-20": 3,
+		"2019-11-21": 1,
+		"2019-11-22": historyRetries + 1,
+		"2019-11-23": 1,
+	}
+	if !reflect.DeepEqual(td.calls, wantCalls) {
+		t.Errorf("GetTicker() calls = %v, want %v", td.calls, wantCalls)
+	}
+	for _, tt := range []struct {
+		t    time.Time
+		want time.Time
+	}{
+		{t: time.Date(2019, 11, 22, 12, 0, 0, 0, time.UTC), want: time.Date(2019, 11, 20, 0, 0, 0, 0, time.UTC)},
+		{t: time.Date(2019, 11, 23, 12, 0, 0, 0, time.UTC), want: time.Date(2019, 11, 23, 0, 0, 0, 0, time.UTC)},
+	} {
+		ticker, err := d.FiatRatesFindTicker(tt.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ticker == nil || !ticker.Timestamp.Equal(tt.want) {
+			t.Errorf("FiatRatesFindTicker(%v) = %+v, want ticker from %v", tt.t, ticker, tt.want)
+		}
+	}
+}
+
+// testTemporaryErrorDownloader always returns a temporary error and signals the calls
+type testTemporaryErrorDownloader struct {
+	called chan struct{}
+}
+
+func (td *testTemporaryErrorDownloader) GetTicker(t time.Time) (*db.CurrencyRatesTicker, error) {
+	select {
+	case td.called <- struct{}{}:
+	default:
+	}
+	return nil, &temporaryError{errors.New("coingecko returned status 503")}
+}
+
+func TestRatesDownloader_Stop(t *testing.T) {
+	d, dbpath := setupRocksDB(t)
+	defer closeAndDestroyRocksDB(t, d, dbpath)
+	file := writeRatesFile(t)
+	defer os.Remove(file)
+
+	rd, err := NewFiatRatesDownloader(d, "file", `{"file":"`+filepath.ToSlash(file)+`","periodSeconds":60,"startDate":"2019-11-20"}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	td := &testTemporaryErrorDownloader{called: make(chan struct{}, 1)}
+	rd.downloader = td
+	rd.retryDelay = time.Hour
+	go rd.Run()
+	<-td.called
+	// the history synchronization waits for the retry, it must be interrupted by Stop
+	stopped := make(chan struct{})
+	go func() {
+		rd.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Stop() did not stop the waiting history synchronization")
+	}
+}
+
+func TestCoinGeckoDownloader(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path+"?"+r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/coins/bitcoin/history":
+			if r.URL.Query().Get("date") == "01-01-2009" {
+				w.Write([]byte(`{"id":"bitcoin","symbol":"btc","name":"Bitcoin"}`))
+			} else {
+				w.Write([]byte(`{"id":"bitcoin","market_data":{"current_price":{"usd":7347.9,"eur":6545.2}}}`))
+			}
+		case "/coins/bitcoin":
+			w.Write([]byte(`{"id":"bitcoin","market_data":{"current_price":{"usd":8001.1,"eur":7100.3}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	cg, err := NewCoinGeckoDownloader(`{"url":"` + ts.URL + `","coin":"bitcoin","periodSeconds":60}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := cg.GetTicker(time.Date(2019, 12, 30, 17, 20, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &db.CurrencyRatesTicker{
+		Timestamp: time.Date(2019, 12, 30, 0, 0, 0, 0, time.UTC),
+		Rates:     map[string]float64{"usd": 7347.9, "eur": 6545.2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetTicker() history = %+v, want %+v", got, want)
+	}
+
+	now := time.Now().UTC()
+	got, err = cg.GetTicker(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = &db.CurrencyRatesTicker{
+		Timestamp: now,
+		Rates:     map[string]float64{"usd": 8001.1, "eur": 7100.3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetTicker() current = %+v, want %+v", got, want)
+	}
+
+	// no market data before the coin was listed
+	got, err = cg.GetTicker(time.Date(2009, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("GetTicker() before listing = %+v, want nil", got)
+	}
+
+	wantRequests := []string{
+		"/coins/bitcoin/history?localization=false&date=30-12-2019",
+		"/coins/bitcoin?localization=false&tickers=false&market_data=true&community_data=false&developer_data=false&sparkline=false",
+		"/coins/bitcoin/history?localization=false&date=01-01-2009",
+	}
+	if !reflect.DeepEqual(requests, wantRequests) {
+		t.Errorf("requests = %v, want %v", requests, wantRequests)
+	}
+
+	cg.coin = "unknown"
+	if _, err = cg.GetTicker(now); err == nil {
+		t.Error("GetTicker() of unknown coin expected error")
+	}
+}
@@ -0,0 +1,66 @@
+package fiat
+
+import (
+	"blockbook/db"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// the file read by FileDownloader contains an array of tickers, ts is a unix timestamp
+// [{"ts":1574344800,"rates":{"usd":7814.5,"eur":7100.0}},{"ts":1574431200,"rates":{"usd":7291.1,"eur":6620.2}}]
+
+type fileParams struct {
+	File string `json:"file"`
+}
+
+type fileTicker struct {
+	Timestamp int64              `json:"ts"`
+	Rates     map[string]float64 `json:"rates"`
+}
+
+// FileDownloader returns the exchange rates read from a json file, it allows to run without access to a rates API
+type FileDownloader struct {
+	tickers []db.CurrencyRatesTicker
+}
+
+// NewFileDownloader creates FileDownloader from the file specified in the params
+func NewFileDownloader(params string) (*FileDownloader, error) {
+	var p fileParams
+	if err := json.Unmarshal([]byte(params), &p); err != nil {
+		return nil, errors.Annotatef(err, "Invalid file params")
+	}
+	if p.File == "" {
+		return nil, errors.New("Missing parameter file")
+	}
+	data, err := ioutil.ReadFile(p.File)
+	if err != nil {
+		return nil, errors.Annotatef(err, "Error reading file %v", p.File)
+	}
+	var ft []fileTicker
+	if err = json.Unmarshal(data, &ft); err != nil {
+		return nil, errors.Annotatef(err, "Error parsing file %v", p.File)
+	}
+	fd := &FileDownloader{tickers: make([]db.CurrencyRatesTicker, len(ft))}
+	for i := range ft {
+		fd.tickers[i] = db.CurrencyRatesTicker{
+			Timestamp: time.Unix(ft[i].Timestamp, 0).UTC(),
+			Rates:     ft[i].Rates,
+		}
+	}
+	sort.Slice(fd.tickers, func(i, j int) bool { return fd.tickers[i].Timestamp.Before(fd.tickers[j].Timestamp) })
+	return fd, nil
+}
+
+// GetTicker returns the newest ticker from the file which is not newer than t
+func (fd *FileDownloader) GetTicker(t time.Time) (*db.CurrencyRatesTicker, error) {
+	i := sort.Search(len(fd.tickers), func(i int) bool { return fd.tickers[i].Timestamp.After(t) })
+	if i == 0 {
+		return nil, nil
+	}
+	ticker := fd.tickers[i-1]
+	return &ticker, nil
+}
@@ -29,8 +29,8 @@ type InternalServer struct {
 }
 
 // NewInternalServer creates new internal http interface to blockbook and returns its handle
-func NewInternalServer(binding, certFiles string, db *db.RocksDB, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, is *common.InternalState) (*InternalServer, error) {
-	api, err := api.NewWorker(db, chain, mempool, txCache, is)
+func NewInternalServer(binding, certFiles string, db *db.RocksDB, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, metrics *common.Metrics, is *common.InternalState) (*InternalServer, error) {
+	api, err := api.NewWorker(db, chain, mempool, txCache, metrics, is)
 	if err != nil {
 		return nil, err
 	}
@@ -55,6 +55,7 @@ func NewInternalServer(binding, certFiles string, db *db.RocksDB, chain bchain.B
 
 	serveMux.Handle(path+"favicon.ico", http.FileServer(http.Dir("./static/")))
 	serveMux.HandleFunc(path+"metrics", promhttp.Handler().ServeHTTP)
+	serveMux.HandleFunc(path+"admin/checkpoint", s.checkpoint)
 	serveMux.HandleFunc(path, s.index)
 
 	return s, nil
@@ -83,7 +84,9 @@ func (s *InternalServer) Shutdown(ctx context.Context) error {
 }
 
 func (s *InternalServer) index(w http.ResponseWriter, r *http.Request) {
+	s.db.LockRead()
 	si, err := s.api.GetSystemInfo(true)
+	s.db.UnlockRead()
 	if err != nil {
 		glog.Error(err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -98,3 +101,37 @@ func (s *InternalServer) index(w http.ResponseWriter, r *http.Request) {
 
 	w.Write(buf)
 }
+
+type checkpointResult struct {
+	Dir    string `json:"dir"`
+	Height uint32 `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// checkpoint creates a checkpoint of the database in the directory passed in the parameter dir
+func (s *InternalServer) checkpoint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dir := r.FormValue("dir")
+	if dir == "" {
+		http.Error(w, "Missing parameter 'dir'", http.StatusBadRequest)
+		return
+	}
+	height, hash, err := s.db.CreateCheckpoint(dir)
+	if err != nil {
+		glog.Error("checkpoint: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	buf, err := json.Marshal(checkpointResult{Dir: dir, Height: height, Hash: hash})
+	if err != nil {
+		glog.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(buf)
+}
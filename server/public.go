@@ -12,6 +12,7 @@ import (
 	"io/ioutil"
 	"math/big"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"reflect"
 	"regexp"
@@ -60,7 +61,7 @@ type PublicServer struct {
 // only basic functionality is mapped, to map all functions, call
 func NewPublicServer(binding string, certFiles string, db *db.RocksDB, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, explorerURL string, metrics *common.Metrics, is *common.InternalState, debugMode bool) (*PublicServer, error) {
 
-	api, err := api.NewWorker(db, chain, mempool, txCache, is)
+	api, err := api.NewWorker(db, chain, mempool, txCache, metrics, is)
 	if err != nil {
 		return nil, err
 	}
@@ -185,6 +186,12 @@ func (s *PublicServer) ConnectFullPublicInterface() {
 	serveMux.HandleFunc(path+"api/v2/block/", s.jsonHandler(s.apiBlock, apiV2))
 	serveMux.HandleFunc(path+"api/v2/sendtx/", s.jsonHandler(s.apiSendTx, apiV2))
 	serveMux.HandleFunc(path+"api/v2/estimatefee/", s.jsonHandler(s.apiEstimateFee, apiV2))
+	serveMux.HandleFunc(path+"api/v2/balancehistory/", s.jsonHandler(s.apiBalanceHistory, apiV2))
+	serveMux.HandleFunc(path+"api/v2/block-filter/", s.jsonHandler(s.apiBlockFilter, apiV2))
+	serveMux.HandleFunc(path+"api/v2/block-by-time/", s.jsonHandler(s.apiBlockByTime, apiV2))
+	serveMux.HandleFunc(path+"api/v2/headers/", s.jsonHandler(s.apiBlockHeaders, apiV2))
+	serveMux.HandleFunc(path+"api/v2/tx-proof/", s.jsonHandler(s.apiTxMerkleProof, apiV2))
+	serveMux.HandleFunc(path+"api/v2/tickers/", s.jsonHandler(s.apiTickers, apiV2))
 	// socket.io interface
 	serveMux.Handle(path+"socket.io/", s.socketio.GetHandler())
 	// websocket interface
@@ -207,6 +214,12 @@ func (s *PublicServer) Shutdown(ctx context.Context) error {
 func (s *PublicServer) OnNewBlock(hash string, height uint32) {
 	s.socketio.OnNewBlockHash(hash)
 	s.websocket.OnNewBlock(hash, height)
+	go s.api.UpdateXpubCache()
+}
+
+// OnNewFiatRatesTicker notifies users subscribed to fiat rates about a new ticker
+func (s *PublicServer) OnNewFiatRatesTicker(ticker *db.CurrencyRatesTicker) {
+	s.websocket.OnNewFiatRatesTicker(ticker)
 }
 
 // OnNewTxAddr notifies users subscribed to bitcoind/addresstxid about new block
@@ -247,6 +260,9 @@ func getFunctionName(i interface{}) string {
 	return runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name()
 }
 
+// binaryData returned by the api handler is sent as is instead of json
+type binaryData []byte
+
 func (s *PublicServer) jsonHandler(handler func(r *http.Request, apiVersion int) (interface{}, error), apiVersion int) func(w http.ResponseWriter, r *http.Request) {
 	type jsonError struct {
 		Text       string `json:"error"`
@@ -265,6 +281,13 @@ func (s *PublicServer) jsonHandler(handler func(r *http.Request, apiVersion int)
 					data = jsonError{"Internal server error", http.StatusInternalServerError}
 				}
 			}
+			if b, isBinary := data.(binaryData); isBinary {
+				w.Header().Set("Content-Type", "application/octet-stream")
+				if _, err = w.Write(b); err != nil {
+					glog.Warning("binary write ", err)
+				}
+				return
+			}
 			w.Header().Set("Content-Type", "application/json; charset=utf-8")
 			if e, isError := data.(jsonError); isError {
 				w.WriteHeader(e.HTTPStatus)
@@ -274,6 +297,8 @@ func (s *PublicServer) jsonHandler(handler func(r *http.Request, apiVersion int)
 				glog.Warning("json encode ", err)
 			}
 		}()
+		s.db.LockRead()
+		defer s.db.UnlockRead()
 		data, err = handler(r, apiVersion)
 		if err != nil || data == nil {
 			if apiErr, ok := err.(*api.APIError); ok {
@@ -350,6 +375,8 @@ func (s *PublicServer) htmlTemplateHandler(handler func(w http.ResponseWriter, r
 			// to reflect changes during development
 			s.templates = s.parseTemplates()
 		}
+		s.db.LockRead()
+		defer s.db.UnlockRead()
 		t, data, err = handler(w, r)
 		if err != nil || (data == nil && t != noTpl) {
 			t = errorInternalTpl
@@ -426,6 +453,7 @@ func (s *PublicServer) parseTemplates() []*template.Template {
 		"setTxToTemplateData":      setTxToTemplateData,
 		"isOwnAddress":             isOwnAddress,
 		"isOwnAddresses":           isOwnAddresses,
+		"addressAlias":             addressAlias,
 	}
 	var createTemplate func(filenames ...string) *template.Template
 	if s.debug {
@@ -529,6 +557,21 @@ func isOwnAddress(td *TemplateData, a string) bool {
 	return false
 }
 
+// returns the alias of the address, either from the transaction or from the address detail
+func addressAlias(td *TemplateData, a string) string {
+	if td.Tx != nil {
+		if alias, found := td.Tx.AddressAliases[a]; found {
+			return alias.Alias
+		}
+	}
+	if td.Address != nil {
+		if alias, found := td.Address.AddressAliases[a]; found {
+			return alias.Alias
+		}
+	}
+	return ""
+}
+
 // returns true if addresses are "own",
 // i.e. either the address of the address detail or belonging to the xpub
 func isOwnAddresses(td *TemplateData, addresses []string) bool {
@@ -548,6 +591,7 @@ func (s *PublicServer) explorerTx(w http.ResponseWriter, r *http.Request) (tpl,
 		if err != nil {
 			return errorTpl, nil, err
 		}
+		tx.AddressAliases = s.api.GetTxAddressAliases(tx)
 	}
 	data := s.newTemplateData()
 	data.Tx = tx
@@ -631,11 +675,26 @@ func (s *PublicServer) getAddressQueryParams(r *http.Request, accountDetails api
 	if ec != nil {
 		gap = 0
 	}
+	atHeight, ec := strconv.Atoi(r.URL.Query().Get("atHeight"))
+	if ec != nil || atHeight < 0 {
+		atHeight = 0
+	}
+	fromTime, ec := strconv.ParseInt(r.URL.Query().Get("fromTime"), 10, 64)
+	if ec != nil {
+		fromTime = 0
+	}
+	toTime, ec := strconv.ParseInt(r.URL.Query().Get("toTime"), 10, 64)
+	if ec != nil {
+		toTime = 0
+	}
 	return page, pageSize, accountDetails, &api.AddressFilter{
 		Vout:           voutFilter,
 		TokensToReturn: tokensToReturn,
 		FromHeight:     uint32(from),
 		ToHeight:       uint32(to),
+		FromTime:       fromTime,
+		ToTime:         toTime,
+		AtHeight:       uint32(atHeight),
 	}, filterParam, gap
 }
 
@@ -667,12 +726,17 @@ func (s *PublicServer) explorerAddress(w http.ResponseWriter, r *http.Request) (
 	return addressTpl, data, nil
 }
 
-func (s *PublicServer) explorerXpub(w http.ResponseWriter, r *http.Request) (tpl, *TemplateData, error) {
-	var xpub string
-	i := strings.LastIndexByte(r.URL.Path, '/')
-	if i > 0 {
-		xpub = r.URL.Path[i+1:]
+// descriptorFromPath returns the part of the url path following the segment,
+// unlike an address or xpub, an output descriptor can contain slashes
+func descriptorFromPath(path string, segment string) string {
+	if i := strings.Index(path, "/"+segment+"/"); i >= 0 {
+		return path[i+len(segment)+2:]
 	}
+	return ""
+}
+
+func (s *PublicServer) explorerXpub(w http.ResponseWriter, r *http.Request) (tpl, *TemplateData, error) {
+	xpub := descriptorFromPath(r.URL.Path, "xpub")
 	if len(xpub) == 0 {
 		return errorTpl, nil, api.NewAPIError("Missing xpub", true)
 	}
@@ -759,7 +823,7 @@ func (s *PublicServer) explorerSearch(w http.ResponseWriter, r *http.Request) (t
 	if len(q) > 0 {
 		address, err = s.api.GetXpubAddress(q, 0, 1, api.AccountDetailsBasic, &api.AddressFilter{Vout: api.AddressFilterVoutOff}, 0)
 		if err == nil {
-			http.Redirect(w, r, joinURL("/xpub/", address.AddrStr), 302)
+			http.Redirect(w, r, joinURL("/xpub/", url.PathEscape(address.AddrStr)), 302)
 			return noTpl, nil, nil
 		}
 		block, err = s.api.GetBlock(q, 0, 1)
@@ -932,9 +996,16 @@ func (s *PublicServer) apiTx(r *http.Request, apiVersion int) (interface{}, erro
 		}
 	}
 	tx, err = s.api.GetTransaction(txid, spendingTxs, false)
-	if err == nil && apiVersion == apiV1 {
+	if err != nil {
+		return nil, err
+	}
+	if apiVersion == apiV1 {
 		return s.api.TxToV1(tx), nil
 	}
+	tx.AddressAliases = s.api.GetTxAddressAliases(tx)
+	if currency := r.URL.Query().Get("currency"); currency != "" {
+		err = s.api.SetTxFiatValue(tx, currency)
+	}
 	return tx, err
 }
 
@@ -971,15 +1042,14 @@ func (s *PublicServer) apiAddress(r *http.Request, apiVersion int) (interface{},
 	if err == nil && apiVersion == apiV1 {
 		return s.api.AddressToV1(address), nil
 	}
+	if currency := r.URL.Query().Get("currency"); err == nil && currency != "" {
+		err = s.api.SetAddressFiatValue(address, currency)
+	}
 	return address, err
 }
 
 func (s *PublicServer) apiXpub(r *http.Request, apiVersion int) (interface{}, error) {
-	var xpub string
-	i := strings.LastIndexByte(r.URL.Path, '/')
-	if i > 0 {
-		xpub = r.URL.Path[i+1:]
-	}
+	xpub := descriptorFromPath(r.URL.Path, "xpub")
 	if len(xpub) == 0 {
 		return nil, api.NewAPIError("Missing xpub", true)
 	}
@@ -991,13 +1061,16 @@ func (s *PublicServer) apiXpub(r *http.Request, apiVersion int) (interface{}, er
 	if err == nil && apiVersion == apiV1 {
 		return s.api.AddressToV1(address), nil
 	}
+	if currency := r.URL.Query().Get("currency"); err == nil && currency != "" {
+		err = s.api.SetAddressFiatValue(address, currency)
+	}
 	return address, err
 }
 
 func (s *PublicServer) apiUtxo(r *http.Request, apiVersion int) (interface{}, error) {
-	var utxo []api.Utxo
+	var utxo api.Utxos
 	var err error
-	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+	if descriptor := descriptorFromPath(r.URL.Path, "utxo"); len(descriptor) > 0 {
 		onlyConfirmed := false
 		c := r.URL.Query().Get("confirmed")
 		if len(c) > 0 {
@@ -1010,20 +1083,99 @@ func (s *PublicServer) apiUtxo(r *http.Request, apiVersion int) (interface{}, er
 		if ec != nil {
 			gap = 0
 		}
-		utxo, err = s.api.GetXpubUtxo(r.URL.Path[i+1:], onlyConfirmed, gap)
+		var atHeight uint64
+		if h := r.URL.Query().Get("atHeight"); len(h) > 0 {
+			atHeight, err = strconv.ParseUint(h, 10, 32)
+			if err != nil {
+				return nil, api.NewAPIError("Parameter 'atHeight' cannot be converted to block height", true)
+			}
+		}
+		filter := &api.UtxoFilter{}
+		if mv := r.URL.Query().Get("minValue"); len(mv) > 0 {
+			minValue, ok := new(big.Int).SetString(mv, 10)
+			if !ok {
+				return nil, api.NewAPIError("Parameter 'minValue' is not a valid amount in satoshis", true)
+			}
+			filter.MinValue = minValue
+		}
+		if mc := r.URL.Query().Get("maxCount"); len(mc) > 0 {
+			filter.MaxCount, err = strconv.Atoi(mc)
+			if err != nil {
+				return nil, api.NewAPIError("Parameter 'maxCount' cannot be converted to number", true)
+			}
+		}
+		var target int64
+		var feeRate float64
+		if t := r.URL.Query().Get("target"); len(t) > 0 {
+			target, err = strconv.ParseInt(t, 10, 64)
+			if err != nil {
+				return nil, api.NewAPIError("Parameter 'target' is not a valid amount in satoshis", true)
+			}
+			feeRate, err = strconv.ParseFloat(r.URL.Query().Get("feeRate"), 64)
+			if err != nil {
+				return nil, api.NewAPIError("Parameter 'feeRate' cannot be converted to number", true)
+			}
+		}
+		utxo, err = s.api.GetXpubUtxo(descriptor, onlyConfirmed, gap, uint32(atHeight))
 		if err == nil {
 			s.metrics.ExplorerViews.With(common.Labels{"action": "api-xpub-utxo"}).Inc()
 		} else {
-			utxo, err = s.api.GetAddressUtxo(r.URL.Path[i+1:], onlyConfirmed)
+			utxo, err = s.api.GetAddressUtxo(descriptor, onlyConfirmed, uint32(atHeight))
 			s.metrics.ExplorerViews.With(common.Labels{"action": "api-address-utxo"}).Inc()
 		}
-		if err == nil && apiVersion == apiV1 {
+		if err != nil {
+			return nil, err
+		}
+		utxo = api.FilterUtxos(utxo, filter)
+		if target != 0 {
+			return s.api.SelectUtxos(utxo, target, feeRate)
+		}
+		if apiVersion == apiV1 {
 			return s.api.AddressUtxoToV1(utxo), nil
 		}
 	}
 	return utxo, err
 }
 
+func (s *PublicServer) apiBalanceHistory(r *http.Request, apiVersion int) (interface{}, error) {
+	var history api.BalanceHistories
+	var fromTime, toTime int64
+	var err error
+	if descriptor := descriptorFromPath(r.URL.Path, "balancehistory"); len(descriptor) > 0 {
+		gap, ec := strconv.Atoi(r.URL.Query().Get("gap"))
+		if ec != nil {
+			gap = 0
+		}
+		from := r.URL.Query().Get("from")
+		if from != "" {
+			fromTime, err = strconv.ParseInt(from, 10, 64)
+			if err != nil {
+				return nil, api.NewAPIError("Parameter 'from' is not a unix timestamp", true)
+			}
+		}
+		to := r.URL.Query().Get("to")
+		if to != "" {
+			toTime, err = strconv.ParseInt(to, 10, 64)
+			if err != nil {
+				return nil, api.NewAPIError("Parameter 'to' is not a unix timestamp", true)
+			}
+		}
+		var groupBy uint64
+		groupBy, err = strconv.ParseUint(r.URL.Query().Get("groupBy"), 10, 32)
+		if err != nil || groupBy == 0 {
+			groupBy = 3600
+		}
+		history, err = s.api.GetXpubBalanceHistory(descriptor, fromTime, toTime, uint32(groupBy), gap)
+		if err == nil {
+			s.metrics.ExplorerViews.With(common.Labels{"action": "api-xpub-balancehistory"}).Inc()
+		} else {
+			history, err = s.api.GetBalanceHistory(descriptor, fromTime, toTime, uint32(groupBy))
+			s.metrics.ExplorerViews.With(common.Labels{"action": "api-address-balancehistory"}).Inc()
+		}
+	}
+	return history, err
+}
+
 func (s *PublicServer) apiBlock(r *http.Request, apiVersion int) (interface{}, error) {
 	var block *api.Block
 	var err error
@@ -1041,6 +1193,83 @@ func (s *PublicServer) apiBlock(r *http.Request, apiVersion int) (interface{}, e
 	return block, err
 }
 
+func (s *PublicServer) apiBlockFilter(r *http.Request, apiVersion int) (interface{}, error) {
+	var filter *api.BlockFilter
+	var err error
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-block-filter"}).Inc()
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		filter, err = s.api.GetBlockFilter(r.URL.Path[i+1:])
+	}
+	return filter, err
+}
+
+func (s *PublicServer) apiTxMerkleProof(r *http.Request, apiVersion int) (interface{}, error) {
+	var proof *api.TxMerkleProof
+	var err error
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-tx-proof"}).Inc()
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		proof, err = s.api.GetTxMerkleProof(r.URL.Path[i+1:])
+	}
+	return proof, err
+}
+
+func (s *PublicServer) apiBlockByTime(r *http.Request, apiVersion int) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-block-by-time"}).Inc()
+	var timestamp int64
+	var err error
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		timestamp, err = strconv.ParseInt(r.URL.Path[i+1:], 10, 64)
+	}
+	if err != nil || timestamp <= 0 {
+		return nil, api.NewAPIError("Missing or invalid Unix timestamp", true)
+	}
+	return s.api.GetBlockByTime(timestamp)
+}
+
+func (s *PublicServer) apiBlockHeaders(r *http.Request, apiVersion int) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-block-headers"}).Inc()
+	var height uint64
+	var err error
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		height, err = strconv.ParseUint(r.URL.Path[i+1:], 10, 32)
+	}
+	if err != nil {
+		return nil, api.NewAPIError("Missing or invalid block height", true)
+	}
+	count := 0
+	if c := r.URL.Query().Get("count"); c != "" {
+		count, err = strconv.Atoi(c)
+		if err != nil {
+			return nil, api.NewAPIError("Parameter 'count' cannot be converted to number", true)
+		}
+	}
+	headers, err := s.api.GetBlockHeaders(uint32(height), count)
+	if err != nil {
+		return nil, err
+	}
+	if r.URL.Query().Get("format") == "binary" {
+		return binaryData(headers.Raw), nil
+	}
+	return headers, nil
+}
+
+func (s *PublicServer) apiTickers(r *http.Request, apiVersion int) (interface{}, error) {
+	var timestamp int64
+	var err error
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-tickers"}).Inc()
+	if t := r.URL.Query().Get("timestamp"); t != "" {
+		timestamp, err = strconv.ParseInt(t, 10, 64)
+		if err != nil {
+			return nil, api.NewAPIError("Parameter 'timestamp' is not a valid Unix timestamp", true)
+		}
+	}
+	var currencies []string
+	if c := r.URL.Query().Get("currency"); c != "" {
+		currencies = strings.Split(c, ",")
+	}
+	return s.api.GetFiatRatesTicker(timestamp, currencies)
+}
+
 type resultSendTransaction struct {
 	Result string `json:"result"`
 }
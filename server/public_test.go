@@ -3,11 +3,13 @@
 package server
 
 import (
+	"blockbook/api"
 	"blockbook/bchain"
 	"blockbook/bchain/coins/btc"
 	"blockbook/common"
 	"blockbook/db"
 	"blockbook/tests/dbtestdata"
+	"encoding/hex"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -16,6 +18,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -50,6 +53,8 @@ func setupRocksDB(t *testing.T, parser bchain.BlockChainParser) (*db.RocksDB, *c
 		t.Fatal(err)
 	}
 	d.SetInternalState(is)
+	d.EnableBlockFilter(true)
+	d.SetXpubCacheSize(100)
 	// import data
 	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(parser)); err != nil {
 		t.Fatal(err)
@@ -59,9 +64,40 @@ func setupRocksDB(t *testing.T, parser bchain.BlockChainParser) (*db.RocksDB, *c
 		t.Fatal(err)
 	}
 	is.FinishedSync(block2.Height)
+	if err := initTestFiatRates(d); err != nil {
+		t.Fatal(err)
+	}
 	return d, is, tmp
 }
 
+// initTestFiatRates stores tickers around the times of the test blocks
+func initTestFiatRates(d *db.RocksDB) error {
+	tickers := []db.CurrencyRatesTicker{
+		{
+			Timestamp: time.Unix(1534809600, 0),
+			Rates:     map[string]float64{"usd": 6300, "eur": 5500},
+		},
+		{
+			Timestamp: time.Unix(1534858200, 0),
+			Rates:     map[string]float64{"usd": 6400.5, "eur": 5600.25},
+		},
+		{
+			Timestamp: time.Unix(1534860000, 0),
+			Rates:     map[string]float64{"usd": 6500, "eur": 5700},
+		},
+		{
+			Timestamp: time.Unix(1534896000, 0),
+			Rates:     map[string]float64{"usd": 7000, "eur": 6000},
+		},
+	}
+	for i := range tickers {
+		if err := d.FiatRatesStoreTicker(&tickers[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func setupPublicHTTPServer(t *testing.T) (*PublicServer, string) {
 	parser := btc.NewBitcoinParser(
 		btc.GetChainParams("test"),
@@ -147,6 +183,10 @@ func newPostRequest(u string, body string) *http.Request {
 }
 
 func httpTestsBitcoinType(t *testing.T, ts *httptest.Server) {
+	headerB2, err := hex.DecodeString(dbtestdata.HeaderB2)
+	if err != nil {
+		t.Fatal(err)
+	}
 	tests := []struct {
 		name        string
 		r           *http.Request
@@ -487,6 +527,15 @@ func httpTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 				`{"page":1,"totalPages":1,"itemsOnPage":1000,"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"1234567890123","totalSent":"1234567890123","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":2,"transactions":[{"txid":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","vin":[{"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","n":0,"addresses":["mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"],"isAddress":true,"value":"1234567890123"},{"txid":"00b2c06055e5e90e9c82bd4181fde310104391a7fa4f289b1704e5d90caa3840","vout":1,"n":1,"addresses":["mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz"],"isAddress":true,"value":"12345"}],"vout":[{"value":"317283951061","n":0,"spent":true,"hex":"76a914ccaaaf374e1b06cb83118453d102587b4273d09588ac","addresses":["mzB8cYrfRwFRFAGTDzV8LkUQy5BQicxGhX"],"isAddress":true},{"value":"917283951061","n":1,"hex":"76a9148d802c045445df49613f6a70ddd2e48526f3701f88ac","addresses":["mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL"],"isAddress":true},{"value":"0","n":2,"hex":"6a072020f1686f6a20","addresses":["OP_RETURN 2020f1686f6a20"],"isAddress":false}],"blockHash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6","blockHeight":225494,"confirmations":1,"blockTime":22549400000,"value":"1234567902122","valueIn":"1234567902468","fees":"346"},{"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","vin":[],"vout":[{"value":"1234567890123","n":0,"spent":true,"hex":"76a914a08eae93007f22668ab5e4a9c83c8cd1c325e3e088ac","addresses":["mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"],"isAddress":true},{"value":"1","n":1,"spent":true,"hex":"a91452724c5178682f70e0ba31c6ec0633755a3b41d987","addresses":["2MzmAKayJmja784jyHvRUW1bXPget1csRRG"],"isAddress":true},{"value":"9876","n":2,"spent":true,"hex":"a914e921fc4912a315078f370d959f2c4f7b6d2a683c87","addresses":["2NEVv9LJmAnY99W1pFoc5UJjVdypBqdnvu1"],"isAddress":true}],"blockHash":"0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997","blockHeight":225493,"confirmations":2,"blockTime":22549300001,"value":"1234567900000","valueIn":"0","fees":"0"}]}`,
 			},
 		},
+		{
+			name:        "apiAddress v2 atHeight",
+			r:           newGetRequest(ts.URL + "/api/v2/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?atHeight=225493"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"page":1,"totalPages":1,"itemsOnPage":1000,"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"1234567890123","totalReceived":"1234567890123","totalSent":"0","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":1,"txids":["effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"]}`,
+			},
+		},
 		{
 			name:        "apiAddress v2 missing address",
 			r:           newGetRequest(ts.URL + "/api/v2/address/"),
@@ -586,6 +635,15 @@ func httpTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 				`[{"txid":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","vout":1,"value":"917283951061","height":225494,"confirmations":1}]`,
 			},
 		},
+		{
+			name:        "apiUtxo v2 atHeight",
+			r:           newGetRequest(ts.URL + "/api/v2/utxo/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?atHeight=225493"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[{"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","vout":0,"value":"1234567890123","height":225493,"confirmations":2}]`,
+			},
+		},
 		{
 			name:        "apiUtxo v2 xpub",
 			r:           newGetRequest(ts.URL + "/api/v2/utxo/" + dbtestdata.Xpub),
@@ -595,6 +653,223 @@ func httpTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 				`[{"txid":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","vout":0,"value":"118641975500","height":225494,"confirmations":1,"address":"2N6utyMZfPNUb1Bk8oz7p2JqJrXkq83gegu","path":"m/49'/1'/33'/1/3"}]`,
 			},
 		},
+		{
+			name:        "apiUtxo v2 output descriptor",
+			r:           newGetRequest(ts.URL + "/api/v2/utxo/sh(wpkh(" + dbtestdata.Xpub + "))%23a3n3slna"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[{"txid":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","vout":0,"value":"118641975500","height":225494,"confirmations":1,"address":"2N6utyMZfPNUb1Bk8oz7p2JqJrXkq83gegu","path":"m/49'/1'/33'/1/3"}]`,
+			},
+		},
+		{
+			name:        "apiBalanceHistory Addr4 v2",
+			r:           newGetRequest(ts.URL + "/api/v2/balancehistory/" + dbtestdata.Addr4),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[{"time":1534856400,"txs":2,"received":"1","sent":"1","balance":"0"}]`,
+			},
+		},
+		{
+			name:        "apiBalanceHistory Addr4 v2 from=1534859000&groupBy=60",
+			r:           newGetRequest(ts.URL + "/api/v2/balancehistory/" + dbtestdata.Addr4 + "?from=1534859000&groupBy=60"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[{"time":1534859100,"txs":1,"received":"0","sent":"1","balance":"0"}]`,
+			},
+		},
+		{
+			name:        "apiBalanceHistory xpub v2 groupBy=60",
+			r:           newGetRequest(ts.URL + "/api/v2/balancehistory/" + dbtestdata.Xpub + "?groupBy=60"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[{"time":1534858020,"txs":1,"received":"1","sent":"0","balance":"1"},{"time":1534859100,"txs":1,"received":"118641975500","sent":"1","balance":"118641975500"}]`,
+			},
+		},
+		{
+			name:        "apiBalanceHistory xpub v2 to=1534859000",
+			r:           newGetRequest(ts.URL + "/api/v2/balancehistory/" + dbtestdata.Xpub + "?to=1534859000"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[{"time":1534856400,"txs":1,"received":"1","sent":"0","balance":"1"}]`,
+			},
+		},
+		{
+			name:        "apiBlockFilter height v2",
+			r:           newGetRequest(ts.URL + "/api/v2/block-filter/225494"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"hash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6","height":225494,"filter":"09ea6890f708b5824e9724de06a5539aa7624e22b784875628"}`,
+			},
+		},
+		{
+			name:        "apiBlockFilter hash v2",
+			r:           newGetRequest(ts.URL + "/api/v2/block-filter/00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"hash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6","height":225494,"filter":"09ea6890f708b5824e9724de06a5539aa7624e22b784875628"}`,
+			},
+		},
+		{
+			name:        "apiBlockFilter - not found v2",
+			r:           newGetRequest(ts.URL + "/api/v2/block-filter/1"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Block not found"}`,
+			},
+		},
+		{
+			name:        "apiBlockByTime v2",
+			r:           newGetRequest(ts.URL + "/api/v2/block-by-time/1534858500"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"hash":"0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997","height":225493,"time":1534858021,"medianTime":1534858021}`,
+			},
+		},
+		{
+			name:        "apiBlockByTime - before first block v2",
+			r:           newGetRequest(ts.URL + "/api/v2/block-by-time/1500000000"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Block not found"}`,
+			},
+		},
+		{
+			name:        "apiBlockHeaders v2",
+			r:           newGetRequest(ts.URL + "/api/v2/headers/225493?count=2"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"height":225493,"count":2,"headers":"` + dbtestdata.HeaderB1 + dbtestdata.HeaderB2 + `"}`,
+			},
+		},
+		{
+			name:        "apiBlockHeaders v2 binary",
+			r:           newGetRequest(ts.URL + "/api/v2/headers/225494?format=binary"),
+			status:      http.StatusOK,
+			contentType: "application/octet-stream",
+			body: []string{
+				string(headerB2),
+			},
+		},
+		{
+			name:        "apiBlockHeaders - missing block v2",
+			r:           newGetRequest(ts.URL + "/api/v2/headers/225495"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Block not found"}`,
+			},
+		},
+		{
+			name:        "apiBlockHeaders - below stored headers v2",
+			r:           newGetRequest(ts.URL + "/api/v2/headers/225492?count=2"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Block headers are not available below height 225493"}`,
+			},
+		},
+		{
+			name:        "apiTxMerkleProof v2",
+			r:           newGetRequest(ts.URL + "/api/v2/tx-proof/05e2e48aeabdd9b75def7b48d756ba304713c2aba7b522bf9dbc893fc4231b07"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"txid":"05e2e48aeabdd9b75def7b48d756ba304713c2aba7b522bf9dbc893fc4231b07","blockHash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6","blockHeight":225494,"header":"` + dbtestdata.HeaderB2 + `","merkleRoot":"8cb556735dbbc2762d00d5b62ac125fc8238b7eeaba2946db99ebab1583d3483","pos":2,"merkle":["fdd824a780cbb718eeb766eb05d83fdefc793a27082cd5e67f856d69798cf7db","ca8b83277505d907b6e5b7c259198d2c4775b47567968b1b3b138422f21cf15b"]}`,
+			},
+		},
+		{
+			name:        "apiTxMerkleProof - unknown tx v2",
+			r:           newGetRequest(ts.URL + "/api/v2/tx-proof/1111111111111111111111111111111111111111111111111111111111111111"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Transaction '1111111111111111111111111111111111111111111111111111111111111111' not found or not confirmed"}`,
+			},
+		},
+		{
+			name:        "apiTxMerkleProof - invalid txid v2",
+			r:           newGetRequest(ts.URL + "/api/v2/tx-proof/1234"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Invalid txid"}`,
+			},
+		},
+		{
+			name:        "apiAddress v2 fromTime",
+			r:           newGetRequest(ts.URL + "/api/v2/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?fromTime=1534858500"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"page":1,"totalPages":1,"itemsOnPage":1000,"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"1234567890123","totalSent":"1234567890123","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":2,"txids":["7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25"]}`,
+			},
+		},
+		{
+			name:        "apiTickers last",
+			r:           newGetRequest(ts.URL + "/api/v2/tickers/"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"ts":1534896000,"rates":{"eur":6000,"usd":7000}}`,
+			},
+		},
+		{
+			name:        "apiTickers timestamp=1534858021&currency=usd",
+			r:           newGetRequest(ts.URL + "/api/v2/tickers/?timestamp=1534858021&currency=usd"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"ts":1534858200,"rates":{"usd":6400.5}}`,
+			},
+		},
+		{
+			name:        "apiTickers timestamp=1534859123&currency=EUR,czk",
+			r:           newGetRequest(ts.URL + "/api/v2/tickers/?timestamp=1534859123&currency=EUR,czk"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"ts":1534860000,"rates":{"czk":-1,"eur":5700}}`,
+			},
+		},
+		{
+			name:        "apiTickers invalid timestamp",
+			r:           newGetRequest(ts.URL + "/api/v2/tickers/?timestamp=yesterday"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Parameter 'timestamp' is not a valid Unix timestamp"}`,
+			},
+		},
+		{
+			name:        "apiTx v2 currency=usd",
+			r:           newGetRequest(ts.URL + "/api/v2/tx/05e2e48aeabdd9b75def7b48d756ba304713c2aba7b522bf9dbc893fc4231b07?currency=usd"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`"value":"9000","valueIn":"9876","fees":"876","valueFiat":{"currency":"usd","rate":7000,"value":0.63,"ts":1534896000}}`,
+			},
+		},
+		{
+			name:        "apiAddress v2 currency=EUR",
+			r:           newGetRequest(ts.URL + "/api/v2/address/" + dbtestdata.Addr5 + "?currency=EUR"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`"balance":"9000"`,
+				`"balanceFiat":{"currency":"eur","rate":6000,"value":0.54,"ts":1534896000}}`,
+			},
+		},
 		{
 			name:        "apiSendTx",
 			r:           newGetRequest(ts.URL + "/api/v2/sendtx/1234567890"),
@@ -949,6 +1224,79 @@ func websocketTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 			},
 			want: `{"id":"15","data":{"subscribed":false}}`,
 		},
+		{
+			name: "websocket getBalanceHistory",
+			req: websocketReq{
+				Method: "getBalanceHistory",
+				Params: map[string]interface{}{
+					"descriptor": dbtestdata.Addr4,
+					"groupBy":    60,
+				},
+			},
+			want: `{"id":"16","data":[{"time":1534858020,"txs":1,"received":"1","sent":"0","balance":"1"},{"time":1534859100,"txs":1,"received":"0","sent":"1","balance":"0"}]}`,
+		},
+		{
+			name: "websocket getBlockFilter",
+			req: websocketReq{
+				Method: "getBlockFilter",
+				Params: map[string]interface{}{
+					"block": "225494",
+				},
+			},
+			want: `{"id":"17","data":{"hash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6","height":225494,"filter":"09ea6890f708b5824e9724de06a5539aa7624e22b784875628"}}`,
+		},
+		{
+			name: "websocket getFiatRatesForTimestamps",
+			req: websocketReq{
+				Method: "getFiatRatesForTimestamps",
+				Params: map[string]interface{}{
+					"timestamps": []int64{1534858021, 1534900000, 1500000000},
+					"currencies": []string{"usd"},
+				},
+			},
+			want: `{"id":"18","data":{"tickers":[{"ts":1534858200,"rates":{"usd":6400.5}},{"ts":1534896000,"rates":{"usd":7000}},{"ts":1534809600,"rates":{"usd":6300}}]}}`,
+		},
+		{
+			name: "websocket getFiatRatesForTimestamps missing timestamps",
+			req: websocketReq{
+				Method: "getFiatRatesForTimestamps",
+				Params: map[string]interface{}{
+					"currencies": []string{"usd"},
+				},
+			},
+			want: `{"id":"19","data":{"error":{"message":"No timestamps provided"}}}`,
+		},
+		{
+			name: "websocket getBlockByTime",
+			req: websocketReq{
+				Method: "getBlockByTime",
+				Params: map[string]interface{}{
+					"time": 1534859200,
+				},
+			},
+			want: `{"id":"20","data":{"hash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6","height":225494,"time":1534859123,"medianTime":1534859123}}`,
+		},
+		{
+			name: "websocket getBlockHeaders",
+			req: websocketReq{
+				Method: "getBlockHeaders",
+				Params: map[string]interface{}{
+					"height": 225493,
+					"count":  1,
+				},
+			},
+			want: `{"id":"21","data":{"height":225493,"count":1,"headers":"` + dbtestdata.HeaderB1 + `"}}`,
+		},
+		{
+			name: "websocket getTransactionMerkleProof",
+			req: websocketReq{
+				Method: "getTransactionMerkleProof",
+				Params: map[string]interface{}{
+					"txid": dbtestdata.TxidB1T2,
+				},
+			},
+			want: `{"id":"22","data":{"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","blockHash":"0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997","blockHeight":225493,"header":"` + dbtestdata.HeaderB1 + `","merkleRoot":"4b9b8d2d53bd6d364a8a7b7040cc524e89f0ddc599c35507c0412881d9770679","pos":1,"merkle":["00b2c06055e5e90e9c82bd4181fde310104391a7fa4f289b1704e5d90caa3840"]}}`,
+		},
 	}
 
 	// send all requests at once
@@ -998,6 +1346,49 @@ func websocketTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 	}
 }
 
+// txMerkleProofTestsBitcoinType verifies the returned proofs the same way as a light client, against the merkle root in the header
+func txMerkleProofTestsBitcoinType(t *testing.T, ts *httptest.Server) {
+	txids := []string{
+		dbtestdata.TxidB1T1, dbtestdata.TxidB1T2,
+		dbtestdata.TxidB2T1, dbtestdata.TxidB2T2, dbtestdata.TxidB2T3, dbtestdata.TxidB2T4,
+	}
+	for _, txid := range txids {
+		t.Run(txid, func(t *testing.T) {
+			resp, err := http.DefaultClient.Do(newGetRequest(ts.URL + "/api/v2/tx-proof/" + txid))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("StatusCode = %v, want %v", resp.StatusCode, http.StatusOK)
+			}
+			var proof api.TxMerkleProof
+			if err = json.NewDecoder(resp.Body).Decode(&proof); err != nil {
+				t.Fatal(err)
+			}
+			header, err := hex.DecodeString(proof.Header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(header) != 80 {
+				t.Fatalf("header length = %v, want 80", len(header))
+			}
+			// the merkle root is stored in the header in the reversed byte order
+			root := make([]byte, 32)
+			for i := range root {
+				root[i] = header[67-i]
+			}
+			got, err := bchain.MerkleRootFromBranch(txid, proof.Pos, proof.Merkle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != hex.EncodeToString(root) {
+				t.Errorf("merkle root from branch = %v, header merkle root = %v", got, hex.EncodeToString(root))
+			}
+		})
+	}
+}
+
 func Test_PublicServer_BitcoinType(t *testing.T) {
 	s, dbpath := setupPublicHTTPServer(t)
 	defer closeAndDestroyPublicServer(t, s, dbpath)
@@ -1009,4 +1400,47 @@ func Test_PublicServer_BitcoinType(t *testing.T) {
 	httpTestsBitcoinType(t, ts)
 	socketioTestsBitcoinType(t, ts)
 	websocketTestsBitcoinType(t, ts)
+	txMerkleProofTestsBitcoinType(t, ts)
+}
+
+// Test_PublicServer_XpubCacheUpdate runs xpub requests concurrently with the update of the xpub cache after a new block,
+// the data race is detected only by the race detector (make test ARGS=-race)
+func Test_PublicServer_XpubCacheUpdate(t *testing.T) {
+	s, dbpath := setupPublicHTTPServer(t)
+	defer closeAndDestroyPublicServer(t, s, dbpath)
+	filter := &api.AddressFilter{Vout: api.AddressFilterVoutOff}
+	// cache the xpub as of the first block
+	block2 := dbtestdata.GetTestBitcoinTypeBlock2(s.chainParser)
+	if err := s.db.DisconnectBlockRangeBitcoinType(block2.Height, block2.Height); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.api.GetXpubAddress(dbtestdata.Xpub, 0, 1000, api.AccountDetailsTxidHistory, filter, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.api.UpdateXpubCache()
+	}()
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.api.GetXpubAddress(dbtestdata.Xpub, 0, 1000, api.AccountDetailsTxidHistory, filter, 0); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	a, err := s.api.GetXpubAddress(dbtestdata.Xpub, 0, 1000, api.AccountDetailsTxidHistory, filter, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Txs != 2 || len(a.Txids) != 2 {
+		t.Errorf("GetXpubAddress() = %v txs, txids %v, want 2 txs", a.Txs, a.Txids)
+	}
 }
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"runtime/debug"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -53,26 +54,28 @@ type websocketChannel struct {
 
 // WebsocketServer is a handle to websocket server
 type WebsocketServer struct {
-	socket                    *websocket.Conn
-	upgrader                  *websocket.Upgrader
-	db                        *db.RocksDB
-	txCache                   *db.TxCache
-	chain                     bchain.BlockChain
-	chainParser               bchain.BlockChainParser
-	mempool                   bchain.Mempool
-	metrics                   *common.Metrics
-	is                        *common.InternalState
-	api                       *api.Worker
-	block0hash                string
-	newBlockSubscriptions     map[*websocketChannel]string
-	newBlockSubscriptionsLock sync.Mutex
-	addressSubscriptions      map[string]map[*websocketChannel]string
-	addressSubscriptionsLock  sync.Mutex
+	socket                     *websocket.Conn
+	upgrader                   *websocket.Upgrader
+	db                         *db.RocksDB
+	txCache                    *db.TxCache
+	chain                      bchain.BlockChain
+	chainParser                bchain.BlockChainParser
+	mempool                    bchain.Mempool
+	metrics                    *common.Metrics
+	is                         *common.InternalState
+	api                        *api.Worker
+	block0hash                 string
+	newBlockSubscriptions      map[*websocketChannel]string
+	newBlockSubscriptionsLock  sync.Mutex
+	addressSubscriptions       map[string]map[*websocketChannel]string
+	addressSubscriptionsLock   sync.Mutex
+	fiatRatesSubscriptions     map[string]map[*websocketChannel]string
+	fiatRatesSubscriptionsLock sync.Mutex
 }
 
 // NewWebsocketServer creates new websocket interface to blockbook and returns its handle
 func NewWebsocketServer(db *db.RocksDB, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, metrics *common.Metrics, is *common.InternalState) (*WebsocketServer, error) {
-	api, err := api.NewWorker(db, chain, mempool, txCache, is)
+	api, err := api.NewWorker(db, chain, mempool, txCache, metrics, is)
 	if err != nil {
 		return nil, err
 	}
@@ -86,17 +89,18 @@ func NewWebsocketServer(db *db.RocksDB, chain bchain.BlockChain, mempool bchain.
 			WriteBufferSize: 1024 * 32,
 			CheckOrigin:     checkOrigin,
 		},
-		db:                    db,
-		txCache:               txCache,
-		chain:                 chain,
-		chainParser:           chain.GetChainParser(),
-		mempool:               mempool,
-		metrics:               metrics,
-		is:                    is,
-		api:                   api,
-		block0hash:            b0,
-		newBlockSubscriptions: make(map[*websocketChannel]string),
-		addressSubscriptions:  make(map[string]map[*websocketChannel]string),
+		db:                     db,
+		txCache:                txCache,
+		chain:                  chain,
+		chainParser:            chain.GetChainParser(),
+		mempool:                mempool,
+		metrics:                metrics,
+		is:                     is,
+		api:                    api,
+		block0hash:             b0,
+		newBlockSubscriptions:  make(map[*websocketChannel]string),
+		addressSubscriptions:   make(map[string]map[*websocketChannel]string),
+		fiatRatesSubscriptions: make(map[string]map[*websocketChannel]string),
 	}
 	return s, nil
 }
@@ -214,6 +218,7 @@ func (s *WebsocketServer) onConnect(c *websocketChannel) {
 func (s *WebsocketServer) onDisconnect(c *websocketChannel) {
 	s.unsubscribeNewBlock(c)
 	s.unsubscribeAddresses(c)
+	s.unsubscribeFiatRates(c)
 	glog.Info("Client disconnected ", c.id, ", ", c.ip)
 	s.metrics.WebsocketClients.Dec()
 }
@@ -239,23 +244,91 @@ var requestHandlers = map[string]func(*WebsocketServer, *websocketChannel, *webs
 		}
 		return
 	},
+	"getBlockByTime": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		r := struct {
+			Time int64 `json:"time"`
+		}{}
+		err = json.Unmarshal(req.Params, &r)
+		if err == nil {
+			rv, err = s.api.GetBlockByTime(r.Time)
+		}
+		return
+	},
+	"getBlockHeaders": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		r := struct {
+			Height int `json:"height"`
+			Count  int `json:"count"`
+		}{}
+		err = json.Unmarshal(req.Params, &r)
+		if err == nil {
+			if r.Height < 0 {
+				return nil, api.NewAPIError("Invalid height", true)
+			}
+			rv, err = s.api.GetBlockHeaders(uint32(r.Height), r.Count)
+		}
+		return
+	},
+	"getBlockFilter": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		r := struct {
+			Block string `json:"block"`
+		}{}
+		err = json.Unmarshal(req.Params, &r)
+		if err == nil {
+			rv, err = s.api.GetBlockFilter(r.Block)
+		}
+		return
+	},
 	"getAccountUtxo": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		r := utxoReq{}
+		err = json.Unmarshal(req.Params, &r)
+		if err == nil {
+			rv, err = s.getAccountUtxo(&r)
+		}
+		return
+	},
+	"getBalanceHistory": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
 		r := struct {
 			Descriptor string `json:"descriptor"`
+			From       int64  `json:"from"`
+			To         int64  `json:"to"`
+			GroupBy    uint32 `json:"groupBy"`
+			Gap        int    `json:"gap"`
 		}{}
 		err = json.Unmarshal(req.Params, &r)
 		if err == nil {
-			rv, err = s.getAccountUtxo(r.Descriptor)
+			rv, err = s.getBalanceHistory(r.Descriptor, r.From, r.To, r.GroupBy, r.Gap)
 		}
 		return
 	},
 	"getTransaction": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		r := struct {
+			Txid     string `json:"txid"`
+			Currency string `json:"currency"`
+		}{}
+		err = json.Unmarshal(req.Params, &r)
+		if err == nil {
+			rv, err = s.getTransaction(r.Txid, r.Currency)
+		}
+		return
+	},
+	"getTransactionMerkleProof": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
 		r := struct {
 			Txid string `json:"txid"`
 		}{}
 		err = json.Unmarshal(req.Params, &r)
 		if err == nil {
-			rv, err = s.getTransaction(r.Txid)
+			rv, err = s.api.GetTxMerkleProof(r.Txid)
+		}
+		return
+	},
+	"getFiatRatesForTimestamps": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		r := struct {
+			Timestamps []int64  `json:"timestamps"`
+			Currencies []string `json:"currencies"`
+		}{}
+		err = json.Unmarshal(req.Params, &r)
+		if err == nil {
+			rv, err = s.api.GetFiatRatesForTimestamps(r.Timestamps, r.Currencies)
 		}
 		return
 	},
@@ -298,6 +371,19 @@ var requestHandlers = map[string]func(*WebsocketServer, *websocketChannel, *webs
 	"unsubscribeAddresses": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
 		return s.unsubscribeAddresses(c)
 	},
+	"subscribeFiatRates": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		r := struct {
+			Currency string `json:"currency"`
+		}{}
+		err = json.Unmarshal(req.Params, &r)
+		if err == nil {
+			rv, err = s.subscribeFiatRates(c, strings.ToLower(r.Currency), req)
+		}
+		return
+	},
+	"unsubscribeFiatRates": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		return s.unsubscribeFiatRates(c)
+	},
 }
 
 func sendResponse(c *websocketChannel, req *websocketReq, data interface{}) {
@@ -332,6 +418,8 @@ func (s *WebsocketServer) onRequest(c *websocketChannel, req *websocketReq) {
 	defer s.metrics.WebsocketReqDuration.With(common.Labels{"method": req.Method}).Observe(float64(time.Since(t)) / 1e3) // in microseconds
 	f, ok := requestHandlers[req.Method]
 	if ok {
+		s.db.LockRead()
+		defer s.db.UnlockRead()
 		data, err = f(s, c, req)
 	} else {
 		err = errors.New("unknown method")
@@ -356,8 +444,12 @@ type accountInfoReq struct {
 	Page           int    `json:"page"`
 	FromHeight     int    `json:"from"`
 	ToHeight       int    `json:"to"`
+	AtHeight       int    `json:"atHeight"`
+	FromTime       int64  `json:"fromTime"`
+	ToTime         int64  `json:"toTime"`
 	ContractFilter string `json:"contractFilter"`
 	Gap            int    `json:"gap"`
+	Currency       string `json:"currency"`
 }
 
 func unmarshalGetAccountInfoRequest(params []byte) (*accountInfoReq, error) {
@@ -395,6 +487,9 @@ func (s *WebsocketServer) getAccountInfo(req *accountInfoReq) (res *api.Address,
 	filter := api.AddressFilter{
 		FromHeight:     uint32(req.FromHeight),
 		ToHeight:       uint32(req.ToHeight),
+		AtHeight:       uint32(req.AtHeight),
+		FromTime:       req.FromTime,
+		ToTime:         req.ToTime,
 		Contract:       req.ContractFilter,
 		Vout:           api.AddressFilterVoutOff,
 		TokensToReturn: tokensToReturn,
@@ -404,21 +499,83 @@ func (s *WebsocketServer) getAccountInfo(req *accountInfoReq) (res *api.Address,
 	}
 	a, err := s.api.GetXpubAddress(req.Descriptor, req.Page, req.PageSize, opt, &filter, req.Gap)
 	if err != nil {
-		return s.api.GetAddress(req.Descriptor, req.Page, req.PageSize, opt, &filter)
+		a, err = s.api.GetAddress(req.Descriptor, req.Page, req.PageSize, opt, &filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if req.Currency != "" {
+		if err = s.api.SetAddressFiatValue(a, req.Currency); err != nil {
+			return nil, err
+		}
 	}
 	return a, nil
 }
 
-func (s *WebsocketServer) getAccountUtxo(descriptor string) (interface{}, error) {
-	utxo, err := s.api.GetXpubUtxo(descriptor, false, 0)
+type utxoReq struct {
+	Descriptor string  `json:"descriptor"`
+	Confirmed  bool    `json:"confirmed"`
+	MinValue   string  `json:"minValue"`
+	MaxCount   int     `json:"maxCount"`
+	Target     string  `json:"target"`
+	FeeRate    float64 `json:"feeRate"`
+	AtHeight   uint32  `json:"atHeight"`
+}
+
+func (s *WebsocketServer) getAccountUtxo(req *utxoReq) (interface{}, error) {
+	filter := &api.UtxoFilter{MaxCount: req.MaxCount}
+	if req.MinValue != "" {
+		minValue, ok := new(big.Int).SetString(req.MinValue, 10)
+		if !ok {
+			return nil, api.NewAPIError("Invalid minValue", true)
+		}
+		filter.MinValue = minValue
+	}
+	var target int64
+	if req.Target != "" {
+		var err error
+		target, err = strconv.ParseInt(req.Target, 10, 64)
+		if err != nil {
+			return nil, api.NewAPIError("Invalid target", true)
+		}
+	}
+	utxo, err := s.api.GetXpubUtxo(req.Descriptor, req.Confirmed, 0, req.AtHeight)
 	if err != nil {
-		return s.api.GetAddressUtxo(descriptor, false)
+		utxo, err = s.api.GetAddressUtxo(req.Descriptor, req.Confirmed, req.AtHeight)
+		if err != nil {
+			return nil, err
+		}
+	}
+	utxo = api.FilterUtxos(utxo, filter)
+	if target != 0 {
+		return s.api.SelectUtxos(utxo, target, req.FeeRate)
 	}
 	return utxo, nil
 }
 
-func (s *WebsocketServer) getTransaction(txid string) (interface{}, error) {
-	return s.api.GetTransaction(txid, false, false)
+func (s *WebsocketServer) getBalanceHistory(descriptor string, from, to int64, groupBy uint32, gap int) (interface{}, error) {
+	if groupBy == 0 {
+		groupBy = 3600
+	}
+	history, err := s.api.GetXpubBalanceHistory(descriptor, from, to, groupBy, gap)
+	if err != nil {
+		return s.api.GetBalanceHistory(descriptor, from, to, groupBy)
+	}
+	return history, nil
+}
+
+func (s *WebsocketServer) getTransaction(txid string, currency string) (interface{}, error) {
+	tx, err := s.api.GetTransaction(txid, false, false)
+	if err != nil {
+		return nil, err
+	}
+	tx.AddressAliases = s.api.GetTxAddressAliases(tx)
+	if currency != "" {
+		if err = s.api.SetTxFiatValue(tx, currency); err != nil {
+			return nil, err
+		}
+	}
+	return tx, nil
 }
 
 func (s *WebsocketServer) getTransactionSpecific(txid string) (interface{}, error) {
@@ -609,6 +766,70 @@ func (s *WebsocketServer) unsubscribeAddresses(c *websocketChannel) (res interfa
 	return &subscriptionResponse{false}, nil
 }
 
+// subscribeFiatRates subscribes to the new tickers of the currency, empty currency means all currencies
+func (s *WebsocketServer) subscribeFiatRates(c *websocketChannel, currency string, req *websocketReq) (res interface{}, err error) {
+	// unsubscribe all previous subscriptions
+	s.unsubscribeFiatRates(c)
+	s.fiatRatesSubscriptionsLock.Lock()
+	defer s.fiatRatesSubscriptionsLock.Unlock()
+	as, ok := s.fiatRatesSubscriptions[currency]
+	if !ok {
+		as = make(map[*websocketChannel]string)
+		s.fiatRatesSubscriptions[currency] = as
+	}
+	as[c] = req.ID
+	return &subscriptionResponse{true}, nil
+}
+
+// unsubscribeFiatRates unsubscribes all fiat rates subscriptions by this channel
+func (s *WebsocketServer) unsubscribeFiatRates(c *websocketChannel) (res interface{}, err error) {
+	s.fiatRatesSubscriptionsLock.Lock()
+	defer s.fiatRatesSubscriptionsLock.Unlock()
+	for _, sa := range s.fiatRatesSubscriptions {
+		delete(sa, c)
+	}
+	return &subscriptionResponse{false}, nil
+}
+
+// OnNewFiatRatesTicker is a callback that broadcasts the new rates to the clients subscribed to them
+func (s *WebsocketServer) OnNewFiatRatesTicker(ticker *db.CurrencyRatesTicker) {
+	s.fiatRatesSubscriptionsLock.Lock()
+	defer s.fiatRatesSubscriptionsLock.Unlock()
+	count := 0
+	for currency, as := range s.fiatRatesSubscriptions {
+		if len(as) == 0 {
+			continue
+		}
+		var rates map[string]float64
+		if currency == "" {
+			rates = ticker.Rates
+		} else {
+			rate, found := ticker.Rates[currency]
+			if !found {
+				continue
+			}
+			rates = map[string]float64{currency: rate}
+		}
+		data := struct {
+			Timestamp int64              `json:"ts"`
+			Rates     map[string]float64 `json:"rates"`
+		}{
+			Timestamp: ticker.Timestamp.Unix(),
+			Rates:     rates,
+		}
+		for c, id := range as {
+			if c.IsAlive() {
+				c.out <- &websocketRes{
+					ID:   id,
+					Data: &data,
+				}
+			}
+		}
+		count += len(as)
+	}
+	glog.Info("broadcasting new fiat rates ticker ", ticker.Timestamp, " to ", count, " channels")
+}
+
 // OnNewBlock is a callback that broadcasts info about new block to subscribed clients
 func (s *WebsocketServer) OnNewBlock(hash string, height uint32) {
 	s.newBlockSubscriptionsLock.Lock()
@@ -649,6 +870,7 @@ func (s *WebsocketServer) OnNewTxAddr(tx *bchain.Tx, addrDesc bchain.AddressDesc
 				glog.Error("GetTransactionFromBchainTx error ", err, " for ", tx.Txid)
 				return
 			}
+			atx.AddressAliases = s.api.GetTxAddressAliases(atx)
 			data := struct {
 				Address string  `json:"address"`
 				Tx      *api.Tx `json:"tx"`
@@ -33,6 +33,12 @@ const (
 	TxidB2T1Output3OpReturn = "6a072020f1686f6a20"
 )
 
+// Raw headers of the test blocks, they contain the merkle roots of the test transactions but their proof of work is not valid
+const (
+	HeaderB1 = "000000200000000000000000000000000000000000000000000000000000000000000000790677d9812841c00755c399c5ddf0894e52cc40707b8a4a366dbd532d8d9b4b25137c5bffff001d00000000"
+	HeaderB2 = "0000002097294ee985ad46f74c449d9c4e98aa5ba36a85180e5bd70fd9befb760000000083343d58b1ba9eb96d94a2abeeb73882fc25c12ab6d5002d76c2bb5d7356b58c73177c5bffff001d00000000"
+)
+
 // Amounts in satoshis
 var (
 	SatZero   = big.NewInt(0)
@@ -61,6 +67,14 @@ func AddressToPubKeyHex(addr string, parser bchain.BlockChainParser) string {
 	return hex.EncodeToString(b)
 }
 
+func hexToBytes(h string) []byte {
+	b, err := hex.DecodeString(h)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	return b
+}
+
 // GetTestBitcoinTypeBlock1 returns block #1
 func GetTestBitcoinTypeBlock1(parser bchain.BlockChainParser) *bchain.Block {
 	return &bchain.Block{
@@ -125,6 +139,7 @@ func GetTestBitcoinTypeBlock1(parser bchain.BlockChainParser) *bchain.Block {
 				Confirmations: 2,
 			},
 		},
+		RawHeader: hexToBytes(HeaderB1),
 	}
 }
 
@@ -264,5 +279,6 @@ func GetTestBitcoinTypeBlock2(parser bchain.BlockChainParser) *bchain.Block {
 				Confirmations: 1,
 			},
 		},
+		RawHeader: hexToBytes(HeaderB2),
 	}
 }
@@ -16,6 +16,8 @@ const (
 	EthAddrContract4a = "4af4114f73d1c1c903ac9e0361b379d1291808a2" // ERC-20 (VTY)
 	EthAddrContract0d = "0d0f936ee4c93e25944694d6c121de94d9760f11" // ERC-20 (MTT)
 	EthAddrContract47 = "479cc461fecd078f766ecc58533d6f69580cf3ac" // non ERC20
+	EthAddrContractCd = "cda9fc258358ecaa88845f19af595e908bb7efe9" // ERC-721
+	EthAddrContract6f = "6fd712e3a5b556654044608f9129040a4839e36c" // ERC-1155
 
 	EthTxidB1T1  = "cd647151552b5132b2aef7c9be00dc6f73afc5901dde157aab131335baaa853b"
 	EthTx1Packed = "08e8dd870210a6a6f0db051a6908ece40212050430e234001888a40122081bc0159d530e60003220cd647151552b5132b2aef7c9be00dc6f73afc5901dde157aab131335baaa853b3a14555ee11fbddc0e49a9bab358a8941ad95ffdb48f42143e3a3d69dc66ba10737f531ed088954a9ec89d97480a22070a025208120101"
@@ -25,6 +27,10 @@ const (
 	EthTx3Packed = "08e9dd870210d4b5f0db051a6708c20112050218711a001888a401220710bc3578bd37d83220c2c3dd1ecb00e8a6d81f793d24387cf2947a313e94ab03b1fb22cd63320f6c913a149f4981531fda132e83c44680787dfa7ee31e4f8d4214555ee11fbddc0e49a9bab358a8941ad95ffdb48f480722070a025208120101"
 	EthTxidB2T2  = "c92919ad24ffd58f760b18df7949f06e1190cf54a50a0e3745a385608ed3cbf2"
 	EthTx4Packed = "08e9dd870210d4b5f0db051aa50b08f6be0712043b9aca001890a10f2ac40a4f15078700000000000000000000000000000000000000000000000000000000000000c0000000000000000000000000000000000000000000000000000000000000022000000000000000000000000000000000000000000000000000000000000003c00000000000000000000000000000000000000000000000000000000000000420000000000000000000000000000000000000000000000000000000000000048000000000000000000000000000000000000000000000000000000000000004e00000000000000000000000000000000000000000000000000000000000000002000000000000000000000000555ee11fbddc0e49a9bab358a8941ad95ffdb48f0000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d0000000000000000000000000d0f936ee4c93e25944694d6c121de94d9760f110000000000000000000000004af4114f73d1c1c903ac9e0361b379d1291808a200000000000000000000000000000000000000000000000000000000000000000000000000000000000000007b62eb7fe80350dc7ec945c0b73242cb9877fb1b0000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d0000000000000000000000004af4114f73d1c1c903ac9e0361b379d1291808a20000000000000000000000000d0f936ee4c93e25944694d6c121de94d9760f110000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000a5ef5a7656bfb0000000000000000000000000000000000000000000000000000004ba78398d5c5000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000166cfe0b9579b4ecf7a2801880f644009a324671a79754ea57c3a103c6e70d3dbef6ba69a08000000000000000000000000000000000000000000000000004f937d86afb90000000000000000000000000000000000000000000000000ab280fd8037d500000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000166cfb784b7c1f3fbe8b75484603ab8adc58aaee3a46245a6579fac7077b5570018b4e0d4eb0000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000308fd0e798ac00000000000000000000000000000000000000000000000006a8313d60b1f80000000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000001b000000000000000000000000000000000000000000000000000000000000001b00000000000000000000000000000000000000000000000000000000000000029de0ccec59e8948e3d905b40e5542335ebc1eb4674db517d2f6392ec7fdeb3d45f3449d313ee2589819c6c79eb1c1b047adae68565c1608e3a1d1d70823febb0000000000000000000000000000000000000000000000000000000000000000234d06fe17f1202e8b07177a30eb64d14adc08cdb3fa1b3e3e0bea0f9672c02175b77c01c51d3c7e460723b27ecbc7801fd6482559a8c9999593f9a4d149c73843220c92919ad24ffd58f760b18df7949f06e1190cf54a50a0e3745a385608ed3cbf23a14479cc461fecd078f766ecc58533d6f69580cf3ac42144bda106325c335df99eab7fe363cac8a0ba2a24d482422d40b0a03034d301201011a9e010a140d0f936ee4c93e25944694d6c121de94d9760f1112200000000000000000000000000000000000000000000000006a8313d60b1f606b1a20ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef1a20000000000000000000000000555ee11fbddc0e49a9bab358a8941ad95ffdb48f1a200000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d1a9e010a144af4114f73d1c1c903ac9e0361b379d1291808a21220000000000000000000000000000000000000000000000000000308fd0e798ac01a20ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef1a200000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d1a20000000000000000000000000555ee11fbddc0e49a9bab358a8941ad95ffdb48f1aa1030a14479cc461fecd078f766ecc58533d6f69580cf3ac1280020000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d0000000000000000000000000d0f936ee4c93e25944694d6c121de94d9760f110000000000000000000000004af4114f73d1c1c903ac9e0361b379d1291808a20000000000000000000000000000000000000000000000006a8313d60b1f606b000000000000000000000000000000000000000000000000000308fd0e798ac0000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000005e083a16f4b092c5729a49f9c3ed3cc171bb3d3d0c22e20b1de6063c32f399ac1a200d0b9391970d9a25552f37d436d2aae2925e2bfe1b2a923754bada030c498cb31a20000000000000000000000000555ee11fbddc0e49a9bab358a8941ad95ffdb48f1a2000000000000000000000000000000000000000000000000000000000000000001a205af266c0a89a07c1917deaa024414577e6c3c31c8907d079e13eb448c082594f1a9e010a144af4114f73d1c1c903ac9e0361b379d1291808a2122000000000000000000000000000000000000000000000000000031855667df7a81a20ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef1a200000000000000000000000007b62eb7fe80350dc7ec945c0b73242cb9877fb1b1a200000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d1a9e010a140d0f936ee4c93e25944694d6c121de94d9760f1112200000000000000000000000000000000000000000000000006a8313d60b1f80001a20ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef1a200000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d1a200000000000000000000000007b62eb7fe80350dc7ec945c0b73242cb9877fb1b1aa1030a14479cc461fecd078f766ecc58533d6f69580cf3ac1280020000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d0000000000000000000000004af4114f73d1c1c903ac9e0361b379d1291808a20000000000000000000000000d0f936ee4c93e25944694d6c121de94d9760f1100000000000000000000000000000000000000000000000000031855667df7a80000000000000000000000000000000000000000000000006a8313d60b1f800000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000f2b0d62c44ed08f2a5adef40c875d20310a42a9d4f488bd26323256fe01c7f481a200d0b9391970d9a25552f37d436d2aae2925e2bfe1b2a923754bada030c498cb31a200000000000000000000000007b62eb7fe80350dc7ec945c0b73242cb9877fb1b1a2000000000000000000000000000000000000000000000000000000000000000001a20b0b69dad58df6032c3b266e19b1045b19c87acd2c06fb0c598090f44b8e263aa"
+	EthTxidB3T1  = "7f1f4e2fa7b6c3a8d5e9c0b1a2f3e4d5c6b7a8f9e0d1c2b3a4f5e6d7c8b9a0f1"
+	EthTx5Packed = "08eadd87021081baf0db051a6208ede40212043b9aca0018c09a0c2a043ccfd60b32207f1f4e2fa7b6c3a8d5e9c0b1a2f3e4d5c6b7a8f9e0d1c2b3a4f5e6d7c8b9a0f13a14479cc461fecd078f766ecc58533d6f69580cf3ac42143e3a3d69dc66ba10737f531ed088954a9ec89d9722070a029c401201012a361214479cc461fecd078f766ecc58533d6f69580cf3ac1a149f4981531fda132e83c44680787dfa7ee31e4f8d22081bc16d674ec800002a351214479cc461fecd078f766ecc58533d6f69580cf3ac1a143e3a3d69dc66ba10737f531ed088954a9ec89d9722072386f26fc100002a2e08021214479cc461fecd078f766ecc58533d6f69580cf3ac1a147b62eb7fe80350dc7ec945c0b73242cb9877fb1b"
+	EthTxidB3T2  = "d8d6d2ae5f7a9c8b3e1f0a4b6c2d8e9f7a1b3c5d7e9f0a2b4c6d8e0f1a3b5c7d"
+	EthTx6Packed = "08eadd87021081baf0db051a5c082a12043b9aca0018c09a0c3220d8d6d2ae5f7a9c8b3e1f0a4b6c2d8e9f7a1b3c5d7e9f0a2b4c6d8e0f1a3b5c7d3a14cda9fc258358ecaa88845f19af595e908bb7efe942144bda106325c335df99eab7fe363cac8a0ba2a24d480122d1070a0301e8b41201011a9e010a14cda9fc258358ecaa88845f19af595e908bb7efe91a20ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef1a200000000000000000000000007b62eb7fe80350dc7ec945c0b73242cb9877fb1b1a200000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d1a2000000000000000000000000000000000000000000000000000000000000001a41a9e010a14cda9fc258358ecaa88845f19af595e908bb7efe91a20ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef1a200000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d1a20000000000000000000000000555ee11fbddc0e49a9bab358a8941ad95ffdb48f1a2000000000000000000000000000000000000000000000000000000000000001a41aa1030a146fd712e3a5b556654044608f9129040a4839e36c128002000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000000a00000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000500000000000000000000000000000000000000000000000000000000000000011a204a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb1a200000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d1a200000000000000000000000007b62eb7fe80350dc7ec945c0b73242cb9877fb1b1a200000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d1ae0010a146fd712e3a5b556654044608f9129040a4839e36c1240000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000000000000000000000000000000000000000021a20c3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f621a200000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d1a200000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d1a20000000000000000000000000555ee11fbddc0e49a9bab358a8941ad95ffdb48f"
 )
 
 func unpackTxs(packed []string, parser bchain.BlockChainParser) []bchain.Tx {
@@ -70,3 +76,31 @@ func GetTestEthereumTypeBlock2(parser bchain.BlockChainParser) *bchain.Block {
 		Txs: unpackTxs([]string{EthTx3Packed, EthTx4Packed}, parser),
 	}
 }
+
+// GetTestEthereumTypeBlock3 returns block #3, its transaction contains internal transfers
+func GetTestEthereumTypeBlock3(parser bchain.BlockChainParser) *bchain.Block {
+	return &bchain.Block{
+		BlockHeader: bchain.BlockHeader{
+			Height:        4321002,
+			Hash:          "0x8d6dd2d8d6ec3c4bf4f2c6b26a1bfbb4d7d9c7a1c79c4b3a6b8e4a0e5f0c3a11",
+			Size:          1234,
+			Time:          1534860545,
+			Confirmations: 1,
+		},
+		Txs: unpackTxs([]string{EthTx5Packed}, parser),
+	}
+}
+
+// GetTestEthereumTypeBlock3NFT returns alternative block #3, its transaction contains ERC721 and ERC1155 transfers
+func GetTestEthereumTypeBlock3NFT(parser bchain.BlockChainParser) *bchain.Block {
+	return &bchain.Block{
+		BlockHeader: bchain.BlockHeader{
+			Height:        4321002,
+			Hash:          "0x2f3d5b7a9c1e4f6a8b0d2c4e6f8a1b3d5c7e9f0a2b4d6c8e0f1a3c5b7d9e0f2a",
+			Size:          2345,
+			Time:          1534860545,
+			Confirmations: 1,
+		},
+		Txs: unpackTxs([]string{EthTx6Packed}, parser),
+	}
+}